@@ -0,0 +1,59 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// HeaderAccepted is the request header which overrides accepted mode of the update ("true"/"false")
+const HeaderAccepted = "X-Spawn-Accepted"
+
+// isAccepted checks that the update should be acknowledged by 202 Accepted status,
+// the request header takes precedence over the options
+func (server *Server) isAccepted(request *http.Request) bool {
+	if value := request.Header.Get(HeaderAccepted); value != "" {
+		if accepted, err := strconv.ParseBool(value); err == nil {
+			return accepted
+		}
+		errlog.Println("Could not recognize header", HeaderAccepted, value)
+	}
+	return server.Options.FanOut.Accepted
+}
+
+// acceptedResponse returns 202 Accepted response with the list of the nodes
+// which the update is queued for, instead of the response of the node
+func acceptedResponse(request *http.Request, nodes []string) (*http.Response, error) {
+	return jsonResponse(request, http.StatusAccepted, data{"success": true, "total": len(nodes), "nodes": nodes})
+}
+
+// jsonResponse returns the response with the status code and JSON content
+// which is produced by the server instead of the node
+func jsonResponse(request *http.Request, code int, content data) (*http.Response, error) {
+	body, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}, nil
+}
@@ -0,0 +1,87 @@
+package spawn
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAccepted(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+
+	request, err := http.NewRequest(methodPOST, "/", nil)
+	test(t, err == nil, "Expected create a new request, got", err)
+	test(t, !server.isAccepted(request), "Expected accepted mode is disabled by default")
+
+	server.Options.FanOut.Accepted = true
+	test(t, server.isAccepted(request), "Expected accepted mode is enabled by options")
+
+	// the header takes precedence over the options
+	request.Header.Set(HeaderAccepted, "false")
+	test(t, !server.isAccepted(request), "Expected accepted mode is disabled by header")
+	server.Options.FanOut.Accepted = false
+	request.Header.Set(HeaderAccepted, "true")
+	test(t, server.isAccepted(request), "Expected accepted mode is enabled by header")
+	request.Header.Set(HeaderAccepted, "unknown")
+	test(t, !server.isAccepted(request), "Expected unrecognized header is ignored")
+
+	response, err := acceptedResponse(request, []string{"127.0.0.1:3001", "127.0.0.1:3002"})
+	test(t, err == nil, "Expected create accepted response, got", err)
+	test(t, response.StatusCode == http.StatusAccepted, "Expected status 202, got", response.StatusCode)
+
+	var result struct {
+		Success bool     `json:"success"`
+		Total   int      `json:"total"`
+		Nodes   []string `json:"nodes"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	test(t, err == nil, "Expected decode accepted response, got", err)
+	test(t, result.Success && result.Total == 2 && len(result.Nodes) == 2,
+		"Expected list of 2 nodes, got", result)
+}
+
+func TestAcceptedDelivery(t *testing.T) {
+	status := http.StatusInternalServerError
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/check" {
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	defer node.Close()
+	host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+	number, _ := strconv.ParseUint(port, 10, 64)
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.check.URL = "/check"
+	server.Options.FanOut.Accepted = true
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: host, Port: number, Active: true}})
+	server.job <- responseSignal
+	<-server.response
+
+	update := func() (*http.Response, error) {
+		request, err := http.NewRequest(methodPOST, "http://example.com/", strings.NewReader("update"))
+		test(t, err == nil, "Expected create a new request, got", err)
+		return server.RoundTrip(request)
+	}
+
+	// the update which is failed by the node is not acknowledged
+	_, err = update()
+	e, ok := err.(*statusError)
+	test(t, ok && e.code == http.StatusBadGateway, "Expected status 502 if the node fails, got", err)
+
+	status = http.StatusCreated
+	response, err := update()
+	test(t, err == nil && response.StatusCode == http.StatusAccepted, "Expected status 202 after the delivery, got", err)
+	if err == nil {
+		response.Body.Close()
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/takama/router"
+)
+
+// loopbackNetworks are allowed to call the API if the networks are not defined
+var loopbackNetworks = []string{"127.0.0.0/8", "::1/128"}
+
+// APIAccess defines the networks which are allowed to call the API,
+// the requests from other networks are rejected with 403 status
+type APIAccess struct {
+	Enabled bool `json:"enabled"`
+
+	// the allowed networks (CIDR) or addresses, if it is empty, only localhost is allowed
+	Networks []string `json:"networks"`
+
+	// the client address is taken from X-Forwarded-For header instead of the address
+	// of the connection, it should be used behind the trusted reverse proxy only
+	TrustForwarded bool `json:"trust-forwarded"`
+
+	// the networks (CIDR) or the addresses of the trusted reverse proxies which are skipped
+	// in X-Forwarded-For header, if it is empty, the proxy of the connection is trusted only
+	TrustedProxies []string `json:"trusted-proxies"`
+
+	// the parsed networks
+	networks []*net.IPNet
+
+	// the parsed trusted proxies
+	proxies []*net.IPNet
+}
+
+// compileAPIAccess checks the networks of the access list and parses them
+func compileAPIAccess(access APIAccess) (APIAccess, error) {
+	networks := access.Networks
+	if len(networks) == 0 {
+		networks = loopbackNetworks
+	}
+	var err error
+	if access.networks, err = parseNetworks(networks); err != nil {
+		return access, err
+	}
+	access.proxies, err = parseNetworks(access.TrustedProxies)
+
+	return access, err
+}
+
+// parseNetworks parses the networks (CIDR) or the addresses
+func parseNetworks(networks []string) ([]*net.IPNet, error) {
+	parsed := make([]*net.IPNet, 0, len(networks))
+	for index, network := range networks {
+		if !strings.Contains(network, "/") {
+			ip := net.ParseIP(network)
+			if ip == nil {
+				return nil, fmt.Errorf("The network %d has incorrect address: %s", index, network)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			parsed = append(parsed, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, fmt.Errorf("The network %d is incorrect: %s", index, err)
+		}
+		parsed = append(parsed, ipNet)
+	}
+
+	return parsed, nil
+}
+
+// clientIP returns the address of the client of the request
+func (access *APIAccess) clientIP(request *http.Request) net.IP {
+	return clientIP(request, access.TrustForwarded, access.proxies)
+}
+
+// clientIP returns the address of the client of the request, it is taken from X-Forwarded-For
+// header if it is trusted, otherwise it is the address of the connection. The header is walked
+// from the right, because its left part is defined by the client, the addresses
+// of the trusted proxies are skipped and the first address before them is the client.
+// If the trusted proxies are not defined, the proxy of the connection is trusted only
+// and the last address of the header is the client
+func clientIP(request *http.Request, trustForwarded bool, proxies []*net.IPNet) net.IP {
+	remote := net.ParseIP(remoteHost(request.RemoteAddr))
+	if !trustForwarded || (len(proxies) > 0 && !containsIP(proxies, remote)) {
+		return remote
+	}
+	var addresses []string
+	for _, forwarded := range request.Header["X-Forwarded-For"] {
+		addresses = append(addresses, strings.Split(forwarded, ",")...)
+	}
+	for index := len(addresses) - 1; index >= 0; index-- {
+		ip := net.ParseIP(strings.TrimSpace(addresses[index]))
+		if ip == nil || !containsIP(proxies, ip) || index == 0 {
+			return ip
+		}
+	}
+	return remote
+}
+
+// containsIP checks that the address is in one of the networks
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allow checks that the client of the request is in the allowed networks
+func (access *APIAccess) allow(request *http.Request) bool {
+	if !access.Enabled {
+		return true
+	}
+	return containsIP(access.networks, access.clientIP(request))
+}
+
+// accessDenied replies that the client is not in the allowed networks
+func accessDenied(c *router.Control) {
+	replyError(c, http.StatusForbidden, data{
+		"success": false,
+		"error":   http.StatusForbidden,
+		"message": "Forbidden",
+		"info":    "Access to the API is denied from the network of the client",
+	})
+	errlog.Println("Access to the API is denied for", c.Request.RemoteAddr)
+}
@@ -0,0 +1,68 @@
+package spawn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/takama/router"
+)
+
+func TestAPIAccess(t *testing.T) {
+	_, err := compileAPIAccess(APIAccess{Enabled: true, Networks: []string{"10.0.0.0/33"}})
+	test(t, err != nil, "Expected the incorrect network is rejected")
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	r := router.New()
+	r.CustomHandler = server.baseHandler(r)
+	r.GET("/nodes", func(c *router.Control) { c.Code(http.StatusOK).Body(data{"success": true}) })
+
+	status := func(remoteAddr, forwarded string) int {
+		request, _ := http.NewRequest("GET", "/nodes", nil)
+		request.RemoteAddr = remoteAddr
+		if forwarded != "" {
+			request.Header.Set("X-Forwarded-For", forwarded)
+		}
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	// the access is not limited by default
+	test(t, status("192.0.2.1:1234", "") == http.StatusOK, "Expected the access is allowed")
+
+	// only localhost is allowed if the networks are not defined
+	server.apiAccess, err = compileAPIAccess(APIAccess{Enabled: true})
+	test(t, err == nil, "Expected the access list is compiled, got", err)
+	test(t, status("127.0.0.1:1234", "") == http.StatusOK, "Expected the localhost is allowed")
+	test(t, status("[::1]:1234", "") == http.StatusOK, "Expected the localhost is allowed")
+	test(t, status("192.0.2.1:1234", "") == http.StatusForbidden, "Expected the access is denied")
+
+	server.apiAccess, err = compileAPIAccess(APIAccess{Enabled: true, Networks: []string{"10.0.0.0/8", "192.0.2.1"}})
+	test(t, err == nil, "Expected the access list is compiled, got", err)
+	test(t, status("10.1.2.3:1234", "") == http.StatusOK, "Expected the network is allowed")
+	test(t, status("192.0.2.1:1234", "") == http.StatusOK, "Expected the address is allowed")
+	test(t, status("192.0.2.2:1234", "") == http.StatusForbidden, "Expected the access is denied")
+	test(t, status("127.0.0.1:1234", "") == http.StatusForbidden, "Expected the localhost is denied")
+
+	// X-Forwarded-For is used for the trusted reverse proxy only
+	test(t, status("192.0.2.2:1234", "10.1.2.3") == http.StatusForbidden, "Expected forwarded address is ignored")
+	server.apiAccess.TrustForwarded = true
+	test(t, status("192.0.2.2:1234", "10.1.2.3") == http.StatusOK, "Expected forwarded address is used")
+
+	// the address which is added by the client before the proxy is not trusted
+	test(t, status("192.0.2.2:1234", "10.1.2.3, 192.0.2.2") == http.StatusForbidden,
+		"Expected forged forwarded address is ignored")
+	test(t, status("192.0.2.2:1234", "garbage") == http.StatusForbidden, "Expected incorrect address is denied")
+
+	// the trusted proxies are skipped from the right
+	server.apiAccess, err = compileAPIAccess(APIAccess{Enabled: true, Networks: []string{"10.0.0.0/8"},
+		TrustForwarded: true, TrustedProxies: []string{"192.0.2.0/24"}})
+	test(t, err == nil, "Expected the access list is compiled, got", err)
+	test(t, status("192.0.2.2:1234", "10.1.2.3, 192.0.2.2") == http.StatusOK, "Expected the proxies are skipped")
+	test(t, status("192.0.2.2:1234", "10.1.2.3, 198.51.100.1, 192.0.2.3") == http.StatusForbidden,
+		"Expected the address before the trusted proxies is the client")
+	test(t, status("198.51.100.1:1234", "10.1.2.3") == http.StatusForbidden,
+		"Expected the header of untrusted connection is ignored")
+}
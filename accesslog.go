@@ -0,0 +1,100 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Formats of the access log
+const (
+	CommonLogFormat   = "common"
+	CombinedLogFormat = "combined"
+)
+
+// responseRecorder captures status and size of the response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+// WriteHeader captures status of the response
+func (recorder *responseRecorder) WriteHeader(status int) {
+	if recorder.status == 0 {
+		recorder.status = status
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// Write captures size of the response
+func (recorder *responseRecorder) Write(b []byte) (int, error) {
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	n, err := recorder.ResponseWriter.Write(b)
+	recorder.size += n
+	return n, err
+}
+
+// Flush sends buffered data to the client, if the writer supports it
+func (recorder *responseRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// accessLog wraps the handler to write access log in common or combined format,
+// if the format is not defined, the handler is returned as is
+func (server *Server) accessLog(handler http.Handler) http.Handler {
+	format := server.Options.AccessLog
+	if format != CommonLogFormat && format != CombinedLogFormat {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w}
+
+		// the request could be changed by handler, so keep the original values
+		host, _, err := net.SplitHostPort(request.RemoteAddr)
+		if err != nil {
+			host = request.RemoteAddr
+		}
+		line := fmt.Sprintf("%s %s %s", request.Method, request.RequestURI, request.Proto)
+		user := "-"
+		if request.URL.User != nil && request.URL.User.Username() != "" {
+			user = request.URL.User.Username()
+		}
+
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		size := "-"
+		if recorder.size > 0 {
+			size = fmt.Sprint(recorder.size)
+		}
+		entry := fmt.Sprintf("%s - %s [%s] %q %d %s",
+			host, user, start.Format("02/Jan/2006:15:04:05 -0700"), line, recorder.status, size)
+		if format == CombinedLogFormat {
+			entry += fmt.Sprintf(" %q %q %d",
+				orDash(request.Referer()), orDash(request.UserAgent()),
+				time.Since(start).Nanoseconds()/int64(time.Microsecond))
+		}
+		accesslog.Println(entry)
+	})
+}
+
+// orDash returns the value or dash if it is empty
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,33 @@
+package spawn
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buffer bytes.Buffer
+	accesslog.SetOutput(&buffer)
+	defer accesslog.SetOutput(os.Stdout)
+
+	server := new(Server)
+	server.Options.AccessLog = CombinedLogFormat
+	handler := server.accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+
+	request := httptest.NewRequest("PUT", "/nodes/localhost/7017", nil)
+	request.RemoteAddr = "192.168.0.1:56324"
+	request.Header.Set("User-Agent", "test-agent")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	entry := buffer.String()
+	test(t, strings.HasPrefix(entry, "192.168.0.1 - - ["), "Expected remote host in the log, got", entry)
+	test(t, strings.Contains(entry, `"PUT /nodes/localhost/7017 HTTP/1.1" 201 7 "-" "test-agent"`),
+		"Expected request, status, size and user agent in the log, got", entry)
+}
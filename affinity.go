@@ -0,0 +1,146 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/takama/router"
+)
+
+// Affinity defines the nodes which are preferred for the reads of the clients from the networks,
+// the rules are ordered and the first matched rule is used, if no one of the preferred nodes
+// could serve the request, the rest nodes are used
+type Affinity struct {
+	Rules []AffinityRule `json:"rules"`
+
+	// the client address is taken from X-Forwarded-For header instead of the address
+	// of the connection, it should be used behind the trusted reverse proxy only
+	TrustForwarded bool `json:"trust-forwarded"`
+
+	// the networks (CIDR) or the addresses of the trusted reverse proxies which are skipped
+	// in X-Forwarded-For header, if it is empty, the proxy of the connection is trusted only
+	TrustedProxies []string `json:"trusted-proxies"`
+
+	// the parsed trusted proxies
+	proxies []*net.IPNet
+}
+
+// AffinityRule prefers the nodes which have all annotations of the rule
+// for the clients from the networks (CIDR) or the addresses
+type AffinityRule struct {
+	Networks    []string    `json:"networks"`
+	Annotations Annotations `json:"annotations"`
+
+	networks []*net.IPNet
+}
+
+// compileAffinity checks the rules of the affinity and parses their networks
+func compileAffinity(affinity Affinity) (Affinity, error) {
+	rules := make([]AffinityRule, len(affinity.Rules))
+	for index, rule := range affinity.Rules {
+		if len(rule.Networks) == 0 {
+			return affinity, fmt.Errorf("The affinity rule %d has no networks", index)
+		}
+		if len(rule.Annotations) == 0 {
+			return affinity, fmt.Errorf("The affinity rule %d has no annotations", index)
+		}
+		networks, err := parseNetworks(rule.Networks)
+		if err != nil {
+			return affinity, fmt.Errorf("The affinity rule %d: %s", index, err)
+		}
+		rule.networks = networks
+		rules[index] = rule
+	}
+	affinity.Rules = rules
+	proxies, err := parseNetworks(affinity.TrustedProxies)
+	if err != nil {
+		return affinity, fmt.Errorf("The trusted proxies of the affinity: %s", err)
+	}
+	affinity.proxies = proxies
+
+	return affinity, nil
+}
+
+// Validate checks the rules and the trusted proxies of the affinity
+func (affinity Affinity) Validate() error {
+	_, err := compileAffinity(affinity)
+	return err
+}
+
+// match returns the first rule which contains the address of the client of the request,
+// nil means no one of the nodes is preferred
+func (affinity *Affinity) match(request *http.Request) *AffinityRule {
+	if len(affinity.Rules) == 0 {
+		return nil
+	}
+	ip := clientIP(request, affinity.TrustForwarded, affinity.proxies)
+	if ip == nil {
+		return nil
+	}
+	for index := range affinity.Rules {
+		for _, network := range affinity.Rules[index].networks {
+			if network.Contains(ip) {
+				return &affinity.Rules[index]
+			}
+		}
+	}
+	return nil
+}
+
+// includes checks that the node has all annotations of the rule
+func (rule *AffinityRule) includes(node Node) bool {
+	for key, value := range rule.Annotations {
+		if current, ok := node.Annotations[key]; !ok || current != value {
+			return false
+		}
+	}
+	return true
+}
+
+// receiveAffinity reproduces the request on the nodes which are preferred for the client,
+// the tried nodes are not used again by the selection of the other nodes. The nodes which
+// do not serve the route, are blackholed or are down are not preferred
+func (server *Server) receiveAffinity(attempt *receiveAttempt) (*http.Response, bool) {
+	rule := server.affinity.match(attempt.request)
+	if rule == nil {
+		return nil, false
+	}
+	nodes, _ := server.Nodes.GetAll()
+	for _, node := range nodes {
+		if !node.Active || node.Maintenance || !rule.includes(node) || attempt.err != nil {
+			continue
+		}
+		id := fmt.Sprintf("%s:%d", node.Host, node.Port)
+		if !attempt.route.includes(node) || attempt.tried[id] || server.Nodes.isBlackhole(id) {
+			continue
+		}
+		if health := server.probes.health(id); health != nil && !health.Up {
+			continue
+		}
+		response, ok := server.receiveFrom(attempt, node)
+		if attempt.tried == nil {
+			attempt.tried = make(map[string]bool)
+		}
+		attempt.tried[id] = true
+		if ok {
+			return response, true
+		}
+	}
+	return nil, false
+}
+
+// getAffinity - gets the rules of the affinity of the clients to the nodes
+func (server *Server) getAffinity(c *router.Control) {
+	c.UseTimer()
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"total":   len(server.affinity.Rules),
+		"results": server.affinity.Rules,
+	})
+}
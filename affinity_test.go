@@ -0,0 +1,97 @@
+package spawn
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestCompileAffinity(t *testing.T) {
+	_, err := compileAffinity(Affinity{Rules: []AffinityRule{{Annotations: Annotations{"zone": "eu"}}}})
+	test(t, err != nil, "Expected the rule without networks is not valid")
+	_, err = compileAffinity(Affinity{Rules: []AffinityRule{{Networks: []string{"10.0.0.0/8"}}}})
+	test(t, err != nil, "Expected the rule without annotations is not valid")
+	_, err = compileAffinity(Affinity{Rules: []AffinityRule{
+		{Networks: []string{"10.0.0.0/33"}, Annotations: Annotations{"zone": "eu"}},
+	}})
+	test(t, err != nil, "Expected the rule with incorrect network is not valid")
+
+	affinity, err := compileAffinity(Affinity{Rules: []AffinityRule{
+		{Networks: []string{"10.1.0.0/16"}, Annotations: Annotations{"zone": "eu"}},
+		{Networks: []string{"10.0.0.0/8"}, Annotations: Annotations{"zone": "us"}},
+	}})
+	test(t, err == nil, "Expected the rules are valid, got", err)
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "10.1.2.3:54321"
+	rule := affinity.match(request)
+	test(t, rule != nil && rule.Annotations["zone"] == "eu", "Expected the first matched rule, got", rule)
+	request.RemoteAddr = "192.0.2.1:54321"
+	test(t, affinity.match(request) == nil, "Expected no rule for the client from other network")
+	request.Header.Set("X-Forwarded-For", "10.2.0.1")
+	test(t, affinity.match(request) == nil, "Expected X-Forwarded-For is not trusted")
+	affinity.TrustForwarded = true
+	rule = affinity.match(request)
+	test(t, rule != nil && rule.Annotations["zone"] == "us", "Expected the rule by X-Forwarded-For, got", rule)
+
+	// the address which is added by the client before the proxy is not trusted
+	request.Header.Set("X-Forwarded-For", "10.1.2.3, 192.0.2.1")
+	test(t, affinity.match(request) == nil, "Expected forged X-Forwarded-For is ignored")
+	affinity.TrustedProxies = []string{"192.0.2.0/24"}
+	affinity, err = compileAffinity(affinity)
+	test(t, err == nil, "Expected the trusted proxies are valid, got", err)
+	rule = affinity.match(request)
+	test(t, rule != nil && rule.Annotations["zone"] == "eu", "Expected the trusted proxy is skipped, got", rule)
+	test(t, Affinity{TrustedProxies: []string{"proxy"}}.Validate() != nil, "Expected incorrect proxy is not valid")
+}
+
+func TestReceiveAffinity(t *testing.T) {
+	var nodes []Node
+	for index, zone := range []string{"us", "eu"} {
+		zone := zone
+		node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(zone))
+		}))
+		defer node.Close()
+		host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+		number, _ := strconv.ParseUint(port, 10, 64)
+		nodes = append(nodes, Node{Host: host, Port: number, Active: true, Priority: index + 1,
+			Annotations: Annotations{"zone": zone}})
+	}
+
+	// the nodes are selected according to priority, so the client without affinity gets the first one
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.byPriority = true
+	server.transport = http.DefaultTransport
+	server.responseTimeout = 5
+	server.affinity, err = compileAffinity(Affinity{Rules: []AffinityRule{
+		{Networks: []string{"10.1.0.0/16"}, Annotations: Annotations{"zone": "eu"}},
+	}})
+	test(t, err == nil, "Expected the rules are valid, got", err)
+	go server.jobListener()
+	server.Nodes.SetAll(nodes)
+	server.job <- responseSignal
+	<-server.response
+
+	read := func(remoteAddr string) string {
+		request, _ := http.NewRequest("GET", "http://example.com/", nil)
+		request.RemoteAddr = remoteAddr
+		response, err := server.RoundTrip(request)
+		test(t, err == nil, "Expected the response of the node, got", err)
+		defer response.Body.Close()
+		data, _ := ioutil.ReadAll(response.Body)
+		return string(data)
+	}
+	got := read("10.1.2.3:54321")
+	test(t, got == "eu", "Expected the node of the affinity of the client, got", got)
+	got = read("192.0.2.1:54321")
+	test(t, got == "us", "Expected the first node for the client without affinity, got", got)
+
+	// the blackholed node is not preferred
+	server.Nodes.SetBlackhole(nodes[1].Host, nodes[1].Port, true)
+	got = read("10.1.2.3:54321")
+	test(t, got == "us", "Expected the blackholed node of the affinity is skipped, got", got)
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/takama/router"
+)
+
+// HeaderAnnotationPrefix is the prefix of the response headers which contain the annotations
+// of the node which produced the response
+const HeaderAnnotationPrefix = "X-Spawn-Annotation-"
+
+// Annotations contains free-form metadata of the node (version, datacenter, etc.),
+// they do not change the behaviour of the server
+type Annotations map[string]string
+
+// clone returns the copy of the annotations which could be changed without side effects
+func (annotations Annotations) clone() Annotations {
+	if annotations == nil {
+		return nil
+	}
+	copied := make(Annotations, len(annotations))
+	for key, value := range annotations {
+		copied[key] = value
+	}
+	return copied
+}
+
+// prune removes the annotations with empty values, so they could be deleted by update,
+// nil value is returned if no one of the annotations is left
+func (annotations Annotations) prune() Annotations {
+	for key, value := range annotations {
+		if value == "" {
+			delete(annotations, key)
+		}
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+	return annotations
+}
+
+// checkAnnotations checks that the keys and values of the annotations could be used in headers
+func checkAnnotations(annotations Annotations, c *router.Control) bool {
+	for key, value := range annotations {
+		if key == "" || strings.ContainsAny(key, " :\t\r\n") || strings.ContainsAny(value, "\r\n") {
+			err := errors.New("annotation " + strconv.Quote(key) + " could not be used in headers")
+			notRecognizedParameterError("annotations", err, c)
+			return false
+		}
+	}
+
+	return true
+}
+
+// equal checks that the nodes have the same values including the annotations,
+// the empty annotations are equal to nil
+func (node Node) equal(other Node) bool {
+	if len(node.Annotations) == 0 {
+		node.Annotations = nil
+	}
+	if len(other.Annotations) == 0 {
+		other.Annotations = nil
+	}
+	return reflect.DeepEqual(node, other)
+}
+
+// annotations returns the annotations of the node specified by ID (host:port)
+func (bundle *NodeBundle) annotations(id string) Annotations {
+	host, port, err := net.SplitHostPort(id)
+	if err != nil {
+		return nil
+	}
+	number, err := strconv.ParseUint(port, 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	// Lock the bundle for 'read' operation
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	return bundle.records[host][number].Annotations
+}
+
+// exposeAnnotations adds the annotations of the node which produced the response to its headers
+func (server *Server) exposeAnnotations(id string, response *http.Response) {
+	for key, value := range server.Nodes.annotations(id) {
+		response.Header.Set(HeaderAnnotationPrefix+key, value)
+	}
+}
@@ -0,0 +1,66 @@
+package spawn
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestAnnotations(t *testing.T) {
+	node := Node{Host: "127.0.0.1", Port: 80, Annotations: Annotations{"version": "1.4.2"}}
+	test(t, node.equal(node), "Expected the node is equal to itself")
+	other := node
+	other.Annotations = Annotations{"version": "1.4.3"}
+	test(t, !node.equal(other), "Expected the nodes with different annotations are not equal")
+	other.Annotations = Annotations{}
+	test(t, other.equal(Node{Host: "127.0.0.1", Port: 80}), "Expected the empty annotations are equal to nil")
+
+	copied := node.Annotations.clone()
+	copied["version"] = ""
+	test(t, node.Annotations["version"] == "1.4.2", "Expected the annotations are not changed by the copy")
+	test(t, copied.prune() == nil, "Expected the annotations with empty values are deleted")
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	go server.jobListener()
+	server.Nodes.Set(&node)
+	server.job <- responseSignal
+	<-server.response
+
+	loaded, ok := server.Nodes.Get(node.Host, node.Port)
+	test(t, ok, "Expected the node is found")
+	test(t, loaded.Annotations["version"] == "1.4.2", "Expected the annotations of the node, got", loaded.Annotations)
+}
+
+func TestExposeAnnotations(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer node.Close()
+	host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+	number, _ := strconv.ParseUint(port, 10, 64)
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: host, Port: number, Active: true, Annotations: Annotations{"Datacenter": "ams1"}}})
+	server.job <- responseSignal
+	<-server.response
+
+	exposed := func() string {
+		request, err := http.NewRequest(methodGET, "http://example.com/", nil)
+		test(t, err == nil, "Expected create a new request, got", err)
+		response, err := server.RoundTrip(request)
+		test(t, err == nil, "Expected the response of the node, got", err)
+		response.Body.Close()
+		return response.Header.Get(HeaderAnnotationPrefix + "Datacenter")
+	}
+
+	test(t, exposed() == "", "Expected the annotations are not exposed by default")
+
+	server.Options.ExposeAnnotations = true
+	got := exposed()
+	test(t, got == "ams1", "Expected the annotation of the node, got", got)
+}
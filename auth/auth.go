@@ -15,7 +15,9 @@ type AuthType string
 
 // List of aith methods
 const (
-	LDAP AuthType = "LDAP"
+	Guest  AuthType = "guest"
+	LDAP   AuthType = "LDAP"
+	Static AuthType = "static"
 )
 
 var (
@@ -23,6 +25,14 @@ var (
 	ErrUserDoesNotExist       = errors.New("User does not exist")
 	ErrNotLogged              = errors.New("User has not logged in")
 	ErrTooManyEntriesReturned = errors.New("Too many entries returned")
+	ErrSessionDoesNotExist    = errors.New("Session does not exist")
+	ErrInvalidSearchScope     = errors.New("Search scope is not valid, use base, one or sub")
+	ErrInvalidCredentials     = errors.New("Invalid user name or secret")
+	ErrOTPRequired            = errors.New("One-time password is required")
+	ErrInvalidOTP             = errors.New("One-time password is not valid")
+	ErrOTPNotConfigured       = errors.New("Two-factor authentication is not configured for the user")
+	ErrUnknownAuthType        = errors.New("Auth type is not known, use guest, LDAP or static")
+	ErrGroupLookupFailed      = errors.New("Groups of the user could not be found")
 )
 
 // AuthInfo contains authentication information
@@ -36,11 +46,25 @@ type AuthInfo struct {
 	Groups []string
 }
 
+// SessionInfo contains information about the active session, the token is masked
+type SessionInfo struct {
+	ID      string    `json:"id"`
+	Token   string    `json:"token"`
+	Info    *AuthInfo `json:"info"`
+	Issued  time.Time `json:"issued-at"`
+	Expires time.Time `json:"expires-at"`
+}
+
 // Auth is a interface which contains basic authentication methods
 type Auth interface {
-	Login(username, password string) (token string, err error)
+	Login(username, password, otp string) (token string, err error)
 	Logout(token string) error
+	Refresh(token string) (newToken string, err error)
+	LogoutUser(uid string) (count int, err error)
 	Info(token string) *AuthInfo
+	IsAdmin(token string) bool
+	Sessions() []SessionInfo
+	CloseSession(id string) error
 	Close()
 }
 
@@ -50,9 +74,26 @@ type AuthConfig struct {
 
 	ExpirationTime time.Duration `json:"expiration"`
 
+	// maximum count of the sessions per user, zero value means no limits
+	MaxSessions int `json:"max-sessions"`
+
+	// group of the users who have access to the admin methods,
+	// if it is empty, no one has access to the admin methods
+	AdminGroup string `json:"admin-group"`
+
 	Host string `json:"host"`
 	Port int    `json:"port"`
 
+	// maximum count of the connections to auth server
+	PoolSize int `json:"pool-size"`
+
+	// idle connections to auth server will be closed after timeout in minutes
+	IdleTimeout time.Duration `json:"idle-timeout"`
+
+	// the sessions are not accepted while auth server is not reachable, and the implicit
+	// guest session of auth server is not used, by default the existing sessions are accepted
+	FailClosed bool `json:"fail-closed"`
+
 	Settings struct {
 		Base    string `json:"base"`
 		UseSSL  bool   `json:"ssl"`
@@ -61,6 +102,45 @@ type AuthConfig struct {
 			Group string `json:"group"`
 		} `json:"filters"`
 		Attributes []string `json:"attributes"`
+
+		// search scope: "base", "one" or "sub" (default)
+		Scope string `json:"scope"`
+
+		// size limit of the search results, zero value means no limits
+		SizeLimit int `json:"size-limit"`
+
+		// time limit of the search in seconds (default: 10)
+		TimeLimit int `json:"time-limit"`
+
+		// page size of the group search results (default: 100)
+		PageSize uint32 `json:"page-size"`
+
+		// the group search is retried on the transient failures, if it still fails,
+		// the login is rejected in strict mode, otherwise the user has no groups
+		GroupLookup struct {
+
+			// count of the retries of the group search (default: 2), -1 disables the retries
+			Retries int `json:"retries"`
+
+			Strict bool `json:"strict"`
+		} `json:"group-lookup"`
+
+		// the second factor of the login by time-based one-time password (TOTP)
+		OTP struct {
+
+			// LDAP attribute which contains base32 encoded seed of the user,
+			// if it is empty, the second factor is not used by LDAP
+			Attribute string `json:"attribute"`
+
+			// the users without the seed are not allowed to login
+			Required bool `json:"required"`
+		} `json:"otp"`
+
+		// pre-shared tokens of the static authentication
+		Tokens map[string]StaticUser `json:"tokens"`
+
+		// users of the static authentication who could login by user name and secret
+		Users map[string]StaticUser `json:"users"`
 	} `json:"settings"`
 }
 
@@ -70,14 +150,20 @@ var (
 	errlog = log.New(os.Stderr, "[AUTH:ERROR]: ", log.Ldate|log.Ltime|log.Lshortfile)
 )
 
-// NewAuth creates new type of authentication
+// NewAuth creates new type of authentication, the guest access is used if the type
+// is guest or it is not defined, the unknown type is not downgraded to guest
 func NewAuth(config *AuthConfig) (Auth, error) {
 	switch config.Type {
 	case LDAP:
 		return NewAuthLDAP(config)
-	default:
+	case Static:
+		return NewAuthStatic(config)
+	case Guest, "":
 		stdlog.Println("Warning: authentication is not used")
 		return NewAuthGuest(config)
+	default:
+		errlog.Printf("Auth type %q is not known", config.Type)
+		return nil, ErrUnknownAuthType
 	}
 }
 
@@ -86,3 +172,16 @@ func GenerateSecureKey() string {
 	io.ReadFull(rand.Reader, k)
 	return fmt.Sprintf("%x", k)
 }
+
+// isAdmin checks that the user has access to the admin methods
+func (config *AuthConfig) isAdmin(info *AuthInfo) bool {
+	if info == nil || config.AdminGroup == "" {
+		return false
+	}
+	for _, group := range info.Groups {
+		if group == config.AdminGroup {
+			return true
+		}
+	}
+	return false
+}
@@ -4,23 +4,25 @@ import "time"
 
 // AuthGuest contains guest parameters
 type AuthGuest struct {
-	session map[string]*AuthInfo
+	config  *AuthConfig
+	session *sessionBundle
 }
 
 // NewAuthGuest creates new guest connection
 func NewAuthGuest(config *AuthConfig) (*AuthGuest, error) {
 	ag := new(AuthGuest)
-	ag.session = make(map[string]*AuthInfo)
+	ag.config = config
+	ag.session = newSessionBundle(config.MaxSessions)
 	return ag, nil
 }
 
-// Login create secure connection by username & password
-func (ag *AuthGuest) Login(username, password string) (token string, err error) {
+// Login create secure connection by username & password, one-time password is not used
+func (ag *AuthGuest) Login(username, password, otp string) (token string, err error) {
 	token = GenerateSecureKey()
-	if _, exists := ag.session[token]; !exists {
-		ag.session[token] = &AuthInfo{
+	if _, exists := ag.session.get(token); !exists {
+		ag.session.add(token, &AuthInfo{
 			UID: username,
-		}
+		}, time.Minute)
 		time.AfterFunc(time.Minute, func() {
 			ag.Logout(token)
 		})
@@ -30,25 +32,60 @@ func (ag *AuthGuest) Login(username, password string) (token string, err error)
 
 // Logout resets current authentication
 func (ag *AuthGuest) Logout(token string) error {
-	if _, exists := ag.session[token]; exists {
-		delete(ag.session, token)
+	if _, exists := ag.session.remove(token); exists {
 		return nil
 	}
 	return ErrNotLogged
 }
 
+// Refresh issues new token and extends the session if the token is still valid
+func (ag *AuthGuest) Refresh(token string) (newToken string, err error) {
+	newToken = GenerateSecureKey()
+	if _, exists := ag.session.replace(token, newToken, time.Minute); !exists {
+		return "", ErrNotLogged
+	}
+	time.AfterFunc(time.Minute, func() {
+		ag.Logout(newToken)
+	})
+	return
+}
+
+// LogoutUser resets all authentications of the user
+func (ag *AuthGuest) LogoutUser(uid string) (int, error) {
+	if count := ag.session.removeUser(uid); count > 0 {
+		return count, nil
+	}
+	return 0, ErrNotLogged
+}
+
 // Close disconects from auth server and logout all users
 func (ag *AuthGuest) Close() {
-	for key := range ag.session {
-		delete(ag.session, key)
-	}
+	ag.session.clear()
 	return
 }
 
 // Info contains user detailed information
 func (ag *AuthGuest) Info(token string) *AuthInfo {
-	if info, exists := ag.session[token]; exists {
+	if info, exists := ag.session.get(token); exists {
 		return info
 	}
 	return nil
 }
+
+// IsAdmin checks that the user has access to the admin methods
+func (ag *AuthGuest) IsAdmin(token string) bool {
+	return ag.config.isAdmin(ag.Info(token))
+}
+
+// Sessions contains information about all active sessions
+func (ag *AuthGuest) Sessions() []SessionInfo {
+	return ag.session.list()
+}
+
+// CloseSession resets the authentication specified by session ID
+func (ag *AuthGuest) CloseSession(id string) error {
+	if _, exists := ag.session.removeByID(id); exists {
+		return nil
+	}
+	return ErrSessionDoesNotExist
+}
@@ -12,94 +12,174 @@ import (
 // AuthLDAP contains LDAP connection parameters
 type AuthLDAP struct {
 	mutex   sync.RWMutex
-	conn    *ldap.Conn
+	pool    *ldapPool
 	config  *AuthConfig
-	session map[string]*AuthInfo
+	scope   int
+	session *sessionBundle
+
+	// the attributes of the user search, including the seed of one-time passwords
+	attributes []string
+
+	// the last known availability of LDAP server which is used in fail-closed mode,
+	// only one probe of LDAP server is running at a time
+	availability struct {
+		mutex     sync.Mutex
+		checked   time.Time
+		available bool
+		probing   bool
+	}
 }
 
 var DefaultExpiration = 60 * time.Minute
 
+// AvailabilityInterval is time of caching of the availability of LDAP server in fail-closed mode
+var AvailabilityInterval = 10 * time.Second
+
+// Default values of the search settings
+const (
+	DefaultTimeLimit    = 10
+	DefaultPageSize     = 100
+	DefaultGroupRetries = 2
+)
+
+// groupRetryDelay is the delay before the retry of the failed group search, it grows with every retry
+const groupRetryDelay = 100 * time.Millisecond
+
 // NewAuthLDAP creates new LDAP connection
 func NewAuthLDAP(config *AuthConfig) (*AuthLDAP, error) {
 	al := &AuthLDAP{
 		config:  config,
-		session: make(map[string]*AuthInfo),
+		session: newSessionBundle(config.MaxSessions),
 	}
-	al.session["guest"] = &AuthInfo{
-		UID: "guest",
+	switch config.Settings.Scope {
+	case "base":
+		al.scope = ldap.ScopeBaseObject
+	case "one":
+		al.scope = ldap.ScopeSingleLevel
+	case "sub", "":
+		al.scope = ldap.ScopeWholeSubtree
+	default:
+		return nil, ErrInvalidSearchScope
+	}
+	al.attributes = append([]string{}, config.Settings.Attributes...)
+	if config.Settings.OTP.Attribute != "" {
+		al.attributes = append(al.attributes, config.Settings.OTP.Attribute)
+	}
+	al.pool = newLDAPPool(config.PoolSize, config.IdleTimeout*time.Minute, al.dial)
+	if config.Settings.TimeLimit == 0 {
+		config.Settings.TimeLimit = DefaultTimeLimit
+	}
+	if config.Settings.PageSize == 0 {
+		config.Settings.PageSize = DefaultPageSize
+	}
+	if config.Settings.GroupLookup.Retries == 0 {
+		config.Settings.GroupLookup.Retries = DefaultGroupRetries
+	}
+	// the implicit guest session accepts everyone, it is not used in fail-closed mode
+	if !config.FailClosed {
+		al.session.add("guest", &AuthInfo{
+			UID: "guest",
+		}, 0)
 	}
 	return al, nil
 }
 
-// connect to LDAP server
-func (al *AuthLDAP) connect() error {
-	if al.conn == nil {
-		var err error
-		ldap.DefaultTimeout = 15 * time.Second
-		link := fmt.Sprintf("%s:%d", al.config.Host, al.config.Port)
-		if al.config.Settings.UseSSL {
-			al.conn, err = ldap.DialTLS("tcp", link, &tls.Config{InsecureSkipVerify: false})
-			if err != nil {
-				return err
-			}
-		} else {
-			if al.conn, err = ldap.Dial("tcp", link); err != nil {
-				return err
-			}
-
-			// Reconnect with TLS
-			if err = al.conn.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
-				return err
-			}
-		}
-		stdlog.Println("LDAP Connection has opened")
-		// set expiration for LDAP connection
-		time.AfterFunc(DefaultExpiration, func() {
-			al.mutex.Lock()
-			if al.conn != nil {
-				al.conn.Close()
-				al.conn = nil
-				stdlog.Println("Closing of LDAP connection due to time expiration")
-			}
-			al.mutex.Unlock()
-		})
+// setAvailable keeps the availability of LDAP server
+func (al *AuthLDAP) setAvailable(available bool) {
+	al.availability.mutex.Lock()
+	defer al.availability.mutex.Unlock()
+	al.availability.checked = time.Now()
+	al.availability.available = available
+}
+
+// available checks that LDAP server is reachable, the result is cached during the interval,
+// the callers are not waiting for the running probe and get the last known availability
+func (al *AuthLDAP) available() bool {
+	al.availability.mutex.Lock()
+	if al.availability.probing || time.Since(al.availability.checked) < AvailabilityInterval {
+		available := al.availability.available
+		al.availability.mutex.Unlock()
+		return available
 	}
-	return nil
+	al.availability.probing = true
+	al.availability.mutex.Unlock()
+
+	conn, err := al.pool.get()
+	if err != nil {
+		errlog.Println("LDAP server is not available, the sessions are not accepted:", err)
+	} else {
+		al.pool.put(conn, false)
+	}
+
+	al.availability.mutex.Lock()
+	defer al.availability.mutex.Unlock()
+	al.availability.probing = false
+	al.availability.checked = time.Now()
+	al.availability.available = err == nil
+	return al.availability.available
 }
 
-// Login create secure connection by username & password
-func (al *AuthLDAP) Login(username, password string) (token string, err error) {
-	al.mutex.Lock()
+// dial opens new connection to LDAP server
+func (al *AuthLDAP) dial() (*ldap.Conn, error) {
+	ldap.DefaultTimeout = 15 * time.Second
+	link := fmt.Sprintf("%s:%d", al.config.Host, al.config.Port)
+	if al.config.Settings.UseSSL {
+		return ldap.DialTLS("tcp", link, &tls.Config{InsecureSkipVerify: false})
+	}
+	conn, err := ldap.Dial("tcp", link)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reconnect with TLS
+	if err = conn.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Login create secure connection by username & password and one-time password, if it is used
+func (al *AuthLDAP) Login(username, password, otp string) (token string, err error) {
+	var conn *ldapConn
+	var broken bool
 	defer func() {
-		al.mutex.Unlock()
 		if recovery := recover(); recovery != nil {
 			errlog.Println("Method 'Login' has been recovered:", recovery)
 			err = fmt.Errorf("%s", recovery)
+			broken = true
+		}
+		if conn != nil {
+			al.pool.put(conn, broken)
 		}
 	}()
-	if err = al.connect(); err != nil {
+	if conn, err = al.pool.get(); err != nil {
 		errlog.Println("Could not connect to LDAP server:", err)
+		al.setAvailable(false)
 		return
 	}
+	al.setAvailable(true)
 	request := ldap.NewSearchRequest(
 		al.config.Settings.Base,
-		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 10, false,
+		al.scope, ldap.NeverDerefAliases,
+		al.config.Settings.SizeLimit, al.config.Settings.TimeLimit, false,
 		fmt.Sprintf(al.config.Settings.Filters.User, username),
-		al.config.Settings.Attributes,
+		al.attributes,
 		nil,
 	)
-	result, err := al.conn.Search(request)
+	result, err := conn.Search(request)
 	if err != nil {
-		al.conn.Close()
-		al.conn = nil
-		stdlog.Println("LDAP Connection has been closed:", err)
-		if err = al.connect(); err != nil {
+		// the connection is broken, try again with another one
+		stdlog.Println("LDAP Search has failed:", err)
+		al.pool.put(conn, true)
+		if conn, err = al.pool.get(); err != nil {
 			errlog.Println("Could not connect to LDAP server:", err)
 			return
 		}
-		result, err = al.conn.Search(request)
+		result, err = conn.Search(request)
 		if err != nil {
 			errlog.Println("Could not connect to LDAP server:", err)
+			broken = true
 			return
 		}
 	}
@@ -114,9 +194,18 @@ func (al *AuthLDAP) Login(username, password string) (token string, err error) {
 	var ai = &AuthInfo{
 		UID: "guest",
 	}
-	if err = al.conn.Bind(result.Entries[0].DN, password); err != nil {
+	if err = conn.Bind(result.Entries[0].DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			err = ErrInvalidCredentials
+		}
 		return
 	}
+	if attr := al.config.Settings.OTP.Attribute; attr != "" {
+		if err = al.config.checkOTP(result.Entries[0].GetAttributeValue(attr), otp); err != nil {
+			errlog.Println("Attempt to login as", username, "without valid one-time password")
+			return
+		}
+	}
 	for _, attr := range al.config.Settings.Attributes {
 		v = result.Entries[0].GetAttributeValue(attr)
 		switch attr {
@@ -132,18 +221,40 @@ func (al *AuthLDAP) Login(username, password string) (token string, err error) {
 	}
 	groupRequest := ldap.NewSearchRequest(
 		al.config.Settings.Base,
-		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 10, false,
+		al.scope, ldap.NeverDerefAliases,
+		al.config.Settings.SizeLimit, al.config.Settings.TimeLimit, false,
 		fmt.Sprintf(al.config.Settings.Filters.Group, username),
 		[]string{"cn"},
 		nil,
 	)
-	if result, err := al.conn.Search(groupRequest); err == nil {
-		for _, entry := range result.Entries {
+	groups, groupErr := conn.SearchWithPaging(groupRequest, al.config.Settings.PageSize)
+	groupErr = retryGroups(al.config.Settings.GroupLookup.Retries, groupErr, func() (err error) {
+		// the connection could be broken, try again with another one which is bound by the user
+		al.pool.put(conn, true)
+		if conn, err = al.pool.get(); err != nil {
+			return
+		}
+		if err = conn.Bind(result.Entries[0].DN, password); err != nil {
+			return
+		}
+		groups, err = conn.SearchWithPaging(groupRequest, al.config.Settings.PageSize)
+		return
+	})
+	if groupErr != nil {
+		errlog.Println("Could not find groups of the user", username+":", groupErr)
+		broken = conn != nil
+		if al.config.Settings.GroupLookup.Strict {
+			return "", ErrGroupLookupFailed
+		}
+	} else {
+		for _, entry := range groups.Entries {
 			ai.Groups = append(ai.Groups, entry.GetAttributeValue("cn"))
 		}
 	}
 	token = GenerateSecureKey()
-	al.session[token] = ai
+	if evicted := al.session.add(token, ai, al.config.ExpirationTime*time.Minute); len(evicted) > 0 {
+		stdlog.Println("user", ai.UID, "has exceeded count of the sessions,", len(evicted), "oldest closed")
+	}
 	time.AfterFunc(al.config.ExpirationTime*time.Minute, func() {
 		al.Logout(token)
 	})
@@ -153,18 +264,74 @@ func (al *AuthLDAP) Login(username, password string) (token string, err error) {
 	return
 }
 
+// retryGroups retries the failed group search by the function while the error is transient,
+// the delay grows with every retry, the negative count of the retries disables them
+func retryGroups(retries int, err error, search func() error) error {
+	for attempt := 1; err != nil && isTransient(err) && attempt <= retries; attempt++ {
+		stdlog.Println("LDAP group search has failed:", err)
+		time.Sleep(groupRetryDelay * time.Duration(attempt))
+		err = search()
+	}
+	return err
+}
+
+// isTransient checks that the error of LDAP server could disappear on retry
+func isTransient(err error) bool {
+	for _, code := range []uint8{
+		ldap.ErrorNetwork,
+		ldap.LDAPResultBusy,
+		ldap.LDAPResultUnavailable,
+		ldap.LDAPResultTimeLimitExceeded,
+	} {
+		if ldap.IsErrorWithCode(err, code) {
+			return true
+		}
+	}
+	return false
+}
+
 // Logout resets current authentication
 func (al *AuthLDAP) Logout(token string) error {
 	al.mutex.Lock()
 	defer al.mutex.Unlock()
-	if ai, exists := al.session[token]; exists {
-		delete(al.session, token)
+	if ai, exists := al.session.remove(token); exists {
 		stdlog.Println("user", ai.UID, "has logged out")
 		return nil
 	}
 	return ErrNotLogged
 }
 
+// Refresh issues new token and extends the session if the token is still valid
+func (al *AuthLDAP) Refresh(token string) (newToken string, err error) {
+	// guest session does not expire
+	if token == "guest" {
+		return token, nil
+	}
+	newToken = GenerateSecureKey()
+	ai, exists := al.session.replace(token, newToken, al.config.ExpirationTime*time.Minute)
+	if !exists {
+		return "", ErrNotLogged
+	}
+	time.AfterFunc(al.config.ExpirationTime*time.Minute, func() {
+		al.Logout(newToken)
+	})
+
+	stdlog.Println("user", ai.UID, "has refreshed the session")
+
+	return
+}
+
+// LogoutUser resets all authentications of the user
+func (al *AuthLDAP) LogoutUser(uid string) (int, error) {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+	if count := al.session.removeUser(uid); count > 0 {
+		stdlog.Println("user", uid, "has logged out from", count, "session(s)")
+		return count, nil
+	}
+	return 0, ErrNotLogged
+}
+
 // Close disconects from auth server and logout all users
 func (al *AuthLDAP) Close() {
 	al.mutex.Lock()
@@ -174,22 +341,44 @@ func (al *AuthLDAP) Close() {
 			errlog.Println("Method 'Close' has been recovered:", recovery)
 		}
 	}()
-	for key := range al.session {
-		delete(al.session, key)
-	}
-	if al.conn != nil {
-		al.conn.Close()
-		al.conn = nil
-	}
+	al.session.clear()
+	al.pool.close()
 	stdlog.Println("LDAP Connection has been closed")
 }
 
-// Info contains user detailed information
+// Info contains user detailed information, the sessions are not accepted
+// in fail-closed mode while LDAP server is not reachable
 func (al *AuthLDAP) Info(token string) *AuthInfo {
+	if al.config.FailClosed && !al.available() {
+		return nil
+	}
 	al.mutex.RLock()
 	defer al.mutex.RUnlock()
-	if info, exists := al.session[token]; exists {
+	if info, exists := al.session.get(token); exists {
 		return info
 	}
 	return nil
 }
+
+// IsAdmin checks that the user has access to the admin methods,
+// the implicit guest session has no access to them
+func (al *AuthLDAP) IsAdmin(token string) bool {
+	if token == "guest" {
+		return false
+	}
+	return al.config.isAdmin(al.Info(token))
+}
+
+// Sessions contains information about all active sessions
+func (al *AuthLDAP) Sessions() []SessionInfo {
+	return al.session.list()
+}
+
+// CloseSession resets the authentication specified by session ID
+func (al *AuthLDAP) CloseSession(id string) error {
+	if _, exists := al.session.removeByID(id); exists {
+		stdlog.Println("session", id, "has been closed")
+		return nil
+	}
+	return ErrSessionDoesNotExist
+}
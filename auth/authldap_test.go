@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gopkg.in/ldap.v2"
+)
+
+func test(t *testing.T, condition bool, messages ...interface{}) {
+	if !condition {
+		t.Error(messages...)
+	}
+}
+
+func TestNewAuthType(t *testing.T) {
+	service, err := NewAuth(&AuthConfig{})
+	_, ok := service.(*AuthGuest)
+	test(t, err == nil && ok, "Expected the guest access for the empty type, got", service, err)
+
+	service, err = NewAuth(&AuthConfig{Type: Guest})
+	_, ok = service.(*AuthGuest)
+	test(t, err == nil && ok, "Expected the guest access for the guest type, got", service, err)
+
+	_, err = NewAuth(&AuthConfig{Type: "ldap"})
+	test(t, err == ErrUnknownAuthType, "Expected the unknown type is rejected, got", err)
+}
+
+func TestAvailable(t *testing.T) {
+	al, err := NewAuthLDAP(&AuthConfig{Type: LDAP, FailClosed: true})
+	test(t, err == nil, "Expected new LDAP auth, got", err)
+
+	release := make(chan struct{})
+	dialed := make(chan struct{}, 1)
+	al.pool = newLDAPPool(1, 0, func() (*ldap.Conn, error) {
+		dialed <- struct{}{}
+		<-release
+		return nil, errors.New("LDAP server is not reachable")
+	})
+	done := make(chan bool)
+	go func() {
+		done <- al.available()
+	}()
+	<-dialed
+
+	// the callers are not waiting for the running probe
+	start := time.Now()
+	test(t, !al.available(), "Expected the last known availability during the probe")
+	test(t, al.Info("guest") == nil, "Expected the session is not accepted during the probe")
+	test(t, time.Since(start) < 100*time.Millisecond, "Expected the callers are not waiting, got", time.Since(start))
+
+	close(release)
+	test(t, !<-done, "Expected LDAP server is not available")
+	al.availability.mutex.Lock()
+	probing, checked := al.availability.probing, al.availability.checked
+	al.availability.mutex.Unlock()
+	test(t, !probing && !checked.IsZero(), "Expected the probe is finished and cached")
+
+	al.setAvailable(true)
+	test(t, al.available(), "Expected the cached availability")
+}
+
+func TestGroupRetries(t *testing.T) {
+	al, err := NewAuthLDAP(&AuthConfig{Type: LDAP})
+	test(t, err == nil && al.config.Settings.GroupLookup.Retries == DefaultGroupRetries,
+		"Expected the default retries, got", al.config.Settings.GroupLookup.Retries, err)
+	config := &AuthConfig{Type: LDAP}
+	config.Settings.GroupLookup.Retries = -1
+	al, err = NewAuthLDAP(config)
+	test(t, err == nil && al.config.Settings.GroupLookup.Retries == -1,
+		"Expected the retries are disabled, got", al.config.Settings.GroupLookup.Retries, err)
+
+	transient := &ldap.Error{Err: errors.New("busy"), ResultCode: ldap.LDAPResultBusy}
+	count := 0
+	search := func() error {
+		count++
+		return transient
+	}
+	err = retryGroups(-1, transient, search)
+	test(t, err == transient && count == 0, "Expected no retries, got", count)
+
+	err = retryGroups(2, transient, search)
+	test(t, err == transient && count == 2, "Expected 2 retries, got", count)
+
+	count = 0
+	err = retryGroups(2, transient, func() error {
+		count++
+		return nil
+	})
+	test(t, err == nil && count == 1, "Expected the retry succeeds, got", count, err)
+
+	count = 0
+	invalid := &ldap.Error{Err: errors.New("invalid"), ResultCode: ldap.LDAPResultInvalidCredentials}
+	err = retryGroups(2, invalid, search)
+	test(t, err == invalid && count == 0, "Expected the permanent error is not retried, got", count)
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"sync"
+	"time"
+)
+
+// StaticUser contains the user information of the pre-shared token or the user name
+type StaticUser struct {
+	UID    string   `json:"uid"`
+	Groups []string `json:"groups"`
+
+	// secret of the user which is used for login by user name, it is not used for the tokens
+	Secret string `json:"secret"`
+
+	// base32 encoded seed of one-time passwords of the user, if it is empty, the second factor is not used
+	OTP string `json:"otp"`
+}
+
+// AuthStatic contains pre-shared tokens and users which are defined by config
+type AuthStatic struct {
+	mutex   sync.RWMutex
+	config  *AuthConfig
+	tokens  map[string]*AuthInfo
+	session *sessionBundle
+}
+
+// NewAuthStatic creates new authentication by pre-shared tokens
+func NewAuthStatic(config *AuthConfig) (*AuthStatic, error) {
+	as := new(AuthStatic)
+	as.config = config
+	as.session = newSessionBundle(config.MaxSessions)
+	as.tokens = make(map[string]*AuthInfo, len(config.Settings.Tokens))
+	for token, user := range config.Settings.Tokens {
+		as.tokens[token] = &AuthInfo{UID: user.UID, Groups: user.Groups}
+	}
+	stdlog.Println("Static authentication is loaded with", len(as.tokens), "token(s)")
+
+	return as, nil
+}
+
+// Login create secure connection by username & secret and one-time password, if the users are defined,
+// the unknown user and the wrong secret get the same error, so the users could not be enumerated
+func (as *AuthStatic) Login(username, password, otp string) (token string, err error) {
+	user, exists := as.config.Settings.Users[username]
+	if !exists || user.Secret == "" || subtle.ConstantTimeCompare([]byte(user.Secret), []byte(password)) != 1 {
+		errlog.Println("Attempt to login as", username)
+		return "", ErrInvalidCredentials
+	}
+	if err = as.config.checkOTP(user.OTP, otp); err != nil {
+		errlog.Println("Attempt to login as", username, "without valid one-time password")
+		return "", err
+	}
+	ai := &AuthInfo{UID: user.UID, Groups: user.Groups}
+	if ai.UID == "" {
+		ai.UID = username
+	}
+	token = GenerateSecureKey()
+	if evicted := as.session.add(token, ai, as.config.ExpirationTime*time.Minute); len(evicted) > 0 {
+		stdlog.Println("user", ai.UID, "has exceeded count of the sessions,", len(evicted), "oldest closed")
+	}
+	time.AfterFunc(as.config.ExpirationTime*time.Minute, func() {
+		as.Logout(token)
+	})
+
+	stdlog.Println("user", ai.UID, "has logged in")
+
+	return
+}
+
+// Logout resets current authentication, the pre-shared tokens could not be reset
+func (as *AuthStatic) Logout(token string) error {
+	if ai, exists := as.session.remove(token); exists {
+		stdlog.Println("user", ai.UID, "has logged out")
+		return nil
+	}
+	return ErrNotLogged
+}
+
+// Refresh issues new token and extends the session if the token is still valid,
+// the pre-shared token does not expire and is returned as is
+func (as *AuthStatic) Refresh(token string) (newToken string, err error) {
+	if as.static(token) != nil {
+		return token, nil
+	}
+	newToken = GenerateSecureKey()
+	ai, exists := as.session.replace(token, newToken, as.config.ExpirationTime*time.Minute)
+	if !exists {
+		return "", ErrNotLogged
+	}
+	time.AfterFunc(as.config.ExpirationTime*time.Minute, func() {
+		as.Logout(newToken)
+	})
+
+	stdlog.Println("user", ai.UID, "has refreshed the session")
+
+	return
+}
+
+// LogoutUser resets all authentications of the user except the pre-shared tokens
+func (as *AuthStatic) LogoutUser(uid string) (int, error) {
+	if count := as.session.removeUser(uid); count > 0 {
+		stdlog.Println("user", uid, "has logged out from", count, "session(s)")
+		return count, nil
+	}
+	return 0, ErrNotLogged
+}
+
+// Close logouts all users and drops the pre-shared tokens
+func (as *AuthStatic) Close() {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	as.session.clear()
+	as.tokens = make(map[string]*AuthInfo)
+}
+
+// Info contains user detailed information
+func (as *AuthStatic) Info(token string) *AuthInfo {
+	if info := as.static(token); info != nil {
+		return info
+	}
+	if info, exists := as.session.get(token); exists {
+		return info
+	}
+	return nil
+}
+
+// IsAdmin checks that the user has access to the admin methods
+func (as *AuthStatic) IsAdmin(token string) bool {
+	return as.config.isAdmin(as.Info(token))
+}
+
+// Sessions contains information about all active sessions, the pre-shared tokens are not included
+func (as *AuthStatic) Sessions() []SessionInfo {
+	return as.session.list()
+}
+
+// CloseSession resets the authentication specified by session ID
+func (as *AuthStatic) CloseSession(id string) error {
+	if _, exists := as.session.removeByID(id); exists {
+		return nil
+	}
+	return ErrSessionDoesNotExist
+}
+
+// static returns the user information of the pre-shared token
+func (as *AuthStatic) static(token string) *AuthInfo {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+
+	for key, info := range as.tokens {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1 {
+			return info
+		}
+	}
+	return nil
+}
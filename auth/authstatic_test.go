@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"testing"
+)
+
+func TestStaticLogin(t *testing.T) {
+	config := &AuthConfig{Type: Static, ExpirationTime: 60}
+	config.Settings.Users = map[string]StaticUser{
+		"jdoe":  {Secret: "secret"},
+		"empty": {},
+	}
+	as, err := NewAuthStatic(config)
+	test(t, err == nil, "Expected new static auth, got", err)
+
+	_, unknown := as.Login("unknown", "secret", "")
+	_, wrong := as.Login("jdoe", "wrong", "")
+	_, empty := as.Login("empty", "", "")
+	test(t, unknown == ErrInvalidCredentials && wrong == unknown && empty == unknown,
+		"Expected the same error for unknown user and wrong secret, got", unknown, wrong, empty)
+
+	token, err := as.Login("jdoe", "secret", "")
+	test(t, err == nil && token != "", "Expected the user is logged in, got", err)
+	info := as.Info(token)
+	test(t, info != nil && info.UID == "jdoe", "Expected the session of the user, got", info)
+}
+
+func TestStaticTokens(t *testing.T) {
+	config := &AuthConfig{Type: Static, ExpirationTime: 60, AdminGroup: "admins"}
+	config.Settings.Tokens = map[string]StaticUser{
+		"admin-token": {UID: "admin", Groups: []string{"admins"}},
+		"user-token":  {UID: "user", Groups: []string{"users"}},
+	}
+	as, err := NewAuthStatic(config)
+	test(t, err == nil, "Expected new static auth, got", err)
+
+	tokens := []struct {
+		token string
+		uid   string
+		admin bool
+	}{
+		{"admin-token", "admin", true},
+		{"user-token", "user", false},
+		{"unknown-token", "", false},
+	}
+	for _, item := range tokens {
+		info := as.Info(item.token)
+		if item.uid == "" {
+			test(t, info == nil, "Expected no info for", item.token, "got", info)
+		} else {
+			test(t, info != nil && info.UID == item.uid, "Expected user", item.uid, "for", item.token, "got", info)
+		}
+		test(t, as.IsAdmin(item.token) == item.admin, "Expected admin", item.admin, "for", item.token)
+	}
+
+	// the pre-shared token does not expire and could not be reset
+	token, err := as.Refresh("user-token")
+	test(t, err == nil && token == "user-token", "Expected the pre-shared token as is, got", token, err)
+	_, err = as.Refresh("unknown-token")
+	test(t, err == ErrNotLogged, "Expected unknown token is not refreshed, got", err)
+	err = as.Logout("user-token")
+	test(t, err == ErrNotLogged, "Expected the pre-shared token is not logged out, got", err)
+	test(t, as.Info("user-token") != nil, "Expected the pre-shared token is still valid")
+	test(t, len(as.Sessions()) == 0, "Expected the pre-shared tokens are not in the sessions, got", as.Sessions())
+
+	// without the users the login issues nothing
+	logins := []struct {
+		username, password string
+	}{
+		{"admin", ""},
+		{"admin", "admin-token"},
+		{"user-token", "user-token"},
+	}
+	for _, item := range logins {
+		token, err := as.Login(item.username, item.password, "")
+		test(t, err == ErrInvalidCredentials && token == "",
+			"Expected no token for", item.username, "got", token, err)
+	}
+	test(t, len(as.Sessions()) == 0, "Expected no sessions, got", as.Sessions())
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"gopkg.in/ldap.v2"
+)
+
+// Default values of the LDAP connection pool
+const (
+	DefaultPoolSize = 4
+)
+
+// ldapConn contains the LDAP connection and the time of its last use
+type ldapConn struct {
+	*ldap.Conn
+	used time.Time
+}
+
+// ldapPool contains the idle LDAP connections and limits count of the open connections
+type ldapPool struct {
+	mutex  sync.Mutex
+	dial   func() (*ldap.Conn, error)
+	idle   time.Duration
+	conns  []*ldapConn
+	tokens chan struct{}
+}
+
+// newLDAPPool creates new pool of the LDAP connections
+func newLDAPPool(size int, idle time.Duration, dial func() (*ldap.Conn, error)) *ldapPool {
+	if size <= 0 {
+		size = DefaultPoolSize
+	}
+	if idle <= 0 {
+		idle = DefaultExpiration
+	}
+	return &ldapPool{
+		dial:   dial,
+		idle:   idle,
+		tokens: make(chan struct{}, size),
+	}
+}
+
+// get takes the idle connection which is alive or opens a new one,
+// it is waiting if all connections of the pool are busy
+func (pool *ldapPool) get() (*ldapConn, error) {
+	pool.tokens <- struct{}{}
+	for {
+		pool.mutex.Lock()
+		if len(pool.conns) == 0 {
+			pool.mutex.Unlock()
+			break
+		}
+		conn := pool.conns[len(pool.conns)-1]
+		pool.conns = pool.conns[:len(pool.conns)-1]
+		pool.mutex.Unlock()
+
+		if time.Since(conn.used) > pool.idle {
+			conn.Close()
+			stdlog.Println("Closing of LDAP connection due to idle timeout")
+			continue
+		}
+		if !isAlive(conn.Conn) {
+			conn.Close()
+			stdlog.Println("LDAP Connection is not alive, closing")
+			continue
+		}
+		return conn, nil
+	}
+	conn, err := pool.dial()
+	if err != nil {
+		<-pool.tokens
+		return nil, err
+	}
+	stdlog.Println("LDAP Connection has opened")
+
+	return &ldapConn{Conn: conn}, nil
+}
+
+// put returns the connection into the pool, broken connection will be closed
+func (pool *ldapPool) put(conn *ldapConn, broken bool) {
+	defer func() { <-pool.tokens }()
+	if broken {
+		conn.Close()
+		stdlog.Println("LDAP Connection has been closed")
+		return
+	}
+	conn.used = time.Now()
+	pool.mutex.Lock()
+	pool.conns = append(pool.conns, conn)
+	pool.mutex.Unlock()
+}
+
+// close closes all idle connections of the pool
+func (pool *ldapPool) close() {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	for _, conn := range pool.conns {
+		conn.Close()
+	}
+	pool.conns = nil
+}
+
+// isAlive checks the connection by reading of the root DSE
+func isAlive(conn *ldap.Conn) bool {
+	request := ldap.NewSearchRequest(
+		"", ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, DefaultTimeLimit, false,
+		"(objectClass=*)", []string{"1.1"}, nil,
+	)
+	_, err := conn.Search(request)
+	return err == nil
+}
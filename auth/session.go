@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// session contains authentication information of the logged in user
+type session struct {
+	id      string
+	info    *AuthInfo
+	issued  time.Time
+	expires time.Time
+}
+
+// sessionBundle contains the sessions indexed by token and by user ID
+type sessionBundle struct {
+	mutex sync.RWMutex
+
+	// maximum count of the sessions per user, zero value means no limits
+	max int
+
+	records map[string]*session
+	users   map[string][]string
+}
+
+// newSessionBundle creates new bundle of the sessions
+func newSessionBundle(max int) *sessionBundle {
+	return &sessionBundle{
+		max:     max,
+		records: make(map[string]*session),
+		users:   make(map[string][]string),
+	}
+}
+
+// add creates new session which expires after ttl (zero value means no expiration),
+// if count of the user sessions exceeds the limit, the oldest sessions will be removed
+func (bundle *sessionBundle) add(token string, info *AuthInfo, ttl time.Duration) (evicted []string) {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	s := &session{id: GenerateSecureKey()[:16], info: info, issued: time.Now()}
+	if ttl > 0 {
+		s.expires = s.issued.Add(ttl)
+	}
+	bundle.records[token] = s
+	tokens := append(bundle.users[info.UID], token)
+	if bundle.max > 0 && len(tokens) > bundle.max {
+		evicted = tokens[:len(tokens)-bundle.max]
+		tokens = tokens[len(tokens)-bundle.max:]
+		for _, key := range evicted {
+			delete(bundle.records, key)
+		}
+	}
+	bundle.users[info.UID] = tokens
+
+	return
+}
+
+// get returns the user information by token
+func (bundle *sessionBundle) get(token string) (*AuthInfo, bool) {
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	if s, exists := bundle.records[token]; exists {
+		return s.info, true
+	}
+	return nil, false
+}
+
+// remove deletes the session by token
+func (bundle *sessionBundle) remove(token string) (*AuthInfo, bool) {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	s, exists := bundle.records[token]
+	if !exists {
+		return nil, false
+	}
+	delete(bundle.records, token)
+	tokens := bundle.users[s.info.UID]
+	for i, key := range tokens {
+		if key == token {
+			tokens = append(tokens[:i], tokens[i+1:]...)
+			break
+		}
+	}
+	if len(tokens) == 0 {
+		delete(bundle.users, s.info.UID)
+	} else {
+		bundle.users[s.info.UID] = tokens
+	}
+
+	return s.info, true
+}
+
+// replace moves the session to the new token and extends its expiration
+func (bundle *sessionBundle) replace(token, newToken string, ttl time.Duration) (*AuthInfo, bool) {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	s, exists := bundle.records[token]
+	if !exists {
+		return nil, false
+	}
+	delete(bundle.records, token)
+	if ttl > 0 {
+		s.expires = time.Now().Add(ttl)
+	}
+	bundle.records[newToken] = s
+	for i, key := range bundle.users[s.info.UID] {
+		if key == token {
+			bundle.users[s.info.UID][i] = newToken
+			break
+		}
+	}
+
+	return s.info, true
+}
+
+// removeByID deletes the session by session ID and returns its token
+func (bundle *sessionBundle) removeByID(id string) (string, bool) {
+	bundle.mutex.RLock()
+	var token string
+	for key, s := range bundle.records {
+		if s.id == id {
+			token = key
+			break
+		}
+	}
+	bundle.mutex.RUnlock()
+
+	if token == "" {
+		return "", false
+	}
+	_, exists := bundle.remove(token)
+
+	return token, exists
+}
+
+// list returns information about all the sessions sorted by issue time
+func (bundle *sessionBundle) list() []SessionInfo {
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	sessions := make([]SessionInfo, 0, len(bundle.records))
+	for token, s := range bundle.records {
+		sessions = append(sessions, SessionInfo{
+			ID:      s.id,
+			Token:   maskToken(token),
+			Info:    s.info,
+			Issued:  s.issued,
+			Expires: s.expires,
+		})
+	}
+	sort.Sort(byIssued(sessions))
+
+	return sessions
+}
+
+// removeUser deletes all the sessions of the user and returns count of deleted sessions
+func (bundle *sessionBundle) removeUser(uid string) int {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	tokens := bundle.users[uid]
+	for _, key := range tokens {
+		delete(bundle.records, key)
+	}
+	delete(bundle.users, uid)
+
+	return len(tokens)
+}
+
+// clear deletes all the sessions
+func (bundle *sessionBundle) clear() {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	bundle.records = make(map[string]*session)
+	bundle.users = make(map[string][]string)
+}
+
+// byIssued type defines specially for sorting of the sessions by issue time
+type byIssued []SessionInfo
+
+func (bi byIssued) Len() int {
+	return len(bi)
+}
+func (bi byIssued) Swap(i, j int) {
+	bi[i], bi[j] = bi[j], bi[i]
+}
+func (bi byIssued) Less(i, j int) bool {
+	return bi[i].Issued.Before(bi[j].Issued)
+}
+
+// maskToken hides the token except a few first and last symbols
+func maskToken(token string) string {
+	if len(token) < 16 {
+		return "****"
+	}
+	return token[:4] + "****" + token[len(token)-4:]
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Parameters of the time-based one-time passwords (RFC 6238)
+const (
+	otpStep   = 30 * time.Second
+	otpDigits = 6
+
+	// count of the steps before and after the current one which are accepted due to clock skew
+	otpSkew = 1
+)
+
+// validateOTP checks the one-time password against the base32 encoded seed
+func validateOTP(seed, code string, now time.Time) bool {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(
+		strings.TrimRight(strings.ToUpper(strings.Replace(seed, " ", "", -1)), "="))
+	if err != nil || len(key) == 0 || len(code) != otpDigits {
+		return false
+	}
+	counter := now.Unix() / int64(otpStep/time.Second)
+	for skew := int64(-otpSkew); skew <= otpSkew; skew++ {
+		expected := generateOTP(key, uint64(counter+skew), otpDigits)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// generateOTP returns the one-time password of the digits for the counter (RFC 4226)
+func generateOTP(key []byte, counter uint64, digits int) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulus := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulus *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%modulus)
+}
+
+// checkOTP verifies the second factor of the user who has the seed,
+// the user without the seed is rejected if the second factor is required
+func (config *AuthConfig) checkOTP(seed, code string) error {
+	if seed == "" {
+		if config.Settings.OTP.Required {
+			return ErrOTPNotConfigured
+		}
+		return nil
+	}
+	if code == "" {
+		return ErrOTPRequired
+	}
+	if !validateOTP(seed, code, time.Now()) {
+		return ErrInvalidOTP
+	}
+	return nil
+}
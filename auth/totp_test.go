@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// the seed of the test vectors of RFC 4226 and RFC 6238 (SHA1)
+const otpTestSeed = "12345678901234567890"
+
+func TestGenerateOTP(t *testing.T) {
+	key := []byte(otpTestSeed)
+
+	// RFC 4226, Appendix D
+	for counter, expected := range []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	} {
+		code := generateOTP(key, uint64(counter), 6)
+		test(t, code == expected, "Expected", expected, "for counter", counter, "got", code)
+	}
+
+	// RFC 6238, Appendix B
+	for unix, expected := range map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	} {
+		counter := uint64(unix / int64(otpStep/time.Second))
+		code := generateOTP(key, counter, 8)
+		test(t, code == expected, "Expected", expected, "at", unix, "got", code)
+		short := generateOTP(key, counter, otpDigits)
+		test(t, short == expected[len(expected)-otpDigits:], "Expected", expected[len(expected)-otpDigits:], "at", unix, "got", short)
+	}
+}
+
+func TestValidateOTP(t *testing.T) {
+	seed := base32.StdEncoding.EncodeToString([]byte(otpTestSeed))
+	now := time.Unix(1111111109, 0)
+	test(t, validateOTP(seed, "081804", now), "Expected the code of the current step is valid")
+	test(t, validateOTP(seed, "081804", now.Add(otpStep)), "Expected the code of the previous step is valid")
+	test(t, !validateOTP(seed, "081804", now.Add(3*otpStep)), "Expected the old code is not valid")
+	test(t, !validateOTP(seed, "07081804", now), "Expected the code of other length is not valid")
+	test(t, !validateOTP("", "081804", now), "Expected the empty seed is not valid")
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/takama/router"
+)
+
+// blackhole checks that all traffic to the node is stopped (must be called under lock)
+func (bundle *NodeBundle) blackhole(host string, port uint64) bool {
+	return bundle.blackholes[fmt.Sprintf("%s:%d", host, port)]
+}
+
+// isBlackhole checks that the node specified by ID (host:port) is blackholed
+func (bundle *NodeBundle) isBlackhole(id string) bool {
+	// Lock the bundle for 'read' operation
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	return bundle.blackholes[id]
+}
+
+// SetBlackhole - stops or restores all traffic to the node, the reads skip the node
+// and the updates for it are dropped instead of queuing
+func (bundle *NodeBundle) SetBlackhole(host string, port uint64, enabled bool) bool {
+	// Lock the bundle for the transaction processing
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	if _, ok := bundle.records[host][port]; !ok {
+		return false
+	}
+	id := fmt.Sprintf("%s:%d", host, port)
+	if enabled {
+		bundle.blackholes[id] = true
+		stdlog.Println("blackhole node", host, port)
+	} else {
+		delete(bundle.blackholes, id)
+		stdlog.Println("restore node", host, port)
+	}
+
+	return true
+}
+
+// putBlackhole stops all traffic to the node specified by host and port
+func (bundle *NodeBundle) putBlackhole(c *router.Control) {
+	bundle.setBlackholeRecord(c, true)
+}
+
+// deleteBlackhole restores the traffic to the node specified by host and port
+func (bundle *NodeBundle) deleteBlackhole(c *router.Control) {
+	bundle.setBlackholeRecord(c, false)
+}
+
+func (bundle *NodeBundle) setBlackholeRecord(c *router.Control, enabled bool) {
+	c.UseTimer()
+
+	// Try to decode host
+	host, ok := decodeString(":host", c)
+	if !ok {
+		return
+	}
+
+	// Try to decode port
+	port, ok := decodeNumber(":port", c)
+	if !ok {
+		return
+	}
+
+	if !bundle.SetBlackhole(host, port, enabled) {
+		recordNotFound(c)
+		return
+	}
+	record, _ := bundle.Get(host, port)
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"total":   1,
+		"results": []Node{record},
+	})
+}
@@ -0,0 +1,43 @@
+package spawn
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBlackhole(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	go server.jobListener()
+	go server.Metrics.updateMetrics()
+	server.Nodes.SetAll([]Node{{Host: "127.0.0.1", Port: 1, Active: true}})
+	server.job <- responseSignal
+	<-server.response
+
+	test(t, !server.Nodes.SetBlackhole("unknown", 1, true), "Expected the node is not found")
+	test(t, server.Nodes.SetBlackhole("127.0.0.1", 1, true), "Expected the node is blackholed")
+	record, _ := server.Nodes.Get("127.0.0.1", 1)
+	test(t, record.Blackhole, "Expected the blackhole flag of the node")
+	nodes, _ := server.Nodes.GetAllByHost("127.0.0.1")
+	test(t, len(nodes) == 1 && nodes[0].Blackhole, "Expected the blackhole flag in the nodes, got", nodes)
+
+	// the read skips the node
+	request, _ := http.NewRequest("GET", "http://example.com/", nil)
+	attempt := &receiveAttempt{request: request}
+	response, ok := server.receiveFrom(attempt, record)
+	test(t, !ok && response == nil, "Expected the blackholed node is skipped")
+
+	// the update is dropped
+	request, _ = http.NewRequest(methodPOST, "http://example.com/", strings.NewReader("update"))
+	_, err = server.RoundTrip(request)
+	se, ok := err.(*statusError)
+	test(t, ok && se.code == http.StatusServiceUnavailable && se.delivery == DeliveryNone,
+		"Expected the update is dropped, got", err)
+	queue, _ := server.queues.check("127.0.0.1:1")
+	test(t, len(queue.jobs) == 0, "Expected the update is not queued, got", len(queue.jobs))
+
+	test(t, server.Nodes.SetBlackhole("127.0.0.1", 1, false), "Expected the node is restored")
+	record, _ = server.Nodes.Get("127.0.0.1", 1)
+	test(t, !record.Blackhole, "Expected the node is not blackholed")
+}
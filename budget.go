@@ -0,0 +1,91 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultBudgetWindow is a sliding window of the retry budget in seconds
+const DefaultBudgetWindow time.Duration = 10
+
+// count of the buckets of the sliding window
+const budgetBuckets = 10
+
+// budgetBucket contains counters of the requests and retries for a part of the window
+type budgetBucket struct {
+	start    time.Time
+	requests int
+	retries  int
+}
+
+// retryBudget limits count of the retries to count of the requests over the sliding window
+type retryBudget struct {
+	mutex   sync.Mutex
+	ratio   float64
+	min     int
+	window  time.Duration
+	buckets [budgetBuckets]budgetBucket
+}
+
+// configure sets parameters of the budget and resets the counters
+func (budget *retryBudget) configure(options RetryBudget) {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+
+	budget.ratio = options.Ratio
+	budget.min = options.Min
+	budget.window = time.Second * options.Window
+	if budget.window <= 0 {
+		budget.window = time.Second * DefaultBudgetWindow
+	}
+	budget.buckets = [budgetBuckets]budgetBucket{}
+}
+
+// request counts the request
+func (budget *retryBudget) request() {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+
+	if budget.ratio > 0 {
+		budget.bucket(time.Now()).requests++
+	}
+}
+
+// retry checks that the budget is not exhausted and counts the retry
+func (budget *retryBudget) retry() bool {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+
+	if budget.ratio <= 0 {
+		return true
+	}
+	now := time.Now()
+	var requests, retries int
+	for _, bucket := range budget.buckets {
+		if now.Sub(bucket.start) < budget.window {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+	if retries >= budget.min && float64(retries+1) > budget.ratio*float64(requests) {
+		return false
+	}
+	budget.bucket(now).retries++
+
+	return true
+}
+
+// bucket returns the bucket for the current time, the expired bucket is reset
+func (budget *retryBudget) bucket(now time.Time) *budgetBucket {
+	size := budget.window / budgetBuckets
+	start := now.Truncate(size)
+	bucket := &budget.buckets[(start.UnixNano()/int64(size))%budgetBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = budgetBucket{start: start}
+	}
+	return bucket
+}
@@ -0,0 +1,26 @@
+package spawn
+
+import "testing"
+
+func TestRetryBudget(t *testing.T) {
+	budget := new(retryBudget)
+
+	// the budget without ratio has no limits
+	budget.request()
+	test(t, budget.retry(), "Expected the retry is allowed, got it is not")
+
+	budget.configure(RetryBudget{Ratio: 0.1, Min: 1})
+	for i := 0; i < 10; i++ {
+		budget.request()
+	}
+
+	// the first retry is allowed by minimum and the ratio
+	test(t, budget.retry(), "Expected the retry is allowed, got it is not")
+	test(t, !budget.retry(), "Expected the retry is not allowed, got it is")
+
+	for i := 0; i < 10; i++ {
+		budget.request()
+	}
+	test(t, budget.retry(), "Expected the retry is allowed, got it is not")
+	test(t, !budget.retry(), "Expected the retry is not allowed, got it is")
+}
@@ -0,0 +1,189 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/takama/router"
+)
+
+// Canary contains the transient weight of the node in percents of its base weight,
+// which is ramped up to 100% during the ramp time, after that the node has normal weight
+type Canary struct {
+	Percent float64       `json:"percent"`
+	Initial float64       `json:"initial"`
+	Ramp    time.Duration `json:"ramp"`
+	Started time.Time     `json:"started-at"`
+}
+
+// percent returns the current percentage of the canary weight
+func (canary *Canary) percent(now time.Time) float64 {
+	if canary.Ramp <= 0 {
+		return canary.Initial
+	}
+	elapsed := now.Sub(canary.Started).Seconds() / (time.Second * canary.Ramp).Seconds()
+	if elapsed >= 1 {
+		return 100
+	}
+	return canary.Initial + (100-canary.Initial)*elapsed
+}
+
+// canary returns the canary state of the node (must be called under lock),
+// the canary which reached 100% is not returned
+func (bundle *NodeBundle) canary(host string, port uint64) *Canary {
+	canary, ok := bundle.canaries[fmt.Sprintf("%s:%d", host, port)]
+	if !ok {
+		return nil
+	}
+	state := *canary
+	state.Percent = canary.percent(time.Now())
+	if state.Percent >= 100 {
+		return nil
+	}
+	return &state
+}
+
+// canaryWeight returns the percentage of the weight of the node in the selection
+func (bundle *NodeBundle) canaryWeight(node Node) float64 {
+	// Lock the bundle for 'read' operation
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	if canary := bundle.canary(node.Host, node.Port); canary != nil {
+		return canary.Percent
+	}
+	return 100
+}
+
+// skipCanary randomly skips the canary node according to its weight
+func (bundle *NodeBundle) skipCanary(node Node) bool {
+	percent := bundle.canaryWeight(node)
+	return percent < 100 && bundle.Server.random.Float64()*100 >= percent
+}
+
+// canaryCumulative returns the cumulative weights where the weights of the canary nodes
+// are reduced according to the canary percentage, if no one of the nodes is canary,
+// the weights are returned as is
+func (bundle *NodeBundle) canaryCumulative(nodes []Node, cumulative []int) []int {
+	// Lock the bundle for 'read' operation
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	if len(bundle.canaries) == 0 {
+		return cumulative
+	}
+	result := make([]int, len(cumulative))
+	total := 0
+	for index, node := range nodes {
+		weight := cumulativeWeight(cumulative, index) * 100
+		if canary := bundle.canary(node.Host, node.Port); canary != nil {
+			weight = int(float64(weight) * canary.Percent / 100)
+		}
+		total += weight
+		result[index] = total
+	}
+	return result
+}
+
+// SetCanary - sets the canary weight of the node which is ramped up during the ramp time in seconds
+func (bundle *NodeBundle) SetCanary(host string, port uint64, percent float64, ramp time.Duration) bool {
+	// Lock the bundle for the transaction processing
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	if _, ok := bundle.records[host][port]; !ok {
+		return false
+	}
+	id := fmt.Sprintf("%s:%d", host, port)
+	if percent >= 100 {
+		delete(bundle.canaries, id)
+		return true
+	}
+	bundle.canaries[id] = &Canary{Initial: percent, Ramp: ramp, Started: time.Now()}
+
+	return true
+}
+
+// DeleteCanary - deletes the canary weight of the node, the node gets normal weight
+func (bundle *NodeBundle) DeleteCanary(host string, port uint64) bool {
+	// Lock the bundle for the transaction processing
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	id := fmt.Sprintf("%s:%d", host, port)
+	if _, ok := bundle.canaries[id]; !ok {
+		return false
+	}
+	delete(bundle.canaries, id)
+
+	return true
+}
+
+// putCanary sets the canary weight of the node specified by host and port
+func (bundle *NodeBundle) putCanary(c *router.Control) {
+	c.UseTimer()
+
+	// Try to decode host
+	host, ok := decodeString(":host", c)
+	if !ok {
+		return
+	}
+
+	// Try to decode port
+	port, ok := decodeNumber(":port", c)
+	if !ok {
+		return
+	}
+
+	// Try to decode canary parameters
+	canary := Canary{Ramp: bundle.Server.Options.CanaryRamp}
+	if !decodeRecord(&canary, bundle.Server.Options.StrictDecoding, c) {
+		return
+	}
+	if canary.Percent < 0 || canary.Percent > 100 {
+		notRecognizedParameterError("percent",
+			fmt.Errorf("%v is out of range [0, 100]", canary.Percent), c)
+		return
+	}
+
+	if !bundle.SetCanary(host, port, canary.Percent, canary.Ramp) {
+		recordNotFound(c)
+		return
+	}
+	record, _ := bundle.Get(host, port)
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"total":   1,
+		"results": []Node{record},
+	})
+}
+
+// deleteCanary deletes the canary weight of the node specified by host and port
+func (bundle *NodeBundle) deleteCanary(c *router.Control) {
+	c.UseTimer()
+
+	// Try to decode host
+	host, ok := decodeString(":host", c)
+	if !ok {
+		return
+	}
+
+	// Try to decode port
+	port, ok := decodeNumber(":port", c)
+	if !ok {
+		return
+	}
+
+	if !bundle.DeleteCanary(host, port) {
+		recordNotFound(c)
+		return
+	}
+
+	c.Code(http.StatusOK).Body(data{"success": true})
+}
@@ -0,0 +1,40 @@
+package spawn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCanary(t *testing.T) {
+	now := time.Now()
+
+	// the canary without ramp keeps its weight
+	canary := &Canary{Initial: 10, Started: now.Add(-time.Hour)}
+	test(t, canary.percent(now) == 10, "Expected 10 percent, got", canary.percent(now))
+
+	// the canary weight is ramped up to 100 percent
+	canary = &Canary{Initial: 10, Ramp: 100, Started: now.Add(-50 * time.Second)}
+	test(t, canary.percent(now) == 55, "Expected 55 percent, got", canary.percent(now))
+	canary.Started = now.Add(-100 * time.Second)
+	test(t, canary.percent(now) == 100, "Expected 100 percent, got", canary.percent(now))
+
+	bundle := &NodeBundle{
+		Server:   &Server{probes: &probeBundle{states: make(map[string]*NodeHealth)}, random: newRandom(1)},
+		records:  map[string]map[uint64]Node{"localhost": {7017: Node{Host: "localhost", Port: 7017}}},
+		canaries: make(map[string]*Canary),
+	}
+	node := Node{Host: "localhost", Port: 7017}
+	test(t, !bundle.SetCanary("unknown", 7017, 10, 0), "Expected the node is not found")
+	test(t, bundle.SetCanary("localhost", 7017, 0, 0), "Expected the canary is set")
+	test(t, bundle.canaryWeight(node) == 0, "Expected zero weight, got", bundle.canaryWeight(node))
+	test(t, bundle.skipCanary(node), "Expected the canary node with zero weight is skipped")
+	record, _ := bundle.Get("localhost", 7017)
+	test(t, record.Canary != nil, "Expected the canary state of the node, got nil")
+
+	// the canary cumulative weights
+	cumulative := bundle.canaryCumulative([]Node{{Host: "other", Port: 1}, node}, []int{1, 2})
+	test(t, cumulative[0] == 100 && cumulative[1] == 100, "Expected weights [100 100], got", cumulative)
+
+	test(t, bundle.DeleteCanary("localhost", 7017), "Expected the canary is deleted")
+	test(t, bundle.canaryWeight(node) == 100, "Expected full weight, got", bundle.canaryWeight(node))
+}
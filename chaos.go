@@ -0,0 +1,125 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/takama/router"
+)
+
+// Chaos contains parameters of the failure injection into the reads for testing of failover,
+// it could be changed by API only if it is enabled at start of the server
+type Chaos struct {
+
+	// the failure injection is enabled, it is defined by command line flag only
+	Enabled bool `json:"-"`
+
+	// percent of the requests which are forced to fail
+	Failure float64 `json:"failure"`
+
+	// percent of the requests which are delayed by latency
+	Delay float64 `json:"delay"`
+
+	// latency of the delayed requests in milliseconds
+	Latency time.Duration `json:"latency"`
+
+	// the nodes (host:port) which are affected, if it is empty, all nodes are affected
+	Nodes []string `json:"nodes"`
+}
+
+// chaosBundle contains the current parameters of the failure injection
+type chaosBundle struct {
+	mutex  sync.RWMutex
+	config Chaos
+	random *random
+}
+
+// set changes the parameters of the failure injection, the enabled flag is not changed
+func (bundle *chaosBundle) set(config Chaos) {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	config.Enabled = bundle.config.Enabled
+	bundle.config = config
+}
+
+// get returns the parameters of the failure injection
+func (bundle *chaosBundle) get() Chaos {
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	return bundle.config
+}
+
+// inject delays the request to the node and returns the error if the request must fail
+func (bundle *chaosBundle) inject(id string) error {
+	config := bundle.get()
+	if !config.Enabled {
+		return nil
+	}
+	if len(config.Nodes) > 0 {
+		affected := false
+		for _, node := range config.Nodes {
+			if node == id {
+				affected = true
+				break
+			}
+		}
+		if !affected {
+			return nil
+		}
+	}
+	if config.Latency > 0 && bundle.random.Float64()*100 < config.Delay {
+		stdlog.Println("Chaos: request to", id, "is delayed by", time.Millisecond*config.Latency)
+		time.Sleep(time.Millisecond * config.Latency)
+	}
+	if bundle.random.Float64()*100 < config.Failure {
+		return fmt.Errorf("Chaos: request to %s is forced to fail", id)
+	}
+	return nil
+}
+
+// getChaos - gets the parameters of the failure injection
+func (server *Server) getChaos(c *router.Control) {
+	c.UseTimer()
+
+	config := server.chaos.get()
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"enabled": config.Enabled,
+		"results": config,
+	})
+}
+
+// putChaos - sets the parameters of the failure injection, if it is enabled
+func (server *Server) putChaos(c *router.Control) {
+	c.UseTimer()
+
+	if !server.chaos.get().Enabled {
+		replyError(c, http.StatusForbidden, data{
+			"success": false,
+			"error":   http.StatusForbidden,
+			"message": "Chaos mode is not enabled",
+			"info":    "Please start the service with chaos mode flag",
+		})
+		return
+	}
+	var config Chaos
+	if !decodeRecord(&config, server.Options.StrictDecoding, c) {
+		return
+	}
+	server.chaos.set(config)
+	stdlog.Println("Chaos: failure", config.Failure, "%, delay", config.Delay,
+		"% by", time.Millisecond*config.Latency, "for nodes", config.Nodes)
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"results": server.chaos.get(),
+	})
+}
@@ -0,0 +1,22 @@
+package spawn
+
+import (
+	"testing"
+)
+
+func TestChaos(t *testing.T) {
+	bundle := &chaosBundle{random: newRandom(0)}
+
+	// the disabled chaos mode could not be enabled by settings
+	bundle.set(Chaos{Enabled: true, Failure: 100})
+	test(t, bundle.inject("localhost:7017") == nil, "Expected no failure in disabled chaos mode")
+
+	bundle.config.Enabled = true
+	bundle.set(Chaos{Failure: 100, Nodes: []string{"localhost:7017"}})
+	test(t, bundle.get().Enabled, "Expected chaos mode is still enabled")
+	test(t, bundle.inject("localhost:7017") != nil, "Expected the failure of the chosen node")
+	test(t, bundle.inject("localhost:7018") == nil, "Expected no failure of other node")
+
+	bundle.set(Chaos{Failure: 0})
+	test(t, bundle.inject("localhost:7017") == nil, "Expected no failure")
+}
@@ -0,0 +1,53 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"net"
+	"strconv"
+)
+
+// HealthChecker checks the liveness of the node instead of the health check by url,
+// it is used by the library users with own liveness logic
+type HealthChecker interface {
+	Check(node Node) bool
+}
+
+// prober returns the probe of the nodes: the health checker, if it is set,
+// or the health check by url
+func (server *Server) prober() func(string) bool {
+	if server.HealthChecker == nil {
+		return server.probeNode
+	}
+	return server.checkByChecker
+}
+
+// checkByChecker checks the node specified by ID (host:port) by the health checker
+func (server *Server) checkByChecker(id string) bool {
+	node, err := server.nodeByID(id)
+	if err != nil {
+		errlog.Println(err)
+		return false
+	}
+	return server.HealthChecker.Check(node)
+}
+
+// nodeByID returns the node specified by ID (host:port), the node which is not
+// in the records yet (e.g. the new node of swap) contains the host and the port only
+func (server *Server) nodeByID(id string) (Node, error) {
+	host, port, err := net.SplitHostPort(id)
+	if err != nil {
+		return Node{}, err
+	}
+	number, err := strconv.ParseUint(port, 10, 64)
+	if err != nil {
+		return Node{}, err
+	}
+	node, ok := server.Nodes.Get(host, number)
+	if !ok {
+		node = Node{Host: host, Port: number}
+	}
+	return node, nil
+}
@@ -0,0 +1,29 @@
+package spawn
+
+import (
+	"testing"
+)
+
+// annotatedChecker reports the nodes as alive by their annotation
+type annotatedChecker struct{}
+
+func (annotatedChecker) Check(node Node) bool {
+	return node.Annotations["alive"] == "true"
+}
+
+func TestHealthChecker(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{
+		{Host: "127.0.0.1", Port: 1, Annotations: Annotations{"alive": "true"}},
+		{Host: "127.0.0.1", Port: 2},
+	})
+	server.job <- responseSignal
+	<-server.response
+
+	server.HealthChecker = annotatedChecker{}
+	test(t, server.checkNode("127.0.0.1:1"), "Expected the node is alive by the health checker")
+	test(t, !server.checkNode("127.0.0.1:2"), "Expected the node is not alive by the health checker")
+	test(t, !server.checkNode("127.0.0.1:3"), "Expected the unknown node is not alive by the health checker")
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Coalesce defines the reads which share one request to the node with the identical concurrent reads,
+// it is applied to GET and HEAD requests only, the response body is kept in memory
+type Coalesce struct {
+	Enabled bool `json:"enabled"`
+
+	// prefixes of the paths of the coalesced requests, if it is empty, all reads are coalesced
+	Prefixes []string `json:"prefixes"`
+
+	// the request headers which are the part of the coalescing key in addition to method and URL
+	Vary []string `json:"vary"`
+}
+
+// flight contains the request to the node which is shared by the identical requests
+type flight struct {
+	done     chan struct{}
+	response *http.Response
+	body     []byte
+	err      error
+}
+
+// coalesceBundle contains the requests to the nodes which are in flight
+type coalesceBundle struct {
+	mutex   sync.Mutex
+	records map[string]*flight
+}
+
+// key returns the coalescing key of the request, empty key means the request is not coalesced,
+// the forwarded Host header is the part of the key
+func (options *Coalesce) key(request *http.Request) string {
+	if !options.Enabled || (request.Method != http.MethodGet && request.Method != http.MethodHead) {
+		return ""
+	}
+	if len(options.Prefixes) > 0 {
+		matched := false
+		for _, prefix := range options.Prefixes {
+			if strings.HasPrefix(request.URL.Path, prefix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return ""
+		}
+	}
+	key := request.Method + " " + request.Host + request.URL.RequestURI()
+	for _, name := range options.Vary {
+		key += "\n" + http.CanonicalHeaderKey(name) + ": " + strings.Join(request.Header[http.CanonicalHeaderKey(name)], ",")
+	}
+	return key
+}
+
+// do runs the request once for all concurrent callers with the same key,
+// every caller gets own copy of the response
+func (bundle *coalesceBundle) do(key string, request *http.Request,
+	fn func() (*http.Response, error)) (*http.Response, error) {
+
+	bundle.mutex.Lock()
+	if f, ok := bundle.records[key]; ok {
+		bundle.mutex.Unlock()
+		<-f.done
+		return f.copy(request)
+	}
+	f := &flight{done: make(chan struct{})}
+	bundle.records[key] = f
+	bundle.mutex.Unlock()
+
+	f.response, f.err = fn()
+	if f.err == nil {
+		f.body, f.err = ioutil.ReadAll(f.response.Body)
+		f.response.Body.Close()
+	}
+
+	bundle.mutex.Lock()
+	delete(bundle.records, key)
+	bundle.mutex.Unlock()
+	close(f.done)
+
+	return f.copy(request)
+}
+
+// copy returns the response of the flight with own body for the request
+func (f *flight) copy(request *http.Request) (*http.Response, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	response := *f.response
+	response.Header = f.response.Header.Clone()
+	response.Body = ioutil.NopCloser(bytes.NewReader(f.body))
+	response.Request = request
+
+	return &response, nil
+}
@@ -0,0 +1,55 @@
+package spawn
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalesce(t *testing.T) {
+	options := Coalesce{Enabled: true, Prefixes: []string{"/catalog/"}, Vary: []string{"Accept"}}
+
+	request, _ := http.NewRequest("GET", "/catalog/1?page=2", nil)
+	request.Header.Set("Accept", "application/json")
+	key := options.key(request)
+	test(t, key == "GET /catalog/1?page=2\nAccept: application/json", "Expected coalescing key, got", key)
+
+	request, _ = http.NewRequest("POST", "/catalog/1", nil)
+	test(t, options.key(request) == "", "Expected the update is not coalesced")
+	request, _ = http.NewRequest("GET", "/users/1", nil)
+	test(t, options.key(request) == "", "Expected the read out of prefixes is not coalesced")
+
+	// concurrent identical reads share one request
+	bundle := &coalesceBundle{records: make(map[string]*flight)}
+	var count int32
+	fn := func() (*http.Response, error) {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(100 * time.Millisecond)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"X-Test": []string{"test"}},
+			Body:       ioutil.NopCloser(strings.NewReader("body")),
+		}, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request, _ := http.NewRequest("GET", "/catalog/1", nil)
+			response, err := bundle.do("key", request, fn)
+			test(t, err == nil, "Expected the response, got", err)
+			body, _ := ioutil.ReadAll(response.Body)
+			test(t, string(body) == "body" && response.Header.Get("X-Test") == "test",
+				"Expected the copy of the response, got", string(body), response.Header)
+			test(t, response.Request == request, "Expected own request of the response")
+		}()
+	}
+	wg.Wait()
+	test(t, count == 1, "Expected one request to the node, got", count)
+	test(t, len(bundle.records) == 0, "Expected no requests in flight, got", len(bundle.records))
+}
@@ -0,0 +1,149 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultCompressMinSize is size in bytes of the smallest API response which is compressed
+const DefaultCompressMinSize = 1024
+
+// Compression defines gzip compression of the API responses for the clients
+// which accept it (Accept-Encoding: gzip)
+type Compression struct {
+	Enabled bool `json:"enabled"`
+
+	// size in bytes of the smallest compressed response (default: 1024),
+	// the smaller responses are sent as is to avoid overhead
+	MinSize int `json:"min-size"`
+
+	// compression level from 1 (best speed) to 9 (best compression), zero value means default level
+	Level int `json:"level"`
+}
+
+// compressWriter keeps the API response in memory until the handler is done,
+// the response is compressed if it is large enough
+type compressWriter struct {
+	http.ResponseWriter
+	buffer bytes.Buffer
+	code   int
+}
+
+// acceptsGzip checks that the client accepts gzip encoding of the response
+func acceptsGzip(request *http.Request) bool {
+	for _, value := range request.Header["Accept-Encoding"] {
+		for _, token := range strings.Split(value, ",") {
+			parts := strings.Split(token, ";")
+			coding := strings.ToLower(strings.TrimSpace(parts[0]))
+			if coding != "gzip" && coding != "*" {
+				continue
+			}
+			accepted := true
+			for _, param := range parts[1:] {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+						accepted = false
+					}
+				}
+			}
+			if accepted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addVary adds the header name to Vary header if it is not there yet
+func addVary(header http.Header, name string) {
+	for _, value := range header["Vary"] {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), name) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", name)
+}
+
+// newCompressWriter returns the writer which compresses the response of the request,
+// nil means the response is not compressed
+func (options *Compression) newCompressWriter(w http.ResponseWriter, request *http.Request) *compressWriter {
+	if !options.Enabled {
+		return nil
+	}
+	addVary(w.Header(), "Accept-Encoding")
+	if request.Method == http.MethodHead || !acceptsGzip(request) {
+		return nil
+	}
+	return &compressWriter{ResponseWriter: w}
+}
+
+// WriteHeader keeps the status code until the response is complete
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.code == 0 {
+		cw.code = code
+	}
+}
+
+// Write keeps the data of the response until it is complete
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+	return cw.buffer.Write(data)
+}
+
+// close sends the response to the client, it is compressed if its size is not less than minimum,
+// the responses which are already encoded or without body are sent as is
+func (cw *compressWriter) close(options *Compression) error {
+	if cw.code == 0 {
+		return nil
+	}
+	minSize := options.MinSize
+	if minSize <= 0 {
+		minSize = DefaultCompressMinSize
+	}
+	header := cw.ResponseWriter.Header()
+	if cw.buffer.Len() >= minSize && header.Get("Content-Encoding") == "" &&
+		cw.code != http.StatusNoContent && cw.code != http.StatusNotModified {
+		// the response is sent as is if it could not be compressed
+		if compressed, err := gzipBytes(cw.buffer.Bytes(), options.Level); err == nil {
+			header.Set("Content-Encoding", "gzip")
+			header.Del("Content-Length")
+			cw.ResponseWriter.WriteHeader(cw.code)
+			_, err = cw.ResponseWriter.Write(compressed)
+			return err
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.code)
+	_, err := cw.ResponseWriter.Write(cw.buffer.Bytes())
+	return err
+}
+
+// gzipBytes returns the data compressed with the level, zero value means default level
+func gzipBytes(data []byte, level int) ([]byte, error) {
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var compressed bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&compressed, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
@@ -0,0 +1,55 @@
+package spawn
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/takama/router"
+)
+
+func TestCompression(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.Options.Compression = Compression{Enabled: true, MinSize: 100}
+
+	r := router.New()
+	r.CustomHandler = server.baseHandler(r)
+	r.GET("/small", func(c *router.Control) { c.Code(http.StatusOK).Body("small") })
+	r.GET("/large", func(c *router.Control) { c.Code(http.StatusOK).Body(strings.Repeat("large", 100)) })
+
+	get := func(path, encoding string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", path, nil)
+		if encoding != "" {
+			request.Header.Set("Accept-Encoding", encoding)
+		}
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, request)
+		test(t, recorder.Code == http.StatusOK, "Expected status 200, got", recorder.Code)
+		test(t, recorder.Header().Get("Vary") == "Accept-Encoding",
+			"Expected Vary header, got", recorder.Header().Get("Vary"))
+		return recorder
+	}
+
+	recorder := get("/large", "deflate, gzip")
+	test(t, recorder.Header().Get("Content-Encoding") == "gzip",
+		"Expected gzip encoding, got", recorder.Header().Get("Content-Encoding"))
+	reader, err := gzip.NewReader(recorder.Body)
+	test(t, err == nil, "Expected gzip reader, got", err)
+	body, err := ioutil.ReadAll(reader)
+	test(t, err == nil, "Expected read compressed body, got", err)
+	test(t, string(body) == strings.Repeat("large", 100), "Expected decompressed body, got", string(body))
+
+	recorder = get("/small", "gzip")
+	test(t, recorder.Header().Get("Content-Encoding") == "", "Expected small response is not compressed")
+	test(t, recorder.Body.String() == "small", "Expected body 'small', got", recorder.Body.String())
+
+	recorder = get("/large", "")
+	test(t, recorder.Header().Get("Content-Encoding") == "", "Expected response is not compressed without gzip")
+
+	recorder = get("/large", "gzip;q=0")
+	test(t, recorder.Header().Get("Content-Encoding") == "", "Expected response is not compressed if gzip is refused")
+}
@@ -0,0 +1,201 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ConnectionStats contains the connections of the server to the node:
+// open connections are active (serving a request) or idle (kept alive in the pool),
+// the reuse rate is the ratio of the requests which got the kept alive connection
+type ConnectionStats struct {
+	ID        string  `json:"id,omitempty"`
+	Open      int64   `json:"open"`
+	Active    int64   `json:"active"`
+	Idle      int64   `json:"idle"`
+	Dialed    uint64  `json:"dialed"`
+	Requests  uint64  `json:"requests"`
+	Reused    uint64  `json:"reused"`
+	ReuseRate float64 `json:"reuse-rate"`
+}
+
+// connectionCounters are updated atomically by the concurrent dials and requests
+type connectionCounters struct {
+	open     int64
+	active   int64
+	dialed   uint64
+	requests uint64
+	reused   uint64
+}
+
+// stats returns the snapshot of the counters
+func (counters *connectionCounters) stats(id string) ConnectionStats {
+	stats := ConnectionStats{
+		ID:       id,
+		Open:     atomic.LoadInt64(&counters.open),
+		Active:   atomic.LoadInt64(&counters.active),
+		Dialed:   atomic.LoadUint64(&counters.dialed),
+		Requests: atomic.LoadUint64(&counters.requests),
+		Reused:   atomic.LoadUint64(&counters.reused),
+	}
+	if stats.Idle = stats.Open - stats.Active; stats.Idle < 0 {
+		stats.Idle = 0
+	}
+	if stats.Requests > 0 {
+		stats.ReuseRate = float64(stats.Reused) / float64(stats.Requests)
+	}
+	return stats
+}
+
+// countedConn is the connection to the node which is counted until it is closed
+type countedConn struct {
+	net.Conn
+	counters *connectionCounters
+	active   int32
+	closed   int32
+}
+
+// setActive marks the connection as serving a request or as idle in the pool
+func (conn *countedConn) setActive(active bool) {
+	if active {
+		if atomic.CompareAndSwapInt32(&conn.active, 0, 1) {
+			atomic.AddInt64(&conn.counters.active, 1)
+		}
+	} else if atomic.CompareAndSwapInt32(&conn.active, 1, 0) {
+		atomic.AddInt64(&conn.counters.active, -1)
+	}
+}
+
+// Close closes the connection, it is counted once regardless of count of the calls
+func (conn *countedConn) Close() error {
+	if atomic.CompareAndSwapInt32(&conn.closed, 0, 1) {
+		conn.setActive(false)
+		atomic.AddInt64(&conn.counters.open, -1)
+	}
+	return conn.Conn.Close()
+}
+
+// connectionBundle contains the counters of the connections by ID of the node (host:port)
+type connectionBundle struct {
+	mutex   sync.Mutex
+	records map[string]*connectionCounters
+}
+
+// counters returns the counters of the node, they are created on the first use
+func (bundle *connectionBundle) counters(id string) *connectionCounters {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	counters, ok := bundle.records[id]
+	if !ok {
+		counters = new(connectionCounters)
+		bundle.records[id] = counters
+	}
+	return counters
+}
+
+// wrap counts the connections which are dialed by the transport
+func (bundle *connectionBundle) wrap(transport *http.Transport) {
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		counters := bundle.counters(address)
+		atomic.AddUint64(&counters.dialed, 1)
+		atomic.AddInt64(&counters.open, 1)
+		return &countedConn{Conn: conn, counters: counters}, nil
+	}
+}
+
+// trace returns the request which counts the requests and the reuse of the connections,
+// the connection is active from getting it until it is returned to the pool or closed
+func (bundle *connectionBundle) trace(request *http.Request) *http.Request {
+	var mutex sync.Mutex
+	var got *countedConn
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			conn, ok := info.Conn.(*countedConn)
+			if !ok {
+				return
+			}
+			atomic.AddUint64(&conn.counters.requests, 1)
+			if info.Reused {
+				atomic.AddUint64(&conn.counters.reused, 1)
+			}
+			conn.setActive(true)
+			mutex.Lock()
+			got = conn
+			mutex.Unlock()
+		},
+		PutIdleConn: func(err error) {
+			mutex.Lock()
+			conn := got
+			mutex.Unlock()
+			if conn != nil && err == nil {
+				conn.setActive(false)
+			}
+		},
+	}
+	return request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+}
+
+// info returns the connections of the node specified by ID
+func (bundle *connectionBundle) info(id string) (ConnectionStats, bool) {
+	bundle.mutex.Lock()
+	counters, ok := bundle.records[id]
+	bundle.mutex.Unlock()
+	if !ok {
+		return ConnectionStats{}, false
+	}
+	return counters.stats(id), true
+}
+
+// infoAll returns the connections of all the nodes sorted by ID
+func (bundle *connectionBundle) infoAll() []ConnectionStats {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	connections := make([]ConnectionStats, 0, len(bundle.records))
+	for id, counters := range bundle.records {
+		connections = append(connections, counters.stats(id))
+	}
+	sort.Sort(byConnectionID(connections))
+	return connections
+}
+
+// byConnectionID type defines specially for sorting of the connections by ID
+type byConnectionID []ConnectionStats
+
+func (bc byConnectionID) Len() int {
+	return len(bc)
+}
+func (bc byConnectionID) Swap(i, j int) {
+	bc[i], bc[j] = bc[j], bc[i]
+}
+func (bc byConnectionID) Less(i, j int) bool {
+	return bc[i].ID < bc[j].ID
+}
+
+// connectionStats returns the connections of the node specified by ID, nil if there were no connections
+func (server *Server) connectionStats(id string) *ConnectionStats {
+	stats, ok := server.connections.info(id)
+	if !ok {
+		return nil
+	}
+	stats.ID = ""
+	return &stats
+}
@@ -0,0 +1,85 @@
+package spawn
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/takama/router"
+)
+
+func TestConnections(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer node.Close()
+	id := node.Listener.Addr().String()
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	transport := newBackendTransport(Backend{}, nil, nil)
+	server.connections.wrap(transport)
+	server.transport = transport
+	test(t, server.connectionStats(id) == nil, "Expected no connections before the requests")
+
+	get := func() {
+		request, _ := http.NewRequest("GET", node.URL+"/", nil)
+		response, err := server.roundTripNode(request, 0, time.Time{})
+		test(t, err == nil, "Expected the request is served, got", err)
+		ioutil.ReadAll(response.Body)
+		response.Body.Close()
+	}
+	waitIdle := func() *ConnectionStats {
+		for i := 0; i < 100; i++ {
+			if stats := server.connectionStats(id); stats != nil && stats.Active == 0 {
+				return stats
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return server.connectionStats(id)
+	}
+
+	// the sequential requests reuse the kept alive connection
+	for i := 0; i < 5; i++ {
+		get()
+		waitIdle()
+	}
+	stats := waitIdle()
+	test(t, stats.Dialed == 1 && stats.Open == 1 && stats.Idle == 1,
+		"Expected 1 idle connection, got", stats.Dialed, stats.Open, stats.Idle)
+	test(t, stats.Requests == 5 && stats.Reused == 4, "Expected 4 of 5 requests reused, got",
+		stats.Requests, stats.Reused)
+
+	// the counts are consistent after the concurrent dials
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			get()
+		}()
+	}
+	wg.Wait()
+	stats = waitIdle()
+	test(t, stats.Requests == 25, "Expected 25 requests, got", stats.Requests)
+	test(t, stats.Active == 0 && stats.Open == stats.Idle, "Expected no active connections, got", stats.Active)
+
+	// the closed connections are not counted as open
+	transport.CloseIdleConnections()
+	for i := 0; i < 100 && server.connectionStats(id).Open > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats = server.connectionStats(id)
+	test(t, stats.Open == 0 && stats.Idle == 0, "Expected no open connections, got", stats.Open, stats.Idle)
+
+	// the connections are shown by the metrics
+	request, _ := http.NewRequest("GET", "/metrics", nil)
+	recorder := httptest.NewRecorder()
+	server.Metrics.getMetrics(&router.Control{Request: request, Writer: recorder})
+	test(t, strings.Contains(recorder.Body.String(), "CONNECTIONS") && strings.Contains(recorder.Body.String(), id),
+		"Expected the connections in the metrics, got", recorder.Body.String())
+}
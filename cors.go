@@ -0,0 +1,83 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/takama/router"
+)
+
+// DefaultCORSMaxAge is time in seconds of caching of the preflight responses by the browsers
+const DefaultCORSMaxAge time.Duration = 600
+
+// CORS defines the cross-origin policy of the API for the browser-based clients
+type CORS struct {
+
+	// the allowed origins, "*" allows any origin,
+	// if it is empty, the origin of the request is allowed
+	Origins []string `json:"origins"`
+
+	// the request headers which are allowed in addition to Content-Type and Authorization
+	Headers []string `json:"headers"`
+
+	// time in seconds of caching of the preflight responses (default: 600)
+	MaxAge time.Duration `json:"max-age"`
+
+	// the requests with credentials (cookies) are allowed
+	Credentials bool `json:"credentials"`
+}
+
+// allowOrigin checks that the origin is allowed by the policy
+func (policy *CORS) allowOrigin(origin string) bool {
+	if len(policy.Origins) == 0 {
+		return true
+	}
+	for _, allowed := range policy.Origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedMethods returns the sorted methods of the registered routes of the path
+func allowedMethods(r *router.Router, path string) []string {
+	methods := r.AllowedMethods(path)
+	sort.Strings(methods)
+	return methods
+}
+
+// setCORS sets the headers of the cross-origin policy, the preflight request
+// gets the allowed methods and headers of the path
+func (server *Server) setCORS(r *router.Router, c *router.Control) {
+	header := c.Writer.Header()
+	if c.Request.Method == http.MethodOptions {
+		header.Set("Allow", strings.Join(allowedMethods(r, c.Request.URL.Path), ", "))
+	}
+	origin := c.Request.Header.Get("Origin")
+	policy := server.Options.CORS
+	if origin == "" || !policy.allowOrigin(origin) {
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	header.Set("Access-Control-Allow-Credentials", strconv.FormatBool(policy.Credentials))
+	header.Add("Vary", "Origin")
+	if c.Request.Method != http.MethodOptions || c.Request.Header.Get("Access-Control-Request-Method") == "" {
+		return
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(allowedMethods(r, c.Request.URL.Path), ", "))
+	header.Set("Access-Control-Allow-Headers",
+		strings.Join(append([]string{"Content-Type", "Authorization"}, policy.Headers...), ", "))
+	maxAge := policy.MaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultCORSMaxAge
+	}
+	header.Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge)))
+}
@@ -0,0 +1,51 @@
+package spawn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/takama/router"
+)
+
+func TestCORS(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.Options.CORS = CORS{Origins: []string{"https://admin.example.com"}, Headers: []string{"X-Requested-With"}}
+
+	r := router.New()
+	r.CustomHandler = server.baseHandler(r)
+	r.GET("/nodes", func(c *router.Control) { c.Code(http.StatusOK).Body(data{"success": true}) })
+	r.PUT("/nodes", func(c *router.Control) { c.Code(http.StatusOK).Body(data{"success": true}) })
+	r.OPTIONS("/nodes", optionsHandler)
+
+	preflight := func(origin string) http.Header {
+		request, _ := http.NewRequest("OPTIONS", "/nodes", nil)
+		request.Header.Set("Origin", origin)
+		request.Header.Set("Access-Control-Request-Method", "PUT")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, request)
+		test(t, recorder.Code == http.StatusOK, "Expected status 200, got", recorder.Code)
+		return recorder.Header()
+	}
+
+	header := preflight("https://admin.example.com")
+	test(t, header.Get("Allow") == "GET, OPTIONS, PUT", "Expected allowed methods, got", header.Get("Allow"))
+	test(t, header.Get("Access-Control-Allow-Origin") == "https://admin.example.com",
+		"Expected allowed origin, got", header.Get("Access-Control-Allow-Origin"))
+	test(t, header.Get("Access-Control-Allow-Methods") == "GET, OPTIONS, PUT",
+		"Expected allowed methods, got", header.Get("Access-Control-Allow-Methods"))
+	test(t, header.Get("Access-Control-Allow-Headers") == "Content-Type, Authorization, X-Requested-With",
+		"Expected allowed headers, got", header.Get("Access-Control-Allow-Headers"))
+	test(t, header.Get("Access-Control-Max-Age") == "600", "Expected max age, got", header.Get("Access-Control-Max-Age"))
+
+	// the origin which is not allowed
+	header = preflight("https://other.example.com")
+	test(t, header.Get("Access-Control-Allow-Origin") == "", "Expected the origin is not allowed")
+
+	// any origin is allowed by default
+	server.Options.CORS = CORS{}
+	header = preflight("https://other.example.com")
+	test(t, header.Get("Access-Control-Allow-Origin") == "https://other.example.com",
+		"Expected the origin of the request, got", header.Get("Access-Control-Allow-Origin"))
+}
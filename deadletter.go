@@ -0,0 +1,204 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/takama/router"
+)
+
+// DefaultDeadLetterSize is maximum count of the dead letters of the node
+const DefaultDeadLetterSize = 1000
+
+// DeadLetter defines the store of the updates which are not delivered to the node
+// (dispatch failed, answered by 5xx status or abandoned by the readiness timeout),
+// the updates are kept in memory until they are replayed or the service is restarted
+type DeadLetter struct {
+	Enabled bool `json:"enabled"`
+
+	// maximum count of the dead letters of the node, the oldest ones are dropped (default: 1000)
+	Size int `json:"size"`
+}
+
+// ReplayResult is the result of the replay of the dead letters of the node,
+// the updates which are not answered in time are pending in the queue of the node
+type ReplayResult struct {
+	Node      string `json:"node"`
+	Total     int    `json:"total"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	Pending   int    `json:"pending"`
+}
+
+// deadLetter is the update which is not delivered to the node
+type deadLetter struct {
+	method string
+	data   []byte
+	body   *spool
+}
+
+// deadLetterBundle contains the dead letters of the nodes in order of their arrival
+type deadLetterBundle struct {
+	mutex   sync.Mutex
+	records map[string][]deadLetter
+}
+
+// add keeps the update which is not delivered to the node specified by ID (host:port),
+// the body of the update is held until the letter is replayed or dropped
+func (bundle *deadLetterBundle) add(id string, letter deadLetter, size int) {
+	if size <= 0 {
+		size = DefaultDeadLetterSize
+	}
+	if letter.body != nil {
+		letter.body.hold()
+	}
+
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	letters := append(bundle.records[id], letter)
+	if len(letters) > size {
+		for _, dropped := range letters[:len(letters)-size] {
+			if dropped.body != nil {
+				dropped.body.release()
+			}
+		}
+		errlog.Println(len(letters)-size, "oldest dead letter(s) of", id, "are dropped")
+		letters = letters[len(letters)-size:]
+	}
+	bundle.records[id] = letters
+}
+
+// take removes and returns all dead letters of the node specified by ID (host:port)
+func (bundle *deadLetterBundle) take(id string) []deadLetter {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	letters := bundle.records[id]
+	delete(bundle.records, id)
+	return letters
+}
+
+// deadLetter keeps the update which is not delivered to the node, if the store is enabled
+func (server *Server) deadLetter(id string, job *queueJob, data []byte) {
+	if !server.Options.DeadLetter.Enabled {
+		return
+	}
+	server.deadLetters.add(id, deadLetter{method: job.method, data: data, body: job.body},
+		server.Options.DeadLetter.Size)
+}
+
+// errReplayUnavailable is returned when the dead letters could not be replayed,
+// because the node is not active or its worker is not running
+var errReplayUnavailable = &statusError{
+	code:    http.StatusConflict,
+	message: "The node is inactive, in maintenance or its worker is not running, the dead letters are kept",
+}
+
+// replay enqueues the dead letters of the node in order of their arrival
+// and waits for their results while the node answers within the response timeout,
+// the dead letters are kept if the node could not get them
+func (server *Server) replay(node Node) (ReplayResult, error) {
+	id := fmt.Sprintf("%s:%d", node.Host, node.Port)
+	result := ReplayResult{Node: id}
+	queue, ok := server.queues.get(id)
+	if !node.Active || node.Maintenance || !ok || !queue.isWorking() {
+		return result, errReplayUnavailable
+	}
+	letters := server.deadLetters.take(id)
+	result.Total = len(letters)
+	if len(letters) == 0 {
+		return result, nil
+	}
+
+	// the responses of the replayed updates are not answered to anyone
+	ignored := make(chan struct{}, 1)
+	ignored <- struct{}{}
+	outcomes := make(chan updateOutcome, len(letters))
+	for _, letter := range letters {
+		// set metrics
+		server.Metrics.SetMetrics(id, queuedMetric, letter.method)
+
+		job := &queueJob{
+			done:    ignored,
+			query:   make(chan []byte, 1),
+			method:  letter.method,
+			answer:  make(chan *http.Response, 1),
+			outcome: outcomes,
+			maxRPS:  node.MaxRPS,
+			timeout: time.Millisecond * node.Timeout,
+			scheme:  node.scheme(),
+			body:    letter.body,
+		}
+		job.query <- letter.data
+		queue.enqueue(job)
+	}
+
+	wait := time.Second * server.getResponseTimeout()
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	for count := 0; count < len(letters); count++ {
+		select {
+		case outcome := <-outcomes:
+			if outcome.err == nil && outcome.status < http.StatusInternalServerError {
+				result.Succeeded++
+			} else {
+				result.Failed++
+			}
+			if !timeout.Stop() {
+				<-timeout.C
+			}
+			timeout.Reset(wait)
+		case <-timeout.C:
+			result.Pending = len(letters) - count
+			return result, nil
+		}
+	}
+	return result, nil
+}
+
+// replayRecord - replays the dead letters of the node specified by host and port
+func (server *Server) replayRecord(c *router.Control) {
+	c.UseTimer()
+
+	// Try to decode host
+	host, ok := decodeString(":host", c)
+	if !ok {
+		return
+	}
+
+	// Try to decode port
+	port, ok := decodeNumber(":port", c)
+	if !ok {
+		return
+	}
+
+	node, ok := server.Nodes.Get(host, port)
+	if !ok {
+		recordNotFound(c)
+		return
+	}
+	result, err := server.replay(node)
+	if err != nil {
+		replyError(c, errReplayUnavailable.code, data{
+			"success": false,
+			"error":   errReplayUnavailable.code,
+			"message": "Conflict",
+			"info":    err.Error(),
+		})
+		return
+	}
+	stdlog.Println("replay of", result.Total, "dead letter(s) of node", host, port)
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"total":   1,
+		"results": []ReplayResult{result},
+	})
+}
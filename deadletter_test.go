@@ -0,0 +1,88 @@
+package spawn
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDeadLetterBundle(t *testing.T) {
+	bundle := &deadLetterBundle{records: make(map[string][]deadLetter)}
+	for _, method := range []string{methodPUT, methodPOST, "DELETE"} {
+		bundle.add("127.0.0.1:3001", deadLetter{method: method}, 2)
+	}
+	letters := bundle.take("127.0.0.1:3001")
+	test(t, len(letters) == 2 && letters[0].method == methodPOST && letters[1].method == "DELETE",
+		"Expected the oldest dead letter is dropped, got", letters)
+	test(t, len(bundle.take("127.0.0.1:3001")) == 0, "Expected the dead letters are taken")
+}
+
+func TestReplay(t *testing.T) {
+	var broken, received int32
+	atomic.StoreInt32(&broken, 1)
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/check" {
+			return
+		}
+		switch atomic.LoadInt32(&broken) {
+		case 1:
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		case 2:
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		atomic.AddInt32(&received, 1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer node.Close()
+	host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+	number, _ := strconv.ParseUint(port, 10, 64)
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.responseTimeout = 5
+	server.check.URL = "/check"
+	server.Options.DeadLetter.Enabled = true
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: host, Port: number, Active: true}})
+	server.job <- responseSignal
+	<-server.response
+
+	for i := 0; i < 2; i++ {
+		request, err := http.NewRequest(methodPOST, "http://example.com/", strings.NewReader("update"))
+		test(t, err == nil, "Expected create a new request, got", err)
+		_, err = server.RoundTrip(request)
+		test(t, err != nil, "Expected the update is not delivered")
+	}
+
+	// the update which is failed by the node is kept also
+	atomic.StoreInt32(&broken, 2)
+	request, _ := http.NewRequest(methodPOST, "http://example.com/", strings.NewReader("update"))
+	response, err := server.RoundTrip(request)
+	test(t, err == nil && response.StatusCode == http.StatusInternalServerError, "Expected status 500, got", err)
+	response.Body.Close()
+
+	// the dead letters are kept while the node is inactive
+	_, err = server.replay(Node{Host: host, Port: number})
+	test(t, err == errReplayUnavailable, "Expected the replay to inactive node is rejected, got", err)
+	_, err = server.replay(Node{Host: "127.0.0.1", Port: 1, Active: true})
+	test(t, err == errReplayUnavailable, "Expected the replay to node without worker is rejected, got", err)
+	_, ok := server.queues.get("127.0.0.1:1")
+	test(t, !ok, "Expected the queue is not created by the replay")
+
+	atomic.StoreInt32(&broken, 0)
+	result, err := server.replay(Node{Host: host, Port: number, Active: true})
+	test(t, err == nil && result.Total == 3 && result.Succeeded == 3 && result.Failed == 0 && result.Pending == 0,
+		"Expected the dead letters are replayed, got", result, err)
+	test(t, atomic.LoadInt32(&received) == 3, "Expected the node receives the updates, got", received)
+
+	result, _ = server.replay(Node{Host: host, Port: number, Active: true})
+	test(t, result.Total == 0, "Expected no dead letters after the replay, got", result)
+}
@@ -0,0 +1,127 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HeaderDeadline is the request header which overrides the deadline of the request in milliseconds
+const HeaderDeadline = "X-Spawn-Deadline"
+
+// errDeadline is returned when the deadline of the request is exceeded
+var errDeadline = &statusError{
+	code:    http.StatusGatewayTimeout,
+	message: "The deadline of the request is exceeded",
+}
+
+// errNodeTimeout is returned when the node does not answer within its own response timeout
+var errNodeTimeout = &statusError{
+	code:    http.StatusGatewayTimeout,
+	message: "The node is not answered in time",
+}
+
+// requestDeadline returns the deadline of the request across all attempts to the nodes,
+// the request header takes precedence over the options, zero time means no deadline
+func (server *Server) requestDeadline(request *http.Request) time.Time {
+	timeout := time.Millisecond * server.Options.RequestDeadline
+	if value := request.Header.Get(HeaderDeadline); value != "" {
+		if ms, err := strconv.Atoi(value); err == nil && ms > 0 {
+			timeout = time.Millisecond * time.Duration(ms)
+		} else {
+			errlog.Println("Could not recognize header", HeaderDeadline, value)
+		}
+	}
+
+	// the deadline is not forwarded to the nodes
+	request.Header.Del(HeaderDeadline)
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// cancelBody cancels the request to the node when the body of its response is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *cancelBody) Close() error {
+	defer body.cancel()
+	return body.ReadCloser.Close()
+}
+
+// roundTripUntil sends the request to the node, the request is cancelled if the response
+// is not received until the deadline, the body of the received response is not limited
+func (server *Server) roundTripUntil(request *http.Request, deadline time.Time) (*http.Response, error) {
+	request = server.connections.trace(request)
+	if deadline.IsZero() {
+		return server.transport.RoundTrip(request)
+	}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return nil, errDeadline
+	}
+	ctx, cancel := context.WithCancel(request.Context())
+	timer := time.AfterFunc(remaining, cancel)
+	response, err := server.transport.RoundTrip(request.WithContext(ctx))
+	if !timer.Stop() {
+		if err == nil {
+			response.Body.Close()
+		}
+		cancel()
+		return nil, errDeadline
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	response.Body = &cancelBody{ReadCloser: response.Body, cancel: cancel}
+
+	return response, nil
+}
+
+// roundTripNode sends the request to the node until its response timeout or the deadline
+// of the request, whichever is earlier, zero timeout means the deadline of the request only
+func (server *Server) roundTripNode(request *http.Request, timeout time.Duration, deadline time.Time) (*http.Response, error) {
+	if timeout <= 0 {
+		return server.roundTripUntil(request, deadline)
+	}
+	nodeDeadline := time.Now().Add(timeout)
+	if !deadline.IsZero() && deadline.Before(nodeDeadline) {
+		return server.roundTripUntil(request, deadline)
+	}
+
+	// the timeout of the node fails over to the next node unlike the deadline of the request
+	response, err := server.roundTripUntil(request, nodeDeadline)
+	if err == errDeadline {
+		return nil, errNodeTimeout
+	}
+	return response, err
+}
+
+// responseWait returns time of waiting for the answer to the update: the longest response timeout
+// of the nodes, the nodes without own timeout use the response timeout of the server
+func responseWait(nodes []Node, timeout time.Duration) time.Duration {
+	var wait time.Duration
+	for _, node := range nodes {
+		nodeTimeout := time.Millisecond * node.Timeout
+		if nodeTimeout <= 0 {
+			nodeTimeout = timeout
+		}
+		if nodeTimeout > wait {
+			wait = nodeTimeout
+		}
+	}
+	if wait <= 0 {
+		return timeout
+	}
+	return wait
+}
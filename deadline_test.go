@@ -0,0 +1,113 @@
+package spawn
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestDeadline(t *testing.T) {
+	var attempts int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/check" {
+			return
+		}
+		atomic.AddInt32(&attempts, 1)
+		test(t, r.Header.Get(HeaderDeadline) == "", "Expected the deadline is not forwarded")
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	var nodes []Node
+	for i := 0; i < 2; i++ {
+		node := httptest.NewServer(handler)
+		defer node.Close()
+		host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+		number, _ := strconv.ParseUint(port, 10, 64)
+		nodes = append(nodes, Node{Host: host, Port: number, Active: true})
+	}
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.responseTimeout = 5
+	server.check.URL = "/check"
+	server.Options.RequestDeadline = 5000
+	go server.jobListener()
+	server.Nodes.SetAll(nodes)
+	server.job <- responseSignal
+	<-server.response
+
+	// the read fails after the deadline without the attempt to the second node
+	request, _ := http.NewRequest("GET", "http://example.com/", nil)
+	request.Header.Set(HeaderDeadline, "100")
+	start := time.Now()
+	_, err = server.RoundTrip(request)
+	se, ok := err.(*statusError)
+	test(t, ok && se.code == http.StatusGatewayTimeout, "Expected status 504, got", err)
+	test(t, time.Since(start) < 500*time.Millisecond, "Expected the read is bounded by deadline, got", time.Since(start))
+	test(t, atomic.LoadInt32(&attempts) == 1, "Expected 1 attempt, got", atomic.LoadInt32(&attempts))
+
+	// the update is not answered until the deadline
+	request, _ = http.NewRequest(methodPOST, "http://example.com/", strings.NewReader("update"))
+	request.Header.Set(HeaderDeadline, "100")
+	start = time.Now()
+	_, err = server.RoundTrip(request)
+	se, ok = err.(*statusError)
+	test(t, ok && se.code == http.StatusGatewayTimeout, "Expected status 504, got", err)
+	test(t, time.Since(start) < 500*time.Millisecond, "Expected the update is bounded by deadline, got", time.Since(start))
+}
+
+func TestNodeTimeout(t *testing.T) {
+	test(t, responseWait(nil, 5*time.Second) == 5*time.Second, "Expected the response timeout of the server")
+	test(t, responseWait([]Node{{Timeout: 100}}, 5*time.Second) == 100*time.Millisecond,
+		"Expected the response timeout of the node")
+	test(t, responseWait([]Node{{Timeout: 100}, {}}, 5*time.Second) == 5*time.Second,
+		"Expected the longest response timeout of the nodes")
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/check" {
+			return
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+	var nodes []Node
+	for index, node := range []*httptest.Server{slow, fast} {
+		host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+		number, _ := strconv.ParseUint(port, 10, 64)
+		nodes = append(nodes, Node{Host: host, Port: number, Priority: index + 1, Active: true, Timeout: 100})
+	}
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.responseTimeout = 5
+	server.check.URL = "/check"
+	server.byPriority = true
+	go server.jobListener()
+	server.Nodes.SetAll(nodes)
+	server.job <- responseSignal
+	<-server.response
+
+	// the read fails over from the slow node after its timeout
+	request, _ := http.NewRequest("GET", "http://example.com/", nil)
+	start := time.Now()
+	response, err := server.RoundTrip(request)
+	test(t, err == nil && response.StatusCode == http.StatusOK, "Expected the read fails over to the fast node, got", err)
+	response.Body.Close()
+	test(t, time.Since(start) < 500*time.Millisecond, "Expected the read is bounded by timeout of the node, got", time.Since(start))
+}
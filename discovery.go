@@ -0,0 +1,284 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types of the KV stores which are used for discovery of the nodes
+const (
+	DiscoveryConsul = "consul"
+	DiscoveryEtcd   = "etcd"
+)
+
+// DefaultDiscoveryInterval is time in seconds of polling of the KV store
+const DefaultDiscoveryInterval time.Duration = 10
+
+// Discovery defines the key of the KV store which contains the nodes (JSON array),
+// the nodes are reconciled live when the key is changed
+type Discovery struct {
+
+	// type of the KV store: "consul" or "etcd", if it is empty, the discovery is not used
+	Type string `json:"type"`
+
+	// URL of the KV store (http://127.0.0.1:8500, http://127.0.0.1:2379, etc)
+	Address string `json:"address"`
+
+	// the key which contains the nodes
+	Key string `json:"key"`
+
+	// interval of polling of etcd and wait time of blocking query of consul in seconds (default: 10)
+	Interval time.Duration `json:"interval"`
+}
+
+// kvSource reads the value of the key from the KV store,
+// it is waiting for the change of the value if the index of the previous value is defined
+type kvSource interface {
+	get(ctx context.Context, index uint64) (value []byte, newIndex uint64, err error)
+}
+
+// discovery contains the state of the watching of the KV store
+type discovery struct {
+	source   kvSource
+	interval time.Duration
+	index    uint64
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// newDiscovery creates the discovery according to the options
+func newDiscovery(options Discovery) (*discovery, error) {
+	interval := time.Second * options.Interval
+	if interval <= 0 {
+		interval = time.Second * DefaultDiscoveryInterval
+	}
+	address := strings.TrimRight(options.Address, "/")
+	if address == "" || options.Key == "" {
+		return nil, errors.New("The address and the key of the discovery must be defined")
+	}
+	client := &http.Client{Timeout: interval + 30*time.Second}
+	d := &discovery{interval: interval}
+	switch options.Type {
+	case DiscoveryConsul:
+		d.source = &consulSource{client: client, address: address, key: options.Key, wait: interval}
+	case DiscoveryEtcd:
+		d.source = &etcdSource{client: client, address: address, key: options.Key, interval: interval}
+	default:
+		return nil, fmt.Errorf("Unknown type of the discovery: %s", options.Type)
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+
+	return d, nil
+}
+
+// load reads the nodes from the KV store, changed is false if the value is not changed
+func (d *discovery) load() (nodes []Node, changed bool, err error) {
+	value, index, err := d.source.get(d.ctx, d.index)
+	if err != nil {
+		return
+	}
+	if index == d.index && d.index != 0 {
+		return
+	}
+	d.index = index
+	if len(bytes.TrimSpace(value)) == 0 {
+		err = errors.New("The nodes are not defined in the KV store")
+		return
+	}
+	if err = json.Unmarshal(value, &nodes); err != nil {
+		return
+	}
+
+	return nodes, true, nil
+}
+
+// watchNodes reconciles the nodes with the KV store until the discovery is stopped
+func (server *Server) watchNodes(d *discovery) {
+	for {
+		nodes, changed, err := d.load()
+		select {
+		case <-d.ctx.Done():
+			return
+		default:
+		}
+		if err != nil {
+			errlog.Println("Could not load the nodes from the KV store:", err)
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-time.After(d.interval):
+			}
+			continue
+		}
+		if changed {
+			if server.Nodes.reconcile(nodes) {
+				stdlog.Println("The nodes are reloaded from the KV store")
+			} else {
+				errlog.Println("The nodes in the KV store have incorrect values")
+			}
+		}
+	}
+}
+
+// reconcile replaces the nodes by the new set, the nodes which are not in the set are deleted,
+// the maintenance mode of the existing nodes is kept as local operational override
+func (bundle *NodeBundle) reconcile(nodes []Node) bool {
+	current, _ := bundle.GetAll()
+	existing := make(map[string]Node, len(current))
+	for _, node := range current {
+		existing[fmt.Sprintf("%s:%d", node.Host, node.Port)] = node
+	}
+	updated := make(map[string]bool, len(nodes))
+	for index := range nodes {
+		id := fmt.Sprintf("%s:%d", nodes[index].Host, nodes[index].Port)
+		if node, ok := existing[id]; ok {
+			nodes[index].Maintenance = node.Maintenance
+		}
+		nodes[index].Canary = nil
+		updated[id] = true
+	}
+	if !bundle.SetAll(nodes) {
+		return false
+	}
+	for id, node := range existing {
+		if !updated[id] {
+			bundle.Delete(node.Host, node.Port)
+		}
+	}
+
+	return true
+}
+
+// consulSource reads the key by blocking queries of consul KV HTTP API
+type consulSource struct {
+	client  *http.Client
+	address string
+	key     string
+	wait    time.Duration
+}
+
+func (source *consulSource) get(ctx context.Context, index uint64) ([]byte, uint64, error) {
+	query := url.Values{}
+	query.Set("raw", "")
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", fmt.Sprintf("%ds", int(source.wait/time.Second)))
+	}
+	request, err := http.NewRequest(http.MethodGet,
+		source.address+"/v1/kv/"+strings.TrimLeft(source.key, "/")+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, index, err
+	}
+	response, err := source.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, index, err
+	}
+	defer response.Body.Close()
+	value, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, index, err
+	}
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNotFound {
+		return nil, index, fmt.Errorf("Unexpected status of consul: %s", response.Status)
+	}
+	newIndex, err := strconv.ParseUint(response.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return nil, index, fmt.Errorf("Could not recognize index of consul: %s", err)
+	}
+
+	// the index could go backwards, the next query should not block
+	if newIndex < index {
+		newIndex = 0
+	}
+	if response.StatusCode == http.StatusNotFound {
+		value = nil
+	}
+
+	return value, newIndex, nil
+}
+
+// etcdSource reads the key by polling of etcd v3 JSON gateway
+type etcdSource struct {
+	client   *http.Client
+	address  string
+	key      string
+	interval time.Duration
+
+	// the key has been read at least once
+	polled bool
+}
+
+// etcdRange contains the response of etcd range request
+type etcdRange struct {
+	Kvs []struct {
+		Value       string `json:"value"`
+		ModRevision string `json:"mod_revision"`
+	} `json:"kvs"`
+}
+
+func (source *etcdSource) get(ctx context.Context, index uint64) ([]byte, uint64, error) {
+	for {
+		value, revision, err := source.read(ctx)
+		if err != nil || revision != index || !source.polled {
+			source.polled = source.polled || err == nil
+			return value, revision, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, index, ctx.Err()
+		case <-time.After(source.interval):
+		}
+	}
+}
+
+// read returns the value of the key and its modification revision
+func (source *etcdSource) read(ctx context.Context) ([]byte, uint64, error) {
+	body, err := json.Marshal(data{"key": base64.StdEncoding.EncodeToString([]byte(source.key))})
+	if err != nil {
+		return nil, 0, err
+	}
+	request, err := http.NewRequest(http.MethodPost, source.address+"/v3/kv/range", bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := source.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("Unexpected status of etcd: %s", response.Status)
+	}
+	var result etcdRange
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, 0, err
+	}
+	if len(result.Kvs) == 0 {
+		return nil, 0, nil
+	}
+	value, err := base64.StdEncoding.DecodeString(result.Kvs[0].Value)
+	if err != nil {
+		return nil, 0, err
+	}
+	revision, err := strconv.ParseUint(result.Kvs[0].ModRevision, 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Could not recognize revision of etcd: %s", err)
+	}
+
+	return value, revision, nil
+}
@@ -0,0 +1,112 @@
+package spawn
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// testKV contains the value of the key of the fake KV store
+type testKV struct {
+	mutex sync.Mutex
+	value string
+	index uint64
+}
+
+func (kv *testKV) set(value string) {
+	kv.mutex.Lock()
+	defer kv.mutex.Unlock()
+
+	kv.value = value
+	kv.index++
+}
+
+func TestDiscoveryConsul(t *testing.T) {
+	kv := &testKV{}
+	kv.set(`[{"host": "127.0.0.1", "port": 3001, "active": true}]`)
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kv.mutex.Lock()
+		defer kv.mutex.Unlock()
+		test(t, r.URL.Path == "/v1/kv/spawn/nodes", "Expected path of the key, got", r.URL.Path)
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(kv.index, 10))
+		w.Write([]byte(kv.value))
+	}))
+	defer store.Close()
+
+	d, err := newDiscovery(Discovery{Type: DiscoveryConsul, Address: store.URL, Key: "spawn/nodes"})
+	test(t, err == nil, "Expected create discovery, got", err)
+
+	nodes, changed, err := d.load()
+	test(t, err == nil && changed, "Expected load the nodes, got", err)
+	test(t, len(nodes) == 1 && nodes[0].Port == 3001, "Expected one node, got", nodes)
+
+	// the index is not changed
+	nodes, changed, err = d.load()
+	test(t, err == nil && !changed, "Expected the nodes are not changed, got", nodes, err)
+
+	kv.set(`[{"host": "127.0.0.1", "port": 3001}, {"host": "127.0.0.1", "port": 3002}]`)
+	nodes, changed, err = d.load()
+	test(t, err == nil && changed, "Expected the nodes are changed, got", err)
+	test(t, len(nodes) == 2, "Expected two nodes, got", nodes)
+}
+
+func TestDiscoveryEtcd(t *testing.T) {
+	kv := &testKV{}
+	kv.set(`[{"host": "127.0.0.1", "port": 3001, "active": true}]`)
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kv.mutex.Lock()
+		defer kv.mutex.Unlock()
+		test(t, r.URL.Path == "/v3/kv/range", "Expected range request, got", r.URL.Path)
+		w.Write([]byte(`{"kvs": [{"value": "` + base64.StdEncoding.EncodeToString([]byte(kv.value)) +
+			`", "mod_revision": "` + strconv.FormatUint(kv.index, 10) + `"}]}`))
+	}))
+	defer store.Close()
+
+	d, err := newDiscovery(Discovery{Type: DiscoveryEtcd, Address: store.URL, Key: "spawn/nodes"})
+	test(t, err == nil, "Expected create discovery, got", err)
+
+	nodes, changed, err := d.load()
+	test(t, err == nil && changed, "Expected load the nodes, got", err)
+	test(t, len(nodes) == 1 && nodes[0].Port == 3001, "Expected one node, got", nodes)
+
+	kv.set(`[{"host": "127.0.0.1", "port": 3002}]`)
+	nodes, changed, err = d.load()
+	test(t, err == nil && changed, "Expected the nodes are changed, got", err)
+	test(t, len(nodes) == 1 && nodes[0].Port == 3002, "Expected changed node, got", nodes)
+
+	_, err = newDiscovery(Discovery{Type: "unknown", Address: store.URL, Key: "spawn/nodes"})
+	test(t, err != nil, "Expected unknown type of the discovery is not accepted")
+}
+
+func TestReconcile(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	go server.jobListener()
+
+	server.Nodes.SetAll([]Node{
+		{Host: "127.0.0.1", Port: 3001, Maintenance: true},
+		{Host: "127.0.0.1", Port: 3002},
+	})
+	server.job <- responseSignal
+	<-server.response
+
+	test(t, server.Nodes.reconcile([]Node{
+		{Host: "127.0.0.1", Port: 3001, Priority: 1},
+		{Host: "127.0.0.1", Port: 3003},
+	}), "Expected reconcile the nodes, got incorrect values")
+
+	// Wait of response after the nodes will be updated
+	server.job <- responseSignal
+	<-server.response
+
+	node, ok := server.Nodes.Get("127.0.0.1", 3001)
+	test(t, ok && node.Priority == 1, "Expected the node is updated, got", node)
+	test(t, node.Maintenance, "Expected the maintenance of the node is kept, got", node)
+	_, ok = server.Nodes.Get("127.0.0.1", 3002)
+	test(t, !ok, "Expected the node is deleted")
+	_, ok = server.Nodes.Get("127.0.0.1", 3003)
+	test(t, ok, "Expected the node is added")
+}
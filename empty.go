@@ -0,0 +1,60 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// errEmptyUpdate is returned when the update without body is rejected
+var errEmptyUpdate = &statusError{
+	code:    http.StatusBadRequest,
+	message: "The update without body is rejected",
+	reason:  RejectEmptyUpdate,
+}
+
+// hasBody checks that the request has the body, the body of unknown length
+// is checked by reading of the first byte which is kept in the body
+func hasBody(request *http.Request) bool {
+	if request.Body == nil || request.Body == http.NoBody {
+		return false
+	}
+	if request.ContentLength > 0 {
+		return true
+	}
+	first := make([]byte, 1)
+	n, _ := io.ReadFull(request.Body, first)
+	if n == 0 {
+		return false
+	}
+	request.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(first), request.Body), request.Body}
+
+	return true
+}
+
+// isEmptyUpdate checks that the update (PUT, POST) has no body,
+// DELETE without body is the normal update
+func isEmptyUpdate(request *http.Request) bool {
+	if request.Method != methodPUT && request.Method != methodPOST {
+		return false
+	}
+	return !hasBody(request)
+}
+
+// acceptEmpty returns the nodes which accept the updates without body
+func acceptEmpty(nodes []Node) []Node {
+	var accepted []Node
+	for _, node := range nodes {
+		if !node.RejectEmpty {
+			accepted = append(accepted, node)
+		}
+	}
+	return accepted
+}
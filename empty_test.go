@@ -0,0 +1,51 @@
+package spawn
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHasBody(t *testing.T) {
+	request, _ := http.NewRequest(methodPUT, "http://example.com/", nil)
+	test(t, isEmptyUpdate(request), "Expected the update without body is empty")
+
+	request, _ = http.NewRequest(methodDELETE, "http://example.com/", nil)
+	test(t, !isEmptyUpdate(request), "Expected DELETE without body is not empty update")
+
+	// the body of unknown length
+	reader, writer := io.Pipe()
+	go func() {
+		writer.Write([]byte("data"))
+		writer.Close()
+	}()
+	request, _ = http.NewRequest(methodPOST, "http://example.com/", reader)
+	test(t, !isEmptyUpdate(request), "Expected the update with body of unknown length is not empty")
+	body, _ := ioutil.ReadAll(request.Body)
+	test(t, string(body) == "data", "Expected the body is kept, got", string(body))
+
+	reader, writer = io.Pipe()
+	writer.Close()
+	request, _ = http.NewRequest(methodPOST, "http://example.com/", reader)
+	test(t, isEmptyUpdate(request), "Expected the update with empty body of unknown length is empty")
+}
+
+func TestRejectEmptyUpdates(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: "127.0.0.1", Port: 1, Active: true, RejectEmpty: true}})
+	server.job <- responseSignal
+	<-server.response
+
+	request, _ := http.NewRequest(methodPUT, "http://example.com/", nil)
+	_, err = server.RoundTrip(request)
+	test(t, err == errEmptyUpdate, "Expected the node rejects the update without body, got", err)
+
+	server.Options.RejectEmptyUpdates = true
+	request, _ = http.NewRequest(methodPOST, "http://example.com/", strings.NewReader(""))
+	_, err = server.RoundTrip(request)
+	test(t, err == errEmptyUpdate, "Expected the update without body is rejected, got", err)
+}
@@ -7,7 +7,11 @@ package spawn
 import (
 	"bufio"
 	"encoding/json"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/openprovider/spawn/auth"
 	"github.com/takama/router"
@@ -15,13 +19,19 @@ import (
 
 type entryBundle struct {
 	auth.Auth
+
+	// lockout of the user names and IP addresses after the failed login attempts
+	lockout *lockoutBundle
+
+	// the access list of the API, it defines the trusted reverse proxies of the clients
+	access *APIAccess
 }
 
 // login and gets access through given token
 func (entry *entryBundle) login(c *router.Control) {
 
 	// Try to get username and password from params
-	var username, password, info string
+	var username, password, otp, info, reason string
 
 	if c.Request.Header.Get("Content-type") == "application/json" {
 		params := make(map[string]string)
@@ -32,16 +42,32 @@ func (entry *entryBundle) login(c *router.Control) {
 			if p, ok := params["password"]; ok && len(p) > 0 {
 				password = p
 			}
+			otp = params["otp"]
 		}
 	} else {
 		if err := c.Request.ParseForm(); err == nil {
 			username = c.Request.Form.Get("username")
 			password = c.Request.Form.Get("password")
+			otp = c.Request.Form.Get("otp")
 		}
 	}
 	if len(username) > 0 && len(password) > 0 {
-		token, err := entry.Login(username, password)
+
+		// the user name and IP address are locked out after the failed attempts
+		user, ip := "user:"+username, "ip:"+entry.loginIP(c.Request)
+		if wait := entry.lockout.locked(user, ip); wait > 0 {
+			c.Writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			replyError(c, http.StatusTooManyRequests, data{
+				"success": false,
+				"error":   http.StatusTooManyRequests,
+				"message": "Too many requests",
+				"info":    "Too many failed login attempts, try again later",
+			})
+			return
+		}
+		token, err := entry.Login(username, password, otp)
 		if err == nil {
+			entry.lockout.reset(user)
 			result := data{
 				"success": true,
 				"token":   token,
@@ -50,6 +76,19 @@ func (entry *entryBundle) login(c *router.Control) {
 			return
 		} else {
 			info = err.Error()
+			if failedCredentials(err) {
+				entry.lockout.fail(user, ip)
+			}
+		}
+
+		// the reason helps the client to ask the second factor
+		switch err {
+		case auth.ErrOTPRequired:
+			reason = "otp-required"
+		case auth.ErrInvalidOTP:
+			reason = "otp-invalid"
+		case auth.ErrOTPNotConfigured:
+			reason = "otp-not-configured"
 		}
 	} else {
 		info = "Username/Password is required"
@@ -60,7 +99,31 @@ func (entry *entryBundle) login(c *router.Control) {
 		"message": "Not authorized",
 		"info":    info,
 	}
-	c.Code(http.StatusUnauthorized).Body(result)
+	if reason != "" {
+		result["reason"] = reason
+	}
+	replyError(c, http.StatusUnauthorized, result)
+}
+
+// loginIP returns the address of the client which is locked out after the failed logins,
+// the trusted reverse proxies are skipped as in the access list of the API
+func (entry *entryBundle) loginIP(request *http.Request) string {
+	if entry.access != nil {
+		if ip := entry.access.clientIP(request); ip != nil {
+			return ip.String()
+		}
+	}
+	return remoteHost(request.RemoteAddr)
+}
+
+// failedCredentials checks that the login is failed by the credentials of the user,
+// the first step of two-factor login and the failures of the auth service are not counted
+func failedCredentials(err error) bool {
+	switch err {
+	case auth.ErrUserDoesNotExist, auth.ErrInvalidCredentials, auth.ErrInvalidOTP:
+		return true
+	}
+	return false
 }
 
 // info gets user info by token
@@ -85,7 +148,32 @@ func (entry *entryBundle) info(c *router.Control) {
 		"message": "Not authorized",
 		"info":    "Token is not valid",
 	}
-	c.Code(http.StatusUnauthorized).Body(result)
+	replyError(c, http.StatusUnauthorized, result)
+}
+
+// refresh issues new token and extends the session
+func (entry *entryBundle) refresh(c *router.Control) {
+	// Try to decode token
+	token, ok := decodeString(":token", c)
+	if !ok {
+		return
+	}
+	newToken, err := entry.Refresh(token)
+	if err == nil {
+		result := data{
+			"success": true,
+			"token":   newToken,
+		}
+		c.Code(http.StatusOK).Body(result)
+		return
+	}
+	result := data{
+		"success": false,
+		"error":   http.StatusUnauthorized,
+		"message": "Not authorized",
+		"info":    err.Error(),
+	}
+	replyError(c, http.StatusUnauthorized, result)
 }
 
 // logout user by the token
@@ -109,5 +197,111 @@ func (entry *entryBundle) logout(c *router.Control) {
 		"message": "Not authorized",
 		"info":    err.Error(),
 	}
-	c.Code(http.StatusUnauthorized).Body(result)
+	replyError(c, http.StatusUnauthorized, result)
+}
+
+// logoutUser logs out all sessions of the user, the sessions could be closed
+// by the user himself or by the user who has access to the admin methods
+func (entry *entryBundle) logoutUser(c *router.Control) {
+	// Try to decode user ID
+	uid, ok := decodeString(":uid", c)
+	if !ok {
+		return
+	}
+	if info := entry.Info(requestToken(c.Request)); info == nil || info.UID != uid {
+		if !entry.admin(c) {
+			return
+		}
+	}
+	count, err := entry.LogoutUser(uid)
+	if err == nil {
+		result := data{
+			"success": true,
+			"total":   count,
+		}
+		c.Code(http.StatusOK).Body(result)
+		return
+	}
+	result := data{
+		"success": false,
+		"error":   http.StatusUnauthorized,
+		"message": "Not authorized",
+		"info":    err.Error(),
+	}
+	replyError(c, http.StatusUnauthorized, result)
+}
+
+// sessions gets information about all active sessions
+func (entry *entryBundle) sessions(c *router.Control) {
+	c.UseTimer()
+
+	if !entry.admin(c) {
+		return
+	}
+	sessions := entry.Sessions()
+	result := data{
+		"success": true,
+		"total":   len(sessions),
+		"results": sessions,
+	}
+	c.Code(http.StatusOK).Body(result)
+}
+
+// closeSession closes the session specified by session ID
+func (entry *entryBundle) closeSession(c *router.Control) {
+	if !entry.admin(c) {
+		return
+	}
+	// Try to decode session ID
+	id, ok := decodeString(":id", c)
+	if !ok {
+		return
+	}
+	if err := entry.CloseSession(id); err != nil {
+		recordNotFound(c)
+		return
+	}
+	c.Code(http.StatusOK).Body(data{"success": true})
+}
+
+// admin checks that the request contains the token of the user
+// who has access to the admin methods
+func (entry *entryBundle) admin(c *router.Control) bool {
+	token := requestToken(c.Request)
+	if token == "" || entry.Info(token) == nil {
+		replyError(c, http.StatusUnauthorized, data{
+			"success": false,
+			"error":   http.StatusUnauthorized,
+			"message": "Not authorized",
+			"info":    "Token is not valid",
+		})
+		return false
+	}
+	if !entry.IsAdmin(token) {
+		replyError(c, http.StatusForbidden, data{
+			"success": false,
+			"error":   http.StatusForbidden,
+			"message": "Forbidden",
+			"info":    "Access to the admin methods is denied",
+		})
+		return false
+	}
+	return true
+}
+
+// requestToken returns the token of the request from Authorization header (Bearer)
+// or from the query parameter
+func requestToken(request *http.Request) string {
+	if auth := request.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return request.URL.Query().Get("token")
+}
+
+// remoteHost returns the host of the remote address without port
+func remoteHost(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
 }
@@ -0,0 +1,117 @@
+package spawn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/openprovider/spawn/auth"
+	"github.com/takama/router"
+)
+
+func TestLogoutUser(t *testing.T) {
+	config := &auth.AuthConfig{Type: auth.Static, AdminGroup: "admins", ExpirationTime: 60}
+	config.Settings.Tokens = map[string]auth.StaticUser{
+		"other-token": {UID: "other"},
+		"admin-token": {UID: "admin", Groups: []string{"admins"}},
+	}
+	config.Settings.Users = map[string]auth.StaticUser{"jdoe": {Secret: "secret"}}
+	authService, err := auth.NewAuth(config)
+	test(t, err == nil, "Expected new auth service, got", err)
+	entry := &entryBundle{Auth: authService}
+
+	logout := func(token string) int {
+		request, _ := http.NewRequest("DELETE", "/logout/user/jdoe", nil)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		c := &router.Control{Request: request, Writer: recorder}
+		entry.logoutUser(c.Set(router.Param{Key: ":uid", Value: "jdoe"}))
+		return recorder.Code
+	}
+	token, err := entry.Login("jdoe", "secret", "")
+	test(t, err == nil, "Expected the user is logged in, got", err)
+
+	// the sessions of the user are not closed without the token or by the other user
+	test(t, logout("") == http.StatusUnauthorized, "Expected status 401 without token")
+	test(t, logout("other-token") == http.StatusForbidden, "Expected status 403 for the other user")
+	test(t, entry.Info(token) != nil, "Expected the session of the user is kept")
+
+	// the user closes own sessions
+	test(t, logout(token) == http.StatusOK, "Expected status 200 for the user himself")
+	test(t, entry.Info(token) == nil, "Expected the session of the user is closed")
+
+	// the admin closes the sessions of any user
+	token, _ = entry.Login("jdoe", "secret", "")
+	test(t, logout("admin-token") == http.StatusOK, "Expected status 200 for the admin")
+	test(t, entry.Info(token) == nil, "Expected the session of the user is closed by the admin")
+}
+
+func TestEntryAdmin(t *testing.T) {
+	admin := func(service auth.Auth, token string) int {
+		request, _ := http.NewRequest("GET", "/sessions", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		entry := &entryBundle{Auth: service}
+		entry.sessions(&router.Control{Request: request, Writer: recorder})
+		return recorder.Code
+	}
+
+	// no one is admin without the admin group
+	config := &auth.AuthConfig{Type: auth.Static}
+	config.Settings.Tokens = map[string]auth.StaticUser{"admin-token": {UID: "admin", Groups: []string{"admins"}}}
+	static, err := auth.NewAuth(config)
+	test(t, err == nil, "Expected new auth service, got", err)
+	test(t, admin(static, "admin-token") == http.StatusForbidden, "Expected status 403 without admin group")
+	config.AdminGroup = "admins"
+	test(t, admin(static, "admin-token") == http.StatusOK, "Expected status 200 for the member of admin group")
+
+	// the implicit guest session of LDAP is not admin
+	for _, group := range []string{"", "guest"} {
+		ldap, err := auth.NewAuth(&auth.AuthConfig{Type: auth.LDAP, AdminGroup: group})
+		test(t, err == nil, "Expected new auth service, got", err)
+		test(t, admin(ldap, "guest") == http.StatusForbidden, "Expected status 403 for guest session, got",
+			admin(ldap, "guest"), group)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	config := &auth.AuthConfig{Type: auth.Static}
+	config.Settings.Users = map[string]auth.StaticUser{"jdoe": {Secret: "secret", OTP: "JBSWY3DPEHPK3PXP"}}
+	authService, err := auth.NewAuth(config)
+	test(t, err == nil, "Expected new auth service, got", err)
+	entry := &entryBundle{
+		Auth:    authService,
+		lockout: newLockoutBundle(LoginLimit{Attempts: 2, Window: 60}),
+		access:  &APIAccess{TrustForwarded: true},
+	}
+
+	// the clients are behind the same reverse proxy
+	login := func(username, password, forwarded string) int {
+		form := url.Values{"username": {username}, "password": {password}}
+		request, _ := http.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("X-Forwarded-For", forwarded)
+		request.RemoteAddr = "10.0.0.1:1234"
+		recorder := httptest.NewRecorder()
+		entry.login(&router.Control{Request: request, Writer: recorder})
+		return recorder.Code
+	}
+
+	// the first step of two-factor login is not a failure
+	for i := 0; i < 3; i++ {
+		code := login("jdoe", "secret", "192.0.2.1")
+		test(t, code == http.StatusUnauthorized, "Expected status 401 without one-time password, got", code)
+	}
+
+	// the wrong credentials lock out the client, but not the other clients of the proxy
+	login("unknown", "secret", "192.0.2.2")
+	login("jdoe", "wrong", "192.0.2.2")
+	code := login("other", "secret", "192.0.2.2")
+	test(t, code == http.StatusTooManyRequests, "Expected status 429 for the client, got", code)
+	code = login("other", "secret", "192.0.2.3")
+	test(t, code == http.StatusUnauthorized, "Expected status 401 for the other client, got", code)
+}
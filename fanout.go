@@ -0,0 +1,114 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"net/http"
+)
+
+// HeaderDelivery is the header of the failed update response which contains the delivery to the nodes
+const HeaderDelivery = "X-Spawn-Delivery"
+
+// The values of the delivery header
+const (
+	// the update is not delivered to any node
+	DeliveryNone = "none"
+
+	// the update is delivered to some of the nodes, but the answer is not received in time
+	DeliveryPartial = "partial"
+
+	// no one of the nodes confirmed the delivery in time, the rest are still in progress
+	DeliveryUnknown = "unknown"
+)
+
+// updateOutcome is the result of the delivery of the update to the node
+type updateOutcome struct {
+	node   string
+	status int
+	err    error
+}
+
+// succeeded checks that the node answered the update by successful status (2xx)
+func (outcome updateOutcome) succeeded() bool {
+	return outcome.err == nil && outcome.status >= http.StatusOK && outcome.status < http.StatusMultipleChoices
+}
+
+// fanOutResult collects the outcomes of the update of the nodes
+type fanOutResult struct {
+	total     int
+	delivered int
+	failed    []string
+	outcomes  []updateOutcome
+}
+
+// NodeStatus is the status of the delivery of the update to the node in multi-status response,
+// zero status means the node did not answer
+type NodeStatus struct {
+	Node   string `json:"node"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// add counts the outcome of the node, the update which is answered by unsuccessful status
+// is counted as failed as well as the update which is not answered
+func (result *fanOutResult) add(outcome updateOutcome) {
+	result.outcomes = append(result.outcomes, outcome)
+	if !outcome.succeeded() {
+		result.failed = append(result.failed, outcome.node)
+		return
+	}
+	result.delivered++
+}
+
+// failedAll returns true if the update is not delivered to any node
+func (result *fanOutResult) failedAll() bool {
+	return result.total > 0 && len(result.failed) == result.total
+}
+
+// delivery returns the value of the delivery header according to the collected outcomes
+func (result *fanOutResult) delivery() string {
+	switch {
+	case result.failedAll():
+		return DeliveryNone
+	case result.delivered > 0:
+		return DeliveryPartial
+	}
+	return DeliveryUnknown
+}
+
+// complete returns true if the outcomes of all nodes are collected
+func (result *fanOutResult) complete() bool {
+	return len(result.outcomes) >= result.total
+}
+
+// multiStatusResponse returns 207 Multi-Status response with the statuses of the nodes
+// which the update is queued for, the nodes which did not answer in time have zero status,
+// the update is successful if all nodes answered by successful status (2xx)
+func multiStatusResponse(request *http.Request, targets []string, result fanOutResult) (*http.Response, error) {
+	outcomes := make(map[string]updateOutcome, len(result.outcomes))
+	succeeded := 0
+	for _, outcome := range result.outcomes {
+		outcomes[outcome.node] = outcome
+		if outcome.succeeded() {
+			succeeded++
+		}
+	}
+	statuses := make([]NodeStatus, 0, len(targets))
+	for _, node := range targets {
+		status := NodeStatus{Node: node, Error: "not answered in time"}
+		if outcome, ok := outcomes[node]; ok {
+			status.Status, status.Error = outcome.status, ""
+			if outcome.err != nil {
+				status.Error = outcome.err.Error()
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return jsonResponse(request, http.StatusMultiStatus, data{
+		"success": succeeded == len(targets),
+		"total":   len(statuses),
+		"results": statuses,
+	})
+}
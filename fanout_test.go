@@ -0,0 +1,292 @@
+package spawn
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFanOutResult(t *testing.T) {
+	result := fanOutResult{total: 2}
+	test(t, result.delivery() == DeliveryUnknown, "Expected unknown delivery, got", result.delivery())
+
+	result.add(updateOutcome{node: "127.0.0.1:3001", err: errors.New("failed")})
+	test(t, !result.failedAll(), "Expected the update is not failed on all nodes")
+	test(t, result.delivery() == DeliveryUnknown, "Expected unknown delivery, got", result.delivery())
+
+	result.add(updateOutcome{node: "127.0.0.1:3002", err: errors.New("failed")})
+	test(t, result.failedAll(), "Expected the update is failed on all nodes")
+	test(t, result.delivery() == DeliveryNone, "Expected no delivery, got", result.delivery())
+
+	result = fanOutResult{total: 2}
+	result.add(updateOutcome{node: "127.0.0.1:3001", status: http.StatusOK})
+	test(t, result.delivery() == DeliveryPartial, "Expected partial delivery, got", result.delivery())
+}
+
+func TestFanOutRetry(t *testing.T) {
+	var attempts int32
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/check" {
+			return
+		}
+		// the update is failed by the broken connection
+		atomic.AddInt32(&attempts, 1)
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer node.Close()
+	host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+	number, _ := strconv.ParseUint(port, 10, 64)
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.responseTimeout = 5
+	server.check.URL = "/check"
+	server.Options.FanOut.RetryFailed = true
+	server.Options.FanOut.RetryDelay = 10
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: host, Port: number, Active: true}})
+	server.job <- responseSignal
+	<-server.response
+
+	request, err := http.NewRequest(methodPOST, "http://example.com/", strings.NewReader("update"))
+	test(t, err == nil, "Expected create a new request, got", err)
+	_, err = server.RoundTrip(request)
+	se, ok := err.(*statusError)
+	test(t, ok && se.code == http.StatusBadGateway && se.delivery == DeliveryNone,
+		"Expected the update is not delivered to any node, got", err)
+	test(t, atomic.LoadInt32(&attempts) == 2, "Expected the update is retried once, got attempts", attempts)
+}
+
+func TestFanOutServerErrors(t *testing.T) {
+	var attempts int32
+	var nodes []Node
+	for i := 0; i < 2; i++ {
+		node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/check" {
+				return
+			}
+			atomic.AddInt32(&attempts, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer node.Close()
+		host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+		number, _ := strconv.ParseUint(port, 10, 64)
+		nodes = append(nodes, Node{Host: host, Port: number, Active: true})
+	}
+
+	result := fanOutResult{total: 1}
+	result.add(updateOutcome{node: "127.0.0.1:3001", status: http.StatusInternalServerError})
+	test(t, result.failedAll(), "Expected the update answered by 500 is failed")
+	test(t, result.delivery() == DeliveryNone, "Expected no delivery, got", result.delivery())
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.responseTimeout = 5
+	server.check.URL = "/check"
+	server.Options.FanOut.RetryFailed = true
+	server.Options.FanOut.RetryDelay = 10
+	go server.jobListener()
+	server.Nodes.SetAll(nodes)
+	server.job <- responseSignal
+	<-server.response
+
+	// the update which every node answers by 500 is retried and is not delivered
+	request, err := http.NewRequest(methodPOST, "http://example.com/", strings.NewReader("update"))
+	test(t, err == nil, "Expected create a new request, got", err)
+	response, err := server.RoundTrip(request)
+	if err != nil {
+		t.Fatal("Expected the answer of the node, got", err)
+	}
+	response.Body.Close()
+	test(t, response.StatusCode == http.StatusInternalServerError, "Expected status 500, got", response.StatusCode)
+	test(t, response.Header.Get(HeaderDelivery) == DeliveryNone,
+		"Expected the update is not delivered to any node, got", response.Header.Get(HeaderDelivery))
+	test(t, atomic.LoadInt32(&attempts) == 4, "Expected the update is retried once on every node, got attempts", attempts)
+}
+
+func TestFanOutMultiStatus(t *testing.T) {
+	created := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/check" {
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer created.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/check" {
+			return
+		}
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer broken.Close()
+	var nodes []Node
+	for _, node := range []*httptest.Server{created, broken} {
+		host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+		number, _ := strconv.ParseUint(port, 10, 64)
+		nodes = append(nodes, Node{Host: host, Port: number, Active: true})
+	}
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.responseTimeout = 5
+	server.check.URL = "/check"
+	server.Options.FanOut.WaitForAll = true
+	server.Options.FanOut.MultiStatus = true
+	go server.jobListener()
+	server.Nodes.SetAll(nodes)
+	server.job <- responseSignal
+	<-server.response
+
+	request, err := http.NewRequest(methodPOST, "http://example.com/", strings.NewReader("update"))
+	test(t, err == nil, "Expected create a new request, got", err)
+	response, err := server.RoundTrip(request)
+	test(t, err == nil, "Expected the multi-status response, got", err)
+	defer response.Body.Close()
+	test(t, response.StatusCode == http.StatusMultiStatus, "Expected status 207, got", response.StatusCode)
+
+	var result struct {
+		Success bool         `json:"success"`
+		Total   int          `json:"total"`
+		Results []NodeStatus `json:"results"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	test(t, err == nil, "Expected decode the multi-status response, got", err)
+	test(t, !result.Success && result.Total == 2, "Expected partial delivery to 2 nodes, got", result)
+	for _, status := range result.Results {
+		if status.Node == created.Listener.Addr().String() {
+			test(t, status.Status == http.StatusCreated && status.Error == "", "Expected status 201, got", status)
+		} else {
+			test(t, status.Status == 0 && status.Error != "", "Expected the error of the node, got", status)
+		}
+	}
+}
+
+func TestFanOutMultiStatusFailed(t *testing.T) {
+	failed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/check" {
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failed.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/check" {
+			return
+		}
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer broken.Close()
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.responseTimeout = 5
+	server.check.URL = "/check"
+	server.Options.FanOut.WaitForAll = true
+	server.Options.FanOut.MultiStatus = true
+	go server.jobListener()
+
+	var result struct {
+		Success bool         `json:"success"`
+		Total   int          `json:"total"`
+		Results []NodeStatus `json:"results"`
+	}
+	for _, nodes := range [][]*httptest.Server{{failed}, {broken}} {
+		var records []Node
+		for _, node := range nodes {
+			host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+			number, _ := strconv.ParseUint(port, 10, 64)
+			records = append(records, Node{Host: host, Port: number, Active: true})
+		}
+		server.Nodes.DeleteAll()
+		server.Nodes.SetAll(records)
+		server.job <- responseSignal
+		<-server.response
+
+		request, err := http.NewRequest(methodPOST, "http://example.com/", strings.NewReader("update"))
+		test(t, err == nil, "Expected create a new request, got", err)
+		response, err := server.RoundTrip(request)
+		test(t, err == nil && response.StatusCode == http.StatusMultiStatus,
+			"Expected status 207 if the update is not delivered to any node, got", err)
+		if err != nil {
+			continue
+		}
+		err = json.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		test(t, err == nil, "Expected decode the multi-status response, got", err)
+		test(t, !result.Success && result.Total == 1, "Expected the failed update, got", result)
+	}
+	test(t, len(result.Results) == 1 && result.Results[0].Status == 0 && result.Results[0].Error != "",
+		"Expected the error of the broken node, got", result.Results)
+}
+
+func TestFanOutDeadline(t *testing.T) {
+	var ready, checked, updates int32
+	var nodes []Node
+	for _, late := range []bool{false, true} {
+		late := late
+		node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/check" {
+				// the late node is not ready for updates until the deadline is expired
+				if late && atomic.LoadInt32(&ready) == 0 {
+					return
+				}
+				if late {
+					atomic.AddInt32(&checked, 1)
+				}
+				w.Write([]byte("ready"))
+				return
+			}
+			if late {
+				atomic.AddInt32(&updates, 1)
+			}
+		}))
+		defer node.Close()
+		host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+		number, _ := strconv.ParseUint(port, 10, 64)
+		nodes = append(nodes, Node{Host: host, Port: number, Active: true})
+	}
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.check.URL = "/check"
+	server.check.Pattern = "ready"
+	server.check.Seconds = 1
+	server.Options.FanOut.Deadline = 1
+	go server.jobListener()
+	server.Nodes.SetAll(nodes)
+	server.job <- responseSignal
+	<-server.response
+
+	request, err := http.NewRequest(methodPOST, "http://example.com/", strings.NewReader("update"))
+	test(t, err == nil, "Expected create a new request, got", err)
+	response, err := server.RoundTrip(request)
+	test(t, err == nil, "Expected the update is answered by the ready node, got", err)
+	if response != nil {
+		response.Body.Close()
+	}
+
+	// the late node gets ready after the deadline, the update is aborted
+	time.Sleep(1200 * time.Millisecond)
+	atomic.StoreInt32(&ready, 1)
+	for start := time.Now(); atomic.LoadInt32(&checked) == 0 && time.Since(start) < 3*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	test(t, atomic.LoadInt32(&checked) > 0, "Expected the late node is checked")
+	test(t, atomic.LoadInt32(&updates) == 0, "Expected the update is not delivered after the deadline, got", updates)
+}
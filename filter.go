@@ -0,0 +1,130 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/takama/router"
+)
+
+// NodeFilter defines the nodes which are matched by the settings, nil value matches any node
+type NodeFilter struct {
+	Active      *bool
+	Maintenance *bool
+
+	// the priority of the node is less than or greater than the value
+	PriorityLT *int
+	PriorityGT *int
+}
+
+// parseNodeFilter decodes the filter from the query parameters:
+// active, maintenance, priority_lt and priority_gt,
+// returns false if the query has no filter parameters
+func parseNodeFilter(query url.Values) (filter NodeFilter, ok bool, err error) {
+	for _, name := range []string{"active", "maintenance"} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, false, fmt.Errorf("%s: %s", name, err)
+		}
+		if name == "active" {
+			filter.Active = &flag
+		} else {
+			filter.Maintenance = &flag
+		}
+		ok = true
+	}
+	for _, name := range []string{"priority_lt", "priority_gt"} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		priority, err := strconv.Atoi(value)
+		if err != nil {
+			return filter, false, fmt.Errorf("%s: %s", name, err)
+		}
+		if name == "priority_lt" {
+			filter.PriorityLT = &priority
+		} else {
+			filter.PriorityGT = &priority
+		}
+		ok = true
+	}
+
+	return filter, ok, nil
+}
+
+// match checks that the node is matched by all settings of the filter
+func (filter *NodeFilter) match(node Node) bool {
+	if filter.Active != nil && node.Active != *filter.Active {
+		return false
+	}
+	if filter.Maintenance != nil && node.Maintenance != *filter.Maintenance {
+		return false
+	}
+	if filter.PriorityLT != nil && node.Priority >= *filter.PriorityLT {
+		return false
+	}
+	if filter.PriorityGT != nil && node.Priority <= *filter.PriorityGT {
+		return false
+	}
+	return true
+}
+
+// DeleteMatching - deletes the nodes records which are matched by the filter
+// in one transaction, returns count of the deleted records
+func (bundle *NodeBundle) DeleteMatching(filter NodeFilter) int {
+	// Lock the bundle for the transaction processing
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	// Delete the matched records
+	count := 0
+	transaction := bundle.begin()
+	for host := range bundle.records {
+		for port, node := range bundle.records[host] {
+			if !filter.match(node) {
+				continue
+			}
+			transaction.delete(host, port)
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+
+	// Job done - end of the transaction
+	transaction.commit()
+
+	return count
+}
+
+// deleteMatchingRecords deletes the nodes records which are matched by the filter
+// of the query, the deletion must be confirmed by 'confirm=true' parameter
+func (bundle *NodeBundle) deleteMatchingRecords(c *router.Control, filter NodeFilter) {
+	if c.Request.URL.Query().Get("confirm") != "true" {
+		message := "The deletion of the nodes by filter is not confirmed"
+		replyError(c, http.StatusBadRequest, data{
+			"success": false,
+			"error":   http.StatusBadRequest,
+			"message": message,
+			"info":    "Please add 'confirm=true' parameter to the request",
+		})
+		errlog.Println(message)
+		return
+	}
+
+	count := bundle.DeleteMatching(filter)
+
+	c.Code(http.StatusOK).Body(data{"success": true, "total": count})
+}
@@ -0,0 +1,45 @@
+package spawn
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestDeleteMatching(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{
+		{Host: "127.0.0.1", Port: 1, Active: true, Priority: 1},
+		{Host: "127.0.0.1", Port: 2, Active: false, Priority: 1},
+		{Host: "127.0.0.2", Port: 1, Active: true, Priority: -1},
+		{Host: "127.0.0.2", Port: 2, Active: false, Priority: -1},
+	})
+	server.job <- responseSignal
+	<-server.response
+
+	_, ok, err := parseNodeFilter(url.Values{"active": {"maybe"}})
+	test(t, err != nil, "Expected the incorrect filter is rejected")
+	_, ok, err = parseNodeFilter(url.Values{"confirm": {"true"}})
+	test(t, err == nil && !ok, "Expected no filter, got", err)
+
+	filter, ok, err := parseNodeFilter(url.Values{"active": {"false"}, "priority_lt": {"0"}})
+	test(t, err == nil && ok, "Expected the filter, got", err)
+	count := server.Nodes.DeleteMatching(filter)
+	server.job <- responseSignal
+	<-server.response
+	test(t, count == 1, "Expected 1 deleted node, got", count)
+	_, ok = server.Nodes.Get("127.0.0.2", 2)
+	test(t, !ok, "Expected the matched node is deleted")
+
+	filter, _, _ = parseNodeFilter(url.Values{"active": {"false"}})
+	count = server.Nodes.DeleteMatching(filter)
+	server.job <- responseSignal
+	<-server.response
+	test(t, count == 1, "Expected 1 deleted node, got", count)
+	_, total := server.Nodes.GetAll()
+	test(t, total == 2, "Expected 2 nodes, got", total)
+
+	count = server.Nodes.DeleteMatching(filter)
+	test(t, count == 0, "Expected no deleted nodes, got", count)
+}
@@ -0,0 +1,48 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"net/http"
+)
+
+// The values of the outbound headers which are replaced by the values of the request
+const (
+	// the address of the client without port
+	HeaderValueClientIP = "{client-ip}"
+
+	// the user ID of the token of the request, the header is removed if the token is not valid
+	HeaderValueUID = "{uid}"
+
+	// the value of the same header of the client or the generated ID of the request
+	HeaderValueRequestID = "{request-id}"
+)
+
+// injectHeaders sets the outbound headers of the request which is forwarded to the nodes,
+// the dynamic values replace the headers of the client, so they could not be spoofed
+func (server *Server) injectHeaders(request *http.Request) {
+	for name, value := range server.Options.OutboundHeaders {
+		switch value {
+		case HeaderValueClientIP:
+			value = remoteHost(request.RemoteAddr)
+		case HeaderValueUID:
+			value = ""
+			if token := requestToken(request); token != "" && server.entry != nil {
+				if info := server.entry.Info(token); info != nil {
+					value = info.UID
+				}
+			}
+		case HeaderValueRequestID:
+			if value = request.Header.Get(name); value == "" {
+				value = traceID(16)
+			}
+		}
+		if value == "" {
+			request.Header.Del(name)
+			continue
+		}
+		request.Header.Set(name, value)
+	}
+}
@@ -0,0 +1,42 @@
+package spawn
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/openprovider/spawn/auth"
+)
+
+func TestInjectHeaders(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	config := &auth.AuthConfig{Type: auth.Static}
+	config.Settings.Tokens = map[string]auth.StaticUser{"secret-token": {UID: "jdoe"}}
+	authService, err := auth.NewAuth(config)
+	test(t, err == nil, "Expected new auth service, got", err)
+	server.entry = &entryBundle{Auth: authService}
+	server.Options.OutboundHeaders = map[string]string{
+		"X-Forwarded-Proto": "https",
+		"X-Client-IP":       HeaderValueClientIP,
+		"X-User-ID":         HeaderValueUID,
+		"X-Request-ID":      HeaderValueRequestID,
+	}
+
+	request, _ := http.NewRequest("GET", "http://example.com/", nil)
+	request.RemoteAddr = "192.0.2.1:1234"
+	request.Header.Set("Authorization", "Bearer secret-token")
+	request.Header.Set("X-Client-IP", "10.0.0.1")
+	server.injectHeaders(request)
+	test(t, request.Header.Get("X-Forwarded-Proto") == "https", "Expected static header, got", request.Header)
+	test(t, request.Header.Get("X-Client-IP") == "192.0.2.1", "Expected client IP, got", request.Header.Get("X-Client-IP"))
+	test(t, request.Header.Get("X-User-ID") == "jdoe", "Expected user ID, got", request.Header.Get("X-User-ID"))
+	test(t, len(request.Header.Get("X-Request-ID")) == 32, "Expected generated request ID, got", request.Header)
+
+	// the user ID of the client is removed without valid token, the request ID is kept
+	request, _ = http.NewRequest("GET", "http://example.com/", nil)
+	request.Header.Set("X-User-ID", "admin")
+	request.Header.Set("X-Request-ID", "abc")
+	server.injectHeaders(request)
+	test(t, request.Header.Get("X-User-ID") == "", "Expected user ID is removed, got", request.Header.Get("X-User-ID"))
+	test(t, request.Header.Get("X-Request-ID") == "abc", "Expected request ID of client, got", request.Header)
+}
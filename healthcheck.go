@@ -0,0 +1,107 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/takama/router"
+)
+
+// recheckTimeout is maximum time of waiting for the health checks of the nodes on demand
+const recheckTimeout = 30 * time.Second
+
+// NodeRecheck is the result of the health check of the node on demand,
+// the node which is not checked in time has no health state
+type NodeRecheck struct {
+	Node   string      `json:"node"`
+	Alive  bool        `json:"alive"`
+	Health *NodeHealth `json:"health,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// recheck probes the nodes specified by ID (host:port) regardless of the freshness
+// of the previous results and updates their health state
+func (server *Server) recheck(ids []string, timeout time.Duration) []NodeRecheck {
+	type probeResult struct {
+		index int
+		alive bool
+	}
+	done := make(chan probeResult, len(ids))
+	results := make([]NodeRecheck, len(ids))
+	for index, id := range ids {
+		results[index] = NodeRecheck{Node: id, Error: "The health check is not finished in time"}
+		go func(index int, id string) {
+			server.probes.invalidate(id)
+			done <- probeResult{index: index, alive: server.checkNode(id)}
+		}(index, id)
+	}
+
+	// the results of the probes which are not finished in time are not used
+	expired := time.NewTimer(timeout)
+	defer expired.Stop()
+	for count := 0; count < len(ids); count++ {
+		select {
+		case result := <-done:
+			results[result.index].Alive = result.alive
+			results[result.index].Health = server.probes.health(ids[result.index])
+			results[result.index].Error = ""
+		case <-expired.C:
+			return results
+		}
+	}
+	return results
+}
+
+// recheckAllRecords - probes all nodes and returns their health state
+func (server *Server) recheckAllRecords(c *router.Control) {
+	c.UseTimer()
+
+	nodes, _ := server.Nodes.GetAll()
+	ids := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		ids = append(ids, fmt.Sprintf("%s:%d", node.Host, node.Port))
+	}
+	results := server.recheck(ids, recheckTimeout)
+	stdlog.Println("health check of", len(ids), "node(s) on demand")
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"total":   len(results),
+		"results": results,
+	})
+}
+
+// recheckRecord - probes the node specified by host and port and returns its health state
+func (server *Server) recheckRecord(c *router.Control) {
+	c.UseTimer()
+
+	// Try to decode host
+	host, ok := decodeString(":host", c)
+	if !ok {
+		return
+	}
+
+	// Try to decode port
+	port, ok := decodeNumber(":port", c)
+	if !ok {
+		return
+	}
+
+	if _, ok := server.Nodes.Get(host, port); !ok {
+		recordNotFound(c)
+		return
+	}
+	results := server.recheck([]string{fmt.Sprintf("%s:%d", host, port)}, recheckTimeout)
+	stdlog.Println("health check of node", host, port, "on demand")
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"total":   1,
+		"results": results,
+	})
+}
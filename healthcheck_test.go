@@ -0,0 +1,36 @@
+package spawn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRecheck(t *testing.T) {
+	var probes int32
+	alive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&probes, 1)
+	}))
+	defer alive.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.check = HealthCheck{URL: "/check", Freshness: 60000}
+	id := alive.Listener.Addr().String()
+	test(t, server.checkNode(id), "Expected the node is alive")
+
+	results := server.recheck([]string{id}, time.Second)
+	test(t, len(results) == 1 && results[0].Alive && results[0].Health != nil && results[0].Error == "",
+		"Expected the node is alive, got", results)
+	test(t, atomic.LoadInt32(&probes) == 2, "Expected the node is probed regardless of freshness, got", probes)
+
+	results = server.recheck([]string{slow.Listener.Addr().String()}, 100*time.Millisecond)
+	test(t, len(results) == 1 && !results[0].Alive && results[0].Error != "",
+		"Expected the health check is not finished in time, got", results)
+}
@@ -23,6 +23,61 @@ import (
 // data is a shortcut
 type data map[string]interface{}
 
+// Formats of the error responses
+const (
+	formatJSON = "json"
+	formatText = "text"
+)
+
+// textFormat checks that the client prefers plain text error responses,
+// the format parameter takes precedence over Accept header, JSON is the default
+func textFormat(request *http.Request) bool {
+	switch request.URL.Query().Get("format") {
+	case formatText:
+		return true
+	case formatJSON:
+		return false
+	}
+	for _, accept := range strings.Split(request.Header.Get("Accept"), ",") {
+		if index := strings.Index(accept, ";"); index >= 0 {
+			accept = accept[:index]
+		}
+		switch strings.TrimSpace(accept) {
+		case "text/plain":
+			return true
+		case "application/json", "*/*":
+			return false
+		}
+	}
+	return false
+}
+
+// errorLine returns the concise text of the error response
+func errorLine(code int, message, info string) string {
+	line := strconv.Itoa(code) + " " + message
+	if info != "" {
+		line += ": " + info
+	}
+	return line + "\n"
+}
+
+// replyError writes the error response in the format which is negotiated with the client,
+// the text contains the message, info and reason of the result
+func replyError(c *router.Control, code int, result data) {
+	c.Code(code)
+	if !textFormat(c.Request) {
+		c.Body(result)
+		return
+	}
+	message, _ := result["message"].(string)
+	info, _ := result["info"].(string)
+	line := errorLine(code, message, info)
+	if reason, ok := result["reason"].(string); ok {
+		line = strings.TrimSuffix(line, "\n") + " (" + reason + ")\n"
+	}
+	c.Body(line)
+}
+
 func isAlphaNumeric(str string) bool {
 	isAlphaNum := true
 	for _, b := range str {
@@ -35,11 +90,14 @@ func isAlphaNumeric(str string) bool {
 	return isAlphaNum
 }
 
-func decodeRecord(record interface{}, c *router.Control) bool {
+func decodeRecord(record interface{}, strict bool, c *router.Control) bool {
 	decoder := json.NewDecoder(bufio.NewReader(c.Request.Body))
 	decoder.UseNumber()
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
 	if err := decoder.Decode(&record); err != nil {
-		c.Code(http.StatusBadRequest).Body(data{
+		replyError(c, http.StatusBadRequest, data{
 			"success": false,
 			"error":   http.StatusBadRequest,
 			"message": "Could not recognize parameters",
@@ -52,14 +110,17 @@ func decodeRecord(record interface{}, c *router.Control) bool {
 	return true
 }
 
-func preDecodeRecords(records interface{}, c *router.Control) (*bytes.Buffer, bool) {
+func preDecodeRecords(records interface{}, strict bool, c *router.Control) (*bytes.Buffer, bool) {
 	buffer := bytes.NewBuffer(make([]byte, 0))
 	reader := io.TeeReader(bufio.NewReader(c.Request.Body), buffer)
 	defer c.Request.Body.Close()
 	decoder := json.NewDecoder(reader)
 	decoder.UseNumber()
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
 	if err := decoder.Decode(&records); err != nil {
-		c.Code(http.StatusBadRequest).Body(data{
+		replyError(c, http.StatusBadRequest, data{
 			"success": false,
 			"error":   http.StatusBadRequest,
 			"message": "Could not recognize parameters",
@@ -71,11 +132,14 @@ func preDecodeRecords(records interface{}, c *router.Control) (*bytes.Buffer, bo
 	return buffer, true
 }
 
-func postDecodeRecords(buffer *bytes.Buffer, records interface{}, c *router.Control) bool {
+func postDecodeRecords(buffer *bytes.Buffer, records interface{}, strict bool, c *router.Control) bool {
 	decoder := json.NewDecoder(buffer)
 	decoder.UseNumber()
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
 	if err := decoder.Decode(&records); err != nil {
-		c.Code(http.StatusBadRequest).Body(data{
+		replyError(c, http.StatusBadRequest, data{
 			"success": false,
 			"error":   http.StatusBadRequest,
 			"message": "Could not recognize parameters",
@@ -128,7 +192,7 @@ func checkAlphaNumeric(str string, c *router.Control) bool {
 
 func couldNotBeZero(param string, c *router.Control) {
 	message := "The parameter '" + param + "' could not be zero value"
-	c.Code(http.StatusBadRequest).Body(data{
+	replyError(c, http.StatusBadRequest, data{
 		"success": false,
 		"error":   http.StatusBadRequest,
 		"message": message,
@@ -139,7 +203,7 @@ func couldNotBeZero(param string, c *router.Control) {
 
 func couldNotBeEmpty(param string, c *router.Control) {
 	message := "The parameter '" + param + "' could not be empty"
-	c.Code(http.StatusBadRequest).Body(data{
+	replyError(c, http.StatusBadRequest, data{
 		"success": false,
 		"error":   http.StatusBadRequest,
 		"message": message,
@@ -150,7 +214,7 @@ func couldNotBeEmpty(param string, c *router.Control) {
 
 func notRecognizedParameterError(param string, err error, c *router.Control) {
 	message := "Could not recognize " + strings.Trim(param, " ") + " parameter"
-	c.Code(http.StatusBadRequest).Body(data{
+	replyError(c, http.StatusBadRequest, data{
 		"success": false,
 		"error":   http.StatusBadRequest,
 		"message": message,
@@ -161,7 +225,7 @@ func notRecognizedParameterError(param string, err error, c *router.Control) {
 
 func recordNotFound(c *router.Control) {
 	message := "Record(s) not found"
-	c.Code(http.StatusNotFound).Body(data{
+	replyError(c, http.StatusNotFound, data{
 		"success": false,
 		"error":   http.StatusNotFound,
 		"message": message,
@@ -172,12 +236,17 @@ func recordNotFound(c *router.Control) {
 
 func notFound(c *router.Control) {
 	message := "Method not found for " + c.Request.URL.Path
-	c.Code(http.StatusNotFound).Body(data{
-		"Message": data{
-			"Error":       message,
-			"Information": "Please see list of the methods by using /list",
-		},
-	})
+	info := "Please see list of the methods by using /list"
+	if textFormat(c.Request) {
+		c.Code(http.StatusNotFound).Body(errorLine(http.StatusNotFound, message, info))
+	} else {
+		c.Code(http.StatusNotFound).Body(data{
+			"Message": data{
+				"Error":       message,
+				"Information": info,
+			},
+		})
+	}
 	errlog.Println(message)
 }
 
@@ -202,6 +271,18 @@ func infoHandler(c *router.Control) {
 	})
 }
 
+func versionHandler(c *router.Control) {
+	result := data{
+		"version": VERSION,
+		"date":    DATE,
+		"go":      runtime.Version(),
+	}
+	if COMMIT != "" {
+		result["commit"] = COMMIT
+	}
+	c.Code(http.StatusOK).Body(result)
+}
+
 func logger(c *router.Control) {
 	remoteAddr := c.Request.Header.Get("X-Forwarded-For")
 	if remoteAddr == "" {
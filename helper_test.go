@@ -3,8 +3,13 @@ package spawn
 import (
 	"bufio"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/takama/router"
 )
 
 // loadFixtures - loads fixtures
@@ -37,3 +42,87 @@ func TestIsAlphaNumeric(t *testing.T) {
 	str2 := "abcd1234.%*35_df-12"
 	test(t, !isAlphaNumeric(str2), "Expected "+str2+" is not alpha numeric, got true")
 }
+
+func TestReplyError(t *testing.T) {
+	formats := []struct {
+		url    string
+		accept string
+		text   bool
+	}{
+		{"/nodes", "", false},
+		{"/nodes", "text/plain", true},
+		{"/nodes", "application/json, text/plain", false},
+		{"/nodes", "text/plain;q=0.9, application/json", true},
+		{"/nodes", "*/*", false},
+		{"/nodes?format=text", "application/json", true},
+		{"/nodes?format=json", "text/plain", false},
+	}
+	for _, format := range formats {
+		request, _ := http.NewRequest("GET", format.url, nil)
+		request.Header.Set("Accept", format.accept)
+		test(t, textFormat(request) == format.text, "Expected text format", format.text, "for", format.url, format.accept)
+	}
+
+	request, _ := http.NewRequest("GET", "/nodes?format=text", nil)
+	recorder := httptest.NewRecorder()
+	replyError(&router.Control{Request: request, Writer: recorder}, http.StatusUnauthorized, data{
+		"success": false,
+		"error":   http.StatusUnauthorized,
+		"message": "Not authorized",
+		"info":    "Token is not valid",
+		"reason":  "otp-required",
+	})
+	body := recorder.Body.String()
+	test(t, recorder.Code == http.StatusUnauthorized, "Expected status 401, got", recorder.Code)
+	test(t, body == "401 Not authorized: Token is not valid (otp-required)\n", "Expected text error, got", body)
+
+	request, _ = http.NewRequest("GET", "/nodes", nil)
+	recorder = httptest.NewRecorder()
+	replyError(&router.Control{Request: request, Writer: recorder}, http.StatusNotFound, data{
+		"success": false,
+		"message": "Record(s) not found",
+	})
+	test(t, strings.Contains(recorder.Header().Get("Content-type"), "json"),
+		"Expected JSON error by default, got", recorder.Header().Get("Content-type"))
+}
+
+func TestDecodeRecordStrict(t *testing.T) {
+	decode := func(strict bool) (Node, *httptest.ResponseRecorder, bool) {
+		request, _ := http.NewRequest("PUT", "/nodes/127.0.0.1/80", strings.NewReader(`{"prioirty": 5}`))
+		recorder := httptest.NewRecorder()
+		var node Node
+		ok := decodeRecord(&node, strict, &router.Control{Request: request, Writer: recorder})
+		return node, recorder, ok
+	}
+
+	node, _, ok := decode(false)
+	test(t, ok && node.Priority == 0, "Expected the unknown field is ignored by default")
+
+	_, recorder, ok := decode(true)
+	test(t, !ok, "Expected the unknown field is rejected in strict mode")
+	test(t, recorder.Code == http.StatusBadRequest, "Expected status 400, got", recorder.Code)
+	test(t, strings.Contains(recorder.Body.String(), "prioirty"), "Expected the unknown field in error, got",
+		recorder.Body.String())
+}
+
+func TestDecodeNewRecord(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	decode := func(payload string) Node {
+		request, _ := http.NewRequest("PUT", "/nodes/127.0.0.1/80", strings.NewReader(payload))
+		recorder := httptest.NewRecorder()
+		node := server.Nodes.newRecord()
+		ok := decodeRecord(&node, false, &router.Control{Request: request, Writer: recorder})
+		test(t, ok, "Expected the record is decoded", payload)
+		return node
+	}
+
+	node := decode(`{}`)
+	test(t, !node.Active && node.Priority == 0, "Expected the new node is inactive by default, got", node)
+
+	server.Options.NodeDefaults = NodeDefaults{Active: true, Priority: 3}
+	node = decode(`{"port": 80}`)
+	test(t, node.Active && node.Priority == 3, "Expected the defaults of the new node, got", node)
+	node = decode(`{"active": false, "priority": 0}`)
+	test(t, !node.Active && node.Priority == 0, "Expected the explicit attributes are kept, got", node)
+}
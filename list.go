@@ -10,6 +10,32 @@ import (
 	"github.com/takama/router"
 )
 
+func displayRoot(c *router.Control) {
+	if strings.Contains(c.Request.Header.Get("Accept"), router.MIMEJSON) {
+		c.Body(data{
+			"name": "Spawn Sync Service",
+			"links": data{
+				"list":       "/list",
+				"info":       "/info",
+				"version":    "/version",
+				"metrics":    "/metrics",
+				"rejections": "/metrics/rejections",
+				"queues":     "/queues",
+				"routes":     "/routes",
+				"affinity":   "/affinity",
+				"selftest":   "/selftest",
+			},
+		})
+		return
+	}
+	methods := []string{
+		headerOfMethods,
+		rootLinks,
+	}
+	desc := strings.Join(methods, "")
+	c.Body(desc)
+}
+
 func displayAllMethods(c *router.Control) {
 	methods := []string{
 		headerOfMethods,
@@ -61,6 +87,42 @@ Spawn Sync Service
 The Spawn service used as a HTTP REST sync service, that makes
 clustering mode simpler and easier for most of applications.
 `
+var rootLinks = `
+To see list of the methods, use:
+/list
+
+To see a system status of the service, use:
+/info
+
+To see a version of the service, use:
+/version
+
+To see metrics of the nodes and their connections (open, active, idle, reuse rate), use:
+/metrics
+
+To see counters of the rejected requests by reason, use:
+/metrics/rejections
+
+To see queues of the updates of the nodes with the connections to them, use:
+/queues
+/queues/:host/:port
+
+To see delivery status of the update which is not answered in time (async updates), use:
+/updates/:id
+
+To see routes of the requests to the nodes, use:
+/routes
+
+To see affinity of the networks of the clients to the nodes, use:
+/affinity
+
+To send the test request through the proxy to the node, use:
+/selftest
+
+To see or change (PUT) the response timeout in seconds and the dial timeout
+of the requests and the health checks in milliseconds at runtime, use:
+/config/timeout
+`
 var listOfMethods = `
 Use helpers to see detailed information about specific methods.
 
@@ -102,6 +164,17 @@ Method returns node settings:
 | priority       | number           | Priority value          |
 | active         | boolean          | Node is active          |
 | maintenance    | boolean          | Node is in maintenance  |
+| weight         | number           | Weight of the node      |
+| strict-order   | boolean          | Updates in strict order |
+| primary        | boolean          | Answers the updates     |
+| max-rps        | number           | Requests per second     |
+| timeout        | number           | Response timeout in ms  |
+| tls            | boolean          | Node is used over https |
+| reject-empty   | boolean          | Rejects empty updates   |
+| annotations    | object           | Metadata of the node    |
+| canary         | object           | Canary weight, if used  |
+| health         | object           | State of health checks  |
+| blackhole      | boolean          | All traffic is stopped  |
 +----------------+------------------+-------------------------+
 
 Get nodes settings specified by host
@@ -133,6 +206,42 @@ Get all nodes settings
 
 Method returns all nodes settings:
 See description - Get node settings specified by host and port
+
+The nodes of the hosts which could not be read are omitted,
+the hosts are noted in 'warnings' array of the response
+
+Get primary node
+================
+
++----------------+------------------+-------------------------+
+| Method         | Operation        | URL                     |
++----------------+------------------+-------------------------+
+| Get Primary    | GET              | /nodes/primary          |
++----------------+------------------+-------------------------+
+
+Method returns the active node which is marked as primary
+or the node with the highest priority, if no one is marked:
+See description - Get node settings specified by host and port
+
+Get count of the nodes
+======================
+
++----------------+------------------+-------------------------+
+| Method         | Operation        | URL                     |
++----------------+------------------+-------------------------+
+| Count Nodes    | GET              | /nodes/count            |
++----------------+------------------+-------------------------+
+
+Method returns count of the nodes:
++----------------+------------------+-------------------------+
+| Data           | Type             | Description             |
++----------------+------------------+-------------------------+
+| total          | number           | Count of all nodes      |
+| active         | number           | Active, no maintenance  |
+| maintenance    | number           | Active, in maintenance  |
+| inactive       | number           | Node is not active      |
+| hosts          | object           | Count of nodes by host  |
++----------------+------------------+-------------------------+
 `
 var nodeSetMethods = `
 Set node settings specified by host and port
@@ -160,8 +269,19 @@ Method accepts node settings:
 | priority       | number           | Priority value          | 0             |
 | active         | boolean          | Node is active          | false         |
 | maintenance    | boolean          | Node is in maintenance  | false         |
+| weight         | number           | Weight of the node      | 1             |
+| strict-order   | boolean          | Updates in strict order | false         |
+| primary        | boolean          | Answers the updates     | false         |
+| max-rps        | number           | Requests per second     | 0 (no limits) |
+| timeout        | number           | Response timeout in ms  | 0 (server's)  |
+| tls            | boolean          | Node is used over https | false         |
+| reject-empty   | boolean          | Rejects empty updates   | false         |
+| annotations    | object           | Metadata of the node    | {}            |
 +----------------+------------------+-------------------------+---------------+
 
+The new node is rejected with 507 status if count of the nodes
+would exceed max-nodes (default: 10000)
+
 Set all nodes settings
 ======================
 
@@ -173,6 +293,105 @@ Set all nodes settings
 
 Method accepts all nodes settings:
 See description - Set node settings specified by host and port
+
+Set canary weight of the node specified by host and port
+========================================================
+
++----------------+------------------+---------------------------+
+| Method         | Operation        | URL                       |
++----------------+------------------+---------------------------+
+| Set Canary     | PUT              | /nodes/:host/:port/canary |
+| Delete Canary  | DELETE           | /nodes/:host/:port/canary |
++----------------+------------------+---------------------------+
+
+Method accepts canary settings:
++----------------+------------------+-------------------------+---------------+
+| Parameter      | Type             | Description             | Default value |
++----------------+------------------+-------------------------+---------------+
+| percent        | number           | Percent of node weight  | 0             |
+| ramp           | number           | Seconds to reach 100%   | canary-ramp   |
++----------------+------------------+-------------------------+---------------+
+
+Stop all traffic to the node specified by host and port
+=======================================================
+
++-----------------+------------------+------------------------------+
+| Method          | Operation        | URL                          |
++-----------------+------------------+------------------------------+
+| Set Blackhole   | PUT              | /nodes/:host/:port/blackhole |
+| Delete Blackhole| DELETE           | /nodes/:host/:port/blackhole |
++-----------------+------------------+------------------------------+
+
+The blackholed node is skipped by the reads, the updates for it are dropped
+(counted as dropped in metrics), not queued as in maintenance
+
+Quiesce the node specified by host and port before restart
+==========================================================
+
++-----------------+------------------+------------------------------+
+| Method          | Operation        | URL                          |
++-----------------+------------------+------------------------------+
+| Quiesce         | POST             | /nodes/:host/:port/quiesce   |
++-----------------+------------------+------------------------------+
+
+The node is blackholed and the response is returned when its queue is drained:
+200 means the node is safe to restart, 504 means the queue is not drained
+during quiesce-timeout, the traffic is restored by Delete Blackhole
+
+Promote the node specified by host and port to primary
+======================================================
+
++----------------+------------------+----------------------------+
+| Method         | Operation        | URL                        |
++----------------+------------------+----------------------------+
+| Promote Node   | POST             | /nodes/:host/:port/promote |
++----------------+------------------+----------------------------+
+
+Method marks the node as primary and demotes the former primary node,
+the primary node answers the updates in primary fan-out mode
+
+Swap all nodes with rollback
+============================
+
++----------------+------------------+----------------------------+
+| Method         | Operation        | URL                        |
++----------------+------------------+----------------------------+
+| Swap Nodes     | POST             | /nodes/swap                |
++----------------+------------------+----------------------------+
+
+Method accepts the array of the node settings, replaces all nodes in one
+transaction and checks the health of the new nodes: 200 means the new nodes
+are healthy, 502 means fewer than swap.min-healthy new nodes are healthy
+during swap.timeout and the previous nodes are restored, except the nodes
+changed during the swap, 400 means the empty or incorrect nodes
+
+Replay the updates which are not delivered to the node
+======================================================
+
++----------------+------------------+--------------------------------+
+| Method         | Operation        | URL                            |
++----------------+------------------+--------------------------------+
+| Replay Node    | POST             | /nodes/:host/:port/replay      |
++----------------+------------------+--------------------------------+
+
+Method enqueues the dead letters of the node in order of their arrival and
+returns count of the succeeded, failed and pending updates, the updates
+which fail again are kept as dead letters (dead-letter mode only),
+the node must be active and its worker must be running
+
+Health check of the nodes on demand
+===================================
+
++----------------+------------------+--------------------------------+
+| Method         | Operation        | URL                            |
++----------------+------------------+--------------------------------+
+| Check Nodes    | POST             | /nodes/healthcheck             |
++----------------+------------------+--------------------------------+
+| Check Node     | POST             | /nodes/:host/:port/healthcheck |
++----------------+------------------+--------------------------------+
+
+Method probes the nodes regardless of the freshness of the previous checks,
+updates their health state and returns the results of the probes
 `
 
 var nodeDeleteMethods = `
@@ -221,4 +440,27 @@ Delete all nodes settings
 +----------------+------------------+-------------------------+
 
 Method delete all nodes settings
+
+Delete nodes settings by filter
+===============================
+
++----------------+------------------+-------------------------------------------+
+| Method         | Operation        | URL                                       |
++----------------+------------------+-------------------------------------------+
+| Delete Nodes   | DELETE           | /nodes?active=false&confirm=true          |
++----------------+------------------+-------------------------------------------+
+
++----------------+------------------+-------------------------------------------+
+| Parameter      | Type             | Description                               |
++----------------+------------------+-------------------------------------------+
+| active         | boolean          | Node is active                            |
+| maintenance    | boolean          | Node is in maintenance                    |
+| priority_lt    | number           | Priority of node is less than value       |
+| priority_gt    | number           | Priority of node is greater than value    |
+| confirm        | boolean          | Deletion is confirmed (required)          |
++----------------+------------------+-------------------------------------------+
+
+Method deletes the nodes which are matched by all parameters in one transaction
+and returns count of the deleted nodes in total, the deletion without 'confirm=true'
+is rejected with 400 status
 `
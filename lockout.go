@@ -0,0 +1,125 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultLoginWindow is time in seconds of counting of the failed login attempts
+const DefaultLoginWindow time.Duration = 300
+
+// LoginLimit defines the lockout of the user name and IP address after the failed login attempts,
+// the attempts with wrong credentials are counted only, the address of the client behind
+// the trusted reverse proxies is taken according to the access list of the API
+type LoginLimit struct {
+
+	// count of the failed attempts which locks out the user name or IP address,
+	// zero value means no limits
+	Attempts int `json:"attempts"`
+
+	// time in seconds of counting of the failed attempts (default: 300)
+	Window time.Duration `json:"window"`
+
+	// time in seconds of the lockout (default: the window)
+	Lockout time.Duration `json:"lockout"`
+}
+
+// lockoutRecord contains the failed attempts of the user name or IP address
+type lockoutRecord struct {
+	failures int
+	started  time.Time
+	until    time.Time
+}
+
+// lockoutBundle counts the failed login attempts and locks out the keys which exceed the limit
+type lockoutBundle struct {
+	mutex   sync.Mutex
+	limit   LoginLimit
+	pruned  time.Time
+	records map[string]*lockoutRecord
+}
+
+// newLockoutBundle creates the bundle with the limits where zero values are replaced by defaults
+func newLockoutBundle(limit LoginLimit) *lockoutBundle {
+	if limit.Window <= 0 {
+		limit.Window = DefaultLoginWindow
+	}
+	if limit.Lockout <= 0 {
+		limit.Lockout = limit.Window
+	}
+	return &lockoutBundle{limit: limit, records: make(map[string]*lockoutRecord)}
+}
+
+// locked returns the remaining time of the lockout of any of the keys, zero means not locked
+func (bundle *lockoutBundle) locked(keys ...string) time.Duration {
+	if bundle.limit.Attempts <= 0 {
+		return 0
+	}
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	var remaining time.Duration
+	now := time.Now()
+	for _, key := range keys {
+		if record, ok := bundle.records[key]; ok && record.until.After(now) {
+			if left := record.until.Sub(now); left > remaining {
+				remaining = left
+			}
+		}
+	}
+	return remaining
+}
+
+// fail counts the failed attempt of the keys, the key is locked out when it exceeds the limit
+func (bundle *lockoutBundle) fail(keys ...string) {
+	if bundle.limit.Attempts <= 0 {
+		return
+	}
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	now := time.Now()
+	window := time.Second * bundle.limit.Window
+	bundle.prune(now, window)
+	for _, key := range keys {
+		record, ok := bundle.records[key]
+		if !ok || now.Sub(record.started) > window {
+			record = &lockoutRecord{started: now}
+			bundle.records[key] = record
+		}
+		record.failures++
+		if record.failures >= bundle.limit.Attempts {
+			record.until = now.Add(time.Second * bundle.limit.Lockout)
+			record.failures = 0
+			record.started = now
+			stdlog.Println("Login of", key, "is locked out after failed attempts")
+		}
+	}
+}
+
+// reset deletes the failed attempts of the keys after the successful login
+func (bundle *lockoutBundle) reset(keys ...string) {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	for _, key := range keys {
+		delete(bundle.records, key)
+	}
+}
+
+// prune deletes the expired records once per window (must be called under lock)
+func (bundle *lockoutBundle) prune(now time.Time, window time.Duration) {
+	if now.Sub(bundle.pruned) < window {
+		return
+	}
+	bundle.pruned = now
+	for key, record := range bundle.records {
+		if now.Sub(record.started) > window && !record.until.After(now) {
+			delete(bundle.records, key)
+		}
+	}
+}
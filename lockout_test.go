@@ -0,0 +1,29 @@
+package spawn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockout(t *testing.T) {
+	// no limits
+	bundle := newLockoutBundle(LoginLimit{})
+	for i := 0; i < 10; i++ {
+		bundle.fail("user:test")
+	}
+	test(t, bundle.locked("user:test") == 0, "Expected the user is not locked out without limits")
+
+	bundle = newLockoutBundle(LoginLimit{Attempts: 3, Window: 60, Lockout: 30})
+	bundle.fail("user:test", "ip:127.0.0.1")
+	bundle.fail("user:test", "ip:127.0.0.1")
+	test(t, bundle.locked("user:test", "ip:127.0.0.1") == 0, "Expected the user is not locked out yet")
+
+	// the successful login resets the failures of the user only
+	bundle.reset("user:test")
+	bundle.fail("user:test", "ip:127.0.0.1")
+	test(t, bundle.locked("user:test") == 0, "Expected the user is not locked out after reset")
+	wait := bundle.locked("ip:127.0.0.1")
+	test(t, wait > 29*time.Second && wait <= 30*time.Second, "Expected the IP is locked out for 30s, got", wait)
+	test(t, bundle.locked("user:other", "ip:127.0.0.1") > 0, "Expected any user is locked out from the IP")
+	test(t, bundle.locked("user:other", "ip:127.0.0.2") == 0, "Expected other user and IP are not locked out")
+}
@@ -0,0 +1,62 @@
+package spawn
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHasWorkingNode(t *testing.T) {
+	test(t, !hasWorkingNode(nil), "Expected no working node in the empty list")
+	test(t, !hasWorkingNode([]Node{{Active: false}, {Active: true, Maintenance: true}}),
+		"Expected no working node if the nodes are inactive or in maintenance")
+	test(t, hasWorkingNode([]Node{{Active: true, Maintenance: true}, {Active: true}}),
+		"Expected the active node is working")
+}
+
+func TestMaintenancePolicy(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("maintenance"))
+	}))
+	defer node.Close()
+	host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+	number, _ := strconv.ParseUint(port, 10, 64)
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.check.URL = "/check"
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: host, Port: number, Active: true, Maintenance: true}})
+	server.job <- responseSignal
+	<-server.response
+
+	// the reads are not routed to the node in maintenance by default
+	request, _ := http.NewRequest("GET", "http://example.com/", nil)
+	_, err = server.RoundTrip(request)
+	test(t, err != nil, "Expected the read is not served by the node in maintenance")
+
+	server.Options.Maintenance.ReadFallback = true
+	request, _ = http.NewRequest("GET", "http://example.com/", nil)
+	response, err := server.RoundTrip(request)
+	if err != nil {
+		t.Fatal("Expected the read is served by the node in maintenance, got", err)
+	}
+	data, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	test(t, string(data) == "maintenance", "Expected the response of the node in maintenance, got", string(data))
+
+	server.Options.Maintenance.RejectUpdates = true
+	request, _ = http.NewRequest("POST", "http://example.com/", strings.NewReader("data"))
+	_, err = server.RoundTrip(request)
+	status, ok := err.(*statusError)
+	if !ok {
+		t.Fatal("Expected the update is rejected with status, got", err)
+	}
+	test(t, status.code == http.StatusServiceUnavailable, "Expected status 503, got", status.code)
+	test(t, status.reason == RejectNoNodes, "Expected the reason", RejectNoNodes, "got", status.reason)
+}
@@ -0,0 +1,54 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/takama/router"
+)
+
+// DefaultMaxNodes is maximum count of the nodes records
+const DefaultMaxNodes = 10000
+
+// maxNodes returns maximum count of the nodes records
+func (bundle *NodeBundle) maxNodes() int {
+	if bundle.Server.Options.MaxNodes > 0 {
+		return bundle.Server.Options.MaxNodes
+	}
+	return DefaultMaxNodes
+}
+
+// exceedsMaxNodes checks that count of the nodes records exceeds the limit
+// after the nodes are added (must be called under lock)
+func (bundle *NodeBundle) exceedsMaxNodes(nodes []Node) bool {
+	count := 0
+	for host := range bundle.records {
+		count += len(bundle.records[host])
+	}
+	added := make(map[string]bool)
+	for _, node := range nodes {
+		if _, ok := bundle.records[node.Host][node.Port]; !ok {
+			added[fmt.Sprintf("%s:%d", node.Host, node.Port)] = true
+		}
+	}
+	if count+len(added) > bundle.maxNodes() {
+		errlog.Println("The nodes are not added, count of the nodes would be", count+len(added),
+			"and exceed the limit", bundle.maxNodes())
+		return true
+	}
+	return false
+}
+
+// tooManyNodes replies that the nodes are not added because of the limit of the nodes
+func tooManyNodes(limit int, c *router.Control) {
+	replyError(c, http.StatusInsufficientStorage, data{
+		"success": false,
+		"error":   http.StatusInsufficientStorage,
+		"message": "Too many nodes",
+		"info":    fmt.Sprintf("The count of the nodes is limited by %d, please delete unused nodes", limit),
+	})
+}
@@ -0,0 +1,30 @@
+package spawn
+
+import (
+	"testing"
+)
+
+func TestMaxNodes(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	go server.jobListener()
+	server.Options.MaxNodes = 2
+
+	ok := server.Nodes.SetAll([]Node{{Host: "127.0.0.1", Port: 1}, {Host: "127.0.0.1", Port: 2}})
+	server.job <- responseSignal
+	<-server.response
+	test(t, ok, "Expected the nodes within the limit are added")
+
+	ok = server.Nodes.Set(&Node{Host: "127.0.0.1", Port: 1, Active: true})
+	server.job <- responseSignal
+	<-server.response
+	test(t, ok, "Expected the existing node is updated at the limit")
+
+	test(t, !server.Nodes.Set(&Node{Host: "127.0.0.1", Port: 3}), "Expected the node beyond the limit is rejected")
+	test(t, !server.Nodes.SetAll([]Node{{Host: "127.0.0.2", Port: 1}}), "Expected the nodes beyond the limit are rejected")
+	_, total := server.Nodes.GetAll()
+	test(t, total == 2, "Expected 2 nodes, got", total)
+
+	err = server.swap([]Node{{Host: "127.0.0.1", Port: 1}, {Host: "127.0.0.1", Port: 2}, {Host: "127.0.0.1", Port: 3}})
+	test(t, err == errTooManyNodes, "Expected the swap beyond the limit is rejected, got", err)
+}
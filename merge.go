@@ -0,0 +1,87 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Merge policies of the nodes of the config which conflict with the existing nodes or with each other
+const (
+	// the node of the config replaces the existing node, the last duplicate wins (default)
+	MergeFileWins = "file-wins"
+
+	// the existing node which has been changed at runtime is kept, the last duplicate wins
+	MergeRuntimeWins = "runtime-wins"
+
+	// the nodes are not changed if there are conflicts
+	MergeReject = "reject"
+)
+
+// ConflictError contains the conflicting definitions of the nodes
+type ConflictError struct {
+	Conflicts []string
+}
+
+func (e *ConflictError) Error() string {
+	return "Conflicting definitions of the nodes: " + strings.Join(e.Conflicts, "; ")
+}
+
+// settings returns the node without the state which is defined by the server and API
+func (node Node) settings() Node {
+	node.Canary = nil
+	node.Health = nil
+	node.Blackhole = false
+	return node
+}
+
+// Merge sets the nodes of the config according to the merge policy,
+// the conflicts are the duplicates of the nodes with different settings
+// and the existing nodes which settings differ from the config
+func (bundle *NodeBundle) Merge(nodes []Node, policy string) error {
+	defined := make(map[string]Node, len(nodes))
+	var conflicts []string
+	for _, node := range nodes {
+		node = node.settings()
+		id := fmt.Sprintf("%s:%d", node.Host, node.Port)
+		if previous, ok := defined[id]; ok && !previous.equal(node) {
+			conflicts = append(conflicts, fmt.Sprintf("%s is defined twice: %+v and %+v", id, previous, node))
+		}
+		defined[id] = node
+	}
+
+	var merged []Node
+	for _, node := range nodes {
+		id := fmt.Sprintf("%s:%d", node.Host, node.Port)
+		node, ok := defined[id]
+		if !ok {
+			continue
+		}
+		delete(defined, id)
+		if existing, ok := bundle.Get(node.Host, node.Port); ok && !existing.settings().equal(node) {
+			if policy == MergeRuntimeWins {
+				stdlog.Println("The node", id, "is changed at runtime, the config is skipped")
+				continue
+			}
+			conflicts = append(conflicts, fmt.Sprintf("%s is changed at runtime: %+v, config: %+v",
+				id, existing.settings(), node))
+		}
+		merged = append(merged, node)
+	}
+
+	if policy == MergeReject && len(conflicts) > 0 {
+		return &ConflictError{Conflicts: conflicts}
+	}
+	for _, conflict := range conflicts {
+		stdlog.Println("Merge of the nodes:", conflict)
+	}
+	if !bundle.SetAll(merged) {
+		return errors.New("The config parameters for the nodes have incorrect values or exceed the limit of the nodes")
+	}
+
+	return nil
+}
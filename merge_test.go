@@ -0,0 +1,49 @@
+package spawn
+
+import (
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	go server.jobListener()
+	wait := func() {
+		server.job <- responseSignal
+		<-server.response
+	}
+
+	// the duplicates with different settings are rejected
+	duplicates := []Node{{Host: "localhost", Port: 7017, Priority: 1}, {Host: "localhost", Port: 7017, Priority: 2}}
+	err = server.Nodes.Merge(duplicates, MergeReject)
+	conflict, ok := err.(*ConflictError)
+	test(t, ok && len(conflict.Conflicts) == 1, "Expected the conflict of the duplicates, got", err)
+	_, total := server.Nodes.GetAll()
+	test(t, total == 0, "Expected no nodes, got", total)
+
+	// the last duplicate wins
+	test(t, server.Nodes.Merge(duplicates, MergeFileWins) == nil, "Expected the nodes are merged")
+	wait()
+	node, _ := server.Nodes.Get("localhost", 7017)
+	test(t, node.Priority == 2, "Expected the last duplicate, got", node)
+
+	// the node which is changed at runtime
+	config := []Node{{Host: "localhost", Port: 7017, Priority: 3}, {Host: "localhost", Port: 7018}}
+	test(t, server.Nodes.Merge(config, MergeRuntimeWins) == nil, "Expected the nodes are merged")
+	wait()
+	node, _ = server.Nodes.Get("localhost", 7017)
+	test(t, node.Priority == 2, "Expected the node changed at runtime is kept, got", node)
+	_, ok = server.Nodes.Get("localhost", 7018)
+	test(t, ok, "Expected the new node is added")
+
+	err = server.Nodes.Merge(config, MergeReject)
+	test(t, err != nil, "Expected the conflict with the node changed at runtime")
+
+	test(t, server.Nodes.Merge(config, "") == nil, "Expected the nodes are merged")
+	wait()
+	node, _ = server.Nodes.Get("localhost", 7017)
+	test(t, node.Priority == 3, "Expected the node of the config, got", node)
+
+	// the same settings are not the conflict
+	test(t, server.Nodes.Merge(config, MergeReject) == nil, "Expected no conflicts")
+}
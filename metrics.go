@@ -12,6 +12,9 @@ const (
 	successMetric = "success"
 	failureMetric = "failure"
 	queuedMetric  = "queued"
+
+	rejectedMetric = "rejected"
+	droppedMetric  = "dropped"
 )
 
 type Metrics struct {
@@ -30,6 +33,16 @@ type Metrics struct {
 		Set    uint64 `json:"set"`
 		Delete uint64 `json:"delete"`
 	} `json:"queued"`
+	Rejected struct {
+		Get    uint64 `json:"get"`
+		Set    uint64 `json:"set"`
+		Delete uint64 `json:"delete"`
+	} `json:"rejected"`
+	Dropped struct {
+		Get    uint64 `json:"get"`
+		Set    uint64 `json:"set"`
+		Delete uint64 `json:"delete"`
+	} `json:"dropped"`
 }
 
 // MetricsBandle contains an embedded server link and Node records
@@ -100,6 +113,24 @@ func (bundle *MetricsBandle) updateMetrics() {
 			case methodDELETE:
 				metric.Queued.Delete++
 			}
+		case rejectedMetric:
+			switch update.method {
+			case methodGET:
+				metric.Rejected.Get++
+			case methodPUT, methodPOST:
+				metric.Rejected.Set++
+			case methodDELETE:
+				metric.Rejected.Delete++
+			}
+		case droppedMetric:
+			switch update.method {
+			case methodGET:
+				metric.Dropped.Get++
+			case methodPUT, methodPOST:
+				metric.Dropped.Set++
+			case methodDELETE:
+				metric.Dropped.Delete++
+			}
 		}
 
 		// Locks the bundle for the transaction processing
@@ -116,10 +147,16 @@ func (bundle *MetricsBandle) getMetrics(c *router.Control) {
 	defer bundle.mutex.RUnlock()
 
 	templ, err := template.New("metricsList").Parse(metricsList)
+	if err == nil {
+		_, err = templ.New("connectionsList").Parse(connectionsList)
+	}
 	if err == nil {
 		c.Writer.Header().Add("Content-type", router.MIMETEXT)
 		c.Writer.WriteHeader(http.StatusOK)
 		templ.Execute(c.Writer, bundle.records)
+
+		// the connections to the nodes follow the requests
+		templ.ExecuteTemplate(c.Writer, "connectionsList", bundle.Server.connections.infoAll())
 		return
 	}
 	errlog.Println(err)
@@ -138,5 +175,18 @@ var metricsList = `
 +-----------------+-----------------+-----------------+-----------------+
 | QUEUED          | {{ printf "% 15d" $v.Queued.Get }} | {{ printf "% 15d" $v.Queued.Set }} | {{ printf "% 15d" $v.Queued.Delete }} |
 +-----------------+-----------------+-----------------+-----------------+
+| REJECTED        | {{ printf "% 15d" $v.Rejected.Get }} | {{ printf "% 15d" $v.Rejected.Set }} | {{ printf "% 15d" $v.Rejected.Delete }} |
++-----------------+-----------------+-----------------+-----------------+
+| DROPPED         | {{ printf "% 15d" $v.Dropped.Get }} | {{ printf "% 15d" $v.Dropped.Set }} | {{ printf "% 15d" $v.Dropped.Delete }} |
++-----------------+-----------------+-----------------+-----------------+
 {{end}}
 `
+
+var connectionsList = `
+{{ if . }}
++=======================================================================================================+
+| CONNECTIONS              |    OPEN    |   ACTIVE   |    IDLE    |   DIALED   |  REQUESTS  | REUSE RATE |
++=======================================================================================================+
+{{ range . }}| {{ printf "%-24s" .ID }} | {{ printf "% 10d" .Open }} | {{ printf "% 10d" .Active }} | {{ printf "% 10d" .Idle }} | {{ printf "% 10d" .Dialed }} | {{ printf "% 10d" .Requests }} | {{ printf "% 10.3f" .ReuseRate }} |
++--------------------------+------------+------------+------------+------------+------------+------------+
+{{ end }}{{ end }}`
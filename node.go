@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/takama/router"
 )
@@ -38,24 +39,91 @@ type Node struct {
 	Priority    int    `json:"priority"`
 	Active      bool   `json:"active"`
 	Maintenance bool   `json:"maintenance"`
+
+	// weight of the node in weighted random mode, zero value means weight 1
+	Weight int `json:"weight"`
+
+	// the updates are applied to the node strictly in sequence order
+	StrictOrder bool `json:"strict-order"`
+
+	// the response of the node is returned to the client in primary fan-out mode
+	Primary bool `json:"primary"`
+
+	// maximum count of the requests per second to the node, the reads fail over to other nodes
+	// and the updates are throttled when it is exceeded, zero value means no limits
+	MaxRPS float64 `json:"max-rps"`
+
+	// time in milliseconds of waiting for the response of the node, it overrides
+	// the response timeout of the server, zero value means the timeout of the server
+	Timeout time.Duration `json:"timeout"`
+
+	// the requests are forwarded to the node over TLS (https)
+	TLS bool `json:"tls"`
+
+	// the updates (PUT, POST) without body are not forwarded to the node
+	RejectEmpty bool `json:"reject-empty"`
+
+	// free-form metadata of the node, the annotation with empty value is deleted by update
+	Annotations Annotations `json:"annotations,omitempty"`
+
+	// the transient weight of the node during deploy, it is defined by API only
+	Canary *Canary `json:"canary,omitempty"`
+
+	// the state and the streaks of the health checks, it is defined by the server only
+	Health *NodeHealth `json:"health,omitempty"`
+
+	// all traffic to the node is stopped, the updates are dropped, it is defined by API only
+	Blackhole bool `json:"blackhole,omitempty"`
 }
 
 // NodeBundle contains an embedded server link and Node records
 type NodeBundle struct {
 	// contains filtered or unexported fields
+
+	// the last id of the transactions, it is first for 64-bit alignment of atomic operations
+	transactions uint64
+
 	mutex sync.RWMutex
 	*Server
-	ring    *ring.Ring
-	update  chan nodeJob
-	records map[string]map[uint64]Node
+	ring *ring.Ring
+
+	// the nodes which could be selected in weighted random mode
+	// and cumulative weights of them
+	weighted   []Node
+	cumulative []int
+
+	// the canary weights of the nodes by ID (host:port)
+	canaries map[string]*Canary
+
+	// the nodes by ID (host:port) which traffic is stopped
+	blackholes map[string]bool
+
+	// the nodes sorted according to priority, they are sorted when the nodes are changed
+	prioritized []Node
+	update      chan nodeJob
+	records     map[string]map[uint64]Node
+
+	// the jobs of the transactions by id which are not committed yet
+	pending map[uint64][]nodeJob
+}
+
+// NodeCount contains the totals of the nodes records:
+// active nodes are not in maintenance, inactive nodes are not active at all
+type NodeCount struct {
+	Total       int            `json:"total"`
+	Active      int            `json:"active"`
+	Maintenance int            `json:"maintenance"`
+	Inactive    int            `json:"inactive"`
+	Hosts       map[string]int `json:"hosts"`
 }
 
 // nodeJob is struct which contains jobs for update/delete records
 type nodeJob struct {
-	isDelete bool
-	isUpdate bool
-	done     bool
-	record   Node
+	transaction uint64
+	isDelete    bool
+	isUpdate    bool
+	done        bool
+	record      Node
 }
 
 // byPriority type defines speciallly for sorting by priority attribute
@@ -80,6 +148,42 @@ func (bp byPriority) Less(i, j int) bool {
 	return false
 }
 
+// sortPriority sorts the nodes according to priority once the nodes are changed,
+// so the reads use the sorted nodes without sorting, the nodes are not sorted
+// if the priority is not used (must be called under lock)
+func (bundle *NodeBundle) sortPriority() {
+	if !bundle.Server.byPriority {
+		bundle.prioritized = nil
+		return
+	}
+	prioritized := make([]Node, 0, len(bundle.prioritized))
+	for host := range bundle.records {
+		for _, record := range bundle.records[host] {
+			prioritized = append(prioritized, record)
+		}
+	}
+	sort.Sort(byPriority(prioritized))
+	bundle.prioritized = prioritized
+}
+
+// primaryNode returns index of the active node which answers the updates in primary fan-out mode,
+// the node marked as primary is preferred, otherwise the node with the highest priority, -1 means none
+func primaryNode(nodes []Node) int {
+	primary := -1
+	for index, node := range nodes {
+		if !node.Active {
+			continue
+		}
+		if node.Primary {
+			return index
+		}
+		if primary < 0 || byPriority(nodes).Less(index, primary) {
+			primary = index
+		}
+	}
+	return primary
+}
+
 // Get - gets one of the node record specified by host and port
 func (bundle *NodeBundle) Get(host string, port uint64) (node Node, ok bool) {
 	// Lock the bundle for 'read' operation
@@ -87,10 +191,75 @@ func (bundle *NodeBundle) Get(host string, port uint64) (node Node, ok bool) {
 	defer bundle.mutex.RUnlock()
 
 	node, ok = bundle.records[host][port]
+	node = bundle.decorate(node)
 
 	return
 }
 
+// decorate returns the record with the runtime state of the node: the canary,
+// the health and the blackhole, it is used by the listings (must be called under lock)
+func (bundle *NodeBundle) decorate(record Node) Node {
+	record.Canary = bundle.canary(record.Host, record.Port)
+	record.Health = bundle.health(record.Host, record.Port)
+	record.Blackhole = bundle.blackhole(record.Host, record.Port)
+	return record
+}
+
+// scheme returns the scheme of the requests which are forwarded to the node
+func (node Node) scheme() string {
+	if node.TLS {
+		return protocolHTTPS
+	}
+	return protocolHTTP
+}
+
+// health returns the state of the health checks of the node, if it has been checked
+func (bundle *NodeBundle) health(host string, port uint64) *NodeHealth {
+	return bundle.Server.probes.health(fmt.Sprintf("%s:%d", host, port))
+}
+
+// available checks that the nodes are not reconfigured, it is waiting for the end of
+// the reconfiguration until the timeout, zero timeout means waiting without limits
+func (bundle *NodeBundle) available(timeout time.Duration) bool {
+	if timeout <= 0 {
+		return true
+	}
+	if !bundle.rlockUntil(timeout) {
+		return false
+	}
+	bundle.mutex.RUnlock()
+	return true
+}
+
+// rlockUntil tries to lock the bundle for 'read' operation until the timeout,
+// returns false if the bundle is not locked
+func (bundle *NodeBundle) rlockUntil(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for !bundle.mutex.TryRLock() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
+
+// isMaintenance checks that the node specified by ID (host:port) is in maintenance
+func (bundle *NodeBundle) isMaintenance(id string) bool {
+	// Lock the bundle for 'read' operation
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	for host := range bundle.records {
+		for port, record := range bundle.records[host] {
+			if fmt.Sprintf("%s:%d", host, port) == id {
+				return record.Maintenance
+			}
+		}
+	}
+	return false
+}
+
 // GetAllByHost - gets all the nodes records specified by host and sorted according to priority
 func (bundle *NodeBundle) GetAllByHost(host string) (nodes []Node, total int) {
 	// Lock the bundle for 'read' operation
@@ -99,7 +268,7 @@ func (bundle *NodeBundle) GetAllByHost(host string) (nodes []Node, total int) {
 
 	if _, ok := bundle.records[host]; ok {
 		for _, record := range bundle.records[host] {
-			nodes = append(nodes, record)
+			nodes = append(nodes, bundle.decorate(record))
 		}
 	}
 	total = len(nodes)
@@ -110,38 +279,76 @@ func (bundle *NodeBundle) GetAllByHost(host string) (nodes []Node, total int) {
 	return
 }
 
-// GetAll - gets all the nodes records sorted according to priority
+// GetAll - gets all the nodes records sorted according to priority, the records are not
+// decorated by the runtime state of the nodes to keep the reads fast, the sorted nodes
+// are shared by the readers and must not be changed
 func (bundle *NodeBundle) GetAll() (nodes []Node, total int) {
 	// Lock the bundle for 'read' operation
 	bundle.mutex.RLock()
 	defer bundle.mutex.RUnlock()
 
+	// the nodes are already sorted according to priority
+	if bundle.Server.byPriority {
+		return bundle.prioritized, len(bundle.prioritized)
+	}
+
 	for host := range bundle.records {
 		for _, record := range bundle.records[host] {
 			nodes = append(nodes, record)
 		}
 	}
 	total = len(nodes)
-	if bundle.Server.byPriority {
-		sort.Sort(byPriority(nodes))
+
+	return
+}
+
+// Count - gets the totals of the nodes records
+func (bundle *NodeBundle) Count() (count NodeCount) {
+	// Lock the bundle for 'read' operation
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	count.Hosts = make(map[string]int, len(bundle.records))
+	for host := range bundle.records {
+		for _, record := range bundle.records[host] {
+			switch {
+			case !record.Active:
+				count.Inactive++
+			case record.Maintenance:
+				count.Maintenance++
+			default:
+				count.Active++
+			}
+		}
+		count.Hosts[host] = len(bundle.records[host])
+		count.Total += len(bundle.records[host])
 	}
 
 	return
 }
 
-// Set - updates the node record or create one if it does not exist
+// Set - updates the node record or create one if it does not exist,
+// the node is stored as is, the node defaults of the options are not applied
 func (bundle *NodeBundle) Set(node *Node) bool {
 
-	if node.Host == "" || !isAlphaNumeric(node.Host) || node.Port == 0 {
+	if node.Host == "" || !isAlphaNumeric(node.Host) || node.Port == 0 || node.MaxRPS < 0 || node.Timeout < 0 {
+		return false
+	}
+
+	// Lock the bundle for checking of the limit of the nodes
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	if bundle.exceedsMaxNodes([]Node{*node}) {
 		return false
 	}
 
 	// Add/Update a record
-	bundle.update <- nodeJob{isUpdate: true, record: *node}
+	transaction := bundle.begin()
+	transaction.update(*node)
 
 	// Job done - end of the transaction
-	bundle.update <- nodeJob{done: true}
-	bundle.job <- nodeJobSignal
+	transaction.commit()
 
 	return true
 }
@@ -151,19 +358,27 @@ func (bundle *NodeBundle) SetAll(nodes []Node) bool {
 
 	// Validate the Nodes
 	for _, node := range nodes {
-		if node.Host == "" || !isAlphaNumeric(node.Host) || node.Port == 0 {
+		if node.Host == "" || !isAlphaNumeric(node.Host) || node.Port == 0 || node.MaxRPS < 0 || node.Timeout < 0 {
 			return false
 		}
 	}
 
+	// Lock the bundle for checking of the limit of the nodes
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	if bundle.exceedsMaxNodes(nodes) {
+		return false
+	}
+
+	transaction := bundle.begin()
 	for _, node := range nodes {
 		// Add/Update a record
-		bundle.update <- nodeJob{isUpdate: true, record: node}
+		transaction.update(node)
 	}
 
 	// Job done - end of the transaction
-	bundle.update <- nodeJob{done: true}
-	bundle.job <- nodeJobSignal
+	transaction.commit()
 
 	return true
 }
@@ -184,14 +399,11 @@ func (bundle *NodeBundle) Delete(host string, port uint64) bool {
 	}
 
 	// Delete the record
-	bundle.update <- nodeJob{
-		isDelete: true,
-		record:   Node{Host: host, Port: port},
-	}
+	transaction := bundle.begin()
+	transaction.delete(host, port)
 
 	// Job done - end of the transaction
-	bundle.update <- nodeJob{done: true}
-	bundle.job <- nodeJobSignal
+	transaction.commit()
 
 	return true
 }
@@ -211,16 +423,13 @@ func (bundle *NodeBundle) DeleteAllByHost(host string) bool {
 	}
 
 	// Delete the records
+	transaction := bundle.begin()
 	for port := range records {
-		bundle.update <- nodeJob{
-			isDelete: true,
-			record:   Node{Host: host, Port: port},
-		}
+		transaction.delete(host, port)
 	}
 
 	// Job done - end of the transaction
-	bundle.update <- nodeJob{done: true}
-	bundle.job <- nodeJobSignal
+	transaction.commit()
 
 	return true
 }
@@ -232,21 +441,19 @@ func (bundle *NodeBundle) DeleteAll() {
 	defer bundle.mutex.RUnlock()
 
 	// Delete the records
+	transaction := bundle.begin()
 	for host := range bundle.records {
 		for port := range bundle.records[host] {
-			bundle.update <- nodeJob{
-				isDelete: true,
-				record:   Node{Host: host, Port: port},
-			}
+			transaction.delete(host, port)
 		}
 	}
 
 	// Job done - end of the transaction
-	bundle.update <- nodeJob{done: true}
-	bundle.job <- nodeJobSignal
+	transaction.commit()
 }
 
 // InitRing - inits the nodes in the ring ('round-robin') and resets a pointer to the node
+// which is defined by the ring offset
 func (bundle *NodeBundle) InitRing() {
 	nodes, total := bundle.GetAll()
 	if bundle.Server.roundRobin && total > 1 {
@@ -260,10 +467,52 @@ func (bundle *NodeBundle) InitRing() {
 			bundle.ring.Value = node
 			bundle.ring = bundle.ring.Next()
 		}
+
+		// the pointer starts from the offset of the ring
+		if offset := bundle.Server.Options.RingOffset; offset > 0 {
+			bundle.ring = bundle.ring.Move(offset % total)
+		}
 	}
 
 }
 
+// InitWeights - inits cumulative weights of the active nodes ('weighted random'),
+// the nodes in maintenance are not selected
+func (bundle *NodeBundle) InitWeights() {
+	nodes, _ := bundle.GetAll()
+	var weighted []Node
+	var cumulative []int
+	total := 0
+	for _, node := range nodes {
+		if node.Active && !node.Maintenance {
+			weight := node.Weight
+			if weight <= 0 {
+				weight = 1
+			}
+			total += weight
+			weighted = append(weighted, node)
+			cumulative = append(cumulative, total)
+		}
+	}
+
+	// Locks the bundle for the transaction processing
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	bundle.weighted = weighted
+	bundle.cumulative = cumulative
+}
+
+// GetWeighted - gets the nodes and cumulative weights for weighted random selection,
+// they must not be changed by the caller
+func (bundle *NodeBundle) GetWeighted() ([]Node, []int) {
+	// Lock the bundle for 'read' operation
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	return bundle.weighted, bundle.cumulative
+}
+
 // CurrentFromRing gets a current Node from the the ring ('round-robin')
 func (bundle *NodeBundle) CurrentFromRing() (Node, bool) {
 	// Lock the bundle for 'read' operation
@@ -274,6 +523,20 @@ func (bundle *NodeBundle) CurrentFromRing() (Node, bool) {
 	return node, ok
 }
 
+// fromRing gets all the nodes from the ring ('round-robin') starting with the current node
+func (bundle *NodeBundle) fromRing() (nodes []Node) {
+	// Lock the bundle for 'read' operation
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	bundle.ring.Do(func(value interface{}) {
+		if node, ok := value.(Node); ok {
+			nodes = append(nodes, node)
+		}
+	})
+	return
+}
+
 // TwistRing - sets a pointer to the next node from the ring
 func (bundle *NodeBundle) TwistRing() {
 	// Lock the bundle for the transaction processing
@@ -286,71 +549,107 @@ func (bundle *NodeBundle) TwistRing() {
 // updateRecords is method which does exclusive update/delete of the records
 func (bundle *NodeBundle) updateRecords() {
 
+	// The started workers are waited for after the bundle is unlocked,
+	// so the bundle is not locked during the warmup of the workers
+	var started []*queue
+	defer func() {
+		for _, q := range started {
+			bundle.Server.warmupWorker(q)
+		}
+	}()
+
 	// Locks the bundle for the transaction processing
 	bundle.mutex.Lock()
 	defer bundle.mutex.Unlock()
 
+	if bundle.pending == nil {
+		bundle.pending = make(map[uint64][]nodeJob)
+	}
 	for {
-		update := <-bundle.update
+		job := <-bundle.update
 
-		// If the job is done, unlocks the bundle
-		if update.done {
-			return
+		// The jobs are kept until their transaction is done,
+		// so the jobs of the concurrent transactions are not mixed
+		if !job.done {
+			bundle.pending[job.transaction] = append(bundle.pending[job.transaction], job)
+			continue
 		}
 
-		if update.isDelete {
-			queueID := fmt.Sprintf("%s:%d", update.record.Host, update.record.Port)
-			stdlog.Println("delete node", update.record.Host, update.record.Port)
-			delete(bundle.records[update.record.Host], update.record.Port)
-			if len(bundle.records[update.record.Host]) == 0 {
-				delete(bundle.records, update.record.Host)
+		// If the job is done, applies the transaction, sorts the changed nodes and unlocks the bundle
+		for _, update := range bundle.pending[job.transaction] {
+			if q := bundle.applyJob(update); q != nil {
+				started = append(started, q)
 			}
-			// removes update channel
-			bundle.queues.remove(queueID, bundle.Server.responseTimeout)
 		}
-		if update.isUpdate {
-			queueID := fmt.Sprintf("%s:%d", update.record.Host, update.record.Port)
-			stdlog.Println("update node", update.record.Host, update.record.Port)
-			// Checks if host does not exist
-			if _, ok := bundle.records[update.record.Host]; !ok {
-				bundle.records[update.record.Host] = make(map[uint64]Node)
-			}
-			bundle.records[update.record.Host][update.record.Port] = update.record
-
-			if update.record.Active {
-				// Checks the queue, if the queue does not exist,
-				// creates a new one and assigns the worker for it
-				queue, ok := bundle.queues.check(queueID)
-				if !ok {
-					if !update.record.Maintenance {
-						// creates the worker and assign it to the queue
-						go bundle.Server.worker(queue)
+		delete(bundle.pending, job.transaction)
+		bundle.sortPriority()
+		return
+	}
+}
+
+// applyJob does update/delete of the record, the bundle must be locked,
+// returns the queue which worker is started, the caller waits for its warmup
+func (bundle *NodeBundle) applyJob(update nodeJob) (started *queue) {
+	if update.isDelete {
+		queueID := fmt.Sprintf("%s:%d", update.record.Host, update.record.Port)
+		stdlog.Println("delete node", update.record.Host, update.record.Port)
+		delete(bundle.records[update.record.Host], update.record.Port)
+		delete(bundle.canaries, queueID)
+		delete(bundle.blackholes, queueID)
+		bundle.Server.probes.forget(queueID)
+		bundle.Server.rates.forget(queueID)
+		if len(bundle.records[update.record.Host]) == 0 {
+			delete(bundle.records, update.record.Host)
+		}
+		// removes update channel
+		bundle.queues.remove(queueID, bundle.Server.getResponseTimeout())
+	}
+	if update.isUpdate {
+		queueID := fmt.Sprintf("%s:%d", update.record.Host, update.record.Port)
+		stdlog.Println("update node", update.record.Host, update.record.Port)
+		// Checks if host does not exist
+		if _, ok := bundle.records[update.record.Host]; !ok {
+			bundle.records[update.record.Host] = make(map[uint64]Node)
+		}
+		bundle.records[update.record.Host][update.record.Port] = update.record
+
+		if update.record.Active {
+			// Checks the queue, if the queue does not exist,
+			// creates a new one and assigns the worker for it
+			queue, ok := bundle.queues.check(queueID)
+			if !ok {
+				if !update.record.Maintenance {
+					// creates the worker and assign it to the queue
+					go bundle.Server.worker(queue)
+					started = queue
+				}
+			} else {
+				if update.record.Maintenance {
+					// if the worker is alive
+					if getResponse(queue, bundle.Server.getResponseTimeout()) {
+
+						// sends a 'quit' command to the worker
+						queue.quit <- struct{}{}
+
+						// gets a response from the worker
+						<-queue.response
 					}
 				} else {
-					if update.record.Maintenance {
-						// if the worker is alive
-						if getResponse(queue, bundle.Server.responseTimeout) {
-
-							// sends a 'quit' command to the worker
-							queue.quit <- struct{}{}
-
-							// gets a response from the worker
-							<-queue.response
-						}
-					} else {
-						// if the worker is not alive
-						if !getResponse(queue, bundle.Server.responseTimeout) {
-							go bundle.Server.worker(queue)
-						}
+					// if the worker is not alive
+					if !getResponse(queue, bundle.Server.getResponseTimeout()) {
+						go bundle.Server.worker(queue)
+						started = queue
 					}
 				}
-			} else {
-				// Removes a channel if it is not active
-				// There are removing the worker also
-				bundle.queues.remove(queueID, bundle.Server.responseTimeout)
 			}
+		} else {
+			// Removes a channel if it is not active
+			// There are removing the worker also
+			bundle.queues.remove(queueID, bundle.Server.getResponseTimeout())
 		}
 	}
+
+	return
 }
 
 // --------------------
@@ -418,11 +717,12 @@ func (bundle *NodeBundle) getAllRecordsByHost(c *router.Control) {
 func (bundle *NodeBundle) getAllRecords(c *router.Control) {
 	c.UseTimer()
 
-	// Get all
-	nodes, total := bundle.GetAll()
+	// Get all records which could be read
+	nodes, warnings := bundle.GetAllPartial(listLockTimeout)
+	total := len(nodes)
 
 	// if records do not exist
-	if total == 0 {
+	if total == 0 && len(warnings) == 0 {
 		recordNotFound(c)
 		return
 	}
@@ -432,6 +732,22 @@ func (bundle *NodeBundle) getAllRecords(c *router.Control) {
 		"total":   total,
 		"results": nodes,
 	}
+	if len(warnings) > 0 {
+		result["warnings"] = warnings
+	}
+	c.Code(http.StatusOK).Body(result)
+}
+
+// getCountRecords - gets the totals of the nodes records
+func (bundle *NodeBundle) getCountRecords(c *router.Control) {
+	c.UseTimer()
+
+	count := bundle.Count()
+
+	result := data{
+		"success": true,
+		"results": count,
+	}
 	c.Code(http.StatusOK).Body(result)
 }
 
@@ -455,23 +771,29 @@ func (bundle *NodeBundle) putRecord(c *router.Control) {
 	bundle.mutex.RLock()
 	defer bundle.mutex.RUnlock()
 
-	// Try to find a record
+	// Try to find a record, the annotations are decoded into own copy
 	record, exists := bundle.records[host][port]
+	record.Annotations = record.Annotations.clone()
+
+	// The new record gets the defaults which are kept if they are absent in the payload
+	if !exists {
+		record = bundle.newRecord()
+	}
 
 	// Try to decode record
-	if !decodeRecord(&record, c) {
+	if !decodeRecord(&record, bundle.Server.Options.StrictDecoding, c) {
+		return
+	}
+	record.Annotations = record.Annotations.prune()
+	if !checkAnnotations(record.Annotations, c) {
 		return
 	}
 
-	// Updates/Creates a decoded record
+	// Updates/Creates a decoded record, the moved record is deleted from the previous address
+	moved := false
 	if exists {
-		if (record.Host != "" && record.Host != host) ||
-			(record.Port != 0 && record.Port != port) {
-			bundle.update <- nodeJob{
-				isDelete: true,
-				record:   Node{Host: host, Port: port},
-			}
-		}
+		moved = (record.Host != "" && record.Host != host) ||
+			(record.Port != 0 && record.Port != port)
 
 		// Validates Host
 		if record.Host == "" {
@@ -494,15 +816,23 @@ func (bundle *NodeBundle) putRecord(c *router.Control) {
 		record.Host = host
 		record.Port = port
 
+		if bundle.exceedsMaxNodes([]Node{record}) {
+			tooManyNodes(bundle.maxNodes(), c)
+			return
+		}
+
 		c.Code(http.StatusCreated)
 	}
 
 	// Add the record
-	bundle.update <- nodeJob{isUpdate: true, record: record}
+	transaction := bundle.begin()
+	if moved {
+		transaction.delete(host, port)
+	}
+	transaction.update(record)
 
 	// Job done - end of the transaction
-	bundle.update <- nodeJob{done: true}
-	bundle.job <- nodeJobSignal
+	transaction.commit()
 
 	result := data{
 		"success": true,
@@ -512,6 +842,16 @@ func (bundle *NodeBundle) putRecord(c *router.Control) {
 	c.Body(result)
 }
 
+// newRecord returns the record of the new node with the defaults of the options,
+// they are used by putRecord only: putAllRecords updates the existing records only,
+// and the node of Set/SetAll is complete, its zero values could not be told from absent ones
+func (bundle *NodeBundle) newRecord() Node {
+	return Node{
+		Active:   bundle.Server.Options.NodeDefaults.Active,
+		Priority: bundle.Server.Options.NodeDefaults.Priority,
+	}
+}
+
 // putAllRecords updates all the nodes records
 func (bundle *NodeBundle) putAllRecords(c *router.Control) {
 	c.UseTimer()
@@ -521,7 +861,7 @@ func (bundle *NodeBundle) putAllRecords(c *router.Control) {
 	var results []Node
 
 	// Try to decode records
-	buffer, ok := preDecodeRecords(&records, c)
+	buffer, ok := preDecodeRecords(&records, bundle.Server.Options.StrictDecoding, c)
 	if !ok {
 		return
 	}
@@ -543,24 +883,32 @@ func (bundle *NodeBundle) putAllRecords(c *router.Control) {
 		// Try to find a record
 		update, exists := bundle.records[record.Host][record.Port]
 		if exists {
+			update.Annotations = update.Annotations.clone()
 			updates = append(updates, update)
 		}
 	}
 
 	// Try to decode records
-	if !postDecodeRecords(buffer, &updates, c) {
+	if !postDecodeRecords(buffer, &updates, bundle.Server.Options.StrictDecoding, c) {
 		return
 	}
 
+	for index := range updates {
+		updates[index].Annotations = updates[index].Annotations.prune()
+		if !checkAnnotations(updates[index].Annotations, c) {
+			return
+		}
+	}
+
+	transaction := bundle.begin()
 	for _, update := range updates {
 		// Add record
-		bundle.update <- nodeJob{isUpdate: true, record: update}
+		transaction.update(update)
 		results = append(results, update)
 	}
 
 	// Job is done - end of the transaction
-	bundle.update <- nodeJob{done: true}
-	bundle.job <- nodeJobSignal
+	transaction.commit()
 
 	result := data{
 		"success": true,
@@ -616,6 +964,17 @@ func (bundle *NodeBundle) deleteAllRecordsByHost(c *router.Control) {
 func (bundle *NodeBundle) deleteAllRecords(c *router.Control) {
 	c.UseTimer()
 
+	// The nodes are deleted by filter if it is defined
+	filter, ok, err := parseNodeFilter(c.Request.URL.Query())
+	if err != nil {
+		notRecognizedParameterError("filter", err, c)
+		return
+	}
+	if ok {
+		bundle.deleteMatchingRecords(c, filter)
+		return
+	}
+
 	bundle.DeleteAll()
 
 	c.Code(http.StatusOK).Body(data{"success": true})
@@ -57,7 +57,7 @@ func TestNodes(t *testing.T) {
 	for _, node := range nodes {
 		loadedNode, ok := server.Nodes.Get(node.Host, node.Port)
 		test(t, ok, "Error load fixture:", node)
-		test(t, loadedNode == node,
+		test(t, loadedNode.equal(node),
 			"Loaded node has incorrect values, expected", node, "got", loadedNode)
 		id := fmt.Sprintf("%s:%d", loadedNode.Host, loadedNode.Port)
 		q, ok := server.queues.check(id)
@@ -75,6 +75,12 @@ func TestNodes(t *testing.T) {
 
 	// load all nodes again
 	loadedNodes, total := server.Nodes.GetAll()
+
+	// count the nodes
+	count := server.Nodes.Count()
+	test(t, count.Total == total, "Expected count of nodes", total, "got", count.Total)
+	test(t, count.Active+count.Maintenance+count.Inactive == total,
+		"Expected sum of active/maintenance/inactive nodes", total, "got", count)
 	for index, node := range loadedNodes {
 		test(t, node.Priority == expectedPriority[index],
 			"Expected priority is", expectedPriority[index], "got", node.Priority)
@@ -89,6 +95,16 @@ func TestNodes(t *testing.T) {
 		// set pointer to the next node from the ring
 		server.Nodes.TwistRing()
 	}
+
+	// the ring starts from the offset
+	if total > 1 {
+		server.Options.RingOffset = total + 1
+		server.Nodes.InitRing()
+		ringNode, _ := server.Nodes.CurrentFromRing()
+		test(t, ringNode.equal(loadedNodes[1]), "Expected the node at the ring offset, got", ringNode)
+		server.Options.RingOffset = 0
+		server.Nodes.InitRing()
+	}
 	test(t, server.Nodes.DeleteAllByHost(nodes[0].Host),
 		"Expected the nodes have been deleted got have not")
 	test(t, total == len(nodes), "Expected count of nodes", len(nodes), "got", total)
@@ -116,3 +132,119 @@ func TestNodes(t *testing.T) {
 		test(t, !ok, "Expected the queue does not exist, got", q)
 	}
 }
+
+func TestPrimaryNode(t *testing.T) {
+	nodes := []Node{
+		{Host: "a", Port: 1, Priority: -1, Active: true},
+		{Host: "b", Port: 2, Priority: 2, Active: true},
+		{Host: "c", Port: 3, Priority: 1, Active: false},
+		{Host: "d", Port: 4, Priority: 3, Active: true},
+	}
+	index := primaryNode(nodes)
+	test(t, index == 1, "Expected the node with the highest priority is primary, got", index)
+
+	nodes[3].Primary = true
+	index = primaryNode(nodes)
+	test(t, index == 3, "Expected the flagged node is primary, got", index)
+
+	nodes[3].Active = false
+	nodes[2].Primary = true
+	index = primaryNode(nodes)
+	test(t, index == 1, "Expected the inactive node is not primary, got", index)
+
+	index = primaryNode([]Node{{Host: "a", Port: 1}})
+	test(t, index == -1, "Expected no primary node, got", index)
+}
+
+func TestNodesAvailable(t *testing.T) {
+	bundle := new(NodeBundle)
+	test(t, bundle.available(time.Millisecond), "Expected the nodes are available")
+
+	// the nodes are reconfigured
+	bundle.mutex.Lock()
+	test(t, !bundle.available(10*time.Millisecond), "Expected the nodes are not available")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		bundle.mutex.Unlock()
+	}()
+	test(t, bundle.available(time.Second), "Expected the nodes are available after reconfiguration")
+}
+
+func TestPrioritizedNodes(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.byPriority = true
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{
+		{Host: "127.0.0.1", Port: 1, Priority: 3},
+		{Host: "127.0.0.1", Port: 2, Priority: 1},
+		{Host: "127.0.0.2", Port: 1, Priority: -1},
+	})
+	server.job <- responseSignal
+	<-server.response
+
+	ports := func() string {
+		nodes, _ := server.Nodes.GetAll()
+		var got string
+		for _, node := range nodes {
+			got += fmt.Sprintf("%s:%d,", node.Host, node.Port)
+		}
+		return got
+	}
+	got := ports()
+	test(t, got == "127.0.0.1:2,127.0.0.1:1,127.0.0.2:1,", "Expected the nodes sorted by priority, got", got)
+
+	server.Nodes.Set(&Node{Host: "127.0.0.1", Port: 1, Priority: -2})
+	server.job <- responseSignal
+	<-server.response
+	got = ports()
+	test(t, got == "127.0.0.1:2,127.0.0.2:1,127.0.0.1:1,", "Expected the nodes are sorted after update, got", got)
+
+	server.Nodes.Promote("127.0.0.2", 1)
+	nodes, _ := server.Nodes.GetAll()
+	test(t, nodes[1].Primary, "Expected the promoted node in the sorted nodes")
+}
+
+func TestUnprioritizedNodes(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{
+		{Host: "127.0.0.1", Port: 1, Priority: 3},
+		{Host: "127.0.0.1", Port: 2, Priority: 1},
+	})
+	server.job <- responseSignal
+	<-server.response
+
+	server.Nodes.mutex.RLock()
+	prioritized := len(server.Nodes.prioritized)
+	server.Nodes.mutex.RUnlock()
+	test(t, prioritized == 0, "Expected the nodes are not sorted without priority, got", prioritized)
+	_, total := server.Nodes.GetAll()
+	test(t, total == 2, "Expected 2 nodes, got", total)
+}
+
+func TestUndecoratedNodes(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.byPriority = true
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: "127.0.0.1", Port: 1, Active: true}})
+	server.job <- responseSignal
+	<-server.response
+	server.Nodes.SetBlackhole("127.0.0.1", 1, true)
+
+	// the reads use the sorted nodes as is
+	nodes, _ := server.Nodes.GetAll()
+	test(t, len(nodes) == 1 && !nodes[0].Blackhole, "Expected the nodes are not decorated, got", nodes)
+	server.Nodes.mutex.RLock()
+	shared := len(server.Nodes.prioritized) == 1 && &server.Nodes.prioritized[0] == &nodes[0]
+	server.Nodes.mutex.RUnlock()
+	test(t, shared, "Expected the sorted nodes are not copied")
+
+	// the listings contain the runtime state of the nodes
+	nodes, _ = server.Nodes.GetAllPartial(listLockTimeout)
+	test(t, len(nodes) == 1 && nodes[0].Blackhole, "Expected the nodes are decorated, got", nodes)
+	node, _ := server.Nodes.GetPrimary()
+	test(t, node.Blackhole, "Expected the primary node is decorated")
+}
@@ -0,0 +1,335 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import "time"
+
+// Default limits of the listeners
+const (
+	DefaultReadHeaderTimeout time.Duration = 10
+	DefaultReadTimeout       time.Duration = 60
+	DefaultWriteTimeout      time.Duration = 60
+	DefaultIdleTimeout       time.Duration = 120
+	DefaultMaxHeaderBytes                  = 1 << 16
+)
+
+// DefaultShutdownTimeout is time in seconds of waiting for the workers on shutdown
+const DefaultShutdownTimeout time.Duration = 60
+
+// DefaultWorkerWarmup is maximum time in milliseconds of waiting for the started worker to be ready
+const DefaultWorkerWarmup time.Duration = 1000
+
+// DefaultStreamBuffer is size in bytes of the buffer of copying of the responses to the client
+const DefaultStreamBuffer = 32 * 1024
+
+// Options contains optional parameters of the server behaviour,
+// they should be set before the server is running
+type Options struct {
+
+	// behaviour of the server when all nodes are in maintenance
+	Maintenance MaintenancePolicy `json:"maintenance"`
+
+	// timeouts and limits of the service and API listeners
+	Listener ListenerLimits `json:"listener"`
+
+	// adaptive balancing according to the load reported by the nodes
+	Adaptive AdaptiveWeight `json:"adaptive"`
+
+	// the nodes are selected randomly for reads with probability proportional to the weight,
+	// it is used instead of round robin mode
+	WeightedRandom bool `json:"-"`
+
+	// the local node is preferred for reads, the other nodes are used when it fails
+	PreferLocal bool `json:"-"`
+
+	// the node (host:port) which is colocated with the server
+	LocalNode string `json:"local-node"`
+
+	// deadline of the delivery of the updates to the nodes
+	FanOut FanOut `json:"fan-out"`
+
+	// size of the body of the update in bytes, the bigger body is stored in temporary file
+	// which is shared by the nodes instead of memory, zero value means no limits
+	SpoolThreshold int64 `json:"spool-threshold"`
+
+	// size in bytes of the buffer of copying of the responses to the client (default: 32KB),
+	// the streamed responses (chunked or without length) are flushed to the client after every write
+	StreamBuffer int `json:"stream-buffer"`
+
+	// default ramp time in seconds of the canary weight of the node up to the normal weight,
+	// zero value means the canary weight is not changed
+	CanaryRamp time.Duration `json:"canary-ramp"`
+
+	// failure injection into the reads for testing of failover
+	Chaos Chaos `json:"chaos"`
+
+	// limits of the retries of the requests to the nodes
+	RetryBudget RetryBudget `json:"retry-budget"`
+
+	// the connections of the service listener are prepended by PROXY protocol (v1/v2) header,
+	// the client address from the header is used as remote address of the requests
+	ProxyProtocol bool `json:"proxy-protocol"`
+
+	// seed of the random selection of the nodes (weighted, canary, chaos) which makes it reproducible,
+	// zero value means time based seed
+	Seed int64 `json:"seed"`
+
+	// position of the node in the ring which is selected first in round-robin mode
+	RingOffset int `json:"ring-offset"`
+
+	// the networks which are allowed to call the API
+	APIAccess APIAccess `json:"api-access"`
+
+	// the headers which are added to the requests forwarded to the nodes,
+	// the values {client-ip}, {uid} and {request-id} are replaced by the values of the request
+	OutboundHeaders map[string]string `json:"outbound-headers"`
+
+	// the trace context which is generated for the requests without it
+	Tracing Tracing `json:"tracing"`
+
+	// gzip compression of the API responses
+	Compression Compression `json:"compression"`
+
+	// cross-origin policy of the API for the browser-based clients
+	CORS CORS `json:"cors"`
+
+	// merge policy of the nodes of the config which conflict with the nodes changed at runtime
+	// or with each other: "file-wins" (default), "runtime-wins" or "reject"
+	MergePolicy string `json:"merge-policy"`
+
+	// recovery of the job listener and the workers after panic
+	Recovery Recovery `json:"recovery"`
+
+	// the node (host:port) which produced the response is added to X-Spawn-Node header,
+	// it exposes the topology of the nodes to the clients
+	ExposeNode bool `json:"expose-node"`
+
+	// the annotations of the node which produced the response are added
+	// to X-Spawn-Annotation-<Key> headers
+	ExposeAnnotations bool `json:"expose-annotations"`
+
+	// X-Forwarded-Proto header of the client is replaced by the scheme of the client connection,
+	// otherwise it is set if the client did not send it
+	OverrideForwardedProto bool `json:"override-forwarded-proto"`
+
+	// X-Forwarded-For header contains the port of the client as before, by default
+	// the address of the client is added without the port
+	ForwardedForPort bool `json:"forwarded-for-port"`
+
+	// the breakdown of time of the request (selection of the nodes, health checks, the nodes)
+	// is added to X-Spawn-Timing header of the response
+	Timing bool `json:"timing"`
+
+	// the Host header of the client is forwarded to the nodes (name-based virtual hosts),
+	// if it is false, the address of the node is used as Host header
+	PreserveHost bool `json:"preserve-host"`
+
+	// format of the access log of the service and API requests: "common" or "combined",
+	// if it is empty, the API requests are logged in short format
+	AccessLog string `json:"access-log"`
+
+	// time in milliseconds of waiting for the end of the reconfiguration of the nodes,
+	// after that the request fails with 503 status and Retry-After header,
+	// zero value means the requests are waiting without limits
+	ReconfigureTimeout time.Duration `json:"reconfigure-timeout"`
+
+	// deadline in milliseconds of the request across all attempts to the nodes, after that
+	// the request fails with 504 status, it could be overridden per request by X-Spawn-Deadline header,
+	// zero value means no deadline
+	RequestDeadline time.Duration `json:"request-deadline"`
+
+	// the identical concurrent reads share one request to the node
+	Coalesce Coalesce `json:"coalesce"`
+
+	// the reads are sent to several nodes to detect the divergence of the replicas
+	ReadVerify ReadVerify `json:"read-verify"`
+
+	// the last known good response is returned when no one of the nodes could serve the read
+	StaleOnError StaleOnError `json:"stale-on-error"`
+
+	// lockout of the user names and IP addresses after the failed login attempts
+	LoginLimit LoginLimit `json:"login-limit"`
+
+	// the ordered routes of the requests by the path prefix and/or the header to the subsets
+	// of the nodes, the first matched route is used, unmatched requests use all nodes
+	Routes []Route `json:"routes"`
+
+	// the nodes which are preferred for the reads of the clients from the networks
+	Affinity Affinity `json:"affinity"`
+
+	// the nodes are loaded from the KV store and reconciled live instead of the config
+	Discovery Discovery `json:"discovery"`
+
+	// time in seconds of waiting for the connections, the job listener and the workers
+	// on shutdown (default: 60)
+	ShutdownTimeout time.Duration `json:"shutdown-timeout"`
+
+	// the profiling methods of the runtime are available under /debug/pprof of the admin API,
+	// they should not be exposed to the untrusted networks
+	Pprof bool `json:"pprof"`
+
+	// path of the self-test request through the proxy, if it is empty, the URL of the health check is used
+	SelfTestPath string `json:"self-test-path"`
+
+	// maximum time in seconds of the response timeout which could be set at runtime (default: 300)
+	MaxResponseTimeout time.Duration `json:"max-response-timeout"`
+
+	// maximum time in milliseconds of waiting for the started worker of the node to be ready
+	// for the updates before the node is considered ready for dispatch (default: 1000)
+	WorkerWarmup time.Duration `json:"worker-warmup"`
+
+	// time in seconds of waiting for the queue of the quiesced node to drain (default: 60)
+	QuiesceTimeout time.Duration `json:"quiesce-timeout"`
+
+	// the unknown fields of the records of the mutation methods are rejected with 400 status,
+	// by default they are ignored
+	StrictDecoding bool `json:"strict-decoding"`
+
+	// periodical push of the metrics of the nodes to StatsD server
+	StatsD StatsD `json:"statsd"`
+
+	// sampled logging of the rejected requests with their reason
+	RejectLog RejectLog `json:"reject-log"`
+
+	// the updates (PUT, POST) without body are rejected with 400 status instead of forwarding
+	RejectEmptyUpdates bool `json:"reject-empty-updates"`
+
+	// maximum count of the nodes records, the additions beyond the limit are rejected (default: 10000)
+	MaxNodes int `json:"max-nodes"`
+
+	// the attributes of the node which is created by API without them
+	NodeDefaults NodeDefaults `json:"node-defaults"`
+
+	// the updates which are not delivered to the nodes are kept for the replay
+	DeadLetter DeadLetter `json:"dead-letter"`
+
+	// the updates which are not answered in time are acknowledged by 202 Accepted status
+	// with the location of their delivery status
+	AsyncUpdates AsyncUpdates `json:"async-updates"`
+
+	// the health of the new nodes which is required by the swap of all nodes
+	Swap Swap `json:"swap"`
+
+	// timeouts of the connections to the nodes
+	Backend Backend `json:"backend"`
+
+	// host:port of the listener for the admin methods (node mutation, metrics, sessions),
+	// if it is empty, the admin methods use API listener
+	AdminHostPort string `json:"-"`
+}
+
+// MaintenancePolicy defines behaviour of the server
+// when no one of the nodes could serve requests due to maintenance
+type MaintenancePolicy struct {
+
+	// reject the updates with 503 status if no one of the workers could deliver them,
+	// otherwise the updates will be accepted and accumulated in the queues
+	RejectUpdates bool `json:"reject-updates"`
+
+	// route the reads to the nodes in maintenance as a last resort
+	ReadFallback bool `json:"read-fallback"`
+}
+
+// NodeDefaults contains the attributes of the new node which are applied
+// if they are absent in the payload of PUT /nodes/:host/:port,
+// the attributes which are set explicitly (false, 0) are kept as is
+type NodeDefaults struct {
+
+	// the new node is active and starts to serve the requests
+	Active bool `json:"active"`
+
+	// priority of the new node
+	Priority int `json:"priority"`
+}
+
+// AdaptiveWeight contains parameters of the balancing according to the load
+// which is reported by the nodes in the response header, the load (0..1)
+// decreases the chance of the node to be selected for reads
+type AdaptiveWeight struct {
+
+	// name of the response header which contains the load (X-Backend-Load, etc),
+	// if it is empty, the adaptive balancing is not used
+	Header string `json:"header"`
+
+	// smoothing factor (0..1) of the load, the new value is taken with this weight
+	Smoothing float64 `json:"smoothing"`
+}
+
+// RetryBudget limits count of the retries to count of the requests over the sliding window,
+// when the budget is exhausted, the request fails fast instead of retrying
+type RetryBudget struct {
+
+	// maximum ratio of the retries to the requests (0.1 = 10%), zero value means no limits
+	Ratio float64 `json:"ratio"`
+
+	// sliding window in seconds (default: 10)
+	Window time.Duration `json:"window"`
+
+	// count of the retries which are allowed over the window regardless of the ratio
+	Min int `json:"min"`
+}
+
+// FanOut defines lifetime of the update which is delivered to every node,
+// the client gets the answer of the first node (or the primary node), the rest nodes get the update later
+type FanOut struct {
+
+	// deadline in seconds, the update is not delivered to the nodes after it,
+	// zero value means no deadline
+	Deadline time.Duration `json:"deadline"`
+
+	// the update is delivered to all nodes regardless of the deadline
+	WaitForAll bool `json:"wait-for-all"`
+
+	// the client gets 207 Multi-Status with the statuses of all nodes instead of the answer,
+	// even if the update is not delivered to any node, it is used in wait-for-all mode only
+	MultiStatus bool `json:"multi-status"`
+
+	// the client gets the answer of the primary node (flagged or with the highest priority)
+	// within the response timeout, the rest nodes get the update in fire-and-forget manner
+	Primary bool `json:"primary"`
+
+	// the client gets 202 Accepted status with the list of the nodes instead of the answer
+	// after the update is delivered to one of the nodes with successful status (2xx),
+	// it could be overridden per request by X-Spawn-Accepted header
+	Accepted bool `json:"accepted"`
+
+	// the update which is not delivered to any node (no one answered by 2xx) is retried once
+	// to all nodes, after that the client gets the answer of the node or 502 status
+	// with X-Spawn-Delivery header
+	RetryFailed bool `json:"retry-failed"`
+
+	// delay in milliseconds before the retry of the failed update
+	RetryDelay time.Duration `json:"retry-delay"`
+}
+
+// ListenerLimits contains timeouts in seconds and limits of the listeners,
+// zero values will be replaced by default values
+type ListenerLimits struct {
+	ReadHeaderTimeout time.Duration `json:"read-header-timeout"`
+	ReadTimeout       time.Duration `json:"read-timeout"`
+	WriteTimeout      time.Duration `json:"write-timeout"`
+	IdleTimeout       time.Duration `json:"idle-timeout"`
+	MaxHeaderBytes    int           `json:"max-header-bytes"`
+}
+
+// withDefaults returns the limits where zero values are replaced by default values
+func (limits ListenerLimits) withDefaults() ListenerLimits {
+	if limits.ReadHeaderTimeout <= 0 {
+		limits.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	if limits.ReadTimeout <= 0 {
+		limits.ReadTimeout = DefaultReadTimeout
+	}
+	if limits.WriteTimeout <= 0 {
+		limits.WriteTimeout = DefaultWriteTimeout
+	}
+	if limits.IdleTimeout <= 0 {
+		limits.IdleTimeout = DefaultIdleTimeout
+	}
+	if limits.MaxHeaderBytes <= 0 {
+		limits.MaxHeaderBytes = DefaultMaxHeaderBytes
+	}
+	return limits
+}
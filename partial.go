@@ -0,0 +1,53 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// listLockTimeout is time of waiting for the nodes records which are locked by the transaction
+const listLockTimeout = 5 * time.Second
+
+// readHost returns the records of the host, the records which keys do not match
+// their host and port mean the host could not be read (must be called under lock)
+func (bundle *NodeBundle) readHost(host string) (nodes []Node, err error) {
+	for port, record := range bundle.records[host] {
+		if record.Host != host || record.Port != port {
+			return nil, fmt.Errorf("The records of the host %s are inconsistent: %s:%d is stored as %s:%d",
+				host, record.Host, record.Port, host, port)
+		}
+		nodes = append(nodes, bundle.decorate(record))
+	}
+
+	return nodes, nil
+}
+
+// GetAllPartial - gets all the nodes records which could be read sorted according to priority,
+// the warnings contain the hosts which records could not be read
+func (bundle *NodeBundle) GetAllPartial(timeout time.Duration) (nodes []Node, warnings []string) {
+	// Lock the bundle for 'read' operation
+	if !bundle.rlockUntil(timeout) {
+		return nil, []string{"The nodes records are locked by the transaction longer than " + timeout.String()}
+	}
+	defer bundle.mutex.RUnlock()
+
+	for host := range bundle.records {
+		records, err := bundle.readHost(host)
+		if err != nil {
+			errlog.Println(err)
+			warnings = append(warnings, err.Error())
+			continue
+		}
+		nodes = append(nodes, records...)
+	}
+	if bundle.Server.byPriority {
+		sort.Sort(byPriority(nodes))
+	}
+
+	return
+}
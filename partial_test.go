@@ -0,0 +1,35 @@
+package spawn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetAllPartial(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{
+		{Host: "127.0.0.1", Port: 1, Active: true},
+		{Host: "127.0.0.2", Port: 1, Active: true},
+	})
+	server.job <- responseSignal
+	<-server.response
+
+	nodes, warnings := server.Nodes.GetAllPartial(time.Second)
+	test(t, len(nodes) == 2 && len(warnings) == 0, "Expected 2 nodes without warnings, got", nodes, warnings)
+
+	// corrupt the records of the host
+	server.Nodes.mutex.Lock()
+	server.Nodes.records["127.0.0.2"][2] = Node{Host: "127.0.0.3", Port: 2}
+	server.Nodes.mutex.Unlock()
+
+	nodes, warnings = server.Nodes.GetAllPartial(time.Second)
+	test(t, len(nodes) == 1 && nodes[0].Host == "127.0.0.1", "Expected the nodes of the readable host, got", nodes)
+	test(t, len(warnings) == 1, "Expected the warning of the corrupted host, got", warnings)
+
+	server.Nodes.mutex.Lock()
+	nodes, warnings = server.Nodes.GetAllPartial(50 * time.Millisecond)
+	server.Nodes.mutex.Unlock()
+	test(t, len(nodes) == 0 && len(warnings) == 1, "Expected the warning of the locked nodes, got", warnings)
+}
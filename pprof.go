@@ -0,0 +1,23 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"net/http/pprof"
+
+	"github.com/takama/router"
+)
+
+// setupPprof registers the profiling handlers of the runtime under /debug/pprof,
+// the named profiles (heap, goroutine, block, etc.) are served by the index handler
+func setupPprof(r *router.Router) {
+	r.HandlerFunc("GET", "/debug/pprof", pprof.Index)
+	r.HandlerFunc("GET", "/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandlerFunc("GET", "/debug/pprof/profile", pprof.Profile)
+	r.HandlerFunc("GET", "/debug/pprof/symbol", pprof.Symbol)
+	r.HandlerFunc("POST", "/debug/pprof/symbol", pprof.Symbol)
+	r.HandlerFunc("GET", "/debug/pprof/trace", pprof.Trace)
+	r.HandlerFunc("GET", "/debug/pprof/:name", pprof.Index)
+}
@@ -0,0 +1,27 @@
+package spawn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/takama/router"
+)
+
+func TestPprof(t *testing.T) {
+	r := router.New()
+	setupPprof(r)
+
+	request, _ := http.NewRequest("GET", "/debug/pprof/goroutine?debug=1", nil)
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, request)
+	test(t, recorder.Code == http.StatusOK, "Expected status 200, got", recorder.Code)
+	test(t, strings.Contains(recorder.Body.String(), "goroutine profile"),
+		"Expected the goroutine profile, got", recorder.Body.String())
+
+	request, _ = http.NewRequest("GET", "/debug/pprof/cmdline", nil)
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, request)
+	test(t, recorder.Code == http.StatusOK, "Expected status 200, got", recorder.Code)
+}
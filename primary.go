@@ -0,0 +1,97 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"net/http"
+
+	"github.com/takama/router"
+)
+
+// Promote marks the node as primary and demotes the former primary nodes,
+// the primary node answers the updates in primary fan-out mode
+func (bundle *NodeBundle) Promote(host string, port uint64) bool {
+	// Lock the bundle for the transaction processing
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	node, ok := bundle.records[host][port]
+	if !ok {
+		return false
+	}
+	for h := range bundle.records {
+		for p, record := range bundle.records[h] {
+			if record.Primary && (h != host || p != port) {
+				record.Primary = false
+				bundle.records[h][p] = record
+				stdlog.Println("demote node", h, p)
+			}
+		}
+	}
+	node.Primary = true
+	bundle.records[host][port] = node
+	bundle.sortPriority()
+	stdlog.Println("promote node", host, port)
+
+	return true
+}
+
+// GetPrimary returns the active node which is marked as primary
+// or the node with the highest priority, if no one is marked
+func (bundle *NodeBundle) GetPrimary() (Node, bool) {
+	nodes, _ := bundle.GetAll()
+	if index := primaryNode(nodes); index >= 0 {
+		// Lock the bundle for 'read' operation
+		bundle.mutex.RLock()
+		defer bundle.mutex.RUnlock()
+
+		return bundle.decorate(nodes[index]), true
+	}
+	return Node{}, false
+}
+
+func (bundle *NodeBundle) promoteRecord(c *router.Control) {
+	c.UseTimer()
+
+	// Try to decode host
+	host, ok := decodeString(":host", c)
+	if !ok {
+		return
+	}
+
+	// Try to decode port
+	port, ok := decodeNumber(":port", c)
+	if !ok {
+		return
+	}
+
+	if !bundle.Promote(host, port) {
+		recordNotFound(c)
+		return
+	}
+	record, _ := bundle.Get(host, port)
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"total":   1,
+		"results": []Node{record},
+	})
+}
+
+func (bundle *NodeBundle) getPrimaryRecord(c *router.Control) {
+	c.UseTimer()
+
+	record, ok := bundle.GetPrimary()
+	if !ok {
+		recordNotFound(c)
+		return
+	}
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"total":   1,
+		"results": []Node{record},
+	})
+}
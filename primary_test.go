@@ -0,0 +1,42 @@
+package spawn
+
+import "testing"
+
+func TestPromote(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.byPriority = true
+	go server.jobListener()
+
+	server.Nodes.SetAll([]Node{
+		{Host: "127.0.0.1", Port: 3001, Priority: 1},
+		{Host: "127.0.0.1", Port: 3002, Priority: 2},
+	})
+	server.job <- responseSignal
+	<-server.response
+
+	// inactive nodes could not be primary
+	_, ok := server.Nodes.GetPrimary()
+	test(t, !ok, "Expected no primary node")
+
+	server.Nodes.SetAll([]Node{
+		{Host: "127.0.0.1", Port: 3001, Priority: 1, Active: true, Maintenance: true},
+		{Host: "127.0.0.1", Port: 3002, Priority: 2, Active: true, Maintenance: true},
+	})
+	server.job <- responseSignal
+	<-server.response
+
+	// the node with the highest priority is primary by default
+	node, ok := server.Nodes.GetPrimary()
+	test(t, ok && node.Port == 3001, "Expected the node with the highest priority, got", node)
+
+	test(t, !server.Nodes.Promote("127.0.0.1", 3003), "Expected unknown node is not promoted")
+	test(t, server.Nodes.Promote("127.0.0.1", 3002), "Expected the node is promoted")
+	node, ok = server.Nodes.GetPrimary()
+	test(t, ok && node.Port == 3002 && node.Primary, "Expected the promoted node, got", node)
+
+	// the former primary is demoted
+	test(t, server.Nodes.Promote("127.0.0.1", 3001), "Expected the node is promoted")
+	node, _ = server.Nodes.Get("127.0.0.1", 3002)
+	test(t, !node.Primary, "Expected the former primary is demoted, got", node)
+}
@@ -0,0 +1,235 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checkURLVariables are the variables of the URL of the health check which are expanded for every node
+var checkURLVariables = []string{"{host}", "{port}", "{priority}"}
+
+// probe contains the result of the last health check of the node
+type probe struct {
+	done    chan struct{}
+	alive   bool
+	checked time.Time
+}
+
+// NodeHealth contains the state of the node according to the consecutive results of the health checks
+type NodeHealth struct {
+	Up        bool `json:"up"`
+	Failures  int  `json:"failures"`
+	Successes int  `json:"successes"`
+}
+
+// probeBundle is the bundle for the health probes of the nodes
+type probeBundle struct {
+	mutex   sync.RWMutex
+	limit   chan struct{}
+	records map[string]*probe
+
+	// count of the consecutive failures to mark the node down
+	// and count of the consecutive successes to mark it up
+	fall, rise int
+	states     map[string]*NodeHealth
+}
+
+// setLimit sets maximum count of the health probes which are running at the same time,
+// zero value means no limits
+func (bundle *probeBundle) setLimit(concurrency int) {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	bundle.limit = nil
+	if concurrency > 0 {
+		bundle.limit = make(chan struct{}, concurrency)
+	}
+}
+
+// setThresholds sets count of the consecutive failures/successes which change the state of the node,
+// zero values mean the state is changed by every result
+func (bundle *probeBundle) setThresholds(fall, rise int) {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	bundle.fall, bundle.rise = fall, rise
+}
+
+// observe applies the result of the health probe to the streaks of the node
+// and returns its state, the node is up until the first check
+func (bundle *probeBundle) observe(id string, alive bool) bool {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	state, ok := bundle.states[id]
+	if !ok {
+		state = &NodeHealth{Up: true}
+		bundle.states[id] = state
+	}
+	if alive {
+		state.Failures = 0
+		state.Successes++
+		if !state.Up && state.Successes >= bundle.rise {
+			state.Up = true
+		}
+	} else {
+		state.Successes = 0
+		state.Failures++
+		if state.Up && state.Failures >= bundle.fall {
+			state.Up = false
+		}
+	}
+	return state.Up
+}
+
+// health returns the state of the node, nil means the node is not checked yet
+func (bundle *probeBundle) health(id string) *NodeHealth {
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	if state, ok := bundle.states[id]; ok {
+		health := *state
+		return &health
+	}
+	return nil
+}
+
+// forget deletes the result of the probe and the state of the node
+func (bundle *probeBundle) forget(id string) {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	delete(bundle.records, id)
+	delete(bundle.states, id)
+}
+
+// check returns a state of the node according to the health probes.
+// Only one probe for every node is running at the same time,
+// the concurrent callers are waiting and share its result
+// which is used until the freshness window is expired
+func (bundle *probeBundle) check(id string, freshness time.Duration, do func(string) bool) bool {
+	bundle.mutex.Lock()
+	if p, ok := bundle.records[id]; ok {
+		select {
+		case <-p.done:
+			// the result is still fresh
+			if time.Since(p.checked) < freshness {
+				bundle.mutex.Unlock()
+				return p.alive
+			}
+		default:
+			// the probe is in progress, waiting for its result
+			bundle.mutex.Unlock()
+			<-p.done
+			return p.alive
+		}
+	}
+	p := &probe{done: make(chan struct{})}
+	bundle.records[id] = p
+	limit := bundle.limit
+	bundle.mutex.Unlock()
+
+	defer close(p.done)
+	if limit != nil {
+		limit <- struct{}{}
+		defer func() { <-limit }()
+	}
+	p.alive = bundle.observe(id, do(id))
+	p.checked = time.Now()
+
+	return p.alive
+}
+
+// invalidate drops the finished result of the probe for the node,
+// so the next check probes the node again regardless of the freshness window
+func (bundle *probeBundle) invalidate(id string) {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	if p, ok := bundle.records[id]; ok {
+		select {
+		case <-p.done:
+			delete(bundle.records, id)
+		default:
+		}
+	}
+}
+
+// newProbeClient creates HTTP client of the health checks over the transport of the nodes,
+// the TLS probe uses the host of the health check as server name (SNI)
+func newProbeClient(check HealthCheck, transport *http.Transport) *http.Client {
+	if !check.TLS {
+		return &http.Client{Transport: transport}
+	}
+	transport = transport.Clone()
+	transport.TLSClientConfig = &tls.Config{ServerName: check.Host}
+	return &http.Client{Transport: transport}
+}
+
+// expandCheckURL replaces the variables of the URL of the health check by the values of the node
+func expandCheckURL(template string, node Node) string {
+	return strings.NewReplacer(
+		"{host}", node.Host,
+		"{port}", strconv.FormatUint(node.Port, 10),
+		"{priority}", strconv.Itoa(node.Priority),
+	).Replace(template)
+}
+
+// validateCheckURL checks that the URL of the health check contains the known variables only
+// and it is correct after the expansion
+func validateCheckURL(template string) error {
+	rest := template
+	for _, variable := range checkURLVariables {
+		rest = strings.Replace(rest, variable, "", -1)
+	}
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("URL of the health check %q contains unknown variable, use %s",
+			template, strings.Join(checkURLVariables, ", "))
+	}
+	if _, err := url.Parse(expandCheckURL(template, Node{Host: "localhost", Port: 80})); err != nil {
+		return fmt.Errorf("URL of the health check %q is not correct: %s", template, err)
+	}
+	return nil
+}
+
+// probeRequest creates the health check request of the node with the host and the headers of the check,
+// the variables of the URL of the check are expanded by the values of the node
+func (server *Server) probeRequest(host string) (*http.Request, error) {
+	scheme := protocolHTTP
+	if server.check.TLS {
+		scheme = protocolHTTPS
+	}
+	path := server.check.URL
+	if strings.Contains(path, "{") {
+		node, err := server.nodeByID(host)
+		if err != nil {
+			return nil, err
+		}
+		path = expandCheckURL(path, node)
+	}
+	request, err := http.NewRequest(methodGET, scheme+"://"+host+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range server.check.Headers {
+		if http.CanonicalHeaderKey(name) == "Host" {
+			request.Host = value
+			continue
+		}
+		request.Header.Set(name, value)
+	}
+	if server.check.Host != "" {
+		request.Host = server.check.Host
+	}
+	return request, nil
+}
@@ -0,0 +1,131 @@
+package spawn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProbe(t *testing.T) {
+	bundle := &probeBundle{
+		records: make(map[string]*probe),
+		states:  make(map[string]*NodeHealth),
+	}
+	bundle.setLimit(1)
+
+	var mutex sync.Mutex
+	var count int
+	do := func(id string) bool {
+		mutex.Lock()
+		count++
+		mutex.Unlock()
+		time.Sleep(100 * time.Millisecond)
+		return true
+	}
+
+	// concurrent checks of the same node must share one probe
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			test(t, bundle.check("test", time.Second, do), "Expected the node is alive, got it is not")
+		}()
+	}
+	wg.Wait()
+	test(t, count == 1, "Expected count of probes 1, got", count)
+
+	// the result is fresh, probe is not needed
+	test(t, bundle.check("test", time.Second, do), "Expected the node is alive, got it is not")
+	test(t, count == 1, "Expected count of probes 1, got", count)
+
+	// the result is expired, new probe is needed
+	test(t, bundle.check("test", 0, do), "Expected the node is alive, got it is not")
+	test(t, count == 2, "Expected count of probes 2, got", count)
+
+	// the result is invalidated, new probe is needed despite freshness
+	bundle.invalidate("test")
+	test(t, bundle.check("test", time.Second, do), "Expected the node is alive, got it is not")
+	test(t, count == 3, "Expected count of probes 3, got", count)
+}
+
+func TestProbeThresholds(t *testing.T) {
+	bundle := &probeBundle{
+		records: make(map[string]*probe),
+		states:  make(map[string]*NodeHealth),
+	}
+	bundle.setThresholds(2, 3)
+	test(t, bundle.health("test") == nil, "Expected no state of the node which is not checked")
+
+	// the node is marked down after 2 consecutive failures only
+	test(t, bundle.observe("test", false), "Expected the node is up after 1 failure")
+	test(t, bundle.observe("test", true), "Expected the node is up after success")
+	test(t, bundle.observe("test", false), "Expected the node is up after 1 failure")
+	test(t, !bundle.observe("test", false), "Expected the node is down after 2 failures")
+
+	// the node is marked up after 3 consecutive successes only
+	test(t, !bundle.observe("test", true), "Expected the node is down after 1 success")
+	test(t, !bundle.observe("test", true), "Expected the node is down after 2 successes")
+	health := bundle.health("test")
+	test(t, health != nil && !health.Up && health.Successes == 2 && health.Failures == 0,
+		"Expected the node is down with 2 successes, got", health)
+	test(t, bundle.observe("test", true), "Expected the node is up after 3 successes")
+
+	bundle.forget("test")
+	test(t, bundle.health("test") == nil, "Expected the state of the node is deleted")
+}
+
+func TestProbeRequest(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.check = HealthCheck{
+		URL:     "/info",
+		Host:    "api.example.com",
+		Headers: map[string]string{"X-Health-Check": "spawn"},
+		TLS:     true,
+	}
+	request, err := server.probeRequest("127.0.0.1:7017")
+	test(t, err == nil, "Expected create the probe request, got", err)
+	test(t, request.URL.String() == "https://127.0.0.1:7017/info", "Expected TLS probe of the node, got", request.URL)
+	test(t, request.Host == "api.example.com", "Expected Host header of the check, got", request.Host)
+	test(t, request.Header.Get("X-Health-Check") == "spawn", "Expected header of the check, got", request.Header)
+
+	client := newProbeClient(server.check, newBackendTransport(Backend{}, nil, nil))
+	transport, ok := client.Transport.(*http.Transport)
+	test(t, ok && transport.TLSClientConfig.ServerName == "api.example.com", "Expected server name of the check")
+
+	// the node is probed with the host of the check
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "api.example.com" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer node.Close()
+	server.check = HealthCheck{URL: "/", Pattern: "ok", Headers: map[string]string{"Host": "api.example.com"}}
+	server.probeClient = newProbeClient(server.check, newBackendTransport(Backend{}, nil, nil))
+	test(t, server.probeNode(node.Listener.Addr().String()), "Expected the node is alive for the host of the check")
+}
+
+func TestCheckURLTemplate(t *testing.T) {
+	test(t, validateCheckURL("/health/{host}/{port}?priority={priority}") == nil, "Expected the known variables are valid")
+	test(t, validateCheckURL("/health/{id}") != nil, "Expected the unknown variable is not valid")
+	test(t, validateCheckURL("/health/{port") != nil, "Expected the unclosed variable is not valid")
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: "127.0.0.1", Port: 7017, Priority: 2, Active: true}})
+	server.job <- responseSignal
+	<-server.response
+
+	server.check = HealthCheck{URL: "/health/{host}/{port}?priority={priority}"}
+	request, err := server.probeRequest("127.0.0.1:7017")
+	test(t, err == nil, "Expected create the probe request, got", err)
+	test(t, request.URL.String() == "http://127.0.0.1:7017/health/127.0.0.1/7017?priority=2",
+		"Expected the variables are expanded by the node, got", request.URL)
+	test(t, server.selfTestPath() == "/", "Expected root path of the self-test, got", server.selfTestPath())
+}
@@ -7,19 +7,53 @@ package spawn
 import (
 	"io"
 	"net/http"
+	"strconv"
 )
 
 // proxy contains request handler function which manage http requests/responses
 type proxy struct {
 	transport http.RoundTripper
+
+	// the server which state is checked before the request, it is used with the custom transport too
+	server *Server
+
+	// size in bytes of the buffer of copying of the responses, zero value means default size
+	bufferSize int
+}
+
+// statusError is an error which should be returned to the client with specified HTTP status
+type statusError struct {
+	code    int
+	message string
+
+	// time in seconds after which the client could retry the request, zero value means not defined
+	retryAfter int
+
+	// delivery of the update to the nodes (X-Spawn-Delivery header), empty value means not defined
+	delivery string
+
+	// reason of the rejection of the request, empty value means it is defined by the code
+	reason string
+
+	// the connection of the client is closed after the response
+	closeConnection bool
+}
+
+func (e *statusError) Error() string {
+	return e.message
 }
 
 // ServeHTTP implements http.Handler interface.
 func (p *proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// the new requests are not accepted during the shutdown
+	if p.server != nil && p.server.isShuttingDown() {
+		p.server.reject(req, errShuttingDown)
+		writeError(w, errShuttingDown)
+		return
+	}
 	response, err := p.transport.RoundTrip(req)
 	if err != nil {
-		errlog.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 	defer response.Body.Close()
@@ -30,5 +64,61 @@ func (p *proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 
 	w.WriteHeader(response.StatusCode)
-	io.Copy(w, response.Body)
+	size := p.bufferSize
+	if size <= 0 {
+		size = DefaultStreamBuffer
+	}
+	var dst io.Writer = w
+	if flusher, ok := w.(http.Flusher); ok && isStreaming(response) {
+		dst = &flushWriter{writer: w, flusher: flusher}
+	}
+	io.CopyBuffer(dst, response.Body, make([]byte, size))
+}
+
+// isStreaming checks that the response is streamed by the node (chunked or without length),
+// it should reach the client without buffering
+func isStreaming(response *http.Response) bool {
+	if response.ContentLength < 0 {
+		return true
+	}
+	for _, encoding := range response.TransferEncoding {
+		if encoding == "chunked" {
+			return true
+		}
+	}
+	return false
+}
+
+// flushWriter flushes the data to the client after every write,
+// the slow client holds the reading from the node (backpressure)
+type flushWriter struct {
+	writer  io.Writer
+	flusher http.Flusher
+}
+
+func (fw *flushWriter) Write(b []byte) (int, error) {
+	n, err := fw.writer.Write(b)
+	if n > 0 {
+		fw.flusher.Flush()
+	}
+	return n, err
+}
+
+// writeError writes the status of the error to the client, the unknown errors are written as 500
+func writeError(w http.ResponseWriter, err error) {
+	errlog.Println(err)
+	if se, ok := err.(*statusError); ok {
+		if se.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(se.retryAfter))
+		}
+		if se.delivery != "" {
+			w.Header().Set(HeaderDelivery, se.delivery)
+		}
+		if se.closeConnection {
+			w.Header().Set("Connection", "close")
+		}
+		w.WriteHeader(se.code)
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
 }
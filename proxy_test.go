@@ -0,0 +1,68 @@
+package spawn
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testTransport returns the response with the body of specified length
+type testTransport struct {
+	body   string
+	length int64
+}
+
+func (transport *testTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        make(http.Header),
+		ContentLength: transport.length,
+		Body:          ioutil.NopCloser(strings.NewReader(transport.body)),
+	}, nil
+}
+
+func TestProxyStreaming(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/events", nil)
+
+	// the response without length is flushed
+	p := &proxy{transport: &testTransport{body: "data: event\n\n", length: -1}, bufferSize: 4}
+	recorder := httptest.NewRecorder()
+	p.ServeHTTP(recorder, request)
+	test(t, recorder.Flushed, "Expected the streamed response is flushed")
+	test(t, recorder.Body.String() == "data: event\n\n", "Expected the body of the response, got", recorder.Body.String())
+
+	// the response with length is not flushed
+	p = &proxy{transport: &testTransport{body: "result", length: 6}}
+	recorder = httptest.NewRecorder()
+	p.ServeHTTP(recorder, request)
+	test(t, !recorder.Flushed, "Expected the response with length is not flushed")
+	test(t, recorder.Body.String() == "result", "Expected the body of the response, got", recorder.Body.String())
+
+	response := &http.Response{ContentLength: 10, TransferEncoding: []string{"chunked"}}
+	test(t, isStreaming(response), "Expected the chunked response is streamed")
+}
+
+func TestProxyShuttingDown(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.setShuttingDown()
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	p := &proxy{transport: server}
+	recorder := httptest.NewRecorder()
+	p.ServeHTTP(recorder, request)
+	test(t, recorder.Code == http.StatusServiceUnavailable, "Expected status 503, got", recorder.Code)
+	test(t, recorder.Header().Get("Connection") == "close", "Expected the connection is closed, got", recorder.Header())
+	test(t, server.rejections.records[RejectShutdown] == 1, "Expected the request is rejected by shutdown")
+
+	// the custom transport is not used during the shutdown
+	transport := &testTransport{body: "result", length: 6}
+	p = &proxy{transport: transport, server: server}
+	recorder = httptest.NewRecorder()
+	p.ServeHTTP(recorder, request)
+	test(t, recorder.Code == http.StatusServiceUnavailable, "Expected status 503 with custom transport, got", recorder.Code)
+	test(t, recorder.Header().Get("Connection") == "close", "Expected the connection is closed, got", recorder.Header())
+	test(t, server.rejections.records[RejectShutdown] == 2, "Expected the request is rejected by shutdown")
+}
@@ -0,0 +1,164 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// signatures of the PROXY protocol headers
+var (
+	proxyV1Signature = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// maximum length of the PROXY protocol v1 header
+const proxyV1MaxLength = 107
+
+// proxyListener accepts the connections which are prepended by PROXY protocol header
+type proxyListener struct {
+	net.Listener
+
+	// timeout of reading of the header
+	timeout time.Duration
+}
+
+// Accept waits for the next connection, the header will be read with the first use of the connection
+func (listener *proxyListener) Accept() (net.Conn, error) {
+	conn, err := listener.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{
+		Conn:    conn,
+		reader:  bufio.NewReader(conn),
+		timeout: listener.timeout,
+	}, nil
+}
+
+// proxyConn contains the connection and the client address from PROXY protocol header
+type proxyConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+	once    sync.Once
+	remote  net.Addr
+	err     error
+}
+
+// Read reads data from the connection after the header
+func (conn *proxyConn) Read(b []byte) (int, error) {
+	conn.once.Do(conn.readHeader)
+	if conn.err != nil {
+		return 0, conn.err
+	}
+	return conn.reader.Read(b)
+}
+
+// RemoteAddr returns the client address from the header or the address of the connection
+func (conn *proxyConn) RemoteAddr() net.Addr {
+	conn.once.Do(conn.readHeader)
+	if conn.remote != nil {
+		return conn.remote
+	}
+	return conn.Conn.RemoteAddr()
+}
+
+// readHeader reads PROXY protocol header, if it exists
+func (conn *proxyConn) readHeader() {
+	if conn.timeout > 0 {
+		conn.Conn.SetReadDeadline(time.Now().Add(conn.timeout))
+		defer conn.Conn.SetReadDeadline(time.Time{})
+	}
+	if prefix, err := conn.reader.Peek(len(proxyV1Signature)); err == nil &&
+		bytes.Equal(prefix, proxyV1Signature) {
+		conn.remote, conn.err = readProxyV1(conn.reader)
+	} else if prefix, err := conn.reader.Peek(len(proxyV2Signature)); err == nil &&
+		bytes.Equal(prefix, proxyV2Signature) {
+		conn.remote, conn.err = readProxyV2(conn.reader)
+	}
+	if conn.err != nil {
+		errlog.Println("Could not read PROXY protocol header from", conn.Conn.RemoteAddr(), conn.err)
+	}
+}
+
+// readProxyV1 reads the text header: "PROXY TCP4 source destination source-port destination-port\r\n"
+func readProxyV1(reader *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyV1MaxLength {
+			return nil, errors.New("PROXY protocol header is too long")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("PROXY protocol header has incorrect end of line")
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) > 1 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errors.New("PROXY protocol header has incorrect format")
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, errors.New("PROXY protocol header has incorrect source address")
+	}
+
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readProxyV2 reads the binary header, only PROXY command for TCP over IPv4/IPv6 defines the address
+func readProxyV2(reader *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, len(proxyV2Signature)+4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	command, family := header[12], header[13]
+	if command>>4 != 2 {
+		return nil, errors.New("PROXY protocol header has unsupported version")
+	}
+	data := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+
+	// LOCAL command is used by the balancer for health checks
+	if command&0x0F != 1 {
+		return nil, nil
+	}
+	switch family {
+	case 0x11:
+		if len(data) < 12 {
+			return nil, errors.New("PROXY protocol header has incorrect length")
+		}
+		return &net.TCPAddr{IP: net.IP(data[0:4]), Port: int(binary.BigEndian.Uint16(data[8:10]))}, nil
+	case 0x21:
+		if len(data) < 36 {
+			return nil, errors.New("PROXY protocol header has incorrect length")
+		}
+		return &net.TCPAddr{IP: net.IP(data[0:16]), Port: int(binary.BigEndian.Uint16(data[32:34]))}, nil
+	}
+
+	return nil, nil
+}
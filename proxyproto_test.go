@@ -0,0 +1,41 @@
+package spawn
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestProxyProtocol(t *testing.T) {
+	reader := bufio.NewReader(bytes.NewBufferString("PROXY TCP4 192.168.0.1 10.0.0.1 56324 80\r\nGET /"))
+	addr, err := readProxyV1(reader)
+	test(t, err == nil, "Expected no errors, got", err)
+	test(t, addr != nil && addr.String() == "192.168.0.1:56324", "Expected address 192.168.0.1:56324, got", addr)
+
+	reader = bufio.NewReader(bytes.NewBufferString("PROXY UNKNOWN\r\n"))
+	addr, err = readProxyV1(reader)
+	test(t, err == nil && addr == nil, "Expected no address and no errors, got", addr, err)
+
+	reader = bufio.NewReader(bytes.NewBufferString("PROXY TCP4 192.168.0.1\r\n"))
+	_, err = readProxyV1(reader)
+	test(t, err != nil, "Expected error of incorrect format, got nil")
+
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x21, 0x11, 0, 12, 192, 168, 0, 2, 10, 0, 0, 1, 0xDC, 0x04, 0, 80)
+	reader = bufio.NewReader(bytes.NewBuffer(append(header, "GET /"...)))
+	addr, err = readProxyV2(reader)
+	test(t, err == nil, "Expected no errors, got", err)
+	test(t, addr != nil && addr.String() == "192.168.0.2:56324", "Expected address 192.168.0.2:56324, got", addr)
+
+	// the connection without header keeps its own address
+	client, server := net.Pipe()
+	conn := &proxyConn{Conn: server, reader: bufio.NewReader(server)}
+	go client.Write([]byte("GET / HTTP/1.1\r\n"))
+	test(t, conn.RemoteAddr() == server.RemoteAddr(), "Expected address of the connection, got", conn.RemoteAddr())
+	data := make([]byte, 5)
+	n, _ := conn.Read(data)
+	test(t, string(data[:n]) == "GET /", "Expected data 'GET /', got", string(data[:n]))
+	client.Close()
+	server.Close()
+}
@@ -5,14 +5,21 @@
 package spawn
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/takama/router"
 )
 
 const (
 	cmdQueueCapacity = 100
 
+	// time of waiting for the missing update in strict order mode
+	orderWait = time.Second
+
 	doJobTask = iota
 )
 
@@ -24,6 +31,24 @@ type queue struct {
 	ask      chan struct{}
 	response chan struct{}
 	quit     chan struct{}
+
+	// sequence number of the last queued job
+	mutex    sync.Mutex
+	sequence uint64
+
+	// enqueue time of the jobs which are not taken by the worker
+	queued map[uint64]time.Time
+
+	// the worker of the queue is running
+	working bool
+
+	// sequence number of the last taken job and the jobs which arrived out of order,
+	// they are used by the worker only
+	applied uint64
+	pending map[uint64]*queueJob
+
+	// time since the node is not ready for the updates, it is used by the worker only
+	unready time.Time
 }
 
 // queueJob produces a task which contains query/response and status (done)
@@ -32,6 +57,30 @@ type queueJob struct {
 	query  chan []byte
 	method string
 	answer chan *http.Response
+
+	// outcome receives the result of the delivery to the node
+	outcome chan updateOutcome
+
+	// abort signal is closed when the deadline of the update is expired
+	abort chan struct{}
+
+	// sequence number of the job in the queue
+	seq uint64
+
+	// the job must be applied strictly in sequence order
+	strict bool
+
+	// rate limit of the node, zero value means no limits
+	maxRPS float64
+
+	// time of waiting for the response of the node, zero value means no limits
+	timeout time.Duration
+
+	// scheme of the node (http/https)
+	scheme string
+
+	// the body of the update which is stored in temporary file
+	body *spool
 }
 
 // queueBundle is the bundle for the queue data (queries, responses, etc)
@@ -57,6 +106,8 @@ func (bundle *queueBundle) check(id string) (*queue, bool) {
 			ask:      make(chan struct{}, cmdQueueCapacity),
 			response: make(chan struct{}, cmdQueueCapacity),
 			quit:     make(chan struct{}),
+			pending:  make(map[uint64]*queueJob),
+			queued:   make(map[uint64]time.Time),
 		}
 		return bundle.records[id], false
 	}
@@ -65,6 +116,197 @@ func (bundle *queueBundle) check(id string) (*queue, bool) {
 	return bundle.records[id], true
 }
 
+// get returns the queue if it exists, the queue is not created
+func (bundle *queueBundle) get(id string) (*queue, bool) {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	q, ok := bundle.records[id]
+	return q, ok
+}
+
+// enqueue assigns the sequence number to the job and puts it into the queue
+func (q *queue) enqueue(job *queueJob) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.sequence++
+	job.seq = q.sequence
+	q.queued[job.seq] = time.Now()
+	q.jobs <- job
+	q.task <- doJobTask
+}
+
+// take marks the job as taken by the worker
+func (q *queue) take(job *queueJob) *queueJob {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	delete(q.queued, job.seq)
+	q.applied = job.seq
+	return job
+}
+
+// setWorking marks the worker of the queue as running or stopped
+func (q *queue) setWorking(working bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.working = working
+}
+
+// isWorking checks that the worker of the queue is running
+func (q *queue) isWorking() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.working
+}
+
+// next takes the next job from the queue, the job in strict order mode which arrived
+// out of order waits for the missing jobs, they are skipped if not arrived in time
+func (q *queue) next() *queueJob {
+	for {
+		if job, ok := q.pending[q.applied+1]; ok {
+			delete(q.pending, job.seq)
+			return q.take(job)
+		}
+		var job *queueJob
+		if len(q.pending) == 0 {
+			job = <-q.jobs
+		} else {
+			timeout := time.NewTimer(orderWait)
+			select {
+			case job = <-q.jobs:
+				timeout.Stop()
+			case <-timeout.C:
+				var first uint64
+				for seq := range q.pending {
+					if first == 0 || seq < first {
+						first = seq
+					}
+				}
+				errlog.Println("Updates", q.applied+1, "-", first-1, "are missing for", q.id)
+				q.applied = first - 1
+				continue
+			}
+		}
+		if !job.strict || job.seq <= q.applied+1 {
+			return q.take(job)
+		}
+		q.pending[job.seq] = job
+	}
+}
+
+// QueueInfo contains the state of the queue of the node
+type QueueInfo struct {
+	ID          string  `json:"id"`
+	Pending     int     `json:"pending"`
+	Worker      bool    `json:"worker"`
+	Maintenance bool    `json:"maintenance"`
+	OldestAge   float64 `json:"oldest-age"`
+
+	// the connections of the server to the node
+	Connections *ConnectionStats `json:"connections,omitempty"`
+}
+
+// info returns the state of the queue, the age of the oldest job is in seconds
+func (q *queue) info() QueueInfo {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	info := QueueInfo{ID: q.id, Pending: len(q.queued), Worker: q.working}
+	for _, queued := range q.queued {
+		if age := time.Since(queued).Seconds(); age > info.OldestAge {
+			info.OldestAge = age
+		}
+	}
+	return info
+}
+
+// info returns the state of the queue specified by ID
+func (bundle *queueBundle) info(id string) (QueueInfo, bool) {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	if q, ok := bundle.records[id]; ok {
+		return q.info(), true
+	}
+	return QueueInfo{}, false
+}
+
+// infoAll returns the state of all the queues sorted by ID
+func (bundle *queueBundle) infoAll() []QueueInfo {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	queues := make([]QueueInfo, 0, len(bundle.records))
+	for _, q := range bundle.records {
+		queues = append(queues, q.info())
+	}
+	sort.Sort(byQueueID(queues))
+	return queues
+}
+
+// byQueueID type defines specially for sorting of the queues by ID
+type byQueueID []QueueInfo
+
+func (bq byQueueID) Len() int {
+	return len(bq)
+}
+func (bq byQueueID) Swap(i, j int) {
+	bq[i], bq[j] = bq[j], bq[i]
+}
+func (bq byQueueID) Less(i, j int) bool {
+	return bq[i].ID < bq[j].ID
+}
+
+// getQueues - gets the state of all the queues
+func (server *Server) getQueues(c *router.Control) {
+	c.UseTimer()
+
+	queues := server.queues.infoAll()
+	for index := range queues {
+		queues[index].Maintenance = server.Nodes.isMaintenance(queues[index].ID)
+		queues[index].Connections = server.connectionStats(queues[index].ID)
+	}
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"total":   len(queues),
+		"results": queues,
+	})
+}
+
+// getQueue - gets the state of the queue specified by host and port
+func (server *Server) getQueue(c *router.Control) {
+	c.UseTimer()
+
+	// Try to decode host
+	host, ok := decodeString(":host", c)
+	if !ok {
+		return
+	}
+
+	// Try to decode port
+	port, ok := decodeNumber(":port", c)
+	if !ok {
+		return
+	}
+
+	id := fmt.Sprintf("%s:%d", host, port)
+	info, ok := server.queues.info(id)
+	if !ok {
+		recordNotFound(c)
+		return
+	}
+	info.Maintenance = server.Nodes.isMaintenance(id)
+	info.Connections = server.connectionStats(id)
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"results": info,
+	})
+}
+
 // removes the queue and stops the worker
 func (bundle *queueBundle) remove(id string, timeout time.Duration) {
 	bundle.mutex.Lock()
@@ -88,6 +330,67 @@ func (bundle *queueBundle) remove(id string, timeout time.Duration) {
 	}
 }
 
+// stop sends a 'quit' command to the running workers and waits for their responses
+// until the deadline, returns IDs of the workers which are not stopped
+func (bundle *queueBundle) stop(deadline time.Time) []string {
+	bundle.mutex.Lock()
+	var queues []*queue
+	for _, q := range bundle.records {
+		q.mutex.Lock()
+		if q.working {
+			queues = append(queues, q)
+		}
+		q.mutex.Unlock()
+	}
+	bundle.mutex.Unlock()
+
+	var mutex sync.Mutex
+	var running []string
+	var wg sync.WaitGroup
+	for _, q := range queues {
+		wg.Add(1)
+		go func(q *queue) {
+			defer wg.Done()
+			if !stopWorker(q, deadline) {
+				mutex.Lock()
+				running = append(running, q.id)
+				mutex.Unlock()
+			}
+		}(q)
+	}
+	wg.Wait()
+	sort.Strings(running)
+
+	return running
+}
+
+// stopWorker sends a 'quit' command to the worker and waits for its response until the deadline
+func stopWorker(q *queue, deadline time.Time) bool {
+	timeout := time.NewTimer(time.Until(deadline))
+	defer timeout.Stop()
+
+	// sweeps unwanted responses if exist
+	for {
+		select {
+		case <-q.response:
+			continue
+		default:
+		}
+		break
+	}
+	select {
+	case q.quit <- struct{}{}:
+	case <-timeout.C:
+		return false
+	}
+	select {
+	case <-q.response:
+		return true
+	case <-timeout.C:
+		return false
+	}
+}
+
 // getReponse method is waiting a response or get the false value if timeout
 func getResponse(q *queue, timeout time.Duration) bool {
 	ticker := time.NewTimer(time.Second * timeout)
@@ -119,3 +422,64 @@ func getResponse(q *queue, timeout time.Duration) bool {
 		return true
 	}
 }
+
+// waitWorker waits until the started worker of the queue answers the ask,
+// returns false if the worker is not ready during the warmup
+func waitWorker(q *queue, warmup time.Duration) bool {
+	timer := time.NewTimer(warmup)
+	defer timer.Stop()
+
+	// Sends an ASK to the worker
+	q.ask <- struct{}{}
+
+	select {
+	case <-timer.C:
+		// sweeps ask which sent before (if exist), otherwise the ask is taken
+		// by the worker and its late response is drained
+		select {
+		case <-q.ask:
+		default:
+			drain := time.NewTimer(warmup)
+			defer drain.Stop()
+			select {
+			case <-q.response:
+			case <-drain.C:
+			}
+		}
+		return false
+	case <-q.response:
+		return true
+	}
+}
+
+// deliver sends the first response of the update as the answer,
+// the responses of the rest nodes are closed
+func (job *queueJob) deliver(response *http.Response) {
+	select {
+	case job.done <- struct{}{}:
+		job.answer <- response
+	default:
+		// just close connection
+		response.Body.Close()
+	}
+}
+
+// discardAnswer closes the answer which is not read, if the answer is not delivered yet,
+// the done signal is taken to close the responses of all nodes
+func discardAnswer(done chan struct{}, answer chan *http.Response) {
+	select {
+	case done <- struct{}{}:
+	default:
+		go func() {
+			response := <-answer
+			response.Body.Close()
+		}()
+	}
+}
+
+// report sends the result of the delivery of the job to the node and the status of its response
+func (job *queueJob) report(node string, status int, err error) {
+	if job.outcome != nil {
+		job.outcome <- updateOutcome{node: node, status: status, err: err}
+	}
+}
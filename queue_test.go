@@ -1,7 +1,12 @@
 package spawn
 
 import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestQueue(t *testing.T) {
@@ -35,3 +40,189 @@ func TestQueue(t *testing.T) {
 	q, ok = bundle.records["test"]
 	test(t, !ok, "Expected queue must be deleted, got the queue exists")
 }
+
+func TestQueueOrder(t *testing.T) {
+	bundle := &queueBundle{records: make(map[string]*queue)}
+	q, _ := bundle.check("test")
+
+	// the sequence numbers are assigned in order of queueing
+	for i := 0; i < 3; i++ {
+		q.enqueue(&queueJob{strict: true})
+	}
+	for i := uint64(1); i <= 3; i++ {
+		<-q.task
+		job := q.next()
+		test(t, job.seq == i, "Expected sequence number", i, "got", job.seq)
+	}
+
+	// the job which arrived out of order waits for the missing one
+	q.jobs <- &queueJob{seq: 5, strict: true}
+	q.jobs <- &queueJob{seq: 4, strict: true}
+	job := q.next()
+	test(t, job.seq == 4, "Expected sequence number 4, got", job.seq)
+	job = q.next()
+	test(t, job.seq == 5, "Expected sequence number 5, got", job.seq)
+
+	// the missing job is skipped after waiting
+	q.jobs <- &queueJob{seq: 7, strict: true}
+	job = q.next()
+	test(t, job.seq == 7, "Expected sequence number 7, got", job.seq)
+}
+
+func TestQueueInfo(t *testing.T) {
+	bundle := &queueBundle{records: make(map[string]*queue)}
+	q, _ := bundle.check("test")
+	q.enqueue(&queueJob{})
+	q.enqueue(&queueJob{})
+
+	info, ok := bundle.info("test")
+	test(t, ok, "Expected the queue exists, got it does not")
+	test(t, info.Pending == 2, "Expected 2 pending jobs, got", info.Pending)
+	test(t, !info.Worker, "Expected the worker is not running, got it is")
+
+	<-q.task
+	q.next()
+	info, _ = bundle.info("test")
+	test(t, info.Pending == 1, "Expected 1 pending job, got", info.Pending)
+
+	_, ok = bundle.info("unknown")
+	test(t, !ok, "Expected the queue does not exist, got it does")
+	test(t, len(bundle.infoAll()) == 1, "Expected 1 queue, got", len(bundle.infoAll()))
+}
+
+func TestQueueStop(t *testing.T) {
+	bundle := &queueBundle{records: make(map[string]*queue)}
+
+	// the worker which is stopped by 'quit' command
+	q, _ := bundle.check("alive")
+	q.setWorking(true)
+	go func(q *queue) {
+		<-q.quit
+		q.setWorking(false)
+		q.response <- struct{}{}
+	}(q)
+
+	// the worker which does not answer
+	q, _ = bundle.check("stuck")
+	q.setWorking(true)
+
+	// the queue without worker
+	bundle.check("idle")
+
+	running := bundle.stop(time.Now().Add(100 * time.Millisecond))
+	test(t, len(running) == 1 && running[0] == "stuck",
+		"Expected the stuck worker is not stopped only, got", running)
+}
+
+// leakDetector counts the response bodies which are not closed
+type leakDetector struct {
+	open int32
+}
+
+type detectedBody struct {
+	*strings.Reader
+	detector *leakDetector
+	once     sync.Once
+}
+
+func (body *detectedBody) Close() error {
+	body.once.Do(func() { atomic.AddInt32(&body.detector.open, -1) })
+	return nil
+}
+
+func (detector *leakDetector) response() *http.Response {
+	atomic.AddInt32(&detector.open, 1)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       &detectedBody{Reader: strings.NewReader("body"), detector: detector},
+	}
+}
+
+func (detector *leakDetector) leaks() int32 {
+	return atomic.LoadInt32(&detector.open)
+}
+
+func TestQueueDeliver(t *testing.T) {
+	detector := new(leakDetector)
+	total := 10
+	answer := make(chan *http.Response, total)
+	done := make(chan struct{}, 1)
+
+	// concurrent workers deliver the responses, only the first one is answered
+	var wg sync.WaitGroup
+	for i := 0; i < total; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			job := &queueJob{done: done, answer: answer}
+			job.deliver(detector.response())
+		}()
+	}
+	wg.Wait()
+	test(t, len(answer) == 1, "Expected one answer, got", len(answer))
+	(<-answer).Body.Close()
+	test(t, detector.leaks() == 0, "Expected all response bodies are closed, got leaks", detector.leaks())
+
+	// the answers which come after the timeout are closed
+	answer = make(chan *http.Response, total)
+	done = make(chan struct{}, 1)
+	discardAnswer(done, answer)
+	job := &queueJob{done: done, answer: answer}
+	job.deliver(detector.response())
+	test(t, len(answer) == 0, "Expected no answers after the timeout, got", len(answer))
+	test(t, detector.leaks() == 0, "Expected the late response is closed, got leaks", detector.leaks())
+
+	// the answer which is delivered before discarding is closed as well
+	answer = make(chan *http.Response, total)
+	done = make(chan struct{}, 1)
+	job = &queueJob{done: done, answer: answer}
+	job.deliver(detector.response())
+	discardAnswer(done, answer)
+	for i := 0; i < 100 && detector.leaks() != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	test(t, detector.leaks() == 0, "Expected the unread answer is closed, got leaks", detector.leaks())
+}
+
+func TestQueueAbandon(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.check.ReadinessTimeout = 1
+
+	// the node is not ready longer than readiness timeout
+	q, _ := server.queues.check("127.0.0.1:1")
+	q.unready = time.Now().Add(-time.Minute)
+	outcomes := make(chan updateOutcome, 1)
+	job := &queueJob{query: make(chan []byte, 1), method: methodPOST, outcome: outcomes}
+	job.query <- []byte("POST /update HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	q.enqueue(job)
+
+	test(t, !server.doUpdate(q), "Expected the worker is not stopped")
+	outcome := <-outcomes
+	test(t, outcome.err != nil && outcome.node == "127.0.0.1:1", "Expected the update is abandoned, got", outcome)
+	test(t, len(q.jobs) == 0, "Expected no jobs in the queue, got", len(q.jobs))
+}
+
+func TestWaitWorker(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+
+	q, _ := server.queues.check("127.0.0.1:1")
+	test(t, !waitWorker(q, 100*time.Millisecond), "Expected the queue without worker is not ready")
+	test(t, len(q.ask) == 0, "Expected the ask is swept")
+
+	server.startWorker(q)
+	test(t, len(q.response) == 0 && len(q.ask) == 0, "Expected the worker answered the warmup handshake")
+	test(t, getResponse(q, 1), "Expected the worker is alive")
+	q.quit <- struct{}{}
+	<-q.response
+
+	// the worker which takes the ask in time, but answers late
+	go func() {
+		<-q.ask
+		time.Sleep(60 * time.Millisecond)
+		q.response <- struct{}{}
+	}()
+	test(t, !waitWorker(q, 40*time.Millisecond), "Expected the late worker is not ready")
+	test(t, len(q.response) == 0, "Expected the late response is drained")
+}
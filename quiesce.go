@@ -0,0 +1,96 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/takama/router"
+)
+
+// DefaultQuiesceTimeout is time in seconds of waiting for the queue of the node to drain
+const DefaultQuiesceTimeout time.Duration = 60
+
+// quiescePollInterval is interval of checking of the queue which is draining
+const quiescePollInterval = 100 * time.Millisecond
+
+// drain waits until the queue specified by ID has no jobs and the worker is idle,
+// returns false if the queue is not drained during the timeout
+func (bundle *queueBundle) drain(id string, timeout, responseTimeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		bundle.mutex.Lock()
+		q, ok := bundle.records[id]
+		bundle.mutex.Unlock()
+
+		// the node has no queue, nothing to drain
+		if !ok {
+			return true
+		}
+		info := q.info()
+		if info.Pending == 0 && (!info.Worker || getResponse(q, responseTimeout)) {
+			return true
+		}
+		if time.Now().Add(quiescePollInterval).After(deadline) {
+			return false
+		}
+		time.Sleep(quiescePollInterval)
+	}
+}
+
+// quiesceTimeout returns time of waiting for the queue of the node to drain
+func (server *Server) quiesceTimeout() time.Duration {
+	if server.Options.QuiesceTimeout > 0 {
+		return time.Second * server.Options.QuiesceTimeout
+	}
+	return time.Second * DefaultQuiesceTimeout
+}
+
+// quiesceNode stops the traffic to the node specified by host and port (blackhole)
+// and waits until its queue is drained, the node is safe to restart after success,
+// the traffic is restored by deleting of the blackhole
+func (server *Server) quiesceNode(c *router.Control) {
+	c.UseTimer()
+
+	// Try to decode host
+	host, ok := decodeString(":host", c)
+	if !ok {
+		return
+	}
+
+	// Try to decode port
+	port, ok := decodeNumber(":port", c)
+	if !ok {
+		return
+	}
+
+	if !server.Nodes.SetBlackhole(host, port, true) {
+		recordNotFound(c)
+		return
+	}
+	id := fmt.Sprintf("%s:%d", host, port)
+	if !server.queues.drain(id, server.quiesceTimeout(), server.getResponseTimeout()) {
+		info, _ := server.queues.info(id)
+		message := "The queue of the node is not drained"
+		replyError(c, http.StatusGatewayTimeout, data{
+			"success": false,
+			"error":   http.StatusGatewayTimeout,
+			"message": message,
+			"info":    fmt.Sprintf("%d update(s) are pending, please try again later", info.Pending),
+		})
+		errlog.Println(message, id)
+		return
+	}
+	stdlog.Println("quiesce node", host, port)
+	record, _ := server.Nodes.Get(host, port)
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"total":   1,
+		"results": []Node{record},
+	})
+}
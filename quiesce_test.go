@@ -0,0 +1,27 @@
+package spawn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueueDrain(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+
+	test(t, server.queues.drain("127.0.0.1:1", time.Second, 1), "Expected the node without queue is drained")
+
+	// the job is not taken by the worker
+	q, _ := server.queues.check("127.0.0.1:1")
+	job := &queueJob{query: make(chan []byte, 1), method: methodPOST}
+	q.enqueue(job)
+	test(t, !server.queues.drain(q.id, 200*time.Millisecond, 1), "Expected the queue is not drained")
+
+	// the job is taken, the worker is idle
+	q.take(<-q.jobs)
+	<-q.task
+	go server.worker(q)
+	test(t, server.queues.drain(q.id, time.Second, 1), "Expected the queue is drained")
+	q.quit <- struct{}{}
+	<-q.response
+}
@@ -0,0 +1,52 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// random is the source of the random selection of the nodes which is safe for concurrent use,
+// the same seed reproduces the same selection order
+type random struct {
+	mutex  sync.Mutex
+	source *rand.Rand
+}
+
+// newRandom creates the source with the seed, zero value means time based seed
+func newRandom(seed int64) *random {
+	r := new(random)
+	r.seed(seed)
+	return r
+}
+
+// seed resets the source by the seed, zero value means time based seed
+func (r *random) seed(seed int64) {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.source = rand.New(rand.NewSource(seed))
+}
+
+// Float64 returns a pseudo-random number in [0.0,1.0)
+func (r *random) Float64() float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.source.Float64()
+}
+
+// Intn returns a pseudo-random number in [0,n)
+func (r *random) Intn(n int) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.source.Intn(n)
+}
@@ -0,0 +1,81 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket contains the tokens of the node which are refilled with the rate limit,
+// the capacity of the bucket is one second of the rate
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateBundle contains the token buckets of the nodes
+type rateBundle struct {
+	mutex   sync.Mutex
+	records map[string]*tokenBucket
+}
+
+// take refills the bucket of the node and takes one token from it,
+// the token is taken in advance only if force is true, returns time of waiting for the token
+func (bundle *rateBundle) take(id string, rps float64, force bool) time.Duration {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	now := time.Now()
+	capacity := rps
+	if capacity < 1 {
+		capacity = 1
+	}
+	bucket, ok := bundle.records[id]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, updated: now}
+		bundle.records[id] = bucket
+	}
+	bucket.tokens += now.Sub(bucket.updated).Seconds() * rps
+	if bucket.tokens > capacity {
+		bucket.tokens = capacity
+	}
+	bucket.updated = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0
+	}
+	wait := time.Duration((1 - bucket.tokens) / rps * float64(time.Second))
+	if force {
+		bucket.tokens--
+	}
+	return wait
+}
+
+// allow checks that the request to the node does not exceed the rate limit,
+// zero rate means no limits
+func (bundle *rateBundle) allow(id string, rps float64) bool {
+	if rps <= 0 {
+		return true
+	}
+	return bundle.take(id, rps, false) == 0
+}
+
+// reserve takes the token for the request to the node and returns time of waiting for it,
+// zero rate means no limits
+func (bundle *rateBundle) reserve(id string, rps float64) time.Duration {
+	if rps <= 0 {
+		return 0
+	}
+	return bundle.take(id, rps, true)
+}
+
+// forget deletes the bucket of the node
+func (bundle *rateBundle) forget(id string) {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	delete(bundle.records, id)
+}
@@ -0,0 +1,36 @@
+package spawn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	bundle := &rateBundle{records: make(map[string]*tokenBucket)}
+
+	// no limits
+	for i := 0; i < 100; i++ {
+		test(t, bundle.allow("test", 0), "Expected the request is allowed without limits")
+	}
+
+	// the burst is one second of the rate
+	for i := 0; i < 10; i++ {
+		test(t, bundle.allow("limited", 10), "Expected the request is allowed within the burst", i)
+	}
+	test(t, !bundle.allow("limited", 10), "Expected the request is not allowed over the rate")
+
+	// the tokens are refilled with the rate
+	time.Sleep(150 * time.Millisecond)
+	test(t, bundle.allow("limited", 10), "Expected the request is allowed after refill")
+
+	// the reservation takes the token in advance
+	for i := 0; i < 10; i++ {
+		test(t, bundle.reserve("reserved", 10) == 0, "Expected no waiting within the burst", i)
+	}
+	first := bundle.reserve("reserved", 10)
+	second := bundle.reserve("reserved", 10)
+	test(t, first > 0 && second > first, "Expected the waiting is growing, got", first, second)
+
+	bundle.forget("reserved")
+	test(t, bundle.reserve("reserved", 10) == 0, "Expected no waiting after the bucket is deleted")
+}
@@ -0,0 +1,238 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default values of the read in verify mode
+const (
+	// count of the nodes which are queried by the read
+	DefaultReadVerifyReplicas = 2
+
+	// maximum size in bytes of the body of the replica which is compared
+	DefaultReadVerifyMaxBodySize int64 = 1 << 20
+)
+
+// The comparison methods of the responses of the replicas
+const (
+	// the responses are equal if they have the same status and hash of the body
+	ReadVerifyBody = "body"
+
+	// the responses are equal if they have the same status
+	ReadVerifyStatus = "status"
+)
+
+// ReadVerify defines the read which is sent to several nodes to detect the divergence
+// of the replicas, the response of the majority is returned to the client
+type ReadVerify struct {
+	Enabled bool `json:"enabled"`
+
+	// count of the healthy nodes which are queried (default: 2)
+	Replicas int `json:"replicas"`
+
+	// comparison of the responses: "body" (default) or "status"
+	Compare string `json:"compare"`
+
+	// maximum size in bytes of the body which is read to compare, if the body of one
+	// of the replicas is larger, the responses are compared by status (default: 1MB)
+	MaxBodySize int64 `json:"max-body-size"`
+}
+
+// replicaReply contains the response of the replica which body is read,
+// the rest of the body which exceeds the maximum size is not read
+type replicaReply struct {
+	id       string
+	response *http.Response
+	body     []byte
+	rest     io.ReadCloser
+	key      string
+}
+
+// replyKey returns the key of the response which is equal for the equal responses
+func (options *ReadVerify) replyKey(status int, body []byte) string {
+	if options.Compare == ReadVerifyStatus {
+		return fmt.Sprintf("status=%d", status)
+	}
+	return fmt.Sprintf("status=%d hash=%x", status, sha256.Sum256(body))
+}
+
+// majority returns the reply of the largest group of the equal replies,
+// the group of the first reply wins if the groups have the same size
+func majority(replies []replicaReply) (replicaReply, bool) {
+	counts := make(map[string]int)
+	for _, reply := range replies {
+		counts[reply.key]++
+	}
+	chosen := replies[0]
+	for _, reply := range replies {
+		if counts[reply.key] > counts[chosen.key] {
+			chosen = reply
+		}
+	}
+	return chosen, len(counts) > 1
+}
+
+// replicaNodes returns the nodes in order of the selection, in round robin mode
+// the nodes start from the current node of the ring which is moved to the next one,
+// otherwise they are sorted according to priority if it is used
+func (server *Server) replicaNodes() []Node {
+	if server.roundRobin {
+		if nodes := server.Nodes.fromRing(); len(nodes) > 0 {
+			server.Nodes.TwistRing()
+			return nodes
+		}
+	}
+	nodes, _ := server.Nodes.GetAll()
+	return nodes
+}
+
+// processReceiveVerify sends the read to several healthy nodes and returns the response
+// of the majority, the divergent responses are logged, the read falls back to the rest
+// of the nodes if no one of the replicas answered
+func (server *Server) processReceiveVerify(request *http.Request) (*http.Response, error) {
+	options := server.Options.ReadVerify
+	if !options.Enabled {
+		return server.processReceive(request)
+	}
+	replicas := options.Replicas
+	if replicas <= 0 {
+		replicas = DefaultReadVerifyReplicas
+	}
+	maxBodySize := options.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultReadVerifyMaxBodySize
+	}
+	route := server.route(request)
+	deadline := server.requestDeadline(request)
+
+	var candidates, rest []Node
+	for _, node := range server.replicaNodes() {
+		if !node.Active || node.Maintenance || !route.includes(node) {
+			continue
+		}
+		id := fmt.Sprintf("%s:%d", node.Host, node.Port)
+		if len(candidates) < replicas && !server.Nodes.isBlackhole(id) && server.checkNode(id) {
+			candidates = append(candidates, node)
+		} else {
+			rest = append(rest, node)
+		}
+	}
+
+	// every replica gets own copy of the request
+	server.retries.request()
+	answers := make([]*replicaReply, len(candidates))
+	var wg sync.WaitGroup
+	for index, node := range candidates {
+		wg.Add(1)
+		go func(index int, node Node) {
+			defer wg.Done()
+			attempt := &receiveAttempt{
+				request:  request.Clone(request.Context()),
+				route:    route,
+				deadline: deadline,
+			}
+			response, ok := server.receiveFrom(attempt, node)
+			if !ok {
+				return
+			}
+			body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxBodySize+1))
+			if err != nil {
+				response.Body.Close()
+				errlog.Println(err)
+				return
+			}
+			answer := &replicaReply{
+				id:       fmt.Sprintf("%s:%d", node.Host, node.Port),
+				response: response,
+				body:     body,
+				key:      options.replyKey(response.StatusCode, body),
+			}
+			if int64(len(body)) > maxBodySize {
+				answer.rest = response.Body
+			} else {
+				response.Body.Close()
+			}
+			answers[index] = answer
+		}(index, node)
+	}
+	wg.Wait()
+
+	var replies []replicaReply
+	oversized := false
+	for _, answer := range answers {
+		if answer != nil {
+			replies = append(replies, *answer)
+			oversized = oversized || answer.rest != nil
+		}
+	}
+	if len(replies) == 0 {
+		return server.receiveRest(request, route, deadline, rest)
+	}
+
+	// the bodies which are larger than the maximum size could not be compared
+	if oversized {
+		status := ReadVerify{Compare: ReadVerifyStatus}
+		for index := range replies {
+			replies[index].key = status.replyKey(replies[index].response.StatusCode, nil)
+		}
+	}
+	chosen, divergent := majority(replies)
+	if divergent {
+		summary := make([]string, 0, len(replies))
+		for _, reply := range replies {
+			summary = append(summary, reply.id+" "+reply.key)
+		}
+		errlog.Println("Warning: divergent responses of the replicas for", request.Method,
+			request.URL.RequestURI()+":", strings.Join(summary, ", "))
+	}
+	for _, reply := range replies {
+		if reply.rest != nil && reply.id != chosen.id {
+			reply.rest.Close()
+		}
+	}
+	response := chosen.response
+	if chosen.rest != nil {
+		response.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(chosen.body), chosen.rest), chosen.rest}
+	} else {
+		response.Body = ioutil.NopCloser(bytes.NewReader(chosen.body))
+	}
+
+	return response, nil
+}
+
+// receiveRest reproduces the read on the nodes which are not queried as the replicas,
+// it is used if no one of the replicas answered
+func (server *Server) receiveRest(request *http.Request, route *Route, deadline time.Time, nodes []Node) (*http.Response, error) {
+	attempt := &receiveAttempt{
+		request:  request,
+		route:    route,
+		deadline: deadline,
+	}
+	for _, node := range nodes {
+		if attempt.err != nil {
+			return nil, attempt.err
+		}
+		if response, ok := server.receiveFrom(attempt, node); ok {
+			return response, nil
+		}
+	}
+	if attempt.err != nil {
+		return nil, attempt.err
+	}
+	return nil, errNoActiveNodes
+}
@@ -0,0 +1,168 @@
+package spawn
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestReadVerify(t *testing.T) {
+	var nodes []Node
+	for _, answer := range []string{"a", "b", "b"} {
+		answer := answer
+		node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(answer))
+		}))
+		defer node.Close()
+		host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+		number, _ := strconv.ParseUint(port, 10, 64)
+		nodes = append(nodes, Node{Host: host, Port: number, Active: true})
+	}
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	go server.jobListener()
+	server.Nodes.SetAll(nodes)
+	server.job <- responseSignal
+	<-server.response
+
+	read := func() string {
+		request, err := http.NewRequest(methodGET, "http://example.com/", nil)
+		test(t, err == nil, "Expected create a new request, got", err)
+		response, err := server.RoundTrip(request)
+		test(t, err == nil, "Expected the response of the replicas, got", err)
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		return string(body)
+	}
+
+	server.Options.ReadVerify = ReadVerify{Enabled: true, Replicas: 3}
+	for i := 0; i < 5; i++ {
+		got := read()
+		test(t, got == "b", "Expected the response of the majority, got", got)
+	}
+
+	options := ReadVerify{Compare: ReadVerifyStatus}
+	test(t, options.replyKey(200, []byte("a")) == options.replyKey(200, []byte("b")),
+		"Expected the responses with the same status are equal")
+	options.Compare = ReadVerifyBody
+	test(t, options.replyKey(200, []byte("a")) != options.replyKey(200, []byte("b")),
+		"Expected the responses with different bodies are not equal")
+
+	chosen, divergent := majority([]replicaReply{{id: "1", key: "a"}, {id: "2", key: "b"}})
+	test(t, divergent && chosen.id == "1", "Expected the first reply wins the tie, got", chosen.id)
+}
+
+func TestReadVerifyNodes(t *testing.T) {
+	var nodes []Node
+	var answers []string
+	for _, answer := range []string{"a", "b", "c"} {
+		answer := answer
+		node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if answer == "c" {
+				w.Write(bytes.Repeat([]byte(answer), 64))
+				return
+			}
+			w.Write([]byte(answer))
+		}))
+		defer node.Close()
+		host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+		number, _ := strconv.ParseUint(port, 10, 64)
+		nodes = append(nodes, Node{Host: host, Port: number, Active: true})
+		answers = append(answers, answer)
+	}
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.roundRobin = true
+	go server.jobListener()
+	server.Nodes.SetAll(nodes)
+	server.job <- responseSignal
+	<-server.response
+	server.Nodes.InitRing()
+
+	read := func() string {
+		request, err := http.NewRequest(methodGET, "http://example.com/", nil)
+		test(t, err == nil, "Expected create a new request, got", err)
+		response, err := server.processReceiveVerify(request)
+		test(t, err == nil, "Expected the response of the replicas, got", err)
+		if err != nil {
+			return ""
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		return string(body)
+	}
+
+	// the replicas are rotated by the ring in round robin mode
+	server.Options.ReadVerify = ReadVerify{Enabled: true, Replicas: 1}
+	first, ok := server.Nodes.CurrentFromRing()
+	test(t, ok, "Expected the current node of the ring")
+	got := make(map[string]bool)
+	for i := 0; i < len(nodes); i++ {
+		got[read()[:1]] = true
+	}
+	test(t, len(got) == len(nodes), "Expected every node is queried in round robin mode, got", got)
+	current, _ := server.Nodes.CurrentFromRing()
+	test(t, current.Port == first.Port, "Expected the ring is moved once by every read, got", current.Port)
+
+	// the large body is returned completely, the responses are compared by status
+	server.roundRobin = false
+	server.Options.ReadVerify = ReadVerify{Enabled: true, Replicas: 3, MaxBodySize: 16}
+	for i := 0; i < 3; i++ {
+		body := read()
+		test(t, body == "a" || body == "b" || body == string(bytes.Repeat([]byte("c"), 64)),
+			"Expected the complete body of one of the replicas, got", body)
+	}
+}
+
+func TestReadVerifyFallback(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/check" {
+			return
+		}
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer broken.Close()
+	var requests int
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/check" {
+			requests++
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer node.Close()
+	var nodes []Node
+	for index, backend := range []*httptest.Server{broken, node} {
+		host, port, _ := net.SplitHostPort(backend.Listener.Addr().String())
+		number, _ := strconv.ParseUint(port, 10, 64)
+		nodes = append(nodes, Node{Host: host, Port: number, Priority: index + 1, Active: true})
+	}
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.check.URL = "/check"
+	server.byPriority = true
+	go server.jobListener()
+	server.Nodes.SetAll(nodes)
+	server.job <- responseSignal
+	<-server.response
+
+	// the read falls back to the nodes which are not queried as the replicas
+	server.Options.ReadVerify = ReadVerify{Enabled: true, Replicas: 1}
+	request, _ := http.NewRequest(methodGET, "http://example.com/", nil)
+	response, err := server.processReceiveVerify(request)
+	test(t, err == nil && response.StatusCode == http.StatusOK, "Expected the response of the rest of the nodes, got", err)
+	if err == nil {
+		response.Body.Close()
+	}
+	test(t, requests == 1, "Expected the read is sent to the rest of the nodes once, got", requests)
+}
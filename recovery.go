@@ -0,0 +1,87 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultRecoveryWindow is time in seconds of counting of the recoveries of the routines
+const DefaultRecoveryWindow time.Duration = 60
+
+// Recovery defines the recovery of the job listener and the workers after panic
+type Recovery struct {
+
+	// the routines are not recovered, the panic crashes the server
+	Disabled bool `json:"disabled"`
+
+	// count of the recoveries within the window, after that the server is shut down,
+	// zero value means no limits
+	Limit int `json:"limit"`
+
+	// time in seconds of counting of the recoveries (default: 60)
+	Window time.Duration `json:"window"`
+}
+
+// recoveryBudget contains the times of the recoveries within the window
+type recoveryBudget struct {
+	mutex sync.Mutex
+	times []time.Time
+}
+
+// take counts the recovery, returns false if the limit within the window is exceeded
+func (budget *recoveryBudget) take(limit int, window time.Duration) bool {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+
+	now := time.Now()
+	recent := budget.times[:0]
+	for _, recovered := range budget.times {
+		if now.Sub(recovered) < window {
+			recent = append(recent, recovered)
+		}
+	}
+	budget.times = append(recent, now)
+
+	return len(budget.times) <= limit
+}
+
+// recovered handles the panic of the routine, returns true if the routine should be restarted,
+// the panic is raised again if the recovery is disabled, the server is signaled to shut down
+// if the recovery budget is exhausted
+func (server *Server) recovered(name string, recovery interface{}) bool {
+	options := server.Options.Recovery
+	if options.Disabled {
+		errlog.Println("Panic in", name, "routine, the recovery is disabled")
+		panic(recovery)
+	}
+	errlog.Println("Recovered in", name, "routine", recovery)
+	if options.Limit <= 0 {
+		return true
+	}
+	window := options.Window
+	if window <= 0 {
+		window = DefaultRecoveryWindow
+	}
+	if server.recoveries.take(options.Limit, time.Second*window) {
+		return true
+	}
+	err := fmt.Errorf("recovery budget is exhausted: %d recoveries within %s, last in %s routine",
+		options.Limit, time.Second*window, name)
+	errlog.Println("FATAL:", err)
+	select {
+	case server.fatal <- err:
+	default:
+	}
+	return false
+}
+
+// Fatal returns the channel which receives the error when the server could not continue,
+// the server should be shut down after that
+func (server *Server) Fatal() <-chan error {
+	return server.fatal
+}
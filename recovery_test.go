@@ -0,0 +1,38 @@
+package spawn
+
+import (
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+
+	// no limits by default
+	for i := 0; i < 10; i++ {
+		test(t, server.recovered("worker", "test"), "Expected the routine is recovered")
+	}
+
+	// the recovery budget is exhausted
+	server, _ = NewServer("test")
+	server.Options.Recovery.Limit = 2
+	test(t, server.recovered("worker", "test"), "Expected the routine is recovered")
+	test(t, server.recovered("worker", "test"), "Expected the routine is recovered")
+	test(t, !server.recovered("worker", "test"), "Expected the routine is not recovered")
+	select {
+	case err := <-server.Fatal():
+		test(t, err != nil, "Expected the fatal error")
+	default:
+		t.Error("Expected the signal of the fatal error")
+	}
+
+	// the panic is raised again if the recovery is disabled
+	server.Options.Recovery.Disabled = true
+	func() {
+		defer func() {
+			recovery := recover()
+			test(t, recovery == "test", "Expected the panic is raised again, got", recovery)
+		}()
+		server.recovered("worker", "test")
+	}()
+}
@@ -0,0 +1,128 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/takama/router"
+)
+
+// The reasons of the rejected requests
+const (
+	// the nodes are reconfigured
+	RejectReconfigure = "reconfigure"
+
+	// no one of the nodes is defined, active or healthy
+	RejectNoNodes = "no-nodes"
+
+	// the retry budget is exhausted
+	RejectCapacity = "capacity"
+
+	// the update is not answered in time or the deadline of the request is exceeded
+	RejectTimeout = "timeout"
+
+	// the update is not delivered to any node or dropped
+	RejectDelivery = "delivery"
+
+	// the update without body is rejected
+	RejectEmptyUpdate = "empty-update"
+
+	// the service is shutting down
+	RejectShutdown = "shutdown"
+
+	// the request could not be read or forwarded
+	RejectInternal = "internal"
+)
+
+// The errors when no one of the nodes could serve the request
+var (
+	errNoActiveNodes    = errors.New("Warning: no one of the nodes is active")
+	errNoAvailableNodes = errors.New("Warning: no one of the nodes is active or in maintenance")
+	errNodesNotDefined  = errors.New("The nodes are not defined")
+)
+
+// RejectLog defines the sampled logging of the rejected requests
+type RejectLog struct {
+	Enabled bool `json:"enabled"`
+
+	// every n-th rejected request of the reason is logged (default: 1, every request)
+	Sample uint64 `json:"sample"`
+}
+
+// rejectionBundle contains the counters of the rejected requests by reason
+type rejectionBundle struct {
+	mutex   sync.Mutex
+	records map[string]uint64
+}
+
+// rejectReason returns the reason of the rejected request by its error
+func rejectReason(err error) string {
+	if se, ok := err.(*statusError); ok {
+		if se.reason != "" {
+			return se.reason
+		}
+		if se.code == http.StatusGatewayTimeout {
+			return RejectTimeout
+		}
+		return RejectInternal
+	}
+	switch err {
+	case errNoActiveNodes, errNoAvailableNodes, errNodesNotDefined:
+		return RejectNoNodes
+	}
+	return RejectInternal
+}
+
+// observe counts the rejected request and returns count of the requests of the reason
+func (bundle *rejectionBundle) observe(reason string) uint64 {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	bundle.records[reason]++
+	return bundle.records[reason]
+}
+
+// counts returns the copy of the counters of the rejected requests
+func (bundle *rejectionBundle) counts() map[string]uint64 {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	counts := make(map[string]uint64, len(bundle.records))
+	for reason, count := range bundle.records {
+		counts[reason] = count
+	}
+	return counts
+}
+
+// reject counts the request which is rejected with the error and logs it, if it is sampled
+func (server *Server) reject(request *http.Request, err error) {
+	reason := rejectReason(err)
+	count := server.rejections.observe(reason)
+	options := server.Options.RejectLog
+	if !options.Enabled {
+		return
+	}
+	sample := options.Sample
+	if sample == 0 {
+		sample = 1
+	}
+	if count%sample == 0 {
+		stdlog.Println("Rejected", request.Method, request.URL.RequestURI(), "reason:", reason,
+			"total:", count, "error:", err)
+	}
+}
+
+// getRejections - gets the counters of the rejected requests by reason
+func (server *Server) getRejections(c *router.Control) {
+	c.UseTimer()
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"results": server.rejections.counts(),
+	})
+}
@@ -0,0 +1,27 @@
+package spawn
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRejections(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	go server.jobListener()
+	server.Options.RejectLog = RejectLog{Enabled: true, Sample: 2}
+
+	for i := 0; i < 3; i++ {
+		request, err := http.NewRequest(methodGET, "http://example.com/", nil)
+		test(t, err == nil, "Expected create a new request, got", err)
+		_, err = server.RoundTrip(request)
+		test(t, err != nil, "Expected the request is rejected without nodes")
+	}
+	counts := server.rejections.counts()
+	test(t, counts[RejectNoNodes] == 3, "Expected 3 rejections without nodes, got", counts)
+
+	test(t, rejectReason(errDeadline) == RejectTimeout, "Expected the deadline is timeout")
+	test(t, rejectReason(errNoRouteNodes) == RejectNoNodes, "Expected no nodes of the route")
+	test(t, rejectReason(&statusError{code: http.StatusServiceUnavailable, reason: RejectCapacity}) == RejectCapacity,
+		"Expected the reason of the error")
+}
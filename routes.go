@@ -0,0 +1,120 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/takama/router"
+)
+
+// Route defines the nodes which serve the requests matched by the path prefix and/or the header,
+// the routes are ordered and the first matched route is used, unmatched requests use all nodes
+type Route struct {
+
+	// prefix of the path of the request (/images/, etc)
+	Prefix string `json:"prefix"`
+
+	// name of the request header and regexp pattern of its value
+	Header  string `json:"header"`
+	Pattern string `json:"pattern"`
+
+	// the nodes which serve the matched requests, defined by ID (host:port) or by host
+	Nodes []string `json:"nodes"`
+
+	pattern *regexp.Regexp
+}
+
+// compileRoutes checks the routes and compiles patterns of the headers
+func compileRoutes(routes []Route) ([]Route, error) {
+	compiled := make([]Route, len(routes))
+	for index, route := range routes {
+		if route.Prefix == "" && route.Header == "" {
+			return nil, fmt.Errorf("The route %d has neither prefix nor header", index)
+		}
+		if len(route.Nodes) == 0 {
+			return nil, fmt.Errorf("The route %d has no nodes", index)
+		}
+		if route.Header != "" {
+			pattern, err := regexp.Compile(route.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("The route %d has incorrect pattern: %s", index, err)
+			}
+			route.pattern = pattern
+		}
+		compiled[index] = route
+	}
+
+	return compiled, nil
+}
+
+// match checks that the request is matched by the route
+func (route *Route) match(request *http.Request) bool {
+	if route.Prefix != "" && !strings.HasPrefix(request.URL.Path, route.Prefix) {
+		return false
+	}
+	if route.Header != "" && !route.pattern.MatchString(request.Header.Get(route.Header)) {
+		return false
+	}
+	return true
+}
+
+// includes checks that the node serves the requests of the route, nil route includes all nodes
+func (route *Route) includes(node Node) bool {
+	if route == nil {
+		return true
+	}
+	id := fmt.Sprintf("%s:%d", node.Host, node.Port)
+	for _, name := range route.Nodes {
+		if name == id || name == node.Host {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the nodes which serve the requests of the route
+func (route *Route) filter(nodes []Node) []Node {
+	if route == nil {
+		return nodes
+	}
+	var result []Node
+	for _, node := range nodes {
+		if route.includes(node) {
+			result = append(result, node)
+		}
+	}
+	return result
+}
+
+// route returns the first route which matches the request, nil means all nodes are used
+func (server *Server) route(request *http.Request) *Route {
+	for index := range server.routes {
+		if server.routes[index].match(request) {
+			return &server.routes[index]
+		}
+	}
+	return nil
+}
+
+// errNoRouteNodes is returned if no one of the nodes serves the requests of the route
+var errNoRouteNodes = &statusError{
+	code:    http.StatusServiceUnavailable,
+	message: "The nodes of the route are not defined",
+	reason:  RejectNoNodes,
+}
+
+func (server *Server) getRoutes(c *router.Control) {
+	c.UseTimer()
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"total":   len(server.routes),
+		"results": server.routes,
+	})
+}
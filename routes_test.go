@@ -0,0 +1,51 @@
+package spawn
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRoutes(t *testing.T) {
+	_, err := compileRoutes([]Route{{Nodes: []string{"localhost"}}})
+	test(t, err != nil, "Expected the route without prefix and header is not accepted")
+	_, err = compileRoutes([]Route{{Prefix: "/images/"}})
+	test(t, err != nil, "Expected the route without nodes is not accepted")
+	_, err = compileRoutes([]Route{{Header: "X-Tenant", Pattern: "[", Nodes: []string{"localhost"}}})
+	test(t, err != nil, "Expected the route with incorrect pattern is not accepted")
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.routes, err = compileRoutes([]Route{
+		{Prefix: "/images/", Nodes: []string{"images"}},
+		{Prefix: "/users/", Header: "X-Tenant", Pattern: "^vip-", Nodes: []string{"localhost:3001"}},
+		{Prefix: "/users/", Nodes: []string{"localhost"}},
+	})
+	test(t, err == nil, "Expected compile the routes, got", err)
+
+	nodes := []Node{
+		{Host: "images", Port: 3001},
+		{Host: "images", Port: 3002},
+		{Host: "localhost", Port: 3001},
+		{Host: "localhost", Port: 3002},
+	}
+
+	// no match uses all nodes
+	request, _ := http.NewRequest("GET", "/info", nil)
+	route := server.route(request)
+	test(t, route == nil && len(route.filter(nodes)) == 4, "Expected all nodes, got", route)
+
+	// the nodes are matched by host
+	request, _ = http.NewRequest("GET", "/images/logo.png", nil)
+	filtered := server.route(request).filter(nodes)
+	test(t, len(filtered) == 2 && filtered[0].Host == "images", "Expected the image nodes, got", filtered)
+
+	// the first matched route wins, the nodes are matched by ID
+	request, _ = http.NewRequest("GET", "/users/1", nil)
+	request.Header.Set("X-Tenant", "vip-1")
+	filtered = server.route(request).filter(nodes)
+	test(t, len(filtered) == 1 && filtered[0].Port == 3001, "Expected one node, got", filtered)
+
+	request.Header.Set("X-Tenant", "regular")
+	filtered = server.route(request).filter(nodes)
+	test(t, len(filtered) == 2 && filtered[0].Host == "localhost", "Expected the user nodes, got", filtered)
+}
@@ -0,0 +1,77 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/takama/router"
+)
+
+// SelfTestResult contains the result of the request which is sent through the proxy to the node,
+// latency is in milliseconds
+type SelfTestResult struct {
+	Path    string  `json:"path"`
+	Node    string  `json:"node"`
+	Status  int     `json:"status"`
+	Latency float64 `json:"latency"`
+}
+
+// selfTestPath returns the path of the self-test request: the configured path,
+// the URL of the health check without variables of the node or root path
+func (server *Server) selfTestPath() string {
+	if server.Options.SelfTestPath != "" {
+		return server.Options.SelfTestPath
+	}
+	if server.check.URL != "" && !strings.Contains(server.check.URL, "{") {
+		return server.check.URL
+	}
+	return "/"
+}
+
+// selfTest sends GET request through the selection and forwarding of the reads
+// and returns the node which answered, the status of its response and latency
+func (server *Server) selfTest(c *router.Control) {
+	c.UseTimer()
+
+	path := server.selfTestPath()
+	request, err := http.NewRequest(http.MethodGet, "http://localhost"+path, nil)
+	if err != nil {
+		notRecognizedParameterError("self-test-path", err, c)
+		return
+	}
+	request.RemoteAddr = "127.0.0.1:0"
+	request.Header.Set("User-Agent", "spawn-selftest")
+
+	start := time.Now()
+	response, err := server.processReceive(request)
+	if err != nil {
+		message := "The self-test request is failed"
+		replyError(c, http.StatusBadGateway, data{
+			"success": false,
+			"error":   http.StatusBadGateway,
+			"message": message,
+			"info":    err.Error(),
+		})
+		errlog.Println(message, err)
+		return
+	}
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"results": SelfTestResult{
+			Path:    path,
+			Node:    request.URL.Host,
+			Status:  response.StatusCode,
+			Latency: time.Since(start).Seconds() * 1000,
+		},
+	})
+}
@@ -0,0 +1,58 @@
+package spawn
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/takama/router"
+)
+
+func TestSelfTest(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ping" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer node.Close()
+	address := node.Listener.Addr().String()
+	host, port, _ := net.SplitHostPort(address)
+	number, _ := strconv.ParseUint(port, 10, 64)
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.Options.SelfTestPath = "/ping"
+	r := router.New()
+	r.GET("/selftest", server.selfTest)
+
+	selfTest := func() (int, SelfTestResult) {
+		request, _ := http.NewRequest("GET", "/selftest", nil)
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, request)
+		var result struct {
+			Data struct {
+				Results SelfTestResult `json:"results"`
+			} `json:"data"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &result)
+		return recorder.Code, result.Data.Results
+	}
+
+	// no one of the nodes is defined
+	code, _ := selfTest()
+	test(t, code == http.StatusBadGateway, "Expected status 502, got", code)
+
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: host, Port: number, Active: true}})
+	server.job <- responseSignal
+	<-server.response
+
+	code, result := selfTest()
+	test(t, code == http.StatusOK, "Expected status 200, got", code)
+	test(t, result.Node == address && result.Status == http.StatusOK && result.Path == "/ping",
+		"Expected the response of the node, got", result)
+}
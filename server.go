@@ -7,16 +7,19 @@ package spawn
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"os"
 	"regexp"
-	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/openprovider/spawn/auth"
@@ -41,21 +44,32 @@ const (
 	DefaultTimeout time.Duration = 10
 
 	// HTTP methods, which should be queued
-	protocolHTTP = "http"
-	methodGET    = "GET"
-	methodPOST   = "POST"
-	methodPUT    = "PUT"
-	methodDELETE = "DELETE"
+	protocolHTTP  = "http"
+	protocolHTTPS = "https"
+	methodGET     = "GET"
+	methodPOST    = "POST"
+	methodPUT     = "PUT"
+	methodDELETE  = "DELETE"
 
 	// Job signals
 	responseSignal = iota
 	nodeJobSignal
 )
 
+// HeaderNode is the response header which contains the node (host:port) which produced the response
+const HeaderNode = "X-Spawn-Node"
+
+// COMMIT - git commit of the build, which could be injected by
+// go build -ldflags "-X github.com/openprovider/spawn.COMMIT=<commit>"
+var COMMIT string
+
 // simplest logger, which initialized during starts of the application
 var (
 	stdlog = log.New(os.Stdout, "[CORE]: ", log.LstdFlags)
 	errlog = log.New(os.Stderr, "[CORE:ERROR]: ", log.Ldate|log.Ltime|log.Lshortfile)
+
+	// access log contains own time stamp
+	accesslog = log.New(os.Stdout, "", 0)
 )
 
 // Server Record
@@ -67,6 +81,9 @@ type Server struct {
 	// Embeded router
 	*router.Router
 
+	// admin router is used for the admin methods if admin listener is defined
+	admin *router.Router
+
 	// Node Bundle contains the Node records
 	Nodes *NodeBundle
 	// contains filtered or unexported fields
@@ -74,12 +91,82 @@ type Server struct {
 	// Metrics Bundle contains the Metrics records
 	Metrics *MetricsBandle
 
+	// Options contains optional parameters of the server behaviour
+	Options Options
+
+	// HealthChecker replaces the health check of the nodes by url, it should be set before Run
+	HealthChecker HealthChecker
+
 	// Entry Bundle contains the entry methods
 	entry *entryBundle
 
 	// Queue Bundle contains the queue records
 	queues *queueBundle
 
+	// Probe Bundle contains the health probes of the nodes
+	probes *probeBundle
+
+	// Weight Bundle contains the load reported by the nodes
+	weights *weightBundle
+
+	// retry budget limits count of the retries of the requests
+	retries *retryBudget
+
+	// failure injection into the reads
+	chaos *chaosBundle
+
+	// Rate Bundle contains the token buckets of the nodes
+	rates *rateBundle
+
+	// Coalesce Bundle contains the reads which are in flight
+	coalesce *coalesceBundle
+
+	// Stale Bundle contains the last known good responses of the reads
+	stale *staleBundle
+
+	// the counters of the rejected requests by reason
+	rejections *rejectionBundle
+
+	// Update Bundle contains the delivery statuses of the updates in async mode
+	updates *updateBundle
+
+	// Dead Letter Bundle contains the updates which are not delivered to the nodes
+	deadLetters *deadLetterBundle
+
+	// the counters of the connections to the nodes
+	connections *connectionBundle
+
+	// the new requests are rejected after the start of the shutdown (atomic flag)
+	shuttingDown int32
+
+	// source of the random selection of the nodes
+	random *random
+
+	// HTTP client of the health checks
+	probeClient *http.Client
+
+	// the recoveries of the routines after panic and the signal of the fatal error
+	recoveries *recoveryBudget
+	fatal      chan error
+
+	// the routes of the requests to the subsets of the nodes
+	routes []Route
+
+	// the networks which are allowed to call the API
+	apiAccess APIAccess
+
+	// the nodes which are preferred for the networks of the clients
+	affinity Affinity
+
+	// the swaps of all nodes are serialized
+	swapping sync.Mutex
+
+	// listeners of the service, API and admin API
+	listeners []*listenerRecord
+
+	// watching of the nodes in the KV store
+	discovery *discovery
+
 	// round robin mode
 	roundRobin bool
 
@@ -92,8 +179,13 @@ type Server struct {
 	// Node connection transport
 	transport http.RoundTripper
 
-	// responseTimeout is a timeout for worker's response
+	// responseTimeout is a timeout for worker's response, it could be changed at runtime
 	responseTimeout time.Duration
+	timeoutMutex    sync.RWMutex
+
+	// dialTimeout is a timeout in milliseconds of the connections of the requests and
+	// the health checks of the nodes, it could be changed at runtime
+	dialTimeout time.Duration
 
 	// job signal channel
 	job chan int
@@ -116,6 +208,37 @@ type HealthCheck struct {
 
 	// regexp pattern for extended check analyze
 	Pattern string `json:"regexp"`
+
+	// the result of the health check is shared during this time in milliseconds,
+	// the reads and the updates skip the probe of the node while the result is fresh,
+	// zero value means the node is probed by every request
+	Freshness time.Duration `json:"freshness"`
+
+	// maximum count of the health checks which are running at the same time
+	Concurrency int `json:"concurrency"`
+
+	// randomized fraction of the interval between the health checks (0.1 = 10%)
+	Jitter float64 `json:"jitter"`
+
+	// count of the consecutive failed checks to mark the node down
+	// and count of the consecutive successful checks to mark it up again (default: 1)
+	FailureThreshold int `json:"failure-threshold"`
+	SuccessThreshold int `json:"success-threshold"`
+
+	// the Host header of the probe request and the server name (SNI) of the TLS probe,
+	// if it is empty, the address of the node is used
+	Host string `json:"host"`
+
+	// the headers of the probe request
+	Headers map[string]string `json:"headers"`
+
+	// the node is probed over TLS (https)
+	TLS bool `json:"tls"`
+
+	// maximum time in seconds of waiting for the node which is not ready for the updates,
+	// after that the queued updates of the node are abandoned until the node is ready,
+	// zero value means waiting without limits
+	ReadinessTimeout time.Duration `json:"readiness-timeout"`
 }
 
 // NewServer creates a new server which contains the nodes/queues
@@ -124,26 +247,26 @@ func NewServer(name string) (*Server, error) {
 	// Init the Server
 	server := &Server{
 		Name:            name,
-		Router:          router.New(),
 		transport:       http.DefaultTransport,
 		responseTimeout: DefaultTimeout,
 		job:             make(chan int, MaxSignals),
 		response:        make(chan struct{}, MaxSignals),
 		quit:            make(chan struct{}, 1),
+		fatal:           make(chan error, 1),
+		recoveries:      new(recoveryBudget),
 	}
+	server.Router = server.newRouter()
 
-	server.Router.PanicHandler = func(c *router.Control) {
-		c.Code(http.StatusInternalServerError).Body(c.Request)
-	}
-	server.Router.NotFound = notFound
-	server.Router.Logger = logger
-	server.Router.CustomHandler = server.baseHandler
+	// Create the source of the random selection of the nodes, it is time based until the server is running
+	server.random = newRandom(0)
 
 	// Create and init nodes bundle
 	server.Nodes = &NodeBundle{
-		Server:  server,
-		update:  make(chan nodeJob, MaxJobs),
-		records: make(map[string]map[uint64]Node),
+		Server:     server,
+		update:     make(chan nodeJob, MaxJobs),
+		records:    make(map[string]map[uint64]Node),
+		canaries:   make(map[string]*Canary),
+		blackholes: make(map[string]bool),
 	}
 
 	// Create and init the Metrics bundle
@@ -156,6 +279,34 @@ func NewServer(name string) (*Server, error) {
 	// Create and init queues bundle
 	server.queues = &queueBundle{records: make(map[string]*queue)}
 
+	// Create and init probes bundle
+	server.probes = &probeBundle{
+		records: make(map[string]*probe),
+		states:  make(map[string]*NodeHealth),
+	}
+
+	// Create and init weights bundle
+	server.weights = &weightBundle{records: make(map[string]float64)}
+
+	// Create retry budget, it has no limits until the server is running
+	server.retries = new(retryBudget)
+
+	// Create failure injection, it is disabled until the server is running
+	server.chaos = &chaosBundle{random: server.random}
+
+	// Create and init rate limits bundle
+	server.rates = &rateBundle{records: make(map[string]*tokenBucket)}
+
+	// Create and init coalesced reads bundle
+	server.coalesce = &coalesceBundle{records: make(map[string]*flight)}
+
+	// Create and init last known good responses bundle
+	server.stale = &staleBundle{records: make(map[string]*staleEntry)}
+	server.rejections = &rejectionBundle{records: make(map[string]uint64)}
+	server.updates = &updateBundle{records: make(map[string]*updateRecord)}
+	server.deadLetters = &deadLetterBundle{records: make(map[string][]deadLetter)}
+	server.connections = &connectionBundle{records: make(map[string]*connectionCounters)}
+
 	return server, nil
 }
 
@@ -187,47 +338,178 @@ func (server *Server) Run(
 	// Starts the worker which manage server's jobs
 	go server.jobListener()
 
+	// The nodes are loaded from the KV store instead of the config, if the discovery is used
+	if server.Options.Discovery.Type != "" {
+		if server.discovery, err = newDiscovery(server.Options.Discovery); err != nil {
+			status = server.Name + " is not loaded"
+			return
+		}
+		if nodes, _, err = server.discovery.load(); err != nil {
+			status = server.Name + " is not loaded"
+			return
+		}
+		stdlog.Println("The nodes are loaded from", server.Options.Discovery.Type, "key", server.Options.Discovery.Key)
+	}
+
 	// Init the Nodes settings
-	if !server.Nodes.SetAll(nodes) {
+	if err = server.Nodes.Merge(nodes, server.Options.MergePolicy); err != nil {
+		status = server.Name + " is not loaded"
+		return
+	}
+
+	// Init the routes of the requests
+	if server.routes, err = compileRoutes(server.Options.Routes); err != nil {
+		status = server.Name + " is not loaded"
+		return
+	}
+
+	// Init the networks which are allowed to call the API
+	if server.apiAccess, err = compileAPIAccess(server.Options.APIAccess); err != nil {
+		status = server.Name + " is not loaded"
+		return
+	}
+
+	// Init the affinity of the clients to the nodes
+	if server.affinity, err = compileAffinity(server.Options.Affinity); err != nil {
 		status = server.Name + " is not loaded"
-		err = errors.New("The config parameters for the nodes have incorrect values")
 		return
 	}
 
-	// Init a health check settings
+	// Init the transport of the nodes and a health check settings
+	if err = validateCheckURL(check.URL); err != nil {
+		status = server.Name + " is not loaded"
+		return
+	}
+	backend := server.Options.Backend
+	source, err := resolveSource(backend.SourceAddress)
+	if err != nil {
+		status = server.Name + " is not loaded"
+		return
+	}
+	server.setDialTimeout(backend.DialTimeout)
+	backendTransport := newBackendTransport(backend, source, server.getDialTimeout)
+	server.connections.wrap(backendTransport)
+	checkTransport := backendTransport
+	if backend.CheckSourceAddress != "" {
+		var checkSource *net.TCPAddr
+		if checkSource, err = resolveSource(backend.CheckSourceAddress); err != nil {
+			status = server.Name + " is not loaded"
+			return
+		}
+		checkTransport = newBackendTransport(backend, checkSource, server.getDialTimeout)
+	}
+	server.transport = backendTransport
 	server.check = check
+	server.probeClient = newProbeClient(check, checkTransport)
+	server.probes.setLimit(check.Concurrency)
+	server.probes.setThresholds(check.FailureThreshold, check.SuccessThreshold)
+
+	// Init the retry budget
+	server.retries.configure(server.Options.RetryBudget)
+
+	// Init the random selection of the nodes, the seed makes it reproducible
+	server.random.seed(server.Options.Seed)
+
+	// Init the failure injection
+	server.chaos.config = server.Options.Chaos
+	if server.Options.Chaos.Enabled {
+		stdlog.Println("WARNING: chaos mode is enabled, the failures will be injected into the reads")
+	}
 
 	// Init auth service
 	server.entry = &entryBundle{
-		Auth: authService,
+		Auth:    authService,
+		lockout: newLockoutBundle(server.Options.LoginLimit),
+		access:  &server.apiAccess,
 	}
 
 	// update metrics routine
 	go server.Metrics.updateMetrics()
 
+	// push of the metrics to StatsD server
+	if server.Options.StatsD.Address != "" {
+		go server.exportStatsD(server.Options.StatsD)
+	}
+
+	// watching of the changes of the nodes in the KV store
+	if server.discovery != nil {
+		go server.watchNodes(server.discovery)
+	}
+
+	// The access log replaces the log of the API requests
+	if server.Options.AccessLog != "" {
+		server.Router.Logger = nil
+	}
+
+	// Init the admin router, if admin listener is defined
+	if server.Options.AdminHostPort != "" {
+		server.admin = server.newRouter()
+	}
+
 	server.setupRoutes()
 
-	go server.Listen(apiHostPort)
-	go func() {
-		p := &proxy{transport: server}
-		if transport != nil {
-			p.transport = transport
-		}
-		if err := http.ListenAndServe(hostPort, p); err != nil {
-			errlog.Fatal(err)
+	// Create the listeners before serving, they could be inherited from the previous process
+	inherited := inheritedListeners()
+	if _, err = server.listen(apiHostPort, server.Router, inherited); err != nil {
+		status = server.Name + " is not loaded"
+		return
+	}
+	if server.admin != nil {
+		if _, err = server.listen(server.Options.AdminHostPort, server.admin, inherited); err != nil {
+			status = server.Name + " is not loaded"
+			return
 		}
-	}()
+	}
+	p := &proxy{transport: server, server: server, bufferSize: server.Options.StreamBuffer}
+	if transport != nil {
+		p.transport = transport
+	}
+	record, err := server.listen(hostPort, p, inherited)
+	if err != nil {
+		status = server.Name + " is not loaded"
+		return
+	}
+	record.proxyProtocol = server.Options.ProxyProtocol
+
+	// Close the inherited listeners which are not used anymore
+	for _, listener := range inherited {
+		listener.Close()
+	}
+	for _, record := range server.listeners {
+		go server.serve(record)
+	}
 
 	status = server.Name + " is loaded successfully"
 
 	return
 }
 
-// Shutdown closes the server graceful
+// Shutdown closes the server graceful, it stops the job listener and the workers
+// and waits for all of them until the shutdown timeout
 func (server *Server) Shutdown() (status string, err error) {
+	// the new requests are rejected while the active ones are finishing
+	server.setShuttingDown()
 
-	// Set timer to wait one minute
-	timeout := time.NewTimer(time.Minute)
+	wait := time.Second * server.Options.ShutdownTimeout
+	if wait <= 0 {
+		wait = time.Second * DefaultShutdownTimeout
+	}
+	deadline := time.Now().Add(wait)
+
+	// Stop accepting of the connections and wait for active connections
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	if err := server.closeListeners(ctx); err != nil {
+		errlog.Println("Could not close the connections:", err)
+	}
+
+	// Stop watching of the KV store
+	if server.discovery != nil {
+		server.discovery.cancel()
+	}
+
+	// the components which are not stopped until the deadline
+	var running []string
 
 	// sweeps all responses if exist
 	for {
@@ -239,25 +521,57 @@ func (server *Server) Shutdown() (status string, err error) {
 		break
 	}
 
-	// sends a 'quit' signal
+	// sends a 'quit' signal to the job listener
 	server.quit <- struct{}{}
 
-	status = server.Name + " server connections are closed"
+	timeout := time.NewTimer(time.Until(deadline))
 	select {
-
-	// Exit by timeout if jobs have not done
 	case <-timeout.C:
-		err = errors.New("timeout")
-		return
-	// Exit after doing all jobs
+		running = append(running, "job listener")
 	case <-server.response:
-		return
+		timeout.Stop()
+	}
+
+	// stops the workers of the queues
+	for _, id := range server.queues.stop(deadline) {
+		running = append(running, "worker "+id)
+	}
+
+	status = server.Name + " server connections are closed"
+	if len(running) > 0 {
+		err = fmt.Errorf("timeout, not stopped: %s", strings.Join(running, ", "))
+	}
+
+	return
+}
+
+// httpServer creates HTTP server with the timeouts and limits of the listener
+func (server *Server) httpServer(hostPort string, handler http.Handler) *http.Server {
+	limits := server.Options.Listener.withDefaults()
+	return &http.Server{
+		Addr:              hostPort,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Second * limits.ReadHeaderTimeout,
+		ReadTimeout:       time.Second * limits.ReadTimeout,
+		WriteTimeout:      time.Second * limits.WriteTimeout,
+		IdleTimeout:       time.Second * limits.IdleTimeout,
+		MaxHeaderBytes:    limits.MaxHeaderBytes,
 	}
 }
 
 func (server *Server) setupRoutes() {
+	// The admin methods use separate router if it is defined
+	admin := server.Router
+	if server.admin != nil {
+		admin = server.admin
+	}
+
+	// The root handler returns links to the basic methods
+	server.GET("/", displayRoot)
+
 	// The info handler returns a system status of the application
 	server.GET("/info", infoHandler)
+	server.GET("/version", versionHandler)
 
 	// Lists methods, which display how to use API
 	server.GET("/list", displayAllMethods)
@@ -269,35 +583,114 @@ func (server *Server) setupRoutes() {
 	// Entry methods
 	server.POST("/login", server.entry.login)
 	server.GET("/login/:token", server.entry.info)
+	server.POST("/login/:token/refresh", server.entry.refresh)
 	server.DELETE("/logout/:token", server.entry.logout)
 	server.OPTIONS("/login", optionsHandler)
 	server.OPTIONS("/login/:token", optionsHandler)
+	server.OPTIONS("/login/:token/refresh", optionsHandler)
 	server.OPTIONS("/logout/:token", optionsHandler)
+	admin.DELETE("/logout/user/:uid", server.entry.logoutUser)
+	admin.OPTIONS("/logout/user/:uid", optionsHandler)
+
+	// Session methods
+	admin.GET("/sessions", server.entry.sessions)
+	admin.DELETE("/sessions/:id", server.entry.closeSession)
+	admin.OPTIONS("/sessions", optionsHandler)
+	admin.OPTIONS("/sessions/:id", optionsHandler)
 
 	// Init API methods for the Nodes
+	server.GET("/nodes/count", server.Nodes.getCountRecords)
+	server.GET("/nodes/primary", server.Nodes.getPrimaryRecord)
 	server.GET("/nodes/:host/:port", server.Nodes.getRecord)
 	server.GET("/nodes/:host", server.Nodes.getAllRecordsByHost)
 	server.GET("/nodes", server.Nodes.getAllRecords)
-	server.PUT("/nodes/:host/:port", server.Nodes.putRecord)
-	server.PUT("/nodes", server.Nodes.putAllRecords)
-	server.DELETE("/nodes/:host/:port", server.Nodes.deleteRecord)
-	server.DELETE("/nodes/:host", server.Nodes.deleteAllRecordsByHost)
-	server.DELETE("/nodes", server.Nodes.deleteAllRecords)
 	server.OPTIONS("/nodes", optionsHandler)
 	server.OPTIONS("/nodes/:host", optionsHandler)
 	server.OPTIONS("/nodes/:host/:port", optionsHandler)
+	admin.PUT("/nodes/:host/:port", server.Nodes.putRecord)
+	admin.PUT("/nodes", server.Nodes.putAllRecords)
+	admin.DELETE("/nodes/:host/:port", server.Nodes.deleteRecord)
+	admin.DELETE("/nodes/:host", server.Nodes.deleteAllRecordsByHost)
+	admin.DELETE("/nodes", server.Nodes.deleteAllRecords)
+	admin.PUT("/nodes/:host/:port/canary", server.Nodes.putCanary)
+	admin.DELETE("/nodes/:host/:port/canary", server.Nodes.deleteCanary)
+	admin.OPTIONS("/nodes/:host/:port/canary", optionsHandler)
+	admin.PUT("/nodes/:host/:port/blackhole", server.Nodes.putBlackhole)
+	admin.DELETE("/nodes/:host/:port/blackhole", server.Nodes.deleteBlackhole)
+	admin.OPTIONS("/nodes/:host/:port/blackhole", optionsHandler)
+	admin.POST("/nodes/:host/:port/quiesce", server.quiesceNode)
+	admin.OPTIONS("/nodes/:host/:port/quiesce", optionsHandler)
+	admin.POST("/nodes/:host/:port/promote", server.Nodes.promoteRecord)
+	admin.POST("/nodes/swap", server.swapRecords)
+	admin.OPTIONS("/nodes/swap", optionsHandler)
+	admin.OPTIONS("/nodes/:host/:port/promote", optionsHandler)
+	admin.POST("/nodes/:host/:port/replay", server.replayRecord)
+	admin.OPTIONS("/nodes/:host/:port/replay", optionsHandler)
+	admin.POST("/nodes/healthcheck", server.recheckAllRecords)
+	admin.OPTIONS("/nodes/healthcheck", optionsHandler)
+	admin.POST("/nodes/:host/:port/healthcheck", server.recheckRecord)
+	admin.OPTIONS("/nodes/:host/:port/healthcheck", optionsHandler)
+	if admin != server.Router {
+		admin.OPTIONS("/nodes", optionsHandler)
+		admin.OPTIONS("/nodes/:host", optionsHandler)
+		admin.OPTIONS("/nodes/:host/:port", optionsHandler)
+	}
+
+	// Init API methods for the Routes
+	server.GET("/routes", server.getRoutes)
+	server.OPTIONS("/routes", optionsHandler)
+
+	// Init API methods for the Affinity
+	server.GET("/affinity", server.getAffinity)
+	server.OPTIONS("/affinity", optionsHandler)
+
+	// Init API methods for the Queues
+	server.GET("/queues", server.getQueues)
+	server.GET("/queues/:host/:port", server.getQueue)
+	server.OPTIONS("/queues", optionsHandler)
+	server.OPTIONS("/queues/:host/:port", optionsHandler)
+
+	// Init API methods for the delivery statuses of the updates in async mode
+	server.GET("/updates/:id", server.getUpdate)
+	server.OPTIONS("/updates/:id", optionsHandler)
+
+	// Init API methods for the failure injection
+	admin.GET("/chaos", server.getChaos)
+	admin.PUT("/chaos", server.putChaos)
+	admin.OPTIONS("/chaos", optionsHandler)
+
+	// Init API methods for the timeouts which could be changed at runtime
+	admin.GET("/config/timeout", server.getTimeouts)
+	admin.PUT("/config/timeout", server.putTimeouts)
+	admin.OPTIONS("/config/timeout", optionsHandler)
 
 	// Init API methods for the Metrics
-	server.GET("/metrics", server.Metrics.getMetrics)
+	admin.GET("/metrics", server.Metrics.getMetrics)
+	admin.GET("/metrics/rejections", server.getRejections)
+
+	// Init API method for the self-test through the proxy
+	admin.GET("/selftest", server.selfTest)
+
+	// Init profiling methods of the runtime, if they are enabled
+	if server.Options.Pprof {
+		setupPprof(admin)
+	}
 }
 
 // jobListener is routine which listen job signals and activate job controller
 func (server *Server) jobListener() {
 	defer func() {
 		if recovery := recover(); recovery != nil {
-			errlog.Println("Recovered in job listener routine", recovery)
-			// Recover routine
-			go server.jobListener()
+			if server.recovered("job listener", recovery) {
+				// Recover routine
+				go server.jobListener()
+				return
+			}
+			// the listener which is not recovered still answers the 'quit' signal
+			go func() {
+				<-server.quit
+				server.response <- struct{}{}
+			}()
 		} else {
 			stdlog.Println("Listener routine is stopped")
 			server.response <- struct{}{}
@@ -325,7 +718,7 @@ func (server *Server) jobListener() {
 func (server *Server) jobController(signal int) {
 	defer func() {
 		if recovery := recover(); recovery != nil {
-			errlog.Println("Recovered in job controller routine", recovery)
+			server.recovered("job controller", recovery)
 		}
 	}()
 	switch signal {
@@ -334,61 +727,172 @@ func (server *Server) jobController(signal int) {
 	case nodeJobSignal:
 		server.Nodes.updateRecords()
 		server.Nodes.InitRing()
+		server.Nodes.InitWeights()
 	}
 }
 
 // RoundTrip manages all requests/responses
-func (server *Server) RoundTrip(request *http.Request) (*http.Response, error) {
+func (server *Server) RoundTrip(request *http.Request) (response *http.Response, err error) {
+	defer func() {
+		if err != nil {
+			server.reject(request, err)
+		}
+	}()
 
-	// Add "X-Forwarded-For" to repost remote host IP
+	// the new requests are not accepted during the shutdown
+	if server.isShuttingDown() {
+		return nil, errShuttingDown
+	}
+
+	// Add "X-Forwarded-For" to repost remote host IP, the port is kept for compatibility only
 	if request.Header.Get("X-Forwarded-For") == "" {
-		request.Header.Add("X-Forwarded-For", request.RemoteAddr)
+		forwarded := remoteHost(request.RemoteAddr)
+		if server.Options.ForwardedForPort {
+			forwarded = request.RemoteAddr
+		}
+		request.Header.Add("X-Forwarded-For", forwarded)
+	}
+
+	// Add the trace context if it is absent
+	server.Options.Tracing.inject(request)
+
+	// Add the outbound headers of the nodes
+	server.injectHeaders(request)
+
+	// Add "X-Forwarded-Proto" with the scheme of the client connection
+	if server.Options.OverrideForwardedProto || request.Header.Get("X-Forwarded-Proto") == "" {
+		proto := protocolHTTP
+		if request.TLS != nil {
+			proto = protocolHTTPS
+		}
+		request.Header.Set("X-Forwarded-Proto", proto)
 	}
 
-	// Use HTTP scheme
+	// Use HTTP scheme, the scheme of the selected node is used on forwarding
 	request.URL.Scheme = protocolHTTP
 
+	// The Host header of the client is forwarded to the nodes in preserve host mode,
+	// otherwise the address of the selected node is used
+	host := request.Host
+	if !server.Options.PreserveHost {
+		request.Host = ""
+	}
+
+	// The request fails fast while the nodes are reconfigured
+	if !server.Nodes.available(time.Millisecond * server.Options.ReconfigureTimeout) {
+		return nil, &statusError{
+			code:       http.StatusServiceUnavailable,
+			message:    "The nodes are reconfigured, try again later",
+			retryAfter: 1,
+			reason:     RejectReconfigure,
+		}
+	}
+
 	// If requests could not be queued, get result immediately
 	if request.Method != methodPOST &&
 		request.Method != methodPUT &&
 		request.Method != methodDELETE {
 
-		return server.processReceive(request)
+		// The identical concurrent reads share one request to the node
+		if key := server.Options.Coalesce.key(request); key != "" {
+			return server.coalesce.do(key, request, func() (*http.Response, error) {
+				return server.processReceiveStale(request, host)
+			})
+		}
+
+		return server.processReceiveStale(request, host)
 	}
 
 	return server.processUpdate(request)
 }
 
+// receiveAttempt contains state of the request which is reproduced on the nodes
+type receiveAttempt struct {
+	request *http.Request
+
+	// count of the requests to the nodes
+	count int
+
+	// error which stops the selection of the nodes
+	err error
+
+	// the route of the request, nil means all nodes are used
+	route *Route
+
+	// the canary nodes which were skipped according to their weight
+	skipped []Node
+
+	// the local node (host:port) which was tried first
+	local string
+
+	// the nodes (host:port) of the affinity of the client which were tried first
+	tried map[string]bool
+
+	// deadline of the request across all attempts, zero time means no deadline
+	deadline time.Time
+
+	// the breakdown of time of the request, nil means the timing is disabled
+	timing *requestTiming
+}
+
 // calls 'GET' and others requests to the node using defined mode
-func (server *Server) processReceive(request *http.Request) (*http.Response, error) {
-	if server.roundRobin {
+func (server *Server) processReceive(request *http.Request) (result *http.Response, err error) {
+	attempt := &receiveAttempt{
+		request:  request,
+		route:    server.route(request),
+		deadline: server.requestDeadline(request),
+		timing:   server.startTiming(),
+	}
+	defer func() {
+		if err == nil {
+			attempt.timing.attach(result)
+		}
+	}()
+	server.retries.request()
+
+	// Use the local node first in prefer local mode
+	if server.Options.PreferLocal {
+		if response, ok := server.receiveLocal(attempt); ok {
+			return response, nil
+		}
+	}
+
+	// Use the nodes which are preferred for the network of the client
+	if response, ok := server.receiveAffinity(attempt); ok {
+		return response, nil
+	}
+
+	if server.Options.Adaptive.Header != "" {
+
+		// Use weighted selection according to the load reported by the nodes
+		if response, ok := server.receiveWeighted(attempt); ok {
+			return response, nil
+		}
+	} else if server.Options.WeightedRandom {
+
+		// Use random selection with probability proportional to weight of the node
+		if response, ok := server.receiveWeightedRandom(attempt); ok {
+			return response, nil
+		}
+	} else if server.roundRobin {
 
 		// Use round robin to get data from the host
-		for count := 0; count < server.Nodes.ring.Len(); count++ {
+		for count := 0; count < server.Nodes.ring.Len() && attempt.err == nil; count++ {
 			if node, ok := server.Nodes.CurrentFromRing(); ok &&
 				node.Active && !node.Maintenance {
 
-				// The host is active and is not in maintenance
-				request.URL.Host = fmt.Sprintf("%s:%d", node.Host, node.Port)
-
 				// Prepare next host
 				server.Nodes.TwistRing()
 
-				if server.checkNode(request.URL.Host) {
-
-					// set metrics
-					server.Metrics.SetMetrics(request.URL.Host, queuedMetric, request.Method)
+				// The canary host gets a part of the requests
+				if server.Nodes.skipCanary(node) {
+					attempt.skipped = append(attempt.skipped, node)
+					continue
+				}
 
-					response, err := server.transport.RoundTrip(request)
-					if err == nil {
-						// set metrics
-						server.Metrics.SetMetrics(request.URL.Host, successMetric, request.Method)
-						// If response is sucess, return
-						return response, nil
-					}
-					// set metrics
-					server.Metrics.SetMetrics(request.URL.Host, failureMetric, request.Method)
-					errlog.Println(err)
+				// The host is active and is not in maintenance
+				if response, ok := server.receiveFrom(attempt, node); ok {
+					return response, nil
 				}
 			} else {
 
@@ -400,106 +904,552 @@ func (server *Server) processReceive(request *http.Request) (*http.Response, err
 
 		// If is not round robin mode, use first registered host
 		if nodes, total := server.Nodes.GetAll(); total > 0 {
-			if server.byPriority {
-				sort.Sort(byPriority(nodes))
-			}
 			for _, node := range nodes {
-				if node.Active && !node.Maintenance {
+				if node.Active && !node.Maintenance && attempt.err == nil {
+
+					// The canary host gets a part of the requests
+					if server.Nodes.skipCanary(node) {
+						attempt.skipped = append(attempt.skipped, node)
+						continue
+					}
 
 					// The host is active and is not in maintenance
-					request.URL.Host = fmt.Sprintf("%s:%d", node.Host, node.Port)
-					if server.checkNode(request.URL.Host) {
-
-						// set metrics
-						server.Metrics.SetMetrics(request.URL.Host, queuedMetric, request.Method)
-
-						response, err := http.DefaultTransport.RoundTrip(request)
-						if err == nil {
-							// set metrics
-							server.Metrics.SetMetrics(request.URL.Host, successMetric, request.Method)
-							// If response is sucess, return
-							return response, nil
-						}
-						// set metrics
-						server.Metrics.SetMetrics(request.URL.Host, failureMetric, request.Method)
-						errlog.Println(err)
+					if response, ok := server.receiveFrom(attempt, node); ok {
+						return response, nil
 					}
 				}
 			}
 		}
 	}
 
-	return nil, errors.New("Warning: no one of the nodes is active")
+	// Use the skipped canary hosts if no one of the others could serve the request
+	for _, node := range attempt.skipped {
+		if attempt.err != nil {
+			break
+		}
+		if response, ok := server.receiveFrom(attempt, node); ok {
+			return response, nil
+		}
+	}
+	if attempt.err != nil {
+		return nil, attempt.err
+	}
+
+	// Use the nodes in maintenance as a last resort
+	if server.Options.Maintenance.ReadFallback {
+		return server.processReceiveMaintenance(attempt)
+	}
+
+	return nil, errNoActiveNodes
+}
+
+// receiveLocal reproduces the request on the local node if it is active and is not in maintenance,
+// the local node is not used again by the selection of the other nodes
+func (server *Server) receiveLocal(attempt *receiveAttempt) (*http.Response, bool) {
+	host, port, err := net.SplitHostPort(server.Options.LocalNode)
+	if err != nil {
+		return nil, false
+	}
+	number, err := strconv.ParseUint(port, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	node, ok := server.Nodes.Get(host, number)
+	if !ok || !node.Active || node.Maintenance {
+		return nil, false
+	}
+	response, ok := server.receiveFrom(attempt, node)
+	attempt.local = fmt.Sprintf("%s:%d", host, number)
+
+	return response, ok
+}
+
+// receiveFrom checks the node and reproduces the request on it,
+// returns false if the node could not serve the request
+func (server *Server) receiveFrom(attempt *receiveAttempt, node Node) (*http.Response, bool) {
+	// the node which does not serve the route is skipped
+	if !attempt.route.includes(node) {
+		return nil, false
+	}
+	request := attempt.request
+	request.URL.Scheme = node.scheme()
+	request.URL.Host = fmt.Sprintf("%s:%d", node.Host, node.Port)
+
+	// the local node and the nodes of the affinity which already failed are skipped
+	if request.URL.Host == attempt.local || attempt.tried[request.URL.Host] {
+		return nil, false
+	}
+
+	// the node which is blackholed does not get any traffic
+	if server.Nodes.isBlackhole(request.URL.Host) {
+		return nil, false
+	}
+	started := time.Now()
+	alive := server.checkNode(request.URL.Host)
+	attempt.timing.addCheck(started)
+	if !alive {
+		return nil, false
+	}
+
+	// the node which exceeds the rate limit is skipped
+	if !server.rates.allow(request.URL.Host, node.MaxRPS) {
+		// set metrics
+		server.Metrics.SetMetrics(request.URL.Host, rejectedMetric, request.Method)
+		return nil, false
+	}
+
+	// no one of the nodes is tried after the deadline of the request
+	if !attempt.deadline.IsZero() && time.Now().After(attempt.deadline) {
+		attempt.err = errDeadline
+		return nil, false
+	}
+
+	// every request except the first is a retry which is limited by the budget
+	attempt.count++
+	if attempt.count > 1 && !server.retries.retry() {
+		attempt.err = &statusError{
+			code:    http.StatusServiceUnavailable,
+			message: "The retry budget is exhausted",
+			reason:  RejectCapacity,
+		}
+		return nil, false
+	}
+
+	// set metrics
+	server.Metrics.SetMetrics(request.URL.Host, queuedMetric, request.Method)
+
+	// inject the failure in chaos mode
+	if err := server.chaos.inject(request.URL.Host); err != nil {
+		// set metrics
+		server.Metrics.SetMetrics(request.URL.Host, failureMetric, request.Method)
+		errlog.Println(err)
+		return nil, false
+	}
+
+	started = time.Now()
+	response, err := server.roundTripNode(request, time.Millisecond*node.Timeout, attempt.deadline)
+	attempt.timing.addBackend(started)
+	if err != nil {
+		// set metrics
+		server.Metrics.SetMetrics(request.URL.Host, failureMetric, request.Method)
+		errlog.Println(err)
+
+		// no one of the rest nodes is tried after the deadline
+		if err == errDeadline {
+			attempt.err = err
+			return nil, false
+		}
+
+		// the cached result of the health check is not trusted anymore
+		server.probes.invalidate(request.URL.Host)
+		return nil, false
+	}
+
+	// set metrics
+	server.Metrics.SetMetrics(request.URL.Host, successMetric, request.Method)
+	server.observeLoad(request.URL.Host, response)
+	server.exposeNode(request.URL.Host, response)
+
+	return response, true
+}
+
+// calls 'GET' and others requests to the node selected randomly according to its weight,
+// the nodes which failed are excluded from the next selection
+func (server *Server) receiveWeighted(attempt *receiveAttempt) (*http.Response, bool) {
+	var candidates []Node
+	var weights []float64
+	nodes, _ := server.Nodes.GetAll()
+	for _, node := range nodes {
+		if node.Active && !node.Maintenance {
+			candidates = append(candidates, node)
+			weights = append(weights, server.weights.weight(fmt.Sprintf("%s:%d", node.Host, node.Port))*
+				server.Nodes.canaryWeight(node)/100)
+		}
+	}
+	for len(candidates) > 0 && attempt.err == nil {
+		index := pickWeighted(server.random, weights)
+		node := candidates[index]
+		candidates = append(candidates[:index], candidates[index+1:]...)
+		weights = append(weights[:index], weights[index+1:]...)
+		if response, ok := server.receiveFrom(attempt, node); ok {
+			return response, true
+		}
+	}
+
+	return nil, false
+}
+
+// calls 'GET' and others requests to the node selected randomly according to its weight,
+// the node which failed is excluded from the next selection
+func (server *Server) receiveWeightedRandom(attempt *receiveAttempt) (*http.Response, bool) {
+	nodes, cumulative := server.Nodes.GetWeighted()
+	cumulative = server.Nodes.canaryCumulative(nodes, cumulative)
+	excluded := make(map[int]bool)
+	for len(excluded) < len(nodes) && attempt.err == nil {
+		index := pickCumulative(server.random, cumulative, excluded)
+		if index < 0 {
+			break
+		}
+		if response, ok := server.receiveFrom(attempt, nodes[index]); ok {
+			return response, true
+		}
+		excluded[index] = true
+	}
+
+	return nil, false
+}
+
+// calls 'GET' and others requests to the node which is in maintenance
+func (server *Server) processReceiveMaintenance(attempt *receiveAttempt) (*http.Response, error) {
+	if nodes, total := server.Nodes.GetAll(); total > 0 {
+		for _, node := range nodes {
+			if node.Active && node.Maintenance && attempt.err == nil {
+				stdlog.Println("Node", node.Host, node.Port, "is in maintenance, but used as a last resort")
+				if response, ok := server.receiveFrom(attempt, node); ok {
+					return response, nil
+				}
+			}
+		}
+	}
+	if attempt.err != nil {
+		return nil, attempt.err
+	}
+
+	return nil, errNoAvailableNodes
 }
 
 // call 'PUT', 'POST', 'DELETE' request to the node
-func (server *Server) processUpdate(request *http.Request) (*http.Response, error) {
+func (server *Server) processUpdate(request *http.Request) (response *http.Response, err error) {
+	// the health checks of the nodes are made by the workers and are counted as time of the nodes
+	timing := server.startTiming()
+	defer func() {
+		if err == nil {
+			timing.attach(response)
+		}
+	}()
+
+	// the body which exceeds the threshold is stored in temporary file
+	var body *spool
+	if threshold := server.Options.SpoolThreshold; threshold > 0 && request.Body != nil {
+		buffer, spooled, err := spoolBody(request.Body, threshold)
+		if err != nil {
+			return nil, err
+		}
+		if spooled != nil {
+			body = spooled
+			body.hold()
+			defer body.release()
+			request.ContentLength = body.size
+			request.TransferEncoding = nil
+			request.Header.Set("Content-Length", strconv.FormatInt(body.size, 10))
+		} else {
+			request.Body = ioutil.NopCloser(buffer)
+		}
+	}
+
+	// the update without body could be rejected by all or by some of the nodes
+	empty := body == nil && isEmptyUpdate(request)
+	if empty && server.Options.RejectEmptyUpdates {
+		return nil, errEmptyUpdate
+	}
+
+	// the mode of the acknowledgement is not forwarded to the nodes
+	accepted := server.isAccepted(request)
+	request.Header.Del(HeaderAccepted)
+
+	// the client gets the answer until the deadline of the request
+	requestDeadline := server.requestDeadline(request)
+
 	// grab update request
-	proxyRequestData, err := httputil.DumpRequest(request, true)
+	proxyRequestData, err := httputil.DumpRequest(request, body == nil)
 	if err != nil {
 
 		// if unsuccessful, return error
 		return nil, err
 	}
 	var host string
-	var response *http.Response
 	if nodes, total := server.Nodes.GetAll(); total > 0 {
+
+		// the update is delivered to the nodes of the route only
+		if route := server.route(request); route != nil {
+			if nodes = route.filter(nodes); len(nodes) == 0 {
+				return nil, errNoRouteNodes
+			}
+			total = len(nodes)
+		}
+
+		// the update without body is delivered to the nodes which accept it only
+		if empty {
+			if nodes = acceptEmpty(nodes); len(nodes) == 0 {
+				return nil, errEmptyUpdate
+			}
+			total = len(nodes)
+		}
+
+		// if no one of the workers could deliver the update, it may be rejected
+		if server.Options.Maintenance.RejectUpdates && !hasWorkingNode(nodes) {
+			for _, node := range nodes {
+				if node.Active {
+					// set metrics
+					server.Metrics.SetMetrics(fmt.Sprintf("%s:%d", node.Host, node.Port),
+						rejectedMetric, request.Method)
+				}
+			}
+			return nil, &statusError{
+				code:    http.StatusServiceUnavailable,
+				message: "The update is rejected, all nodes are inactive or in maintenance",
+				reason:  RejectNoNodes,
+			}
+		}
+		// the nodes with own response timeout change time of waiting for the answer
+		wait := responseWait(nodes, time.Second*server.getResponseTimeout())
+		if !requestDeadline.IsZero() && time.Until(requestDeadline) < wait {
+			wait = time.Until(requestDeadline)
+		}
 		answer := make(chan *http.Response, total)
-		done := make(chan struct{}, total)
-		for _, node := range nodes {
-			if node.Active {
+		done := make(chan struct{}, 1)
+		outcomes := make(chan updateOutcome, total)
+
+		// the client gets the statuses of all nodes instead of the answer in multi-status mode
+		multiStatus := server.Options.FanOut.WaitForAll && server.Options.FanOut.MultiStatus && !accepted
+
+		// only the primary node answers, the answers of the rest nodes are closed,
+		// the answers are not used if the client gets the statuses or the acknowledgement
+		primary := -1
+		var ignored chan struct{}
+		if server.Options.FanOut.Primary || multiStatus || accepted {
+			if server.Options.FanOut.Primary {
+				primary = primaryNode(nodes)
+			}
+			ignored = make(chan struct{}, 1)
+			ignored <- struct{}{}
+		}
 
+		// the jobs which are not started until the deadline will be aborted
+		var abort chan struct{}
+		var aborting *time.Timer
+		if deadline := server.Options.FanOut.Deadline; deadline > 0 && !server.Options.FanOut.WaitForAll {
+			abort = make(chan struct{})
+			aborting = time.AfterFunc(time.Second*deadline, func() { close(abort) })
+		}
+		var targets []string
+		var dropped int
+		fanOut := func() int {
+			targets = targets[:0]
+			dropped = 0
+			for index, node := range nodes {
+				if !node.Active {
+					continue
+				}
 				host = fmt.Sprintf("%s:%d", node.Host, node.Port)
 
+				// the update for the blackholed node is dropped
+				if server.Nodes.isBlackhole(host) {
+					dropped++
+					server.Metrics.SetMetrics(host, droppedMetric, request.Method)
+					continue
+				}
+				targets = append(targets, host)
+
 				// set metrics
 				server.Metrics.SetMetrics(host, queuedMetric, request.Method)
 
 				// create new queue job
 				job := &queueJob{
-					done:   done,
-					query:  make(chan []byte, 1),
-					method: request.Method,
-					answer: answer,
+					done:    done,
+					query:   make(chan []byte, 1),
+					method:  request.Method,
+					answer:  answer,
+					outcome: outcomes,
+					abort:   abort,
+					strict:  node.StrictOrder,
+					maxRPS:  node.MaxRPS,
+					timeout: time.Millisecond * node.Timeout,
+					scheme:  node.scheme(),
+					body:    body,
+				}
+				if multiStatus || accepted || (primary >= 0 && index != primary) {
+					job.done = ignored
+				}
+				if body != nil {
+					body.hold()
 				}
 				job.query <- proxyRequestData
 
 				queue, _ := server.queues.check(host)
-				queue.jobs <- job
-				queue.task <- doJobTask
+				queue.enqueue(job)
+			}
+			return len(targets)
+		}
+		result := fanOutResult{total: fanOut()}
+
+		// the deadline is not needed once all nodes have reported
+		defer func() {
+			if aborting != nil && result.complete() {
+				aborting.Stop()
+			}
+		}()
+		waiting := time.Now()
+		defer timing.addBackend(waiting)
+		if result.total == 0 && dropped > 0 {
+			return nil, &statusError{
+				code:     http.StatusServiceUnavailable,
+				message:  "The update is dropped, all active nodes are blackholed",
+				delivery: DeliveryNone,
+				reason:   RejectDelivery,
 			}
 		}
-		timeout := time.NewTimer(time.Second * server.responseTimeout)
+
+		// the answer of the node which failed the update is held until the update is
+		// delivered to another node or it is failed on all nodes
+		var held *http.Response
+		hold := func(response *http.Response) {
+			if held != nil {
+				held.Body.Close()
+			}
+			held = response
+
+			// the answer of the next node is accepted
+			<-done
+		}
+
+		// the update which is not delivered to any node is retried once after the delay
+		retried := !server.Options.FanOut.RetryFailed
+		var retry <-chan time.Time
+		timeout := time.NewTimer(wait)
+		defer timeout.Stop()
 		for {
 			select {
 			case response = <-answer:
+				if !(updateOutcome{status: response.StatusCode}).succeeded() {
+					hold(response)
+					continue
+				}
+				if held != nil {
+					held.Body.Close()
+				}
 				return response, nil
+			case outcome := <-outcomes:
+				result.add(outcome)
+
+				// the update is acknowledged after it is delivered to one of the nodes
+				if accepted && outcome.succeeded() {
+					return acceptedResponse(request, targets)
+				}
+				if !result.failedAll() {
+					if multiStatus && result.complete() {
+						return multiStatusResponse(request, targets, result)
+					}
+					if accepted && result.complete() {
+						return nil, &statusError{
+							code:     http.StatusBadGateway,
+							message:  "The update is not accepted by any node",
+							delivery: result.delivery(),
+							reason:   RejectDelivery,
+						}
+					}
+					continue
+				}
+				// the answers are delivered before the outcomes, so the last one is received already
+				select {
+				case response = <-answer:
+					hold(response)
+				default:
+				}
+				if !retried {
+					retried = true
+					delay := time.Millisecond * server.Options.FanOut.RetryDelay
+					stdlog.Println("Update is not delivered to any node, retry in", delay)
+					retry = time.After(delay)
+					continue
+				}
+				if multiStatus {
+					return multiStatusResponse(request, targets, result)
+				}
+
+				// the client gets the answer of the node, if the update is answered
+				if held != nil {
+					held.Header.Set(HeaderDelivery, result.delivery())
+					return held, nil
+				}
+				return nil, &statusError{
+					code:     http.StatusBadGateway,
+					message:  "The update is not delivered to any node: " + strings.Join(result.failed, ", "),
+					delivery: result.delivery(),
+					reason:   RejectDelivery,
+				}
+			case <-retry:
+				retry = nil
+				if held != nil {
+					held.Body.Close()
+					held = nil
+				}
+				result = fanOutResult{total: fanOut()}
 			case <-timeout.C:
-				return response, errors.New("timeout")
+				if multiStatus {
+					return multiStatusResponse(request, targets, result)
+				}
+
+				// the client gets the answer of the node which failed the update, the answers
+				// of the rest nodes are closed
+				if held != nil {
+					discardAnswer(done, answer)
+					return held, nil
+				}
+
+				// the client checks the delivery of the update later in async mode
+				if server.Options.AsyncUpdates.Enabled {
+					discardAnswer(done, answer)
+					return server.asyncResponse(request, targets, result, outcomes)
+				}
+
+				// the answer which comes after the timeout is not read by anyone
+				discardAnswer(done, answer)
+				return nil, &statusError{
+					code:     http.StatusGatewayTimeout,
+					message:  "The update is not answered in time",
+					delivery: result.delivery(),
+				}
 			}
 		}
 	}
-	return response, errors.New("The nodes are not defined")
+	return response, errNodesNotDefined
+}
+
+// hasWorkingNode checks that at least one of the nodes is active and is not in maintenance
+func hasWorkingNode(nodes []Node) bool {
+	for _, node := range nodes {
+		if node.Active && !node.Maintenance {
+			return true
+		}
+	}
+	return false
 }
 
 // worker receives a data from the queue and send it to the node
 func (server *Server) worker(q *queue) {
 	defer func() {
 		if recovery := recover(); recovery != nil {
-			errlog.Println("Recovered in worker routine", recovery)
-			// the worker recovers again
-			go server.worker(q)
+			if server.recovered("worker "+q.id, recovery) {
+				// the worker recovers again
+				go server.worker(q)
+			}
 		} else {
 			q.response <- struct{}{}
 			stdlog.Println("Worker is closed for", q.id)
 		}
 	}()
 	stdlog.Println("Worker is started for", q.id)
+	q.setWorking(true)
+	defer q.setWorking(false)
 	for {
 		select {
 		case task := <-q.task:
 			switch task {
 			case doJobTask:
-				server.doUpdate(q)
+				if server.doUpdate(q) {
+					return
+				}
 			}
 			continue
 		default:
@@ -508,7 +1458,9 @@ func (server *Server) worker(q *queue) {
 		case task := <-q.task:
 			switch task {
 			case doJobTask:
-				server.doUpdate(q)
+				if server.doUpdate(q) {
+					return
+				}
 			}
 			continue
 		case <-q.quit:
@@ -519,57 +1471,176 @@ func (server *Server) worker(q *queue) {
 	}
 }
 
-func (server *Server) doUpdate(q *queue) {
+// workerWarmup returns maximum time of waiting for the started worker to be ready
+func (server *Server) workerWarmup() time.Duration {
+	if server.Options.WorkerWarmup > 0 {
+		return time.Millisecond * server.Options.WorkerWarmup
+	}
+	return time.Millisecond * DefaultWorkerWarmup
+}
+
+// startWorker starts the worker of the queue and waits until it is ready for the updates,
+// so the node is not considered ready for dispatch before its worker is reading the queue
+func (server *Server) startWorker(q *queue) {
+	go server.worker(q)
+	server.warmupWorker(q)
+}
+
+// warmupWorker waits until the started worker of the queue is ready for the updates
+func (server *Server) warmupWorker(q *queue) {
+	if !waitWorker(q, server.workerWarmup()) {
+		errlog.Println("Worker of", q.id, "is not ready during warmup", server.workerWarmup())
+	}
+}
+
+// doUpdate posts the next job of the queue to the node,
+// returns true if the worker got 'quit' command while waiting for the node
+func (server *Server) doUpdate(q *queue) (quit bool) {
 	// check the node
 	for {
 		if server.checkNode(q.id) {
+			q.unready = time.Time{}
 			break
 		}
+		if q.unready.IsZero() {
+			q.unready = time.Now()
+		}
+		if timeout := time.Second * server.check.ReadinessTimeout; timeout > 0 &&
+			time.Since(q.unready) >= timeout {
+			server.abandonUpdate(q, timeout)
+			return
+		}
+		interval := server.checkInterval()
 		stdlog.Println("Node", q.id, "does not ready for updates")
-		stdlog.Println("try again in", server.check.Seconds, "seconds")
-		timeout := time.NewTimer(time.Second * server.check.Seconds)
+		stdlog.Println("try again in", interval)
+		timeout := time.NewTimer(interval)
 		select {
 		//  Repeat by timeout
 		case <-timeout.C:
 			continue
 		case <-q.quit:
 			q.task <- doJobTask
-			return
+			return true
 		case <-q.ask:
 			q.response <- struct{}{}
 		}
 	}
 	// if the node is alive, post data
-	job := <-q.jobs
+	job := q.next()
 	data := <-job.query
-	if response, err := server.dispatchRequest(q.id, data); err != nil {
+	if job.body != nil {
+		defer job.body.release()
+	}
+
+	// the updates are throttled according to the rate limit of the node
+	if wait := server.rates.reserve(q.id, job.maxRPS); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-job.abort:
+			timer.Stop()
+		}
+	}
+	select {
+	case <-job.abort:
+
+		// set metrics
+		server.Metrics.SetMetrics(q.id, failureMetric, job.method)
+		stdlog.Println("Update for", q.id, "is aborted by deadline")
+		job.report(q.id, 0, errors.New("aborted by deadline"))
+		return
+	default:
+	}
+	if response, err := server.dispatchRequest(q.id, job.scheme, data, job.body, job.timeout); err != nil {
 
 		// set metrics
 		server.Metrics.SetMetrics(q.id, failureMetric, job.method)
 
 		// Job does not done
 		errlog.Println(err)
+		server.deadLetter(q.id, job, data)
+		job.report(q.id, 0, err)
 
 	} else {
 
 		// set metrics
 		server.Metrics.SetMetrics(q.id, successMetric, job.method)
+		server.observeLoad(q.id, response)
+		server.exposeNode(q.id, response)
 
-		// job done
-		if len(job.done) == 0 {
-			// send first response and done signal
-			job.done <- struct{}{}
-			job.answer <- response
-		} else {
-			// just close connection
-			response.Body.Close()
+		// the update which is failed by the node is kept for the replay
+		if response.StatusCode >= http.StatusInternalServerError {
+			server.deadLetter(q.id, job, data)
 		}
+
+		// job done, the answer is delivered before the outcome is reported,
+		// so the answer is known once the outcomes of all nodes are collected
+		status := response.StatusCode
+		job.deliver(response)
+		job.report(q.id, status, nil)
 	}
+
+	return
 }
 
-// checks the node
+// abandonUpdate drops the next job of the queue of the node which is not ready for the updates,
+// the update is written to the log as dead letter
+func (server *Server) abandonUpdate(q *queue, timeout time.Duration) {
+	job := q.next()
+	data := <-job.query
+	server.deadLetter(q.id, job, data)
+	if job.body != nil {
+		job.body.release()
+	}
+
+	// set metrics
+	server.Metrics.SetMetrics(q.id, failureMetric, job.method)
+
+	line := string(data)
+	if index := strings.Index(line, "\r\n"); index >= 0 {
+		line = line[:index]
+	}
+	errlog.Println("Dead letter:", line, "for", q.id, "is abandoned, the node is not ready for", timeout)
+	job.report(q.id, 0, errors.New("the node is not ready for updates"))
+}
+
+// exposeNode adds the node which produced the response to its header, if it is enabled
+func (server *Server) exposeNode(id string, response *http.Response) {
+	if server.Options.ExposeNode {
+		response.Header.Set(HeaderNode, id)
+	}
+	if server.Options.ExposeAnnotations {
+		server.exposeAnnotations(id, response)
+	}
+}
+
+// checkInterval returns the interval between the checks of the node
+// randomized by jitter to avoid the checks of all nodes at the same time
+func (server *Server) checkInterval() time.Duration {
+	interval := time.Second * server.check.Seconds
+	if jitter := server.check.Jitter; jitter > 0 && jitter <= 1 {
+		interval += time.Duration(float64(interval) * jitter * (2*server.random.Float64() - 1))
+	}
+	return interval
+}
+
+// checks the node, the concurrent checks of the same node share one probe
 func (server *Server) checkNode(host string) bool {
-	response, err := http.Get(protocolHTTP + "://" + host + server.check.URL)
+	return server.probes.check(host, time.Millisecond*server.check.Freshness, server.prober())
+}
+
+// probes the node by health check url
+func (server *Server) probeNode(host string) bool {
+	request, err := server.probeRequest(host)
+	if err != nil {
+		errlog.Println(err)
+		return false
+	}
+	client := server.probeClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
 	if err != nil {
 		return false
 	}
@@ -589,40 +1660,83 @@ func (server *Server) checkNode(host string) bool {
 	return valid.MatchString(string(data))
 }
 
-// Reproduces request to specified node and capture response
-func (server *Server) dispatchRequest(host string, data []byte) (*http.Response, error) {
+// Reproduces request to specified node and capture response,
+// the response is waited until the timeout of the node, if it is defined
+func (server *Server) dispatchRequest(host, scheme string, data []byte, body *spool,
+	timeout time.Duration) (*http.Response, error) {
 	reader := bufio.NewReader(bytes.NewBuffer(data))
 	request, err := http.ReadRequest(reader)
 	if err != nil {
 		return nil, err
 	}
 	request.Body = ioutil.NopCloser(reader)
-	request.URL.Scheme = protocolHTTP
+	if body != nil {
+		request.Body = body.reader()
+		request.ContentLength = body.size
+	}
+	request.URL.Scheme = scheme
 	request.URL.Host = host
 
-	response, err := server.transport.RoundTrip(request)
+	response, err := server.roundTripNode(request, timeout, time.Time{})
 	if err != nil {
 		return nil, err
 	}
 	return response, nil
 }
 
-func (server *Server) baseHandler(handle router.Handle) router.Handle {
-	return func(c *router.Control) {
-		if c.Get("pretty") != "true" {
-			c.CompactJSON(true)
-		}
-		if origin := c.Request.Header.Get("Origin"); origin != "" {
-			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
-			c.Writer.Header().Set("Access-Control-Allow-Credentials", "false")
-		}
-		if method := c.Request.Header.Get("Access-Control-Request-Method"); method != "" {
-			allowedMethods := server.Router.AllowedMethods(c.Request.URL.Path)
-			c.Writer.Header().Set("Access-Control-Allow-Methods", strings.Join(allowedMethods, ", "))
+// newRouter creates the router with common handlers
+func (server *Server) newRouter() *router.Router {
+	r := router.New()
+	r.PanicHandler = func(c *router.Control) {
+		c.Code(http.StatusInternalServerError).Body(c.Request)
+	}
+	r.NotFound = server.trailingSlashHandler(r)
+	if server.Options.AccessLog == "" {
+		r.Logger = logger
+	}
+	r.CustomHandler = server.baseHandler(r)
+
+	return r
+}
+
+func (server *Server) baseHandler(r *router.Router) func(router.Handle) router.Handle {
+	return func(handle router.Handle) router.Handle {
+		return func(c *router.Control) {
+			if c.Get("pretty") != "true" {
+				c.CompactJSON(true)
+			}
+			if !server.apiAccess.allow(c.Request) {
+				accessDenied(c)
+				return
+			}
+			server.setCORS(r, c)
+			if cw := server.Options.Compression.newCompressWriter(c.Writer, c.Request); cw != nil {
+				writer := c.Writer
+				c.Writer = cw
+				handle(c)
+				c.Writer = writer
+				if err := cw.close(&server.Options.Compression); err != nil {
+					errlog.Println("Compression of response:", err)
+				}
+				return
+			}
+			handle(c)
 		}
-		if headers := c.Request.Header.Get("Access-Control-Request-Headers"); headers != "" {
-			c.Writer.Header().Set("Access-Control-Allow-Headers", "content-type")
+	}
+}
+
+// trailingSlashHandler routes the path with trailing slash to the same handler
+// as the path without slash, if it is not found, returns not found message
+func (server *Server) trailingSlashHandler(r *router.Router) router.Handle {
+	return func(c *router.Control) {
+		path := c.Request.URL.Path
+		if len(path) > 1 && strings.HasSuffix(path, "/") {
+			if trimmed := "/" + strings.Trim(path, "/"); len(r.AllowedMethods(trimmed)) > 0 {
+				c.Request.URL.Path = trimmed
+				r.ServeHTTP(c.Writer, c.Request)
+				return
+			}
 		}
-		handle(c)
+		notFound(c)
 	}
 }
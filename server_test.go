@@ -3,17 +3,22 @@ package spawn
 import (
 	"bufio"
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"sort"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/openprovider/spawn/auth"
+	"github.com/takama/router"
 )
 
 type testAnswer struct {
@@ -114,6 +119,14 @@ func TestServer(t *testing.T) {
 	test(t, response.StatusCode == http.StatusOK,
 		"Expected to get /list method with ok status, got", response.StatusCode)
 
+	// Test /version method
+	testPath = "/version"
+	url = "http://" + apiHost + testPath
+	response, err = http.Get(url)
+	test(t, err == nil, "Expected to get /version method, got", err)
+	test(t, response.StatusCode == http.StatusOK,
+		"Expected to get /version method with ok status, got", response.StatusCode)
+
 	// activate nodes (listen and serve)
 	for _, node := range config.Nodes {
 		id := fmt.Sprintf("%s:%d", node.Host, node.Port)
@@ -329,3 +342,230 @@ func (tp *testProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(content)
 }
+
+func TestPreserveHost(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer node.Close()
+	address := node.Listener.Addr().String()
+	host, port, _ := net.SplitHostPort(address)
+	number, _ := strconv.ParseUint(port, 10, 64)
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: host, Port: number, Active: true}})
+	server.job <- responseSignal
+	<-server.response
+
+	forwarded := func() string {
+		request, err := http.NewRequest("GET", "http://example.com/", nil)
+		test(t, err == nil, "Expected create a new request, got", err)
+		response, err := server.RoundTrip(request)
+		test(t, err == nil, "Expected the response of the node, got", err)
+		defer response.Body.Close()
+		data, _ := ioutil.ReadAll(response.Body)
+		return string(data)
+	}
+
+	got := forwarded()
+	test(t, got == address, "Expected the address of the node as Host header, got", got)
+
+	server.Options.PreserveHost = true
+	got = forwarded()
+	test(t, got == "example.com", "Expected the Host header of the client, got", got)
+}
+
+func TestExposeNode(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer node.Close()
+	address := node.Listener.Addr().String()
+	host, port, _ := net.SplitHostPort(address)
+	number, _ := strconv.ParseUint(port, 10, 64)
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: host, Port: number, Active: true}})
+	server.job <- responseSignal
+	<-server.response
+
+	exposed := func(method string) string {
+		request, err := http.NewRequest(method, "http://example.com/", bytes.NewBufferString("data"))
+		test(t, err == nil, "Expected create a new request, got", err)
+		response, err := server.RoundTrip(request)
+		test(t, err == nil, "Expected the response of the node, got", err)
+		response.Body.Close()
+		return response.Header.Get(HeaderNode)
+	}
+
+	test(t, exposed(methodGET) == "", "Expected the node is not exposed by default")
+
+	server.Options.ExposeNode = true
+	got := exposed(methodGET)
+	test(t, got == address, "Expected the node of the read, got", got)
+	got = exposed(methodPOST)
+	test(t, got == address, "Expected the node of the update, got", got)
+}
+
+func TestPreferLocal(t *testing.T) {
+	var nodes []Node
+	var servers []*httptest.Server
+	for i := 0; i < 2; i++ {
+		name := strconv.Itoa(i)
+		node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		defer node.Close()
+		host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+		number, _ := strconv.ParseUint(port, 10, 64)
+		nodes = append(nodes, Node{Host: host, Port: number, Active: true})
+		servers = append(servers, node)
+	}
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.Options.PreferLocal = true
+	server.Options.LocalNode = servers[1].Listener.Addr().String()
+	go server.jobListener()
+	server.Nodes.SetAll(nodes)
+	server.job <- responseSignal
+	<-server.response
+
+	received := func() string {
+		request, err := http.NewRequest("GET", "http://example.com/", nil)
+		test(t, err == nil, "Expected create a new request, got", err)
+		response, err := server.RoundTrip(request)
+		test(t, err == nil, "Expected the response of the node, got", err)
+		defer response.Body.Close()
+		data, _ := ioutil.ReadAll(response.Body)
+		return string(data)
+	}
+
+	got := received()
+	test(t, got == "1", "Expected the response of the local node, got", got)
+
+	// the other node is used when the local node fails
+	servers[1].Close()
+	got = received()
+	test(t, got == "0", "Expected the response of the remote node, got", got)
+}
+
+func TestForwardedProto(t *testing.T) {
+	node := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		w.Write([]byte(r.Header.Get("X-Forwarded-Proto")))
+	}))
+	defer node.Close()
+	host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+	number, _ := strconv.ParseUint(port, 10, 64)
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = node.Client().Transport
+	server.responseTimeout = 5
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: host, Port: number, Active: true, TLS: true}})
+	server.job <- responseSignal
+	<-server.response
+
+	forwarded := func(method, proto string, secure bool) string {
+		request, err := http.NewRequest(method, "http://example.com/", nil)
+		test(t, err == nil, "Expected create a new request, got", err)
+		if proto != "" {
+			request.Header.Set("X-Forwarded-Proto", proto)
+		}
+		if secure {
+			request.TLS = &tls.ConnectionState{}
+		}
+		response, err := server.RoundTrip(request)
+		test(t, err == nil, "Expected the response of the node, got", err)
+		defer response.Body.Close()
+		test(t, response.StatusCode == http.StatusOK, "Expected the request over TLS, got", response.StatusCode)
+		data, _ := ioutil.ReadAll(response.Body)
+		return string(data)
+	}
+
+	got := forwarded("GET", "", false)
+	test(t, got == "http", "Expected http scheme of the client, got", got)
+	got = forwarded(methodPOST, "", true)
+	test(t, got == "https", "Expected https scheme of the client, got", got)
+	got = forwarded("GET", "https", false)
+	test(t, got == "https", "Expected the header of the client, got", got)
+
+	server.Options.OverrideForwardedProto = true
+	got = forwarded("GET", "https", false)
+	test(t, got == "http", "Expected the scheme of the connection, got", got)
+}
+
+func TestForwardedFor(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Forwarded-For")))
+	}))
+	defer node.Close()
+	host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+	number, _ := strconv.ParseUint(port, 10, 64)
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.responseTimeout = 5
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: host, Port: number, Active: true}})
+	server.job <- responseSignal
+	<-server.response
+
+	forwarded := func() string {
+		request, err := http.NewRequest("GET", "http://example.com/", nil)
+		test(t, err == nil, "Expected create a new request, got", err)
+		request.RemoteAddr = "192.0.2.1:54321"
+		response, err := server.RoundTrip(request)
+		test(t, err == nil, "Expected the response of the node, got", err)
+		defer response.Body.Close()
+		data, _ := ioutil.ReadAll(response.Body)
+		return string(data)
+	}
+
+	got := forwarded()
+	test(t, got == "192.0.2.1", "Expected the address of the client without port, got", got)
+
+	server.Options.ForwardedForPort = true
+	got = forwarded()
+	test(t, got == "192.0.2.1:54321", "Expected the address of the client with port, got", got)
+}
+
+func TestTrailingSlash(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.setupRoutes()
+
+	code := func(path string) int {
+		request, _ := http.NewRequest("GET", path, nil)
+		recorder := httptest.NewRecorder()
+		server.Router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	for _, path := range []string{"/version/", "/list/nodes/", "/list/nodes//"} {
+		test(t, code(path) == http.StatusOK, "Expected the path", path, "is routed to the handler, got", code(path))
+	}
+	test(t, code("/unknown/") == http.StatusNotFound, "Expected unknown path is not found, got", code("/unknown/"))
+	test(t, code("/") == http.StatusOK, "Expected the root path is routed to the handler, got", code("/"))
+
+	// the handler of not found paths routes the path without slash
+	for path, expected := range map[string]int{
+		"/version/": http.StatusOK, "/unknown/": http.StatusNotFound, "/version": http.StatusNotFound,
+	} {
+		request, _ := http.NewRequest("GET", path, nil)
+		recorder := httptest.NewRecorder()
+		server.trailingSlashHandler(server.Router)(&router.Control{Request: request, Writer: recorder})
+		test(t, recorder.Code == expected, "Expected status", expected, "for", path, "got", recorder.Code)
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// errShuttingDown is returned for the new requests after the start of the shutdown,
+// the connection of the client is closed, so it reconnects to another instance
+var errShuttingDown = &statusError{
+	code:            http.StatusServiceUnavailable,
+	message:         "The service is shutting down",
+	retryAfter:      1,
+	reason:          RejectShutdown,
+	closeConnection: true,
+}
+
+// setShuttingDown marks the start of the shutdown
+func (server *Server) setShuttingDown() {
+	atomic.StoreInt32(&server.shuttingDown, 1)
+}
+
+// isShuttingDown checks that the shutdown is started
+func (server *Server) isShuttingDown() bool {
+	return atomic.LoadInt32(&server.shuttingDown) == 1
+}
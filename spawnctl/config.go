@@ -7,8 +7,14 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"net"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/openprovider/spawn"
@@ -26,7 +32,14 @@ const (
 	defaultCheckURL     = "/"
 	defaultCheckPattern = ""
 
+	defaultCheckFreshness   = 0
+	defaultCheckConcurrency = 0
+	defaultCheckJitter      = 0.1
+
 	defaultAuthExpirationTime time.Duration = 30
+
+	// prefix of the environment variables
+	envPrefix = "SPAWN_"
 )
 
 // Config - Application configuration
@@ -41,6 +54,9 @@ type Config struct {
 	QueryMode struct {
 		RoundRobin bool `json:"round-robin"`
 		ByPriority bool `json:"by-priority"`
+
+		WeightedRandom bool `json:"weighted-random"`
+		PreferLocal    bool `json:"prefer-local"`
 	} `json:"query-mode"`
 
 	Check spawn.HealthCheck `json:"health-check"`
@@ -50,11 +66,21 @@ type Config struct {
 		Port int    `json:"port"`
 	} `json:"api"`
 
+	Admin struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	} `json:"admin"`
+
 	TestMode bool `json:"testMode"`
 
+	// number of CPUs which are used by the service, zero value means automatic detection
+	MaxProcs int `json:"max-procs"`
+
 	Nodes []spawn.Node `json:"nodes"`
 
 	AuthEngine auth.AuthConfig `json:"auth"`
+
+	spawn.Options
 }
 
 // New - returns new config record initialized with default values
@@ -62,6 +88,26 @@ func newConfig() *Config {
 	config := new(Config)
 	var authType string
 	var authExpirationTime int
+	var retryBudgetWindow int
+	var fanOutDeadline int
+	var fanOutRetryDelay int
+	var checkFreshness int
+	var checkReadinessTimeout int
+	var reconfigureTimeout int
+	var loginWindow, loginLockout int
+	var canaryRamp int
+	var shutdownTimeout int
+	var quiesceTimeout int
+	var maxResponseTimeout int
+	var workerWarmup int
+	var asyncRetention int
+	var statsdInterval int
+	var swapTimeout int
+	var staleMaxAge int
+	var requestDeadline int
+	var dialTimeout, responseTimeout int
+	var recoveryWindow int
+	var discoveryInterval int
 	flag.BoolVar(&config.ShowVersion, "version", false, "show version")
 	flag.BoolVar(&config.ShowVersion, "v", false, "show version")
 	flag.BoolVar(&config.TestMode, "t", config.TestMode, "")
@@ -70,23 +116,184 @@ func newConfig() *Config {
 		defaultConfigPath, "path to configuration file")
 	flag.StringVar(&config.Host, "host", defaultHost, "host name or IP address")
 	flag.IntVar(&config.Port, "port", defaultPort, "port number")
+	flag.IntVar(&config.MaxProcs, "max-procs", config.MaxProcs, "number of CPUs which are used by the service")
 	flag.BoolVar(&config.QueryMode.RoundRobin, "round-robin",
 		config.QueryMode.RoundRobin, "use round-robin mode for querying of the nodes")
 	flag.BoolVar(&config.QueryMode.ByPriority, "by-priority",
 		config.QueryMode.ByPriority, "nodes will be operating according to priority")
+	flag.BoolVar(&config.QueryMode.WeightedRandom, "weighted-random",
+		config.QueryMode.WeightedRandom, "select nodes randomly according to weight")
+	flag.BoolVar(&config.QueryMode.PreferLocal, "prefer-local",
+		config.QueryMode.PreferLocal, "prefer local node for reads")
+	flag.StringVar(&config.LocalNode, "local-node",
+		config.LocalNode, "local node (host:port) which is colocated with server")
 	flag.DurationVar(&config.Check.Seconds, "check-sec",
 		defaultCheckSec, "check nodes every number of seconds")
 	flag.StringVar(&config.Check.URL, "check-url",
 		defaultCheckURL, "url to check node")
 	flag.StringVar(&config.Check.Pattern, "check-regexp",
 		defaultCheckPattern, "regexp pattern to check node")
+	flag.StringVar(&config.Check.Host, "check-host",
+		config.Check.Host, "Host header and TLS server name of node check")
+	flag.BoolVar(&config.Check.TLS, "check-tls", config.Check.TLS, "check node over TLS")
+	flag.IntVar(&checkFreshness, "check-freshness",
+		defaultCheckFreshness, "share result of the node check during number of milliseconds")
+	flag.IntVar(&config.Check.Concurrency, "check-concurrency",
+		defaultCheckConcurrency, "maximum number of the node checks at the same time")
+	flag.Float64Var(&config.Check.Jitter, "check-jitter",
+		defaultCheckJitter, "randomized fraction of the node check interval")
+	flag.IntVar(&config.Check.FailureThreshold, "check-failure-threshold",
+		0, "number of consecutive failed checks to mark node down")
+	flag.IntVar(&config.Check.SuccessThreshold, "check-success-threshold",
+		0, "number of consecutive successful checks to mark node up")
+	flag.IntVar(&checkReadinessTimeout, "check-readiness-timeout",
+		0, "seconds of waiting for node before its updates are abandoned")
 	flag.StringVar(&config.API.Host, "api-host",
 		defaultAPIHost, "API host name or IP address")
 	flag.IntVar(&config.API.Port, "api-port", defaultPort, "API port number")
-	flag.StringVar(&authType, "auth", "guest", "type of auth (LDAP, oAuth)")
+	flag.StringVar(&config.Admin.Host, "admin-host",
+		defaultAPIHost, "admin API host name or IP address")
+	flag.IntVar(&config.Admin.Port, "admin-port", 0, "admin API port number")
+	flag.BoolVar(&config.Maintenance.RejectUpdates, "maintenance-reject-updates",
+		config.Maintenance.RejectUpdates, "reject updates if all nodes are in maintenance")
+	flag.BoolVar(&config.Maintenance.ReadFallback, "maintenance-read-fallback",
+		config.Maintenance.ReadFallback, "use nodes in maintenance for reads as a last resort")
+	flag.BoolVar(&config.ProxyProtocol, "proxy-protocol",
+		config.ProxyProtocol, "read PROXY protocol header of the service connections")
+	flag.Int64Var(&config.Seed, "seed", config.Seed, "seed of random selection of nodes (default: time based)")
+	flag.IntVar(&config.RingOffset, "ring-offset", config.RingOffset, "position of first node in round-robin mode")
+	flag.BoolVar(&config.ExposeNode, "expose-node",
+		config.ExposeNode, "add node which produced response to X-Spawn-Node header")
+	flag.BoolVar(&config.ExposeAnnotations, "expose-annotations",
+		config.ExposeAnnotations, "add annotations of node to X-Spawn-Annotation-<Key> headers")
+	flag.StringVar(&config.StatsD.Address, "statsd",
+		config.StatsD.Address, "host:port of StatsD server of the metrics of the nodes")
+	flag.IntVar(&statsdInterval, "statsd-interval", 0, "time between flushes of metrics to StatsD in seconds")
+	flag.StringVar(&config.StatsD.Prefix, "statsd-prefix", config.StatsD.Prefix, "prefix of names of StatsD metrics")
+	flag.BoolVar(&config.StatsD.Tags, "statsd-tags",
+		config.StatsD.Tags, "send node and method as DogStatsD tags")
+	flag.BoolVar(&config.RejectLog.Enabled, "reject-log",
+		config.RejectLog.Enabled, "log rejected requests with their reason")
+	flag.Uint64Var(&config.RejectLog.Sample, "reject-log-sample",
+		config.RejectLog.Sample, "every n-th rejected request of the reason is logged")
+	flag.BoolVar(&config.RejectEmptyUpdates, "reject-empty-updates",
+		config.RejectEmptyUpdates, "reject updates (PUT, POST) without body")
+	flag.BoolVar(&config.StrictDecoding, "strict-decoding",
+		config.StrictDecoding, "reject unknown fields of records of API mutation methods")
+	flag.BoolVar(&config.OverrideForwardedProto, "override-forwarded-proto",
+		config.OverrideForwardedProto, "replace X-Forwarded-Proto of client by scheme of connection")
+	flag.BoolVar(&config.ForwardedForPort, "forwarded-for-port",
+		config.ForwardedForPort, "keep port of client in X-Forwarded-For header")
+	flag.BoolVar(&config.Timing, "timing",
+		config.Timing, "add breakdown of time of request to X-Spawn-Timing header")
+	flag.BoolVar(&config.PreserveHost, "preserve-host",
+		config.PreserveHost, "forward the Host header of the client to the nodes")
+	flag.StringVar(&config.AccessLog, "access-log",
+		config.AccessLog, "format of access log (common, combined)")
+	flag.StringVar(&config.Adaptive.Header, "adaptive-header",
+		config.Adaptive.Header, "response header which contains load of the node")
+	flag.Float64Var(&config.Adaptive.Smoothing, "adaptive-smoothing",
+		config.Adaptive.Smoothing, "smoothing factor of load of the node")
+	flag.IntVar(&fanOutDeadline, "fan-out-deadline", 0, "deadline of delivery of updates in seconds")
+	flag.BoolVar(&config.FanOut.WaitForAll, "fan-out-wait-for-all",
+		config.FanOut.WaitForAll, "deliver updates to all nodes regardless of deadline")
+	flag.BoolVar(&config.FanOut.MultiStatus, "fan-out-multi-status",
+		config.FanOut.MultiStatus, "return 207 Multi-Status with statuses of all nodes")
+	flag.BoolVar(&config.FanOut.Primary, "fan-out-primary",
+		config.FanOut.Primary, "return answer of primary node to update")
+	flag.BoolVar(&config.FanOut.Accepted, "fan-out-accepted",
+		config.FanOut.Accepted, "return 202 Accepted status with list of nodes to update")
+	flag.BoolVar(&config.FanOut.RetryFailed, "fan-out-retry-failed",
+		config.FanOut.RetryFailed, "retry update once if it is not delivered to any node")
+	flag.IntVar(&fanOutRetryDelay, "fan-out-retry-delay", 0, "delay before retry of failed update in milliseconds")
+	flag.BoolVar(&config.Pprof, "pprof", config.Pprof, "enable profiling methods under /debug/pprof")
+	flag.StringVar(&config.SelfTestPath, "self-test-path",
+		config.SelfTestPath, "path of self-test request through proxy")
+	flag.BoolVar(&config.APIAccess.Enabled, "api-access",
+		config.APIAccess.Enabled, "allow API calls from configured networks only (default: localhost)")
+	flag.BoolVar(&config.Tracing.Generate, "trace-generate",
+		config.Tracing.Generate, "generate trace context for requests without it")
+	flag.StringVar(&config.Tracing.Format, "trace-format",
+		config.Tracing.Format, "format of generated trace context: w3c or b3")
+	flag.BoolVar(&config.Compression.Enabled, "compress",
+		config.Compression.Enabled, "compress API responses for clients which accept gzip")
+	flag.IntVar(&config.Compression.MinSize, "compress-min-size",
+		config.Compression.MinSize, "size of smallest compressed API response in bytes")
+	flag.BoolVar(&config.StaleOnError.Enabled, "stale-on-error",
+		config.StaleOnError.Enabled, "return last known good response when nodes fail")
+	flag.IntVar(&staleMaxAge, "stale-max-age", 0, "maximum age of stale response in seconds")
+	flag.IntVar(&requestDeadline, "request-deadline", 0, "deadline of request across all attempts in milliseconds")
+	flag.IntVar(&dialTimeout, "dial-timeout", 0, "waiting for connection to node in milliseconds")
+	flag.IntVar(&responseTimeout, "response-timeout", 0, "waiting for response headers of node in milliseconds")
+	flag.StringVar(&config.Backend.SourceAddress, "source-address",
+		config.Backend.SourceAddress, "source IP address or interface of connections to nodes")
+	flag.StringVar(&config.Backend.CheckSourceAddress, "check-source-address",
+		config.Backend.CheckSourceAddress, "source IP address or interface of health checks")
+	flag.BoolVar(&config.ReadVerify.Enabled, "read-verify",
+		config.ReadVerify.Enabled, "send reads to several nodes and log divergent responses")
+	flag.IntVar(&config.ReadVerify.Replicas, "read-verify-replicas",
+		config.ReadVerify.Replicas, "count of nodes which are queried by read (default: 2)")
+	flag.StringVar(&config.ReadVerify.Compare, "read-verify-compare",
+		config.ReadVerify.Compare, "comparison of responses: body (default), status")
+	flag.BoolVar(&config.Coalesce.Enabled, "coalesce",
+		config.Coalesce.Enabled, "identical concurrent reads share one request to node")
+	flag.Int64Var(&config.SpoolThreshold, "spool-threshold",
+		config.SpoolThreshold, "size of update body in bytes which is stored in temporary file")
+	flag.IntVar(&config.StreamBuffer, "stream-buffer",
+		config.StreamBuffer, "size of buffer of copying of responses in bytes")
+	flag.IntVar(&canaryRamp, "canary-ramp", 0, "ramp time of canary weight of the node in seconds")
+	flag.IntVar(&shutdownTimeout, "shutdown-timeout", 0, "time of waiting for workers on shutdown in seconds")
+	flag.IntVar(&quiesceTimeout, "quiesce-timeout", 0, "time of waiting for queue of quiesced node to drain in seconds")
+	flag.IntVar(&maxResponseTimeout, "max-response-timeout", 0, "maximum response timeout set at runtime in seconds")
+	flag.IntVar(&workerWarmup, "worker-warmup", 0, "waiting for started worker of node to be ready in milliseconds")
+	flag.BoolVar(&config.DeadLetter.Enabled, "dead-letter",
+		config.DeadLetter.Enabled, "keep updates which are not delivered to nodes for replay")
+	flag.IntVar(&config.DeadLetter.Size, "dead-letter-size",
+		config.DeadLetter.Size, "maximum count of dead letters of node (default: 1000)")
+	flag.BoolVar(&config.AsyncUpdates.Enabled, "async-updates",
+		config.AsyncUpdates.Enabled, "acknowledge updates which are not answered in time by 202 Accepted status")
+	flag.IntVar(&config.AsyncUpdates.RetryAfter, "async-retry-after",
+		config.AsyncUpdates.RetryAfter, "time after which the client checks the status of the update in seconds")
+	flag.IntVar(&asyncRetention, "async-retention", 0, "time of keeping of the status of the update in seconds")
+	flag.IntVar(&config.MaxNodes, "max-nodes", config.MaxNodes, "maximum count of nodes (default: 10000)")
+	flag.BoolVar(&config.NodeDefaults.Active, "node-default-active",
+		config.NodeDefaults.Active, "new node is active if it is absent in payload")
+	flag.IntVar(&config.NodeDefaults.Priority, "node-default-priority",
+		config.NodeDefaults.Priority, "priority of new node if it is absent in payload")
+	flag.IntVar(&config.Swap.MinHealthy, "swap-min-healthy",
+		config.Swap.MinHealthy, "minimum count of healthy new nodes of swap (default: all)")
+	flag.IntVar(&swapTimeout, "swap-timeout", 0, "time of waiting for healthy new nodes of swap in seconds")
+	flag.BoolVar(&config.Recovery.Disabled, "recovery-disabled",
+		config.Recovery.Disabled, "do not recover job listener and workers after panic")
+	flag.StringVar(&config.MergePolicy, "merge-policy",
+		config.MergePolicy, "merge policy of conflicting nodes (file-wins, runtime-wins, reject)")
+	flag.IntVar(&config.Recovery.Limit, "recovery-limit",
+		config.Recovery.Limit, "number of recoveries within window before shutdown")
+	flag.IntVar(&recoveryWindow, "recovery-window", 0, "time of counting of recoveries in seconds")
+	flag.IntVar(&reconfigureTimeout, "reconfigure-timeout", 0,
+		"time of waiting for reconfiguration of nodes in milliseconds")
+	flag.StringVar(&config.Discovery.Type, "discovery", "", "type of KV store which contains nodes (consul, etcd)")
+	flag.StringVar(&config.Discovery.Address, "discovery-address", "", "URL of KV store")
+	flag.StringVar(&config.Discovery.Key, "discovery-key", "", "key of KV store which contains nodes")
+	flag.IntVar(&discoveryInterval, "discovery-interval", 0, "interval of polling of KV store in seconds")
+	flag.BoolVar(&config.Chaos.Enabled, "chaos", false, "enable failure injection for testing")
+	flag.Float64Var(&config.RetryBudget.Ratio, "retry-budget-ratio",
+		config.RetryBudget.Ratio, "maximum ratio of retries to requests")
+	flag.IntVar(&retryBudgetWindow, "retry-budget-window",
+		int(spawn.DefaultBudgetWindow), "sliding window of retry budget in seconds")
+	flag.IntVar(&config.RetryBudget.Min, "retry-budget-min",
+		config.RetryBudget.Min, "count of retries which are allowed regardless of ratio")
+	flag.StringVar(&authType, "auth", "guest", "type of auth (LDAP, static)")
 	flag.IntVar(&authExpirationTime, "auth-expire", int(defaultAuthExpirationTime), "expiration time of auth (default: 30)")
 	flag.StringVar(&config.AuthEngine.Host, "auth-host", "", "auth service host name or IP address")
 	flag.IntVar(&config.AuthEngine.Port, "auth-port", 0, "auth service port number")
+	flag.IntVar(&config.AuthEngine.MaxSessions, "auth-max-sessions", 0, "maximum count of sessions per user")
+	flag.IntVar(&config.LoginLimit.Attempts, "login-attempts", 0, "failed login attempts which lock out user or IP")
+	flag.IntVar(&loginWindow, "login-window", 0, "time of counting of failed login attempts in seconds")
+	flag.IntVar(&loginLockout, "login-lockout", 0, "time of lockout of user or IP in seconds")
+	flag.StringVar(&config.AuthEngine.AdminGroup, "auth-admin-group", "", "group of users who have access to admin methods")
+	flag.BoolVar(&config.AuthEngine.FailClosed, "auth-fail-closed",
+		config.AuthEngine.FailClosed, "reject sessions while auth server is not reachable")
 
 	return config
 }
@@ -96,6 +303,10 @@ func (config *Config) Load() error {
 	var path string
 	var err error
 
+	// path to config file from environment is used, if it is not defined by cmd flag
+	if value, ok := os.LookupEnv(envPrefix + "CONFIG"); ok && !isFlagSet("config") {
+		config.Path = value
+	}
 	if err = config.loadConfigFile(config.Path); err != nil {
 		return err
 	}
@@ -106,32 +317,224 @@ func (config *Config) Load() error {
 	flags.StringVar(&path, "config", "", "")
 	// End ignored flags
 	authType := string(config.AuthEngine.Type)
+	if authType == "" {
+		authType = string(auth.Guest)
+	}
 	authExpirationTime := int(config.AuthEngine.ExpirationTime)
+	retryBudgetWindow := int(config.RetryBudget.Window)
+	fanOutDeadline := int(config.FanOut.Deadline)
+	fanOutRetryDelay := int(config.FanOut.RetryDelay)
+	checkFreshness := int(config.Check.Freshness)
+	checkReadinessTimeout := int(config.Check.ReadinessTimeout)
+	reconfigureTimeout := int(config.ReconfigureTimeout)
+	loginWindow := int(config.LoginLimit.Window)
+	loginLockout := int(config.LoginLimit.Lockout)
+	canaryRamp := int(config.CanaryRamp)
+	shutdownTimeout := int(config.ShutdownTimeout)
+	quiesceTimeout := int(config.QuiesceTimeout)
+	maxResponseTimeout := int(config.MaxResponseTimeout)
+	workerWarmup := int(config.WorkerWarmup)
+	asyncRetention := int(config.AsyncUpdates.Retention)
+	statsdInterval := int(config.StatsD.Interval)
+	swapTimeout := int(config.Swap.Timeout)
+	staleMaxAge := int(config.StaleOnError.MaxAge)
+	requestDeadline := int(config.RequestDeadline)
+	dialTimeout := int(config.Backend.DialTimeout)
+	responseTimeout := int(config.Backend.ResponseTimeout)
+	recoveryWindow := int(config.Recovery.Window)
+	discoveryInterval := int(config.Discovery.Interval)
 	flags.BoolVar(&config.TestMode, "t", config.TestMode, "")
 	flags.BoolVar(&config.TestMode, "test", config.TestMode, "")
 	flags.StringVar(&config.Host, "host", config.Host, "")
 	flags.IntVar(&config.Port, "port", config.Port, "")
+	flags.IntVar(&config.MaxProcs, "max-procs", config.MaxProcs, "")
 	flags.BoolVar(&config.QueryMode.RoundRobin, "round-robin",
 		config.QueryMode.RoundRobin, "")
 	flags.BoolVar(&config.QueryMode.ByPriority, "by-priority",
 		config.QueryMode.ByPriority, "")
+	flags.BoolVar(&config.QueryMode.WeightedRandom, "weighted-random",
+		config.QueryMode.WeightedRandom, "")
+	flags.BoolVar(&config.QueryMode.PreferLocal, "prefer-local",
+		config.QueryMode.PreferLocal, "")
+	flags.StringVar(&config.LocalNode, "local-node", config.LocalNode, "")
 	flags.DurationVar(&config.Check.Seconds, "check-sec", config.Check.Seconds, "")
 	flags.StringVar(&config.Check.URL, "check-url", config.Check.URL, "")
 	flags.StringVar(&config.Check.Pattern, "check-regexp", config.Check.Pattern, "")
+	flags.StringVar(&config.Check.Host, "check-host", config.Check.Host, "")
+	flags.BoolVar(&config.Check.TLS, "check-tls", config.Check.TLS, "")
+	flags.IntVar(&checkFreshness, "check-freshness", int(config.Check.Freshness), "")
+	flags.IntVar(&config.Check.Concurrency, "check-concurrency", config.Check.Concurrency, "")
+	flags.Float64Var(&config.Check.Jitter, "check-jitter", config.Check.Jitter, "")
+	flags.IntVar(&config.Check.FailureThreshold, "check-failure-threshold", config.Check.FailureThreshold, "")
+	flags.IntVar(&config.Check.SuccessThreshold, "check-success-threshold", config.Check.SuccessThreshold, "")
+	flags.IntVar(&checkReadinessTimeout, "check-readiness-timeout", int(config.Check.ReadinessTimeout), "")
 	flags.StringVar(&config.API.Host, "api-host", config.API.Host, "")
 	flags.IntVar(&config.API.Port, "api-port", config.API.Port, "")
+	flags.StringVar(&config.Admin.Host, "admin-host", config.Admin.Host, "")
+	flags.IntVar(&config.Admin.Port, "admin-port", config.Admin.Port, "")
+	flags.BoolVar(&config.Maintenance.RejectUpdates, "maintenance-reject-updates",
+		config.Maintenance.RejectUpdates, "")
+	flags.BoolVar(&config.Maintenance.ReadFallback, "maintenance-read-fallback",
+		config.Maintenance.ReadFallback, "")
+	flags.BoolVar(&config.ProxyProtocol, "proxy-protocol", config.ProxyProtocol, "")
+	flags.Int64Var(&config.Seed, "seed", config.Seed, "")
+	flags.IntVar(&config.RingOffset, "ring-offset", config.RingOffset, "")
+	flags.BoolVar(&config.ExposeNode, "expose-node", config.ExposeNode, "")
+	flags.BoolVar(&config.ExposeAnnotations, "expose-annotations", config.ExposeAnnotations, "")
+	flags.BoolVar(&config.StrictDecoding, "strict-decoding", config.StrictDecoding, "")
+	flags.BoolVar(&config.RejectEmptyUpdates, "reject-empty-updates", config.RejectEmptyUpdates, "")
+	flags.StringVar(&config.StatsD.Address, "statsd", config.StatsD.Address, "")
+	flags.IntVar(&statsdInterval, "statsd-interval", int(config.StatsD.Interval), "")
+	flags.StringVar(&config.StatsD.Prefix, "statsd-prefix", config.StatsD.Prefix, "")
+	flags.BoolVar(&config.StatsD.Tags, "statsd-tags", config.StatsD.Tags, "")
+	flags.BoolVar(&config.RejectLog.Enabled, "reject-log", config.RejectLog.Enabled, "")
+	flags.Uint64Var(&config.RejectLog.Sample, "reject-log-sample", config.RejectLog.Sample, "")
+	flags.BoolVar(&config.PreserveHost, "preserve-host", config.PreserveHost, "")
+	flags.BoolVar(&config.ForwardedForPort, "forwarded-for-port", config.ForwardedForPort, "")
+	flags.BoolVar(&config.Timing, "timing", config.Timing, "")
+	flags.BoolVar(&config.OverrideForwardedProto, "override-forwarded-proto", config.OverrideForwardedProto, "")
+	flags.StringVar(&config.AccessLog, "access-log", config.AccessLog, "")
+	flags.StringVar(&config.Adaptive.Header, "adaptive-header", config.Adaptive.Header, "")
+	flags.Float64Var(&config.Adaptive.Smoothing, "adaptive-smoothing", config.Adaptive.Smoothing, "")
+	flags.IntVar(&fanOutDeadline, "fan-out-deadline", int(config.FanOut.Deadline), "")
+	flags.BoolVar(&config.FanOut.WaitForAll, "fan-out-wait-for-all", config.FanOut.WaitForAll, "")
+	flags.BoolVar(&config.FanOut.MultiStatus, "fan-out-multi-status", config.FanOut.MultiStatus, "")
+	flags.BoolVar(&config.FanOut.Primary, "fan-out-primary", config.FanOut.Primary, "")
+	flags.BoolVar(&config.FanOut.Accepted, "fan-out-accepted", config.FanOut.Accepted, "")
+	flags.BoolVar(&config.FanOut.RetryFailed, "fan-out-retry-failed", config.FanOut.RetryFailed, "")
+	flags.IntVar(&fanOutRetryDelay, "fan-out-retry-delay", int(config.FanOut.RetryDelay), "")
+	flags.Int64Var(&config.SpoolThreshold, "spool-threshold", config.SpoolThreshold, "")
+	flags.IntVar(&config.StreamBuffer, "stream-buffer", config.StreamBuffer, "")
+	flags.BoolVar(&config.Coalesce.Enabled, "coalesce", config.Coalesce.Enabled, "")
+	flags.BoolVar(&config.ReadVerify.Enabled, "read-verify", config.ReadVerify.Enabled, "")
+	flags.IntVar(&config.ReadVerify.Replicas, "read-verify-replicas", config.ReadVerify.Replicas, "")
+	flags.StringVar(&config.ReadVerify.Compare, "read-verify-compare", config.ReadVerify.Compare, "")
+	flags.BoolVar(&config.StaleOnError.Enabled, "stale-on-error", config.StaleOnError.Enabled, "")
+	flags.IntVar(&staleMaxAge, "stale-max-age", int(config.StaleOnError.MaxAge), "")
+	flags.IntVar(&requestDeadline, "request-deadline", int(config.RequestDeadline), "")
+	flags.IntVar(&dialTimeout, "dial-timeout", int(config.Backend.DialTimeout), "")
+	flags.IntVar(&responseTimeout, "response-timeout", int(config.Backend.ResponseTimeout), "")
+	flags.StringVar(&config.Backend.SourceAddress, "source-address", config.Backend.SourceAddress, "")
+	flags.StringVar(&config.Backend.CheckSourceAddress, "check-source-address", config.Backend.CheckSourceAddress, "")
+	flags.BoolVar(&config.Compression.Enabled, "compress", config.Compression.Enabled, "")
+	flags.BoolVar(&config.Tracing.Generate, "trace-generate", config.Tracing.Generate, "")
+	flags.BoolVar(&config.APIAccess.Enabled, "api-access", config.APIAccess.Enabled, "")
+	flags.StringVar(&config.SelfTestPath, "self-test-path", config.SelfTestPath, "")
+	flags.BoolVar(&config.Pprof, "pprof", config.Pprof, "")
+	flags.StringVar(&config.Tracing.Format, "trace-format", config.Tracing.Format, "")
+	flags.IntVar(&config.Compression.MinSize, "compress-min-size", config.Compression.MinSize, "")
+	flags.IntVar(&canaryRamp, "canary-ramp", int(config.CanaryRamp), "")
+	flags.IntVar(&shutdownTimeout, "shutdown-timeout", int(config.ShutdownTimeout), "")
+	flags.IntVar(&quiesceTimeout, "quiesce-timeout", int(config.QuiesceTimeout), "")
+	flags.IntVar(&maxResponseTimeout, "max-response-timeout", int(config.MaxResponseTimeout), "")
+	flags.IntVar(&workerWarmup, "worker-warmup", int(config.WorkerWarmup), "")
+	flags.BoolVar(&config.DeadLetter.Enabled, "dead-letter", config.DeadLetter.Enabled, "")
+	flags.IntVar(&config.DeadLetter.Size, "dead-letter-size", config.DeadLetter.Size, "")
+	flags.BoolVar(&config.AsyncUpdates.Enabled, "async-updates", config.AsyncUpdates.Enabled, "")
+	flags.IntVar(&config.AsyncUpdates.RetryAfter, "async-retry-after", config.AsyncUpdates.RetryAfter, "")
+	flags.IntVar(&asyncRetention, "async-retention", int(config.AsyncUpdates.Retention), "")
+	flags.IntVar(&config.MaxNodes, "max-nodes", config.MaxNodes, "")
+	flags.BoolVar(&config.NodeDefaults.Active, "node-default-active", config.NodeDefaults.Active, "")
+	flags.IntVar(&config.NodeDefaults.Priority, "node-default-priority", config.NodeDefaults.Priority, "")
+	flags.IntVar(&config.Swap.MinHealthy, "swap-min-healthy", config.Swap.MinHealthy, "")
+	flags.IntVar(&swapTimeout, "swap-timeout", int(config.Swap.Timeout), "")
+	flags.BoolVar(&config.Recovery.Disabled, "recovery-disabled", config.Recovery.Disabled, "")
+	flags.StringVar(&config.MergePolicy, "merge-policy", config.MergePolicy, "")
+	flags.IntVar(&config.Recovery.Limit, "recovery-limit", config.Recovery.Limit, "")
+	flags.IntVar(&recoveryWindow, "recovery-window", int(config.Recovery.Window), "")
+	flags.IntVar(&reconfigureTimeout, "reconfigure-timeout", int(config.ReconfigureTimeout), "")
+	flags.StringVar(&config.Discovery.Type, "discovery", config.Discovery.Type, "")
+	flags.StringVar(&config.Discovery.Address, "discovery-address", config.Discovery.Address, "")
+	flags.StringVar(&config.Discovery.Key, "discovery-key", config.Discovery.Key, "")
+	flags.IntVar(&discoveryInterval, "discovery-interval", int(config.Discovery.Interval), "")
+	flags.BoolVar(&config.Chaos.Enabled, "chaos", config.Chaos.Enabled, "")
+	flags.Float64Var(&config.RetryBudget.Ratio, "retry-budget-ratio", config.RetryBudget.Ratio, "")
+	flags.IntVar(&retryBudgetWindow, "retry-budget-window", int(config.RetryBudget.Window), "")
+	flags.IntVar(&config.RetryBudget.Min, "retry-budget-min", config.RetryBudget.Min, "")
 	flags.StringVar(&authType, "auth", string(config.AuthEngine.Type), "")
 	flags.IntVar(&authExpirationTime, "auth-expire", int(config.AuthEngine.ExpirationTime), "")
 	flags.StringVar(&config.AuthEngine.Host, "auth-host", config.AuthEngine.Host, "")
 	flags.IntVar(&config.AuthEngine.Port, "auth-port", config.AuthEngine.Port, "")
+	flags.IntVar(&config.AuthEngine.MaxSessions, "auth-max-sessions", config.AuthEngine.MaxSessions, "")
+	flags.IntVar(&config.LoginLimit.Attempts, "login-attempts", config.LoginLimit.Attempts, "")
+	flags.IntVar(&loginWindow, "login-window", int(config.LoginLimit.Window), "")
+	flags.IntVar(&loginLockout, "login-lockout", int(config.LoginLimit.Lockout), "")
+	flags.StringVar(&config.AuthEngine.AdminGroup, "auth-admin-group", config.AuthEngine.AdminGroup, "")
+	flags.BoolVar(&config.AuthEngine.FailClosed, "auth-fail-closed", config.AuthEngine.FailClosed, "")
+
+	flags.StringVar(&authType, "auth-type", authType, "")
 
+	// overwrite config from file by environment variables, they are overwritten by cmd flags
+	if err = config.loadEnv(flags); err != nil {
+		return err
+	}
+	flags.Parse(os.Args[1:])
 	config.AuthEngine.Type = auth.AuthType(authType)
 	config.AuthEngine.ExpirationTime = time.Duration(authExpirationTime)
-	flags.Parse(os.Args[1:])
+	config.RetryBudget.Window = time.Duration(retryBudgetWindow)
+	config.FanOut.Deadline = time.Duration(fanOutDeadline)
+	config.FanOut.RetryDelay = time.Duration(fanOutRetryDelay)
+	config.Check.Freshness = time.Duration(checkFreshness)
+	config.Check.ReadinessTimeout = time.Duration(checkReadinessTimeout)
+	config.CanaryRamp = time.Duration(canaryRamp)
+	config.ShutdownTimeout = time.Duration(shutdownTimeout)
+	config.QuiesceTimeout = time.Duration(quiesceTimeout)
+	config.MaxResponseTimeout = time.Duration(maxResponseTimeout)
+	config.WorkerWarmup = time.Duration(workerWarmup)
+	config.AsyncUpdates.Retention = time.Duration(asyncRetention)
+	config.StatsD.Interval = time.Duration(statsdInterval)
+	config.Swap.Timeout = time.Duration(swapTimeout)
+	config.StaleOnError.MaxAge = time.Duration(staleMaxAge)
+	config.RequestDeadline = time.Duration(requestDeadline)
+	config.Backend.DialTimeout = time.Duration(dialTimeout)
+	config.Backend.ResponseTimeout = time.Duration(responseTimeout)
+	config.Recovery.Window = time.Duration(recoveryWindow)
+	config.ReconfigureTimeout = time.Duration(reconfigureTimeout)
+	config.LoginLimit.Window = time.Duration(loginWindow)
+	config.LoginLimit.Lockout = time.Duration(loginLockout)
+	config.Discovery.Interval = time.Duration(discoveryInterval)
 
 	return nil
 }
 
+// cmdOnlyFlags could not be defined by environment variables
+var cmdOnlyFlags = map[string]bool{
+	"config": true,
+	"chaos":  true,
+}
+
+// loadEnv sets the flags from environment variables with names
+// like SPAWN_API_PORT for --api-port flag
+func (config *Config) loadEnv(flags *flag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		name := envName(f.Name)
+		if value, ok := os.LookupEnv(name); ok && err == nil && !cmdOnlyFlags[f.Name] {
+			if e := f.Value.Set(value); e != nil {
+				err = fmt.Errorf("%s: %s", name, e)
+			}
+		}
+	})
+
+	return err
+}
+
+// envName returns name of environment variable for the flag
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// isFlagSet checks that the cmd flag was defined explicitly
+func isFlagSet(name string) bool {
+	found := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
 // LoadConfigFile - loads congig file into config record
 func (config *Config) loadConfigFile(path string) error {
 	_, err := os.Stat(path)
@@ -143,9 +546,379 @@ func (config *Config) loadConfigFile(path string) error {
 		return err
 	}
 	defer file.Close()
-	if err := json.NewDecoder(bufio.NewReader(file)).Decode(&config); err != nil {
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	return nil
+}
+
+// Validate checks the config parameters, the error contains name of the incorrect parameter
+func (config *Config) Validate() error {
+	if config.Host == "" {
+		return errors.New("host: is required")
+	}
+	if err := validatePort("port", config.Port, false); err != nil {
 		return err
 	}
+	if config.API.Host == "" {
+		return errors.New("api.host: is required")
+	}
+	if err := validatePort("api.port", config.API.Port, false); err != nil {
+		return err
+	}
+	if err := validatePort("admin.port", config.Admin.Port, true); err != nil {
+		return err
+	}
+	if config.API.Port == config.Port {
+		return fmt.Errorf("api.port: %d is already used by service", config.API.Port)
+	}
+	if config.Admin.Port == config.Port || config.Admin.Port == config.API.Port {
+		return fmt.Errorf("admin.port: %d is already used by service or API", config.Admin.Port)
+	}
+
+	// adaptive balancing replaces the mode of the reads
+	if config.QueryMode.RoundRobin && config.Adaptive.Header != "" {
+		return errors.New("adaptive.header: could not be used together with query-mode.round-robin")
+	}
+	if config.QueryMode.WeightedRandom && config.Adaptive.Header != "" {
+		return errors.New("adaptive.header: could not be used together with query-mode.weighted-random")
+	}
+	if config.QueryMode.RoundRobin && config.QueryMode.WeightedRandom {
+		return errors.New("query-mode: round-robin and weighted-random could not be used together")
+	}
+	if config.QueryMode.PreferLocal && config.LocalNode == "" {
+		return errors.New("local-node: must be defined in query-mode.prefer-local")
+	}
+	if config.LocalNode != "" {
+		_, port, err := net.SplitHostPort(config.LocalNode)
+		if err == nil {
+			_, err = strconv.ParseUint(port, 10, 16)
+		}
+		if err != nil {
+			return fmt.Errorf("local-node: incorrect address %q, use host:port", config.LocalNode)
+		}
+	}
+
+	if config.MaxProcs < 0 {
+		return errors.New("max-procs: must not be negative")
+	}
+	if config.Check.Seconds <= 0 {
+		return errors.New("health-check.seconds: must be positive")
+	}
+	if config.Check.Freshness < 0 {
+		return errors.New("health-check.freshness: must not be negative")
+	}
+	if config.Check.Concurrency < 0 {
+		return errors.New("health-check.concurrency: must not be negative")
+	}
+	if config.Check.Jitter < 0 || config.Check.Jitter >= 1 {
+		return errors.New("health-check.jitter: must be in range [0, 1)")
+	}
+	if config.Check.FailureThreshold < 0 {
+		return errors.New("health-check.failure-threshold: must not be negative")
+	}
+	if config.Check.SuccessThreshold < 0 {
+		return errors.New("health-check.success-threshold: must not be negative")
+	}
+	if strings.ContainsAny(config.Check.Host, " /\r\n") {
+		return fmt.Errorf("health-check.host: %q is not valid host name", config.Check.Host)
+	}
+	for name, value := range config.Check.Headers {
+		if name == "" || strings.ContainsAny(name, " :\t\r\n") {
+			return fmt.Errorf("health-check.headers: %q is not valid header name", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("health-check.headers.%s: must not contain line breaks", name)
+		}
+	}
+	if config.Check.ReadinessTimeout < 0 {
+		return errors.New("health-check.readiness-timeout: must not be negative")
+	}
+	if _, err := regexp.Compile(config.Check.Pattern); err != nil {
+		return fmt.Errorf("health-check.regexp: %s", err)
+	}
 
+	for index, network := range config.APIAccess.Networks {
+		if _, _, err := net.ParseCIDR(network); err != nil && net.ParseIP(network) == nil {
+			return fmt.Errorf("api-access.networks[%d]: incorrect network %q", index, network)
+		}
+	}
+	for index, network := range config.APIAccess.TrustedProxies {
+		if _, _, err := net.ParseCIDR(network); err != nil && net.ParseIP(network) == nil {
+			return fmt.Errorf("api-access.trusted-proxies[%d]: incorrect network %q", index, network)
+		}
+	}
+	if config.SelfTestPath != "" && !strings.HasPrefix(config.SelfTestPath, "/") {
+		return errors.New("self-test-path: must start with slash")
+	}
+	for name, value := range config.OutboundHeaders {
+		if name == "" || strings.ContainsAny(name, " :\t\r\n") {
+			return fmt.Errorf("outbound-headers: %q is not valid header name", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("outbound-headers.%s: must not contain line breaks", name)
+		}
+	}
+	if config.FanOut.MultiStatus && !config.FanOut.WaitForAll {
+		return errors.New("fan-out.multi-status: must be used together with fan-out.wait-for-all")
+	}
+	if config.ReadVerify.Replicas < 0 {
+		return errors.New("read-verify.replicas: must not be negative")
+	}
+	if config.ReadVerify.MaxBodySize < 0 {
+		return errors.New("read-verify.max-body-size: must not be negative")
+	}
+	switch config.ReadVerify.Compare {
+	case "", spawn.ReadVerifyBody, spawn.ReadVerifyStatus:
+	default:
+		return fmt.Errorf("read-verify.compare: unknown method %q, use %q or %q", config.ReadVerify.Compare,
+			spawn.ReadVerifyBody, spawn.ReadVerifyStatus)
+	}
+	switch config.Tracing.Format {
+	case "", spawn.TraceFormatW3C, spawn.TraceFormatB3:
+	default:
+		return fmt.Errorf("tracing.format: unknown format %q, use %q or %q", config.Tracing.Format,
+			spawn.TraceFormatW3C, spawn.TraceFormatB3)
+	}
+	if config.RequestDeadline < 0 {
+		return errors.New("request-deadline: must not be negative")
+	}
+	if config.Backend.DialTimeout < 0 {
+		return errors.New("backend.dial-timeout: must not be negative")
+	}
+	if config.Backend.ResponseTimeout < 0 {
+		return errors.New("backend.response-timeout: must not be negative")
+	}
+	if config.StaleOnError.MaxAge < 0 {
+		return errors.New("stale-on-error.max-age: must not be negative")
+	}
+	if config.StaleOnError.MaxEntries < 0 {
+		return errors.New("stale-on-error.max-entries: must not be negative")
+	}
+	if config.StaleOnError.MaxBodySize < 0 {
+		return errors.New("stale-on-error.max-body-size: must not be negative")
+	}
+	if config.Compression.MinSize < 0 {
+		return errors.New("compression.min-size: must not be negative")
+	}
+	if config.Compression.Level < 0 || config.Compression.Level > 9 {
+		return errors.New("compression.level: must be in range from 1 to 9")
+	}
+	if config.CORS.MaxAge < 0 {
+		return errors.New("cors.max-age: must not be negative")
+	}
+	for index, origin := range config.CORS.Origins {
+		if origin == "" {
+			return fmt.Errorf("cors.origins[%d]: must not be empty", index)
+		}
+	}
+	switch config.MergePolicy {
+	case "", spawn.MergeFileWins, spawn.MergeRuntimeWins, spawn.MergeReject:
+	default:
+		return fmt.Errorf("merge-policy: unknown policy %q, use %q, %q or %q", config.MergePolicy,
+			spawn.MergeFileWins, spawn.MergeRuntimeWins, spawn.MergeReject)
+	}
+	for index, node := range config.Nodes {
+		if node.Host == "" {
+			return fmt.Errorf("nodes[%d].host: is required", index)
+		}
+		if node.Port == 0 || node.Port > 65535 {
+			return fmt.Errorf("nodes[%d].port: %d is out of range [1, 65535]", index, node.Port)
+		}
+		if node.Weight < 0 {
+			return fmt.Errorf("nodes[%d].weight: must not be negative", index)
+		}
+		if node.MaxRPS < 0 {
+			return fmt.Errorf("nodes[%d].max-rps: must not be negative", index)
+		}
+		if node.Timeout < 0 {
+			return fmt.Errorf("nodes[%d].timeout: must not be negative", index)
+		}
+		for key, value := range node.Annotations {
+			if key == "" || strings.ContainsAny(key, " :\t\r\n") || strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("nodes[%d].annotations: %q could not be used in headers", index, key)
+			}
+		}
+	}
+
+	if err := config.Affinity.Validate(); err != nil {
+		return fmt.Errorf("affinity: %s", err)
+	}
+	for index, route := range config.Routes {
+		if route.Prefix == "" && route.Header == "" {
+			return fmt.Errorf("routes[%d]: prefix or header is required", index)
+		}
+		if len(route.Nodes) == 0 {
+			return fmt.Errorf("routes[%d].nodes: is required", index)
+		}
+		if _, err := regexp.Compile(route.Pattern); err != nil {
+			return fmt.Errorf("routes[%d].pattern: %s", index, err)
+		}
+	}
+
+	limits := config.Listener
+	if limits.ReadHeaderTimeout < 0 || limits.ReadTimeout < 0 ||
+		limits.WriteTimeout < 0 || limits.IdleTimeout < 0 {
+		return errors.New("listener: timeouts must not be negative")
+	}
+	if limits.MaxHeaderBytes < 0 {
+		return errors.New("listener.max-header-bytes: must not be negative")
+	}
+	if config.AccessLog != "" && config.AccessLog != spawn.CommonLogFormat &&
+		config.AccessLog != spawn.CombinedLogFormat {
+		return fmt.Errorf("access-log: unknown format %q, use %q or %q",
+			config.AccessLog, spawn.CommonLogFormat, spawn.CombinedLogFormat)
+	}
+	if config.Adaptive.Smoothing < 0 || config.Adaptive.Smoothing > 1 {
+		return errors.New("adaptive.smoothing: must be in range [0, 1]")
+	}
+	if config.FanOut.Deadline < 0 {
+		return errors.New("fan-out.deadline: must not be negative")
+	}
+	if config.RingOffset < 0 {
+		return errors.New("ring-offset: must not be negative")
+	}
+	if config.FanOut.RetryDelay < 0 {
+		return errors.New("fan-out.retry-delay: must not be negative")
+	}
+	if config.Chaos.Failure < 0 || config.Chaos.Failure > 100 ||
+		config.Chaos.Delay < 0 || config.Chaos.Delay > 100 {
+		return errors.New("chaos: failure and delay must be in range [0, 100]")
+	}
+	if config.Chaos.Latency < 0 {
+		return errors.New("chaos.latency: must not be negative")
+	}
+	if config.CanaryRamp < 0 {
+		return errors.New("canary-ramp: must not be negative")
+	}
+	if config.ShutdownTimeout < 0 {
+		return errors.New("shutdown-timeout: must not be negative")
+	}
+	if config.QuiesceTimeout < 0 {
+		return errors.New("quiesce-timeout: must not be negative")
+	}
+	if config.MaxResponseTimeout < 0 {
+		return errors.New("max-response-timeout: must not be negative")
+	}
+	if config.StatsD.Interval < 0 {
+		return errors.New("statsd.interval: must not be negative")
+	}
+	if config.StatsD.Address != "" {
+		if _, _, err := net.SplitHostPort(config.StatsD.Address); err != nil {
+			return fmt.Errorf("statsd.address: %q must be host:port", config.StatsD.Address)
+		}
+	}
+	if config.WorkerWarmup < 0 {
+		return errors.New("worker-warmup: must not be negative")
+	}
+	if config.DeadLetter.Size < 0 {
+		return errors.New("dead-letter.size: must not be negative")
+	}
+	if config.AsyncUpdates.RetryAfter < 0 {
+		return errors.New("async-retry-after: must not be negative")
+	}
+	if config.AsyncUpdates.Retention < 0 {
+		return errors.New("async-retention: must not be negative")
+	}
+	if config.AsyncUpdates.MaxRecords < 0 {
+		return errors.New("async-updates.max-records: must not be negative")
+	}
+	if config.MaxNodes < 0 {
+		return errors.New("max-nodes: must not be negative")
+	}
+	maxNodes := config.MaxNodes
+	if maxNodes == 0 {
+		maxNodes = spawn.DefaultMaxNodes
+	}
+	if len(config.Nodes) > maxNodes {
+		return fmt.Errorf("nodes: %d nodes exceed max-nodes %d", len(config.Nodes), maxNodes)
+	}
+	if config.Swap.MinHealthy < 0 {
+		return errors.New("swap.min-healthy: must not be negative")
+	}
+	if config.Swap.Timeout < 0 {
+		return errors.New("swap.timeout: must not be negative")
+	}
+	if config.Recovery.Limit < 0 {
+		return errors.New("recovery.limit: must not be negative")
+	}
+	if config.Recovery.Window < 0 {
+		return errors.New("recovery.window: must not be negative")
+	}
+	if config.ReconfigureTimeout < 0 {
+		return errors.New("reconfigure-timeout: must not be negative")
+	}
+	switch config.Discovery.Type {
+	case "":
+	case spawn.DiscoveryConsul, spawn.DiscoveryEtcd:
+		if config.Discovery.Address == "" {
+			return errors.New("discovery.address: is required")
+		}
+		if config.Discovery.Key == "" {
+			return errors.New("discovery.key: is required")
+		}
+		if config.Discovery.Interval < 0 {
+			return errors.New("discovery.interval: must not be negative")
+		}
+	default:
+		return fmt.Errorf("discovery.type: unknown type %q", config.Discovery.Type)
+	}
+	if config.SpoolThreshold < 0 {
+		return errors.New("spool-threshold: must not be negative")
+	}
+	if config.StreamBuffer < 0 {
+		return errors.New("stream-buffer: must not be negative")
+	}
+	if config.RetryBudget.Ratio < 0 {
+		return errors.New("retry-budget.ratio: must not be negative")
+	}
+	if config.RetryBudget.Window < 0 {
+		return errors.New("retry-budget.window: must not be negative")
+	}
+	if config.RetryBudget.Min < 0 {
+		return errors.New("retry-budget.min: must not be negative")
+	}
+
+	if config.AuthEngine.ExpirationTime < 0 {
+		return errors.New("auth.expiration: must not be negative")
+	}
+	if config.AuthEngine.MaxSessions < 0 {
+		return errors.New("auth.max-sessions: must not be negative")
+	}
+	if config.LoginLimit.Attempts < 0 || config.LoginLimit.Window < 0 || config.LoginLimit.Lockout < 0 {
+		return errors.New("login-limit: attempts, window and lockout must not be negative")
+	}
+	switch config.AuthEngine.Type {
+	case auth.Guest, auth.LDAP, auth.Static:
+	default:
+		return fmt.Errorf("auth.type: %q is not known, use guest, LDAP or static", config.AuthEngine.Type)
+	}
+	if config.AuthEngine.Type == auth.Static &&
+		len(config.AuthEngine.Settings.Tokens) == 0 && len(config.AuthEngine.Settings.Users) == 0 {
+		return errors.New("auth.settings: tokens or users are required for static auth")
+	}
+	if config.AuthEngine.Type == auth.LDAP {
+		if config.AuthEngine.Host == "" {
+			return errors.New("auth.host: is required for LDAP")
+		}
+		if err := validatePort("auth.port", config.AuthEngine.Port, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validatePort checks that the port number is in range, zero value is allowed for optional port
+func validatePort(name string, port int, optional bool) error {
+	if optional && port == 0 {
+		return nil
+	}
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("%s: %d is out of range [1, 65535]", name, port)
+	}
 	return nil
 }
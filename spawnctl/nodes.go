@@ -0,0 +1,184 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/openprovider/spawn"
+)
+
+// timeout of the requests to the running instance
+const nodesRequestTimeout = 10 * time.Second
+
+// nodesResponse contains the response of the nodes API
+type nodesResponse struct {
+	Success bool         `json:"success"`
+	Message string       `json:"message"`
+	Results []spawn.Node `json:"results"`
+
+	// the response is wrapped if the timer is used by API
+	Data *nodesResponse `json:"data"`
+}
+
+// nodesClient contains parameters of the requests to the running instance
+type nodesClient struct {
+	api   string
+	admin string
+	token string
+}
+
+// nodes manages the nodes of the running instance: list, add, remove
+func (service *Service) nodes(args []string) (string, error) {
+	if len(args) == 0 {
+		return "Usage: spawnctl nodes list | add | remove", errors.New("Command is not defined")
+	}
+
+	// Load configuration to get API host and port
+	if err := service.Load(); err != nil {
+		return "Loading config was unsuccessful", err
+	}
+	client := &nodesClient{
+		api:   fmt.Sprintf("http://%s:%d", clientHost(service.API.Host), service.API.Port),
+		token: os.Getenv(envPrefix + "TOKEN"),
+	}
+	client.admin = client.api
+	if service.Admin.Port != 0 {
+		client.admin = fmt.Sprintf("http://%s:%d", clientHost(service.Admin.Host), service.Admin.Port)
+	}
+
+	command := args[0]
+	flags := flag.NewFlagSet("nodes "+command, flag.ContinueOnError)
+	flags.StringVar(&client.token, "token", client.token, "auth token")
+	asJSON := flags.Bool("json", false, "print result as JSON")
+	priority := flags.Int("priority", 0, "priority of the node")
+	weight := flags.Int("weight", 0, "weight of the node")
+	maintenance := flags.Bool("maintenance", false, "node is in maintenance")
+	if err := flags.Parse(args[1:]); err != nil {
+		return "Could not recognize options of the command", err
+	}
+
+	switch command {
+	case "list":
+		nodes, err := client.do(http.MethodGet, client.api+"/nodes", nil)
+		if err != nil {
+			return "Could not get the nodes", err
+		}
+		return formatNodes(nodes, *asJSON)
+	case "add":
+		if flags.NArg() != 2 {
+			return "Usage: spawnctl nodes add [--priority=N] [--weight=N] [--maintenance] HOST PORT",
+				errors.New("Host and port are required")
+		}
+		host, port := flags.Arg(0), flags.Arg(1)
+		number, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return "Could not recognize port " + port, err
+		}
+		node := spawn.Node{
+			Host:        host,
+			Port:        number,
+			Priority:    *priority,
+			Weight:      *weight,
+			Active:      true,
+			Maintenance: *maintenance,
+		}
+		nodes, err := client.do(http.MethodPut, client.admin+"/nodes/"+host+"/"+port, node)
+		if err != nil {
+			return "Could not add the node", err
+		}
+		return formatNodes(nodes, *asJSON)
+	case "remove":
+		if flags.NArg() < 1 || flags.NArg() > 2 {
+			return "Usage: spawnctl nodes remove HOST [PORT]",
+				errors.New("Host is required")
+		}
+		path := "/nodes/" + flags.Arg(0)
+		if flags.NArg() == 2 {
+			path += "/" + flags.Arg(1)
+		}
+		if _, err := client.do(http.MethodDelete, client.admin+path, nil); err != nil {
+			return "Could not remove the node", err
+		}
+		return "The node(s) removed successfully", nil
+	}
+
+	return "Usage: spawnctl nodes list | add | remove", errors.New("Unknown command " + command)
+}
+
+// do sends the request to the running instance and decodes the nodes from response
+func (client *nodesClient) do(method, url string, record interface{}) ([]spawn.Node, error) {
+	var body bytes.Buffer
+	if record != nil {
+		if err := json.NewEncoder(&body).Encode(record); err != nil {
+			return nil, err
+		}
+	}
+	request, err := http.NewRequest(method, url, &body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if client.token != "" {
+		request.Header.Set("Authorization", "Bearer "+client.token)
+	}
+	response, err := (&http.Client{Timeout: nodesRequestTimeout}).Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	result := new(nodesResponse)
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("%s %s: %s", method, url, response.Status)
+	}
+	if result.Data != nil {
+		result = result.Data
+	}
+	if !result.Success {
+		return nil, fmt.Errorf("%s %s: %s", method, url, result.Message)
+	}
+
+	return result.Results, nil
+}
+
+// formatNodes returns the nodes as a table or JSON
+func formatNodes(nodes []spawn.Node, asJSON bool) (string, error) {
+	if asJSON {
+		content, err := json.MarshalIndent(nodes, "", "  ")
+		if err != nil {
+			return "Could not encode the nodes", err
+		}
+		return string(content), nil
+	}
+	var buffer bytes.Buffer
+	writer := tabwriter.NewWriter(&buffer, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "HOST\tPORT\tPRIORITY\tWEIGHT\tACTIVE\tMAINTENANCE")
+	for _, node := range nodes {
+		fmt.Fprintf(writer, "%s\t%d\t%d\t%d\t%t\t%t\n",
+			node.Host, node.Port, node.Priority, node.Weight, node.Active, node.Maintenance)
+	}
+	writer.Flush()
+
+	return strings.TrimSuffix(buffer.String(), "\n"), nil
+}
+
+// clientHost returns the host which could be used for connection to the listener
+func clientHost(host string) string {
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		return "localhost"
+	}
+	return host
+}
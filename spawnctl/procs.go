@@ -0,0 +1,71 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// paths to the CPU quota of the container (cgroup v2 and v1)
+const (
+	cgroupCPUMax    = "/sys/fs/cgroup/cpu.max"
+	cgroupCFSQuota  = "/sys/fs/cgroup/cpu/cpu.cfs_quota_us"
+	cgroupCFSPeriod = "/sys/fs/cgroup/cpu/cpu.cfs_period_us"
+)
+
+// setMaxProcs sets the number of CPUs which are used by the service,
+// zero value means automatic detection according to the CPU quota of the container
+func setMaxProcs(procs int) int {
+	if procs <= 0 {
+		procs = runtime.NumCPU()
+		if quota, ok := cpuQuota(); ok && quota < procs {
+			procs = quota
+		}
+	}
+	runtime.GOMAXPROCS(procs)
+
+	return procs
+}
+
+// cpuQuota returns the CPU quota of the container rounded up, if it is defined
+func cpuQuota() (int, bool) {
+	var quota, period string
+	if content, err := ioutil.ReadFile(cgroupCPUMax); err == nil {
+		fields := strings.Fields(string(content))
+		if len(fields) != 2 {
+			return 0, false
+		}
+		quota, period = fields[0], fields[1]
+	} else {
+		content, err := ioutil.ReadFile(cgroupCFSQuota)
+		if err != nil {
+			return 0, false
+		}
+		quota = strings.TrimSpace(string(content))
+		content, err = ioutil.ReadFile(cgroupCFSPeriod)
+		if err != nil {
+			return 0, false
+		}
+		period = strings.TrimSpace(string(content))
+	}
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+	procs := int(math.Ceil(q / p))
+	if procs < 1 {
+		procs = 1
+	}
+
+	return procs, true
+}
@@ -5,9 +5,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"regexp"
+	"strconv"
 	"syscall"
 
 	"github.com/openprovider/spawn"
@@ -39,6 +42,32 @@ func newService(name, description string) (*Service, error) {
 	return &Service{newConfig(), daemonInstance}, nil
 }
 
+// reload sends reload signal to the running service and returns its status
+func (service *Service) reload() (string, error) {
+	status, err := service.Status()
+	if err != nil {
+		return status, err
+	}
+	matches := regexp.MustCompile(`pid\s+(\d+)`).FindStringSubmatch(status)
+	if matches == nil {
+		return status, errors.New("Service is not running")
+	}
+	pid, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return status, err
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return "Could not find process " + matches[1], err
+	}
+	if err := process.Signal(syscall.SIGHUP); err != nil {
+		return "Could not send reload signal to process " + matches[1], err
+	}
+	stdlog.Println("Reload signal delivered to process", pid)
+
+	return service.Status()
+}
+
 // Run - manages the service
 func (service *Service) Run() (string, error) {
 
@@ -56,6 +85,10 @@ func (service *Service) Run() (string, error) {
 			return service.Stop()
 		case "status":
 			return service.Status()
+		case "reload":
+			return service.reload()
+		case "nodes":
+			return service.nodes(os.Args[2:])
 		}
 	}
 
@@ -63,6 +96,10 @@ func (service *Service) Run() (string, error) {
 	if err := service.Load(); err != nil {
 		return "Loading config was unsuccessful", err
 	}
+	if err := service.Validate(); err != nil {
+		return "Config is not valid", err
+	}
+	stdlog.Println("Number of used CPUs:", setMaxProcs(service.MaxProcs))
 
 	// Set up channel on which to send signal notifications.
 	// We must use a buffered channel or risk missing the signal
@@ -70,12 +107,26 @@ func (service *Service) Run() (string, error) {
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, os.Kill, syscall.SIGTERM)
 
+	// reload signal re-reads the config and updates the nodes
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	// upgrade signal starts new binary which inherits the listeners
+	upgrade := make(chan os.Signal, 1)
+	signal.Notify(upgrade, syscall.SIGUSR2)
+
 	serviceHostPort := fmt.Sprintf("%s:%d", service.Host, service.Port)
 	apiHostPort := fmt.Sprintf("%s:%d", service.API.Host, service.API.Port)
 	server, err := spawn.NewServer(Description)
 	if err != nil {
 		return "Initialize service:", err
 	}
+	server.Options = service.Options
+	server.Options.WeightedRandom = service.QueryMode.WeightedRandom
+	server.Options.PreferLocal = service.QueryMode.PreferLocal
+	if service.Admin.Port != 0 {
+		server.Options.AdminHostPort = fmt.Sprintf("%s:%d", service.Admin.Host, service.Admin.Port)
+	}
 	// Initialize auth service
 	authService, err := auth.NewAuth(&service.AuthEngine)
 	if err != nil {
@@ -99,11 +150,50 @@ func (service *Service) Run() (string, error) {
 	// Logs a which is host&port used
 	stdlog.Printf("%s started on %s\n", Description, serviceHostPort)
 	stdlog.Printf("API loaded on %s\n", apiHostPort)
+	if server.Options.AdminHostPort != "" {
+		stdlog.Printf("Admin API loaded on %s\n", server.Options.AdminHostPort)
+	}
 
 	// loop work cycle with accept connections or interrupt
 	// by system signal
 	for {
 		select {
+		case <-hangup:
+			stdlog.Println("Got signal: reload configuration")
+			if err := service.Load(); err != nil {
+				errlog.Println("Loading config was unsuccessful:", err)
+				continue
+			}
+			if err := service.Validate(); err != nil {
+				errlog.Println("Config is not valid:", err)
+				continue
+			}
+			if server.Options.Discovery.Type != "" {
+				stdlog.Println("The nodes are managed by", server.Options.Discovery.Type, "discovery, skipped")
+				continue
+			}
+			if err := server.Nodes.Merge(service.Nodes, server.Options.MergePolicy); err != nil {
+				errlog.Println(err)
+				continue
+			}
+			stdlog.Println("The nodes are reloaded from configuration")
+		case <-upgrade:
+			stdlog.Println("Got signal: upgrade binary")
+			process, err := server.Upgrade()
+			if err != nil {
+				errlog.Println("Upgrade was unsuccessful:", err)
+				continue
+			}
+			stdlog.Println("New process", process.Pid, "is started, draining connections")
+			return server.Shutdown()
+		case err := <-server.Fatal():
+			errlog.Println("Fatal error:", err)
+			stdlog.Println("Stoping listening on ", serviceHostPort, apiHostPort)
+			status, shutdownErr := server.Shutdown()
+			if shutdownErr != nil {
+				errlog.Println(status, shutdownErr)
+			}
+			return "Service is stopped", err
 		case killSignal := <-interrupt:
 			stdlog.Println("Got signal:", killSignal)
 			stdlog.Println("Stoping listening on ", serviceHostPort, apiHostPort)
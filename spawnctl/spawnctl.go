@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"runtime"
 	"time"
 )
 
@@ -28,9 +27,8 @@ var (
 	errlog = log.New(os.Stderr, "[SETUP:ERROR]: ", log.Ldate|log.Ltime)
 )
 
-// Init CPU numbers, "Usage" helper
+// Init "Usage" helper
 func init() {
-	runtime.GOMAXPROCS(runtime.NumCPU())
 	flag.Usage = func() {
 		fmt.Println(Usage())
 	}
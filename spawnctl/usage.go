@@ -8,7 +8,10 @@ var usage = `
 spawnctl - Spawn Sync Service Control
 
 Usage:
-  spawnctl install | remove | start | stop | status
+  spawnctl install | remove | start | stop | status | reload
+  spawnctl nodes list [ --json ]
+  spawnctl nodes add [ --priority=N ] [ --weight=N ] [ --maintenance ] HOST PORT
+  spawnctl nodes remove HOST [ PORT ]
   spawnctl [ -t | --test ] [ --option | --option ... ]
   spawnctl -h | --help
   spawnctl -v | --version
@@ -19,6 +22,9 @@ Commands:
   start             Start service
   stop              Stop service
   status            Check service status
+  reload            Reload nodes of the running service from the config
+  nodes             Manage nodes of the running service through API,
+                    auth token is defined by --token option or SPAWN_TOKEN
 
   -h --help         Show this screen
   -v --version      Show version
@@ -30,15 +36,159 @@ Options:
   --port=PORT            Port number
   --api-host=HOST        API host name or IP address
   --api-port=PORT        API port number
+  --admin-host=HOST      Admin API host name or IP address
+  --admin-port=PORT      Admin API port number (default: use API port)
+  --max-procs=N          Number of used CPUs (default: according to CPU quota)
   --round-robin          Use round-robin mode for querying of nodes
   --by-priority          Nodes will used according to priority
+  --weighted-random      Select nodes randomly according to weight
+  --prefer-local         Prefer local node for reads, other nodes are used when it fails
+  --local-node=HOST:PORT Local node which is colocated with server
   --check-sec=SECONDS    Check nodes every number of seconds
-  --check-url=URL        URL to check nodes (/info, etc)
+  --check-url=URL        URL to check nodes (/info, etc), it could contain
+                         {host}, {port} and {priority} of the node
   --check-regexp=REGEXP  Regexp pattern to check nodes
-  --auth=TYPE            Auth type (LDAP, oAuth, etc)
+  --check-host=HOST      Host header and TLS server name (SNI) of node check
+  --check-tls            Check nodes over TLS (https)
+  --check-freshness=MS   Share result of the node check during milliseconds,
+                         the reads skip the probe of the node (default: 0, disabled)
+  --check-concurrency=N  Maximum number of the node checks at the same time
+  --check-jitter=RATIO   Randomized fraction of the check interval (default: 0.1)
+  --check-failure-threshold=N
+                         Consecutive failed checks to mark node down (default: 1)
+  --check-success-threshold=N
+                         Consecutive successful checks to mark node up (default: 1)
+  --check-readiness-timeout=SECONDS
+                         Waiting for node before its updates are abandoned (default: no limits)
+  --maintenance-reject-updates
+                         Reject updates if all nodes are in maintenance
+  --maintenance-read-fallback
+                         Use nodes in maintenance for reads as a last resort
+  --proxy-protocol       Read PROXY protocol (v1/v2) header of the service connections
+  --seed=N               Seed of random selection of nodes (default: time based)
+  --ring-offset=N        Position of first node in round-robin mode (default: 0)
+  --expose-node          Add node which produced response to X-Spawn-Node header
+  --expose-annotations   Add annotations of node to X-Spawn-Annotation-<Key> headers
+  --strict-decoding      Reject unknown fields of records of API mutation methods
+  --reject-empty-updates Reject updates (PUT, POST) without body
+  --statsd=HOST:PORT     Push metrics of nodes to StatsD server (default: disabled)
+  --statsd-interval=SECONDS
+                         Time between flushes of metrics to StatsD (default: 10)
+  --statsd-prefix=PREFIX Prefix of names of StatsD metrics (default: spawn)
+  --statsd-tags          Send node and method as DogStatsD tags
+  --reject-log           Log rejected requests with their reason
+  --reject-log-sample=N  Log every n-th rejected request of the reason (default: 1)
+  --preserve-host        Forward the Host header of the client to the nodes
+  --override-forwarded-proto
+                         Replace X-Forwarded-Proto of client by scheme of connection
+  --forwarded-for-port   Keep port of client in X-Forwarded-For header
+  --timing               Add breakdown of time of request to X-Spawn-Timing header
+  --access-log=FORMAT    Format of access log: common, combined (default: short)
+  --adaptive-header=NAME Response header which contains load of the node
+  --adaptive-smoothing=RATIO
+                         Smoothing factor of load of the node (default: 0.3)
+  --fan-out-deadline=SECONDS
+                         Deadline of delivery of updates (default: no deadline)
+  --fan-out-wait-for-all Deliver updates to all nodes regardless of deadline
+  --fan-out-multi-status Return 207 Multi-Status with statuses of all nodes
+                         instead of answer (wait-for-all mode only)
+  --fan-out-primary      Return answer of primary node (flagged or highest priority) to update
+  --fan-out-accepted     Return 202 Accepted status with list of nodes to update,
+                         it is overridden by X-Spawn-Accepted request header
+  --fan-out-retry-failed Retry update once if it is not delivered to any node
+  --fan-out-retry-delay=MS
+                         Delay before retry of failed update (default: no delay)
+  --chaos                Enable failure injection for testing (command line only)
+  --canary-ramp=SECONDS  Ramp time of canary weight of the node (default: no ramp)
+  --shutdown-timeout=SECONDS
+                         Time of waiting for workers on shutdown (default: 60)
+  --quiesce-timeout=SECONDS
+                         Time of waiting for queue of quiesced node to drain (default: 60)
+  --max-response-timeout=SECONDS
+                         Maximum response timeout set at runtime (default: 300)
+  --worker-warmup=MS     Waiting for started worker of node to be ready (default: 1000)
+  --dead-letter          Keep updates which are not delivered to nodes for replay
+  --dead-letter-size=N   Maximum count of dead letters of node (default: 1000)
+  --async-updates        Return 202 Accepted status with location of delivery status
+                         to updates which are not answered in time
+  --async-retry-after=SECONDS
+                         Time after which the client checks delivery status (default: 5)
+  --async-retention=SECONDS
+                         Time of keeping of delivery status of update (default: 3600)
+  --max-nodes=N          Maximum count of nodes (default: 10000)
+  --node-default-active  New node is active if it is absent in payload
+  --node-default-priority=N
+                         Priority of new node if it is absent in payload
+  --swap-min-healthy=N   Minimum count of healthy new nodes of swap (default: all)
+  --swap-timeout=SECONDS Time of waiting for healthy new nodes of swap (default: 30)
+  --merge-policy=POLICY  Merge policy of conflicting nodes of config and runtime:
+                         file-wins, runtime-wins, reject (default: file-wins)
+  --recovery-disabled    Do not recover job listener and workers after panic
+  --recovery-limit=N     Recoveries within window before shutdown (default: no limits)
+  --recovery-window=SECONDS
+                         Time of counting of recoveries (default: 60)
+  --reconfigure-timeout=MS
+                         Time of waiting for reconfiguration of nodes, after that
+                         requests fail with 503 status (default: 0, no limits)
+  --discovery=TYPE       Load nodes from KV store instead of config: consul, etcd
+  --discovery-address=URL
+                         URL of KV store (http://127.0.0.1:8500, etc)
+  --discovery-key=KEY    Key of KV store which contains nodes (JSON array)
+  --discovery-interval=SECONDS
+                         Interval of polling of KV store (default: 10)
+  --pprof                Enable profiling methods under /debug/pprof of admin API
+  --self-test-path=PATH  Path of self-test request through proxy (default: check URL)
+  --api-access           Allow API calls from configured networks only (default: localhost)
+  --trace-generate       Generate trace context for requests without it
+  --trace-format=FORMAT  Format of generated trace context: w3c (default), b3
+  --compress             Compress API responses for clients which accept gzip
+  --compress-min-size=BYTES
+                         Size of smallest compressed API response (default: 1024)
+  --request-deadline=MS  Deadline of request across all attempts to nodes,
+                         it could be overridden by X-Spawn-Deadline header
+  --dial-timeout=MS      Waiting for connection to node (default: 30000)
+  --response-timeout=MS  Waiting for response headers of node (default: no limits)
+  --source-address=ADDR  Source IP address or interface of connections to nodes
+  --check-source-address=ADDR
+                         Source IP address or interface of health checks
+                         (default: source-address)
+  --stale-on-error       Return last known good response of read when nodes fail
+  --stale-max-age=SECONDS
+                         Maximum age of stale response (default: 300)
+  --coalesce             Identical concurrent reads (GET, HEAD) share one request to node
+  --read-verify          Send reads to several nodes and log divergent responses
+  --read-verify-replicas=N
+                         Count of nodes which are queried by read (default: 2)
+  --read-verify-compare=METHOD
+                         Comparison of responses: body (default), status
+  --spool-threshold=BYTES
+                         Size of update body which is stored in temporary file
+  --stream-buffer=BYTES  Size of buffer of copying of responses (default: 32768),
+                         streamed responses are flushed after every write
+  --retry-budget-ratio=RATIO
+                         Maximum ratio of retries to requests (default: no limits)
+  --retry-budget-window=SECONDS
+                         Sliding window of retry budget (default: 10)
+  --retry-budget-min=N   Count of retries allowed regardless of ratio
+  --auth=TYPE            Auth type: guest, LDAP, static (default: guest)
   --auth-expire=MINUTES  Auth expiration time (default: 30)
   --auth-host=HOST       Auth service host name or IP address
   --auth-port=PORT       Auth service port number
+  --auth-max-sessions=N  Maximum count of sessions per user (default: no limits)
+  --auth-admin-group=GROUP
+                         Group of users who have access to admin methods
+  --auth-fail-closed     Reject sessions while auth server is not reachable
+  --login-attempts=N     Failed login attempts which lock out user or IP (default: no limits)
+  --login-window=SECONDS Time of counting of failed login attempts (default: 300)
+  --login-lockout=SECONDS
+                         Time of lockout of user or IP (default: login window)
+
+Environment:
+  Each option could be defined by environment variable with prefix SPAWN_
+  in upper case, where dashes are replaced by underscores:
+  SPAWN_CONFIG, SPAWN_HOST, SPAWN_PORT, SPAWN_ROUND_ROBIN, SPAWN_AUTH_TYPE, etc.
+  The cmd options overwrite the environment variables, which overwrite
+  the config file, which overwrites the default values.
 `
 
 // Usage - get usage information
@@ -0,0 +1,89 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// spool contains the body of the update which is stored in temporary file,
+// the file is shared by the jobs of the nodes and removed after all of them
+type spool struct {
+	mutex   sync.Mutex
+	file    *os.File
+	size    int64
+	refs    int
+	removed bool
+}
+
+// spoolBody reads the body, if its size exceeds the threshold, the body is stored
+// in temporary file, otherwise the body is returned in the buffer
+func spoolBody(body io.Reader, threshold int64) (*bytes.Buffer, *spool, error) {
+	buffer := new(bytes.Buffer)
+	n, err := io.CopyN(buffer, body, threshold+1)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	if n <= threshold {
+		return buffer, nil, nil
+	}
+	file, err := ioutil.TempFile("", "spawn-update-")
+	if err != nil {
+		return nil, nil, err
+	}
+	s := &spool{file: file}
+	if s.size, err = io.Copy(file, io.MultiReader(buffer, body)); err != nil {
+		s.release()
+		return nil, nil, err
+	}
+
+	return nil, s, nil
+}
+
+// reader returns the reader of the body from the beginning,
+// it could be used concurrently by several jobs
+func (s *spool) reader() io.ReadCloser {
+	return ioutil.NopCloser(io.NewSectionReader(s.file, 0, s.size))
+}
+
+// hold adds the reference of the job which uses the body
+func (s *spool) hold() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.refs++
+}
+
+// release removes the reference of the job, the file is closed and removed
+// when the body is not used anymore
+func (s *spool) release() {
+	s.mutex.Lock()
+	s.refs--
+	refs := s.refs
+	s.mutex.Unlock()
+
+	if refs <= 0 {
+		s.remove()
+		s.file.Close()
+	}
+}
+
+// remove removes the file, the readers which are in use could read it until it is closed
+func (s *spool) remove() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.removed {
+		return
+	}
+	s.removed = true
+	if err := os.Remove(s.file.Name()); err != nil {
+		errlog.Println(err)
+	}
+}
@@ -0,0 +1,33 @@
+package spawn
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSpool(t *testing.T) {
+	// the small body is kept in memory
+	buffer, body, err := spoolBody(bytes.NewBufferString("small"), 10)
+	test(t, err == nil, "Expected no errors, got", err)
+	test(t, body == nil && buffer.String() == "small", "Expected the body in memory, got", buffer, body)
+
+	// the big body is stored in temporary file
+	_, body, err = spoolBody(bytes.NewBufferString("the big body"), 10)
+	test(t, err == nil, "Expected no errors, got", err)
+	test(t, body != nil && body.size == 12, "Expected the body in file, got", body)
+
+	body.hold()
+	body.hold()
+	for i := 0; i < 2; i++ {
+		data, err := ioutil.ReadAll(body.reader())
+		test(t, err == nil && string(data) == "the big body", "Expected the body, got", string(data), err)
+	}
+	body.release()
+	_, err = os.Stat(body.file.Name())
+	test(t, err == nil, "Expected the file exists, got", err)
+	body.release()
+	_, err = os.Stat(body.file.Name())
+	test(t, os.IsNotExist(err), "Expected the file is removed, got", err)
+}
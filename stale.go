@@ -0,0 +1,223 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default limits of the last known good responses
+const (
+	DefaultStaleMaxAge      time.Duration = 300
+	DefaultStaleMaxEntries                = 1000
+	DefaultStaleMaxBodySize int64         = 1 << 20
+)
+
+// staleWarning is the value of Warning header of the stale response
+const staleWarning = `110 - "Response is Stale"`
+
+// StaleOnError defines the last known good responses of the reads which are returned
+// when no one of the nodes could serve the read, the responses are kept in memory
+type StaleOnError struct {
+	Enabled bool `json:"enabled"`
+
+	// maximum age of the returned response in seconds (default: 300)
+	MaxAge time.Duration `json:"max-age"`
+
+	// maximum count of the kept responses (default: 1000)
+	MaxEntries int `json:"max-entries"`
+
+	// maximum size of the body of the kept response in bytes (default: 1048576)
+	MaxBodySize int64 `json:"max-body-size"`
+}
+
+// staleEntry is the last known good response of the read, it is returned
+// for the requests which have the same values of the headers of Vary only
+type staleEntry struct {
+	response *http.Response
+	body     []byte
+	stored   time.Time
+	vary     []string
+	variant  string
+}
+
+// staleBundle contains the last known good responses by key (method, host of the client and URL)
+type staleBundle struct {
+	mutex   sync.Mutex
+	records map[string]*staleEntry
+}
+
+// staleKey returns the key of the last known good response of the request to the host of the client,
+// empty key means the response is not kept, the responses of the requests with credentials
+// are not shared between the users
+func staleKey(request *http.Request, host string) string {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		return ""
+	}
+	if request.Header.Get("Authorization") != "" || request.Header.Get("Cookie") != "" {
+		return ""
+	}
+	return request.Method + " " + host + request.URL.RequestURI()
+}
+
+// staleVary returns the names of the request headers which vary the response,
+// false means the response could not be kept
+func staleVary(response *http.Response) ([]string, bool) {
+	var names []string
+	for _, value := range response.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "*" {
+				return nil, false
+			}
+			if name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, true
+}
+
+// staleVariant returns the values of the request headers which vary the response
+func staleVariant(request *http.Request, vary []string) string {
+	values := make([]string, 0, len(vary))
+	for _, name := range vary {
+		values = append(values, name+"="+strings.Join(request.Header.Values(name), ","))
+	}
+	return strings.Join(values, "\n")
+}
+
+// isPrivate checks that the response is defined for one user and must not be shared
+func isPrivate(response *http.Response) bool {
+	if len(response.Header.Values("Set-Cookie")) > 0 {
+		return true
+	}
+	for _, value := range response.Header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			switch strings.ToLower(strings.TrimSpace(directive)) {
+			case "private", "no-store":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withDefaults returns the options where zero values are replaced by default values
+func (options StaleOnError) withDefaults() StaleOnError {
+	if options.MaxAge <= 0 {
+		options.MaxAge = DefaultStaleMaxAge
+	}
+	if options.MaxEntries <= 0 {
+		options.MaxEntries = DefaultStaleMaxEntries
+	}
+	if options.MaxBodySize <= 0 {
+		options.MaxBodySize = DefaultStaleMaxBodySize
+	}
+	return options
+}
+
+// store keeps the successful response which body has known size within the limit,
+// the body of the response is replaced by the kept copy, the private responses are not kept
+func (bundle *staleBundle) store(key string, request *http.Request, response *http.Response, options StaleOnError) {
+	if response.StatusCode != http.StatusOK || response.ContentLength < 0 ||
+		response.ContentLength > options.MaxBodySize || isPrivate(response) {
+		return
+	}
+	vary, ok := staleVary(response)
+	if !ok {
+		return
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	entry := &staleEntry{
+		response: new(http.Response),
+		body:     body,
+		stored:   time.Now(),
+		vary:     vary,
+		variant:  staleVariant(request, vary),
+	}
+	*entry.response = *response
+	entry.response.Header = response.Header.Clone()
+	entry.response.Body = nil
+	entry.response.Request = nil
+
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	if _, ok := bundle.records[key]; !ok && len(bundle.records) >= options.MaxEntries {
+		bundle.evict(time.Second*options.MaxAge, options.MaxEntries)
+	}
+	bundle.records[key] = entry
+}
+
+// evict removes the expired responses and one of the rest responses if the count
+// still exceeds the limit (must be called under lock)
+func (bundle *staleBundle) evict(maxAge time.Duration, maxEntries int) {
+	for key, entry := range bundle.records {
+		if time.Since(entry.stored) > maxAge {
+			delete(bundle.records, key)
+		}
+	}
+	for key := range bundle.records {
+		if len(bundle.records) < maxEntries {
+			return
+		}
+		delete(bundle.records, key)
+	}
+}
+
+// load returns the copy of the kept response for the request if it is not older than maximum age,
+// the response has Warning and Age headers
+func (bundle *staleBundle) load(key string, request *http.Request, maxAge time.Duration) (*http.Response, bool) {
+	bundle.mutex.Lock()
+	entry, ok := bundle.records[key]
+	bundle.mutex.Unlock()
+
+	if !ok || time.Since(entry.stored) > maxAge || staleVariant(request, entry.vary) != entry.variant {
+		return nil, false
+	}
+	response := *entry.response
+	response.Header = entry.response.Header.Clone()
+	response.Header.Add("Warning", staleWarning)
+	response.Header.Set("Age", strconv.Itoa(int(time.Since(entry.stored).Seconds())))
+	response.Body = ioutil.NopCloser(bytes.NewReader(entry.body))
+	response.Request = request
+
+	return &response, true
+}
+
+// processReceiveStale calls the read and keeps its response, the last known good response
+// is returned if no one of the nodes could serve the read, the host is the Host header of the client
+func (server *Server) processReceiveStale(request *http.Request, host string) (*http.Response, error) {
+	options := server.Options.StaleOnError
+	key := staleKey(request, host)
+	if !options.Enabled || key == "" {
+		return server.processReceiveVerify(request)
+	}
+	options = options.withDefaults()
+	response, err := server.processReceiveVerify(request)
+	if err != nil {
+		if stale, ok := server.stale.load(key, request, time.Second*options.MaxAge); ok {
+			errlog.Println(err)
+			stdlog.Println("Stale response is returned for", key)
+			return stale, nil
+		}
+		return nil, err
+	}
+	server.stale.store(key, request, response, options)
+
+	return response, nil
+}
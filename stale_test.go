@@ -0,0 +1,95 @@
+package spawn
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStaleOnError(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cookie":
+			w.Header().Set("Set-Cookie", "session=1")
+		case "/private":
+			w.Header().Set("Cache-Control", "max-age=60, private")
+		case "/vary":
+			w.Header().Set("Vary", "Accept-Language")
+		}
+		w.Write([]byte("fresh"))
+	}))
+	host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+	number, _ := strconv.ParseUint(port, 10, 64)
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.Options.StaleOnError = StaleOnError{Enabled: true}
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: host, Port: number, Active: true}})
+	server.job <- responseSignal
+	<-server.response
+
+	read := func(path string, headers ...string) (*http.Response, string, error) {
+		request, _ := http.NewRequest("GET", "http://example.com"+path, nil)
+		for index := 0; index+1 < len(headers); index += 2 {
+			request.Header.Set(headers[index], headers[index+1])
+		}
+		response, err := server.RoundTrip(request)
+		if err != nil {
+			return nil, "", err
+		}
+		defer response.Body.Close()
+		data, _ := ioutil.ReadAll(response.Body)
+		return response, string(data), nil
+	}
+
+	response, body, err := read("/catalog")
+	test(t, err == nil && body == "fresh", "Expected the fresh response, got", body, err)
+	test(t, response.Header.Get("Warning") == "", "Expected no warning of the fresh response")
+
+	// the responses of the users and the private responses are not kept
+	for _, path := range []string{"/auth", "/session", "/cookie", "/private"} {
+		switch path {
+		case "/auth":
+			_, _, err = read(path, "Authorization", "Bearer token")
+		case "/session":
+			_, _, err = read(path, "Cookie", "session=1")
+		default:
+			_, _, err = read(path)
+		}
+		test(t, err == nil, "Expected the fresh response, got", path, err)
+	}
+	_, _, err = read("/vary", "Accept-Language", "nl")
+	test(t, err == nil, "Expected the fresh response, got", err)
+	test(t, len(server.stale.records) == 2, "Expected the shared responses are kept only, got", len(server.stale.records))
+
+	// all nodes fail, the last known good response is returned
+	node.Close()
+	response, body, err = read("/catalog")
+	test(t, err == nil && body == "fresh", "Expected the stale response, got", body, err)
+	test(t, response.Header.Get("Warning") == staleWarning, "Expected the warning, got", response.Header.Get("Warning"))
+	test(t, response.Header.Get("Age") != "", "Expected the age of the stale response")
+
+	// the response of other URL, other host or with other value of Vary header is not returned
+	_, _, err = read("/other")
+	test(t, err != nil, "Expected the error of the read without stale response")
+	request, _ := http.NewRequest("GET", "http://other.example.com/catalog", nil)
+	_, err = server.RoundTrip(request)
+	test(t, err != nil, "Expected the error of the read of other host without stale response")
+	_, body, err = read("/vary", "Accept-Language", "nl")
+	test(t, err == nil && body == "fresh", "Expected the stale response of the same variant, got", body, err)
+	_, _, err = read("/vary", "Accept-Language", "en")
+	test(t, err != nil, "Expected the error of the read of other variant without stale response")
+
+	// the stale response is expired
+	entry, ok := server.stale.records["GET example.com/catalog"]
+	test(t, ok, "Expected the kept response of the read")
+	entry.stored = entry.stored.Add(-time.Second * (DefaultStaleMaxAge + 1))
+	_, _, err = read("/catalog")
+	test(t, err != nil, "Expected the error of the read with expired stale response")
+}
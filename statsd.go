@@ -0,0 +1,173 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default settings of the StatsD exporter
+const (
+	DefaultStatsDInterval time.Duration = 10
+	DefaultStatsDPrefix                 = "spawn"
+)
+
+// maxStatsDPacket is the maximum size of UDP packet of the metrics which is not fragmented
+const maxStatsDPacket = 1432
+
+// StatsD defines the push of the metrics of the nodes to StatsD server,
+// the exporter is disabled if the address is not defined
+type StatsD struct {
+
+	// host:port of StatsD server
+	Address string `json:"address"`
+
+	// time in seconds between the flushes of the metrics (default: 10)
+	Interval time.Duration `json:"interval"`
+
+	// prefix of the names of the metrics (default: spawn)
+	Prefix string `json:"prefix"`
+
+	// the node and the method are sent as DogStatsD tags instead of the parts of the names
+	Tags bool `json:"tags"`
+}
+
+// statsdMetric is the metric of the node by the method
+type statsdMetric struct {
+	name, method string
+	value        uint64
+}
+
+// statsdMetrics returns the metrics of the node by the name and the method
+func statsdMetrics(metric Metrics) []statsdMetric {
+	return []statsdMetric{
+		{successMetric, "get", metric.Success.Get},
+		{successMetric, "set", metric.Success.Set},
+		{successMetric, "delete", metric.Success.Delete},
+		{failureMetric, "get", metric.Failure.Get},
+		{failureMetric, "set", metric.Failure.Set},
+		{failureMetric, "delete", metric.Failure.Delete},
+		{queuedMetric, "get", metric.Queued.Get},
+		{queuedMetric, "set", metric.Queued.Set},
+		{queuedMetric, "delete", metric.Queued.Delete},
+		{rejectedMetric, "get", metric.Rejected.Get},
+		{rejectedMetric, "set", metric.Rejected.Set},
+		{rejectedMetric, "delete", metric.Rejected.Delete},
+		{droppedMetric, "get", metric.Dropped.Get},
+		{droppedMetric, "set", metric.Dropped.Set},
+		{droppedMetric, "delete", metric.Dropped.Delete},
+	}
+}
+
+// statsdName replaces the characters which are reserved by StatsD protocol in the node ID
+func statsdName(id string) string {
+	return strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", "#", "_", ",", "_").Replace(id)
+}
+
+// statsdLines returns the lines of StatsD protocol of the metrics, the queued requests are gauges,
+// the rest metrics are counters of the increments since the previous flush
+func statsdLines(options StatsD, current, previous map[string]Metrics) []string {
+	ids := make([]string, 0, len(current))
+	for id := range current {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var lines []string
+	for _, id := range ids {
+		last := statsdMetrics(previous[id])
+		for index, metric := range statsdMetrics(current[id]) {
+			value, kind := metric.value, "c"
+			if metric.name == queuedMetric {
+				kind = "g"
+			} else {
+				// the counters are not decreased, the reset of the node is sent as the whole value
+				if value >= last[index].value {
+					value -= last[index].value
+				}
+				if value == 0 {
+					continue
+				}
+			}
+			var line string
+			if options.Tags {
+				line = options.Prefix + "." + metric.name + ":" + strconv.FormatUint(value, 10) + "|" + kind +
+					"|#node:" + statsdName(id) + ",method:" + metric.method
+			} else {
+				line = options.Prefix + "." + statsdName(id) + "." + metric.method + "." + metric.name + ":" +
+					strconv.FormatUint(value, 10) + "|" + kind
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// statsdPackets joins the lines into the packets which are not fragmented
+func statsdPackets(lines []string) []string {
+	var packets []string
+	var packet string
+	for _, line := range lines {
+		if packet != "" && len(packet)+1+len(line) > maxStatsDPacket {
+			packets = append(packets, packet)
+			packet = ""
+		}
+		if packet != "" {
+			packet += "\n"
+		}
+		packet += line
+	}
+	if packet != "" {
+		packets = append(packets, packet)
+	}
+	return packets
+}
+
+// snapshot returns the copy of the metrics of all nodes
+func (bundle *MetricsBandle) snapshot() map[string]Metrics {
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	records := make(map[string]Metrics, len(bundle.records))
+	for id, metric := range bundle.records {
+		records[id] = metric
+	}
+	return records
+}
+
+// exportStatsD periodically flushes the metrics of the nodes to StatsD server
+func (server *Server) exportStatsD(options StatsD) {
+	if options.Interval <= 0 {
+		options.Interval = DefaultStatsDInterval
+	}
+	if options.Prefix == "" {
+		options.Prefix = DefaultStatsDPrefix
+	}
+	conn, err := net.Dial("udp", options.Address)
+	if err != nil {
+		errlog.Println("Could not connect to StatsD server:", err)
+		return
+	}
+	defer conn.Close()
+	stdlog.Println("The metrics are exported to StatsD server", options.Address)
+
+	previous := make(map[string]Metrics)
+	ticker := time.NewTicker(time.Second * options.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		current := server.Metrics.snapshot()
+		for _, packet := range statsdPackets(statsdLines(options, current, previous)) {
+			if _, err := conn.Write([]byte(packet)); err != nil {
+				errlog.Println("Could not send the metrics to StatsD server:", err)
+				break
+			}
+		}
+		previous = current
+	}
+}
@@ -0,0 +1,53 @@
+package spawn
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsDLines(t *testing.T) {
+	var metric Metrics
+	metric.Success.Get = 5
+	metric.Queued.Set = 2
+	current := map[string]Metrics{"127.0.0.1:3001": metric}
+
+	lines := statsdLines(StatsD{Prefix: "spawn"}, current, nil)
+	test(t, len(lines) == 4, "Expected counter and gauges of the node, got", lines)
+	test(t, lines[0] == "spawn.127_0_0_1_3001.get.success:5|c", "Expected counter of the node, got", lines[0])
+	test(t, lines[2] == "spawn.127_0_0_1_3001.set.queued:2|g", "Expected gauge of the node, got", lines[2])
+
+	lines = statsdLines(StatsD{Prefix: "spawn", Tags: true}, current, nil)
+	test(t, lines[0] == "spawn.success:5|c|#node:127_0_0_1_3001,method:get", "Expected tagged counter, got", lines[0])
+
+	previous := current
+	metric.Success.Get = 7
+	current = map[string]Metrics{"127.0.0.1:3001": metric}
+	lines = statsdLines(StatsD{Prefix: "spawn"}, current, previous)
+	test(t, lines[0] == "spawn.127_0_0_1_3001.get.success:2|c", "Expected increment since the flush, got", lines[0])
+
+	line := strings.Repeat("x", 1000)
+	packets := statsdPackets([]string{line, line, "y"})
+	test(t, len(packets) == 2 && packets[1] == line+"\ny", "Expected the lines are split into packets, got", len(packets))
+}
+
+func TestStatsDExport(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	test(t, err == nil, "Expected listen UDP, got", err)
+	defer conn.Close()
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	var metric Metrics
+	metric.Failure.Delete = 3
+	server.Metrics.records["127.0.0.1:3001"] = metric
+	go server.exportStatsD(StatsD{Address: conn.LocalAddr().String(), Interval: 1})
+
+	buffer := make([]byte, maxStatsDPacket)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buffer)
+	test(t, err == nil, "Expected receive the metrics, got", err)
+	test(t, strings.Contains(string(buffer[:n]), "spawn.127_0_0_1_3001.delete.failure:3|c"),
+		"Expected the metrics with default prefix, got", string(buffer[:n]))
+}
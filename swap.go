@@ -0,0 +1,250 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/takama/router"
+)
+
+// DefaultSwapTimeout is time in seconds of waiting for the new nodes to be healthy
+const DefaultSwapTimeout time.Duration = 30
+
+// swapPollInterval is interval of the health checks of the new nodes
+const swapPollInterval = 500 * time.Millisecond
+
+// Swap defines the health of the new nodes which is required by the swap of all nodes,
+// otherwise the previous nodes are restored
+type Swap struct {
+
+	// minimum count of the healthy new nodes (default: all new nodes)
+	MinHealthy int `json:"min-healthy"`
+
+	// time in seconds of waiting for the new nodes to be healthy (default: 30)
+	Timeout time.Duration `json:"timeout"`
+}
+
+// SwapError contains count of the healthy new nodes when the swap is rolled back
+// and count of the nodes which are not restored because they were changed during the swap
+type SwapError struct {
+	Healthy, Required, Conflicts int
+}
+
+func (e *SwapError) Error() string {
+	if e.Conflicts > 0 {
+		return fmt.Sprintf("%d of %d required new nodes are healthy, %d nodes changed during the swap are not restored",
+			e.Healthy, e.Required, e.Conflicts)
+	}
+	return fmt.Sprintf("%d of %d required new nodes are healthy, the previous nodes are restored",
+		e.Healthy, e.Required)
+}
+
+// errIncorrectNodes is returned when the new nodes have incorrect values
+var errIncorrectNodes = errors.New("The parameters for the nodes have incorrect values")
+
+// errNoNodes is returned when the new nodes are not defined
+var errNoNodes = errors.New("The new nodes are not defined")
+
+// errTooManyNodes is returned when count of the new nodes exceeds the limit of the nodes
+var errTooManyNodes = errors.New("The count of the new nodes exceeds the limit of the nodes")
+
+// Replace - replaces all the nodes records by the nodes in one transaction,
+// returns the previous nodes records
+func (bundle *NodeBundle) Replace(nodes []Node) (previous []Node, ok bool) {
+
+	// Validate the Nodes
+	defined := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		if node.Host == "" || !isAlphaNumeric(node.Host) || node.Port == 0 || node.MaxRPS < 0 || node.Timeout < 0 {
+			return nil, false
+		}
+		defined[fmt.Sprintf("%s:%d", node.Host, node.Port)] = true
+	}
+
+	// Lock the bundle for the transaction processing
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	transaction := bundle.begin()
+	for host := range bundle.records {
+		for port, record := range bundle.records[host] {
+			previous = append(previous, record)
+			if !defined[fmt.Sprintf("%s:%d", host, port)] {
+				transaction.delete(host, port)
+			}
+		}
+	}
+	for _, node := range nodes {
+		// Add/Update a record
+		transaction.update(node)
+	}
+
+	// Job done - end of the transaction
+	transaction.commit()
+
+	return previous, true
+}
+
+// rollback restores the previous nodes records which are replaced by the nodes in one transaction,
+// the records changed by others since the replacement are kept, returns count of them
+func (bundle *NodeBundle) rollback(previous, nodes []Node) (conflicts int) {
+	replaced := make(map[string]Node, len(nodes))
+	for _, node := range nodes {
+		replaced[fmt.Sprintf("%s:%d", node.Host, node.Port)] = node
+	}
+	restored := make(map[string]Node, len(previous))
+	for _, node := range previous {
+		restored[fmt.Sprintf("%s:%d", node.Host, node.Port)] = node
+	}
+
+	// Lock the bundle for the transaction processing
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	transaction := bundle.begin()
+	for id, node := range replaced {
+		current, ok := bundle.records[node.Host][node.Port]
+		if !ok || !current.equal(node) {
+			conflicts++
+			continue
+		}
+		if record, ok := restored[id]; ok {
+			transaction.update(record)
+		} else {
+			transaction.delete(node.Host, node.Port)
+		}
+	}
+	for id, record := range restored {
+		if _, ok := replaced[id]; ok {
+			continue
+		}
+		if _, ok := bundle.records[record.Host][record.Port]; ok {
+			conflicts++
+			continue
+		}
+		transaction.update(record)
+	}
+
+	// Job done - end of the transaction
+	transaction.commit()
+
+	return conflicts
+}
+
+// healthyNodes checks the nodes until the required count of them is healthy or the timeout
+// is expired, every node is checked until its first successful probe, returns count of the healthy nodes
+func (server *Server) healthyNodes(nodes []Node, required int, timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	healthy := make([]bool, len(nodes))
+	probe := server.prober()
+	count := 0
+	for {
+		var wg sync.WaitGroup
+		for index, node := range nodes {
+			if healthy[index] {
+				continue
+			}
+			wg.Add(1)
+			go func(index int, node Node) {
+				defer wg.Done()
+				healthy[index] = probe(fmt.Sprintf("%s:%d", node.Host, node.Port))
+			}(index, node)
+		}
+		wg.Wait()
+
+		count = 0
+		for _, alive := range healthy {
+			if alive {
+				count++
+			}
+		}
+		if count >= required || time.Now().Add(swapPollInterval).After(deadline) {
+			return count
+		}
+		time.Sleep(swapPollInterval)
+	}
+}
+
+// swap replaces all nodes by the new nodes and restores the previous nodes
+// if fewer than required new nodes are healthy within the timeout
+func (server *Server) swap(nodes []Node) error {
+	server.swapping.Lock()
+	defer server.swapping.Unlock()
+
+	options := server.Options.Swap
+	required := options.MinHealthy
+	if required <= 0 || required > len(nodes) {
+		required = len(nodes)
+	}
+	timeout := time.Second * options.Timeout
+	if timeout <= 0 {
+		timeout = time.Second * DefaultSwapTimeout
+	}
+
+	if len(nodes) == 0 {
+		return errNoNodes
+	}
+	if len(nodes) > server.Nodes.maxNodes() {
+		return errTooManyNodes
+	}
+	previous, ok := server.Nodes.Replace(nodes)
+	if !ok {
+		return errIncorrectNodes
+	}
+	if healthy := server.healthyNodes(nodes, required, timeout); healthy < required {
+		conflicts := server.Nodes.rollback(previous, nodes)
+		return &SwapError{Healthy: healthy, Required: required, Conflicts: conflicts}
+	}
+
+	return nil
+}
+
+// swapRecords replaces all nodes records by the records of the request,
+// the previous records are restored if the new nodes are not healthy
+func (server *Server) swapRecords(c *router.Control) {
+	c.UseTimer()
+
+	var records []Node
+
+	// Try to decode records
+	if !decodeRecord(&records, server.Options.StrictDecoding, c) {
+		return
+	}
+	for _, record := range records {
+		if !checkAnnotations(record.Annotations, c) {
+			return
+		}
+	}
+
+	if err := server.swap(records); err != nil {
+		code := http.StatusBadGateway
+		switch err {
+		case errIncorrectNodes, errNoNodes:
+			code = http.StatusBadRequest
+		case errTooManyNodes:
+			code = http.StatusInsufficientStorage
+		}
+		replyError(c, code, data{
+			"success": false,
+			"error":   code,
+			"message": "The nodes are not swapped",
+			"info":    err.Error(),
+		})
+		errlog.Println(err)
+		return
+	}
+	stdlog.Println("swap nodes, total:", len(records))
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"total":   len(records),
+		"results": records,
+	})
+}
@@ -0,0 +1,102 @@
+package spawn
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSwap(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer node.Close()
+	host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+	number, _ := strconv.ParseUint(port, 10, 64)
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedHost, closedPort, _ := net.SplitHostPort(closed.Listener.Addr().String())
+	closedNumber, _ := strconv.ParseUint(closedPort, 10, 64)
+	closed.Close()
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: "127.0.0.1", Port: 1, Active: true}})
+	server.job <- responseSignal
+	<-server.response
+	server.Options.Swap.Timeout = 1
+
+	err = server.swap([]Node{{Host: host, Port: number, Active: true}})
+	server.job <- responseSignal
+	<-server.response
+	test(t, err == nil, "Expected the nodes are swapped, got", err)
+	nodes, total := server.Nodes.GetAll()
+	test(t, total == 1 && nodes[0].Port == number, "Expected the new node only, got", nodes)
+
+	err = server.swap([]Node{{Host: closedHost, Port: closedNumber, Active: true}})
+	server.job <- responseSignal
+	<-server.response
+	_, ok := err.(*SwapError)
+	test(t, ok, "Expected the swap is rolled back, got", err)
+	nodes, total = server.Nodes.GetAll()
+	test(t, total == 1 && nodes[0].Port == number, "Expected the previous node is restored, got", nodes)
+
+	server.Options.Swap.MinHealthy = 1
+	err = server.swap([]Node{{Host: host, Port: number, Active: true}, {Host: closedHost, Port: closedNumber}})
+	server.job <- responseSignal
+	<-server.response
+	test(t, err == nil, "Expected the nodes are swapped with one healthy node, got", err)
+	_, total = server.Nodes.GetAll()
+	test(t, total == 2, "Expected 2 nodes, got", total)
+
+	err = server.swap([]Node{{Host: "", Port: 1}})
+	test(t, err == errIncorrectNodes, "Expected the incorrect nodes are rejected, got", err)
+
+	err = server.swap([]Node{})
+	test(t, err == errNoNodes, "Expected the empty nodes are rejected, got", err)
+	_, total = server.Nodes.GetAll()
+	test(t, total == 2, "Expected the nodes are not changed by the empty swap, got", total)
+}
+
+func TestSwapRollback(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: "127.0.0.1", Port: 1}, {Host: "127.0.0.1", Port: 2}})
+	server.job <- responseSignal
+	<-server.response
+
+	nodes := []Node{{Host: "127.0.0.1", Port: 2, Priority: 1}, {Host: "127.0.0.1", Port: 3}, {Host: "127.0.0.1", Port: 4}}
+	previous, ok := server.Nodes.Replace(nodes)
+	server.job <- responseSignal
+	<-server.response
+	test(t, ok && len(previous) == 2, "Expected the nodes are replaced, got", previous)
+
+	// the nodes are changed by others during the swap
+	server.Nodes.Set(&Node{Host: "127.0.0.1", Port: 3, Priority: 5})
+	server.Nodes.Set(&Node{Host: "127.0.0.1", Port: 1, Priority: 7})
+	server.job <- responseSignal
+	<-server.response
+
+	conflicts := server.Nodes.rollback(previous, nodes)
+	server.job <- responseSignal
+	<-server.response
+	test(t, conflicts == 2, "Expected 2 conflicts, got", conflicts)
+	_, total := server.Nodes.GetAll()
+	test(t, total == 3, "Expected 3 nodes after rollback, got", total)
+	node, ok := server.Nodes.Get("127.0.0.1", 1)
+	test(t, ok && node.Priority == 7, "Expected the node re-added during the swap is kept, got", node)
+	node, ok = server.Nodes.Get("127.0.0.1", 2)
+	test(t, ok && node.Priority == 0, "Expected the previous node is restored, got", node)
+	node, ok = server.Nodes.Get("127.0.0.1", 3)
+	test(t, ok && node.Priority == 5, "Expected the node changed during the swap is kept, got", node)
+	_, ok = server.Nodes.Get("127.0.0.1", 4)
+	test(t, !ok, "Expected the new node is removed")
+
+	message := (&SwapError{Healthy: 0, Required: 3, Conflicts: conflicts}).Error()
+	test(t, strings.Contains(message, "2 nodes changed"), "Expected the conflicts are reported, got", message)
+}
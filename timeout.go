@@ -0,0 +1,119 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/takama/router"
+)
+
+// DefaultMaxResponseTimeout is maximum time in seconds of the response timeout
+// which could be set at runtime
+const DefaultMaxResponseTimeout time.Duration = 300
+
+// Timeouts contains the timeouts which could be changed at runtime
+type Timeouts struct {
+
+	// time in seconds of waiting for the answer of the worker to the update
+	Response time.Duration `json:"response"`
+
+	// time in milliseconds of waiting for the connection to the node,
+	// it is used by the requests and by the health checks of the nodes
+	Dial time.Duration `json:"dial"`
+}
+
+// getResponseTimeout returns the current timeout of the worker's response
+func (server *Server) getResponseTimeout() time.Duration {
+	server.timeoutMutex.RLock()
+	defer server.timeoutMutex.RUnlock()
+
+	return server.responseTimeout
+}
+
+// setResponseTimeout changes the timeout of the worker's response
+func (server *Server) setResponseTimeout(timeout time.Duration) {
+	server.timeoutMutex.Lock()
+	defer server.timeoutMutex.Unlock()
+
+	server.responseTimeout = timeout
+}
+
+// getDialTimeout returns the current timeout of the connections to the nodes in milliseconds
+func (server *Server) getDialTimeout() time.Duration {
+	server.timeoutMutex.RLock()
+	defer server.timeoutMutex.RUnlock()
+
+	if server.dialTimeout <= 0 {
+		return DefaultDialTimeout
+	}
+	return server.dialTimeout
+}
+
+// setDialTimeout changes the timeout of the connections to the nodes in milliseconds
+func (server *Server) setDialTimeout(timeout time.Duration) {
+	server.timeoutMutex.Lock()
+	defer server.timeoutMutex.Unlock()
+
+	server.dialTimeout = timeout
+}
+
+// timeouts returns the current timeouts
+func (server *Server) timeouts() Timeouts {
+	return Timeouts{Response: server.getResponseTimeout(), Dial: server.getDialTimeout()}
+}
+
+// maxResponseTimeout returns maximum of the response timeout which could be set at runtime
+func (server *Server) maxResponseTimeout() time.Duration {
+	if server.Options.MaxResponseTimeout > 0 {
+		return server.Options.MaxResponseTimeout
+	}
+	return DefaultMaxResponseTimeout
+}
+
+// getTimeouts - gets the current timeouts
+func (server *Server) getTimeouts(c *router.Control) {
+	c.UseTimer()
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"results": server.timeouts(),
+	})
+}
+
+// putTimeouts - changes the timeouts, they are used by the next requests and connections,
+// the changed dial timeout is limited by the maximum of the response timeout
+func (server *Server) putTimeouts(c *router.Control) {
+	c.UseTimer()
+
+	current := server.timeouts()
+	timeouts := current
+	if !decodeRecord(&timeouts, server.Options.StrictDecoding, c) {
+		return
+	}
+	max := server.maxResponseTimeout()
+	if timeouts.Response <= 0 || timeouts.Response > max {
+		notRecognizedParameterError("response",
+			fmt.Errorf("%d is out of range [1, %d]", timeouts.Response, max), c)
+		return
+	}
+	if maxDial := max * time.Second / time.Millisecond; timeouts.Dial != current.Dial &&
+		(timeouts.Dial <= 0 || timeouts.Dial > maxDial) {
+		notRecognizedParameterError("dial",
+			fmt.Errorf("%d is out of range [1, %d]", timeouts.Dial, maxDial), c)
+		return
+	}
+	server.setResponseTimeout(timeouts.Response)
+	server.setDialTimeout(timeouts.Dial)
+	stdlog.Println("Response timeout is changed to", time.Second*timeouts.Response,
+		"dial timeout is changed to", time.Millisecond*timeouts.Dial)
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"results": timeouts,
+	})
+}
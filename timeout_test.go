@@ -0,0 +1,67 @@
+package spawn
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/takama/router"
+)
+
+func TestPutTimeouts(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.Options.MaxResponseTimeout = 60
+
+	put := func(body string) int {
+		request, _ := http.NewRequest("PUT", "/config/timeout", strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		server.putTimeouts(&router.Control{Request: request, Writer: recorder})
+		return recorder.Code
+	}
+
+	code := put(`{"response": 30}`)
+	test(t, code == http.StatusOK, "Expected the timeout is changed, got", code)
+	test(t, server.getResponseTimeout() == 30, "Expected the response timeout 30, got", server.getResponseTimeout())
+
+	code = put(`{"response": 120}`)
+	test(t, code == http.StatusBadRequest, "Expected the timeout above maximum is rejected, got", code)
+	code = put(`{"response": 0}`)
+	test(t, code == http.StatusBadRequest, "Expected the zero timeout is rejected, got", code)
+	test(t, server.getResponseTimeout() == 30, "Expected the response timeout is not changed, got", server.getResponseTimeout())
+
+	test(t, server.getDialTimeout() == DefaultDialTimeout, "Expected the default dial timeout, got", server.getDialTimeout())
+	code = put(`{"response": 30, "dial": 500}`)
+	test(t, code == http.StatusOK, "Expected the dial timeout is changed, got", code)
+	test(t, server.getDialTimeout() == 500, "Expected the dial timeout 500, got", server.getDialTimeout())
+	code = put(`{"dial": 120000}`)
+	test(t, code == http.StatusBadRequest, "Expected the dial timeout above maximum is rejected, got", code)
+	code = put(`{"dial": -1}`)
+	test(t, code == http.StatusBadRequest, "Expected the negative dial timeout is rejected, got", code)
+	test(t, server.getDialTimeout() == 500, "Expected the dial timeout is not changed, got", server.getDialTimeout())
+}
+
+func TestRuntimeDialTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	test(t, err == nil, "Expected a local listener, got", err)
+	defer listener.Close()
+
+	// the dial timeout is taken on every dial
+	var calls int
+	transport := newBackendTransport(Backend{}, nil, func() time.Duration {
+		calls++
+		return 100
+	})
+	for i := 1; i <= 2; i++ {
+		conn, err := transport.DialContext(context.Background(), "tcp", listener.Addr().String())
+		test(t, err == nil, "Expected the connection, got", err)
+		if err == nil {
+			conn.Close()
+		}
+		test(t, calls == i, "Expected the timeout is taken by the dial", i, "got", calls)
+	}
+}
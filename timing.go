@@ -0,0 +1,70 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HeaderTiming is the response header with the breakdown of time of the request
+const HeaderTiming = "X-Spawn-Timing"
+
+// requestTiming collects time of the request spent on selection of the nodes,
+// on their health checks and on the nodes themselves
+type requestTiming struct {
+	started time.Time
+	check   time.Duration
+	backend time.Duration
+}
+
+// startTiming starts the timing of the request, it returns nil if the timing is disabled
+func (server *Server) startTiming() *requestTiming {
+	if !server.Options.Timing {
+		return nil
+	}
+	return &requestTiming{started: time.Now()}
+}
+
+// addCheck adds time of the health check of the node since the start
+func (timing *requestTiming) addCheck(start time.Time) {
+	if timing != nil {
+		timing.check += time.Since(start)
+	}
+}
+
+// addBackend adds time of the node since the start
+func (timing *requestTiming) addBackend(start time.Time) {
+	if timing != nil {
+		timing.backend += time.Since(start)
+	}
+}
+
+// String returns the breakdown in milliseconds, the rest of the time is the selection
+func (timing *requestTiming) String() string {
+	selection := time.Since(timing.started) - timing.check - timing.backend
+	if selection < 0 {
+		selection = 0
+	}
+	return fmt.Sprintf("selection=%.3f, check=%.3f, backend=%.3f",
+		milliseconds(selection), milliseconds(timing.check), milliseconds(timing.backend))
+}
+
+// attach adds the breakdown to the response before it is written to the client
+func (timing *requestTiming) attach(response *http.Response) {
+	if timing == nil || response == nil {
+		return
+	}
+	if response.Header == nil {
+		response.Header = make(http.Header)
+	}
+	response.Header.Set(HeaderTiming, timing.String())
+}
+
+// milliseconds returns the duration in fractional milliseconds
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
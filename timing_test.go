@@ -0,0 +1,56 @@
+package spawn
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTiming(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/check" {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	})
+	node := httptest.NewServer(handler)
+	defer node.Close()
+	host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+	number, _ := strconv.ParseUint(port, 10, 64)
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.responseTimeout = 5
+	server.check.URL = "/check"
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: host, Port: number, Active: true}})
+	server.job <- responseSignal
+	<-server.response
+
+	// the timing is disabled by default
+	request, _ := http.NewRequest("GET", "http://example.com/", nil)
+	response, err := server.RoundTrip(request)
+	test(t, err == nil, "Expected the read is served, got", err)
+	response.Body.Close()
+	test(t, response.Header.Get(HeaderTiming) == "", "Expected no timing header, got", response.Header.Get(HeaderTiming))
+
+	server.Options.Timing = true
+	for _, method := range []string{"GET", methodPOST} {
+		request, _ = http.NewRequest(method, "http://example.com/", strings.NewReader("update"))
+		response, err = server.RoundTrip(request)
+		test(t, err == nil, "Expected the request is served, got", method, err)
+		response.Body.Close()
+		var selection, check, backend float64
+		_, err = fmt.Sscanf(response.Header.Get(HeaderTiming), "selection=%f, check=%f, backend=%f",
+			&selection, &check, &backend)
+		test(t, err == nil, "Expected the timing header is parsed, got", response.Header.Get(HeaderTiming), err)
+		test(t, backend >= 50, "Expected the time of the node is counted, got", method, backend)
+		test(t, selection >= 0 && check >= 0, "Expected non negative timing, got", selection, check)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// The headers of the trace context (W3C Trace Context and B3)
+const (
+	HeaderTraceParent = "Traceparent"
+	HeaderTraceState  = "Tracestate"
+	HeaderB3          = "B3"
+	HeaderB3TraceID   = "X-B3-Traceid"
+	HeaderB3SpanID    = "X-B3-Spanid"
+	HeaderB3Sampled   = "X-B3-Sampled"
+)
+
+// The formats of the generated trace context
+const (
+	TraceFormatW3C = "w3c"
+	TraceFormatB3  = "b3"
+)
+
+// Tracing defines the trace context of the requests which is forwarded to the nodes,
+// the trace headers of the client are always forwarded to all nodes as is
+type Tracing struct {
+
+	// the trace context is generated for the requests without it
+	Generate bool `json:"generate"`
+
+	// format of the generated trace context: "w3c" (default) or "b3"
+	Format string `json:"format"`
+}
+
+// hasTraceContext checks that the request contains the trace context in any format
+func hasTraceContext(header http.Header) bool {
+	return header.Get(HeaderTraceParent) != "" || header.Get(HeaderB3) != "" ||
+		header.Get(HeaderB3TraceID) != ""
+}
+
+// traceID returns the random identifier of the trace or span of the size in bytes as hex string
+func traceID(size int) string {
+	id := make([]byte, size)
+	io.ReadFull(rand.Reader, id)
+	return fmt.Sprintf("%x", id)
+}
+
+// inject adds the new sampled trace context to the request which does not contain it
+func (tracing *Tracing) inject(request *http.Request) {
+	if !tracing.Generate || hasTraceContext(request.Header) {
+		return
+	}
+	switch tracing.Format {
+	case TraceFormatB3:
+		request.Header.Set(HeaderB3TraceID, traceID(16))
+		request.Header.Set(HeaderB3SpanID, traceID(8))
+		request.Header.Set(HeaderB3Sampled, "1")
+	default:
+		request.Header.Set(HeaderTraceParent, "00-"+traceID(16)+"-"+traceID(8)+"-01")
+	}
+}
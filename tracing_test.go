@@ -0,0 +1,87 @@
+package spawn
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTraceFanOut(t *testing.T) {
+	traces := make(chan http.Header, 2)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/check" {
+			return
+		}
+		traces <- r.Header
+	})
+	var nodes []Node
+	for i := 0; i < 2; i++ {
+		node := httptest.NewServer(handler)
+		defer node.Close()
+		host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+		number, _ := strconv.ParseUint(port, 10, 64)
+		nodes = append(nodes, Node{Host: host, Port: number, Active: true})
+	}
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.responseTimeout = 5
+	server.check.URL = "/check"
+	go server.jobListener()
+	server.Nodes.SetAll(nodes)
+	server.job <- responseSignal
+	<-server.response
+
+	trace := http.Header{
+		"Traceparent":  {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		"Tracestate":   {"rojo=00f067aa0ba902b7", "congo=t61rcWkgMzE"},
+		"B3":           {"80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90"},
+		"X-B3-Traceid": {"80f198ee56343ba864fe8b2a57d3eff7"},
+		"X-B3-Spanid":  {"e457b5a2e4d86bd1"},
+		"X-B3-Sampled": {"1"},
+	}
+	request, err := http.NewRequest(methodPOST, "http://example.com/", strings.NewReader("update"))
+	test(t, err == nil, "Expected create a new request, got", err)
+	for name, values := range trace {
+		request.Header[name] = values
+	}
+	response, err := server.RoundTrip(request)
+	test(t, err == nil, "Expected the update is delivered, got", err)
+	response.Body.Close()
+
+	for i := 0; i < 2; i++ {
+		header := <-traces
+		for name, values := range trace {
+			test(t, reflect.DeepEqual(header[name], values), "Expected", name, values, "got", header[name])
+		}
+	}
+}
+
+func TestTraceGenerate(t *testing.T) {
+	request, _ := http.NewRequest("GET", "http://example.com/", nil)
+	tracing := Tracing{}
+	tracing.inject(request)
+	test(t, !hasTraceContext(request.Header), "Expected no trace context without generation")
+
+	tracing.Generate = true
+	tracing.inject(request)
+	parts := strings.Split(request.Header.Get(HeaderTraceParent), "-")
+	test(t, len(parts) == 4 && len(parts[1]) == 32 && len(parts[2]) == 16,
+		"Expected W3C trace context, got", request.Header.Get(HeaderTraceParent))
+
+	// the trace context of the client is kept
+	traceparent := request.Header.Get(HeaderTraceParent)
+	tracing.inject(request)
+	test(t, request.Header.Get(HeaderTraceParent) == traceparent, "Expected the trace context is kept")
+
+	request, _ = http.NewRequest("GET", "http://example.com/", nil)
+	tracing.Format = TraceFormatB3
+	tracing.inject(request)
+	test(t, len(request.Header.Get(HeaderB3TraceID)) == 32 && len(request.Header.Get(HeaderB3SpanID)) == 16 &&
+		request.Header.Get(HeaderB3Sampled) == "1", "Expected B3 trace context, got", request.Header)
+}
@@ -0,0 +1,45 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"sync/atomic"
+)
+
+// nodeTransaction sends the jobs of one caller to the update channel,
+// the jobs of the concurrent transactions could be interleaved in the channel,
+// but each transaction is applied atomically by its id when it is committed
+type nodeTransaction struct {
+	bundle *NodeBundle
+	id     uint64
+}
+
+// begin starts a new transaction of the nodes records
+func (bundle *NodeBundle) begin() *nodeTransaction {
+	return &nodeTransaction{
+		bundle: bundle,
+		id:     atomic.AddUint64(&bundle.transactions, 1),
+	}
+}
+
+// update adds/updates the node record in the transaction
+func (transaction *nodeTransaction) update(node Node) {
+	transaction.bundle.update <- nodeJob{transaction: transaction.id, isUpdate: true, record: node}
+}
+
+// delete deletes the node record specified by host and port in the transaction
+func (transaction *nodeTransaction) delete(host string, port uint64) {
+	transaction.bundle.update <- nodeJob{
+		transaction: transaction.id,
+		isDelete:    true,
+		record:      Node{Host: host, Port: port},
+	}
+}
+
+// commit ends the transaction and signals the job listener to apply it
+func (transaction *nodeTransaction) commit() {
+	transaction.bundle.update <- nodeJob{transaction: transaction.id, done: true}
+	transaction.bundle.job <- nodeJobSignal
+}
@@ -0,0 +1,68 @@
+package spawn
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestNodeTransaction(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.responseTimeout = 1
+
+	// the jobs of two transactions are interleaved in the channel
+	first := server.Nodes.begin()
+	second := server.Nodes.begin()
+	first.update(Node{Host: "localhost", Port: 1})
+	second.update(Node{Host: "localhost", Port: 2})
+	first.update(Node{Host: "localhost", Port: 3})
+	second.update(Node{Host: "localhost", Port: 4})
+	server.Nodes.update <- nodeJob{transaction: second.id, done: true}
+	server.Nodes.update <- nodeJob{transaction: first.id, done: true}
+
+	// the second transaction is applied without the jobs of the first one
+	server.Nodes.updateRecords()
+	_, total := server.Nodes.GetAll()
+	test(t, total == 2, "Expected 2 nodes of the second transaction, got", total)
+	_, ok := server.Nodes.Get("localhost", 1)
+	test(t, !ok, "Expected the node of the first transaction is not applied")
+	_, ok = server.Nodes.Get("localhost", 4)
+	test(t, ok, "Expected the node of the second transaction is applied")
+
+	server.Nodes.updateRecords()
+	_, total = server.Nodes.GetAll()
+	test(t, total == 4, "Expected 4 nodes of both transactions, got", total)
+	test(t, len(server.Nodes.pending) == 0, "Expected no pending jobs, got", len(server.Nodes.pending))
+}
+
+func TestConcurrentSetAll(t *testing.T) {
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.responseTimeout = 1
+	go server.jobListener()
+
+	// every caller sets all nodes with own priority
+	var wg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(priority int) {
+			defer wg.Done()
+			var nodes []Node
+			for port := uint64(1); port <= 10; port++ {
+				nodes = append(nodes, Node{Host: "localhost", Port: port, Priority: priority})
+			}
+			test(t, server.Nodes.SetAll(nodes), "Expected the nodes are set")
+		}(i)
+	}
+	wg.Wait()
+	server.job <- responseSignal
+	<-server.response
+
+	// the nodes are set by one of the callers, they are not mixed
+	nodes, total := server.Nodes.GetAll()
+	test(t, total == 10, "Expected 10 nodes, got", total)
+	for _, node := range nodes {
+		test(t, node.Priority == nodes[0].Priority, "Expected the nodes of one transaction, got priorities",
+			node.Priority, nodes[0].Priority)
+	}
+}
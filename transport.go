@@ -0,0 +1,111 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultDialTimeout is time in milliseconds of waiting for the connection to the node
+const DefaultDialTimeout time.Duration = 30000
+
+// Backend defines the timeouts of the connections to the nodes, the closed port of the node
+// fails immediately, but the dial to the firewalled node hangs until the dial timeout
+type Backend struct {
+
+	// time in milliseconds of waiting for the connection to the node (default: 30000),
+	// the short timeout makes the firewalled node fail over fast
+	DialTimeout time.Duration `json:"dial-timeout"`
+
+	// time in milliseconds of waiting for the response headers of the node
+	// after the request is written (default: no limits)
+	ResponseTimeout time.Duration `json:"response-timeout"`
+
+	// source IP address or name of the interface of the connections to the nodes
+	// (default: chosen by the system)
+	SourceAddress string `json:"source-address"`
+
+	// source IP address or name of the interface of the connections of the health checks,
+	// it separates the management traffic from the data path (default: source-address)
+	CheckSourceAddress string `json:"check-source-address"`
+}
+
+// errNoInterfaceAddress is returned when the source interface has no IP address
+var errNoInterfaceAddress = errors.New("Source interface has no IP address")
+
+// resolveSource returns the local address of the connections to the nodes
+// by the IP address or the name of the interface, nil means the address chosen by the system
+func resolveSource(source string) (*net.TCPAddr, error) {
+	if source == "" {
+		return nil, nil
+	}
+	if ip := net.ParseIP(source); ip != nil {
+		return &net.TCPAddr{IP: ip}, nil
+	}
+	iface, err := net.InterfaceByName(source)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	// IPv4 address of the interface is preferred
+	var found net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return &net.TCPAddr{IP: ipNet.IP}, nil
+		}
+		if found == nil {
+			found = ipNet.IP
+		}
+	}
+	if found == nil {
+		return nil, errNoInterfaceAddress
+	}
+	return &net.TCPAddr{IP: found}, nil
+}
+
+// dialTimeout returns the timeout of the connection to the node which is defined in milliseconds
+func dialTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return time.Millisecond * DefaultDialTimeout
+	}
+	return time.Millisecond * timeout
+}
+
+// newBackendTransport creates the transport of the requests and the health checks of the nodes,
+// the connections are bound to the source address if it is defined, the dial timeout is taken
+// by the function on every dial if it is defined, so it could be changed at runtime
+func newBackendTransport(backend Backend, source *net.TCPAddr, timeout func() time.Duration) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout(backend.DialTimeout),
+		KeepAlive: 30 * time.Second,
+	}
+	if source != nil {
+		dialer.LocalAddr = source
+	}
+	transport.DialContext = dialer.DialContext
+	if timeout != nil {
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			current := *dialer
+			current.Timeout = dialTimeout(timeout())
+			return current.DialContext(ctx, network, address)
+		}
+	}
+	transport.ResponseHeaderTimeout = time.Millisecond * backend.ResponseTimeout
+
+	return transport
+}
@@ -0,0 +1,75 @@
+package spawn
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBackendTransport(t *testing.T) {
+	transport := newBackendTransport(Backend{}, nil, nil)
+	test(t, transport.ResponseHeaderTimeout == 0, "Expected no limits of the response by default")
+
+	// the listener never accepts, the connection fills its backlog, so the next dial hangs
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	test(t, err == nil, "Expected a local listener, got", err)
+	defer listener.Close()
+	raw, err := listener.(*net.TCPListener).SyscallConn()
+	test(t, err == nil, "Expected the raw connection of the listener, got", err)
+	raw.Control(func(fd uintptr) {
+		syscall.Listen(int(fd), 0)
+	})
+	filler, err := net.Dial("tcp", listener.Addr().String())
+	test(t, err == nil, "Expected the connection in the backlog, got", err)
+	if err == nil {
+		defer filler.Close()
+	}
+
+	transport = newBackendTransport(Backend{DialTimeout: 200}, nil, nil)
+	request, err := http.NewRequest(methodGET, "http://"+listener.Addr().String()+"/", nil)
+	test(t, err == nil, "Expected create a new request, got", err)
+	start := time.Now()
+	_, err = transport.RoundTrip(request)
+	test(t, err != nil, "Expected the unreachable node fails")
+	test(t, time.Since(start) < 2*time.Second, "Expected the dial fails fast, got", time.Since(start))
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer node.Close()
+
+	transport = newBackendTransport(Backend{ResponseTimeout: 100}, nil, nil)
+	request, err = http.NewRequest(methodGET, node.URL, nil)
+	test(t, err == nil, "Expected create a new request, got", err)
+	_, err = transport.RoundTrip(request)
+	test(t, err != nil, "Expected the slow response is timed out")
+}
+
+func TestResolveSource(t *testing.T) {
+	source, err := resolveSource("")
+	test(t, err == nil && source == nil, "Expected the source chosen by the system, got", source, err)
+
+	source, err = resolveSource("127.0.0.1")
+	test(t, err == nil && source.IP.Equal(net.ParseIP("127.0.0.1")), "Expected the source IP address, got", source, err)
+
+	_, err = resolveSource("no-such-interface")
+	test(t, err != nil, "Expected the unknown interface fails")
+
+	var remote string
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}))
+	defer node.Close()
+
+	transport := newBackendTransport(Backend{}, source, nil)
+	request, err := http.NewRequest(methodGET, node.URL, nil)
+	test(t, err == nil, "Expected create a new request, got", err)
+	response, err := transport.RoundTrip(request)
+	test(t, err == nil, "Expected the request is delivered, got", err)
+	response.Body.Close()
+	test(t, remote == "127.0.0.1", "Expected the connection from the source address, got", remote)
+}
@@ -0,0 +1,213 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/takama/router"
+)
+
+// Default settings of the updates which are not answered in time in async mode
+const (
+	DefaultAsyncRetryAfter               = 5
+	DefaultAsyncRetention  time.Duration = 3600
+	DefaultAsyncMaxRecords               = 10000
+)
+
+// AsyncUpdates defines the updates which are not answered in time, they are acknowledged
+// by 202 Accepted status with the location of their delivery status instead of 504 status
+type AsyncUpdates struct {
+	Enabled bool `json:"enabled"`
+
+	// time in seconds after which the client should check the status (default: 5)
+	RetryAfter int `json:"retry-after"`
+
+	// time in seconds of keeping of the delivery status (default: 3600)
+	Retention time.Duration `json:"retention"`
+
+	// maximum count of the kept delivery statuses, the oldest ones are dropped (default: 10000)
+	MaxRecords int `json:"max-records"`
+}
+
+// UpdateStatus is the status of the delivery of the update to the nodes,
+// the nodes which did not answer yet have zero status
+type UpdateStatus struct {
+	ID       string       `json:"id"`
+	Created  time.Time    `json:"created"`
+	Complete bool         `json:"complete"`
+	Nodes    []NodeStatus `json:"nodes"`
+}
+
+// updateRecord contains the status of the update and the time of its expiration
+type updateRecord struct {
+	status  UpdateStatus
+	expires time.Time
+}
+
+// updateBundle contains the statuses of the updates which are not answered in time by ID
+type updateBundle struct {
+	mutex   sync.Mutex
+	records map[string]*updateRecord
+}
+
+// withDefaults returns the options where zero values are replaced by default values
+func (options AsyncUpdates) withDefaults() AsyncUpdates {
+	if options.RetryAfter <= 0 {
+		options.RetryAfter = DefaultAsyncRetryAfter
+	}
+	if options.Retention <= 0 {
+		options.Retention = DefaultAsyncRetention
+	}
+	if options.MaxRecords <= 0 {
+		options.MaxRecords = DefaultAsyncMaxRecords
+	}
+	return options
+}
+
+// updateStatus returns the status of the update according to the collected outcomes
+func updateStatus(id string, created time.Time, targets []string, result fanOutResult) UpdateStatus {
+	outcomes := make(map[string]updateOutcome, len(result.outcomes))
+	for _, outcome := range result.outcomes {
+		outcomes[outcome.node] = outcome
+	}
+	status := UpdateStatus{ID: id, Created: created, Complete: result.complete()}
+	for _, node := range targets {
+		nodeStatus := NodeStatus{Node: node, Error: "not delivered yet"}
+		if outcome, ok := outcomes[node]; ok {
+			nodeStatus.Status, nodeStatus.Error = outcome.status, ""
+			if outcome.err != nil {
+				nodeStatus.Error = outcome.err.Error()
+			}
+		}
+		status.Nodes = append(status.Nodes, nodeStatus)
+	}
+	return status
+}
+
+// set keeps the status of the update, removes the expired statuses and the oldest ones
+// if the count of the statuses exceeds the limit
+func (bundle *updateBundle) set(status UpdateStatus, options AsyncUpdates) {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	now := time.Now()
+	bundle.prune(now)
+	expires := status.Created.Add(time.Second * options.Retention)
+	if now.After(expires) {
+		return
+	}
+	if _, ok := bundle.records[status.ID]; !ok {
+		for len(bundle.records) >= options.MaxRecords {
+			bundle.evict()
+		}
+	}
+	bundle.records[status.ID] = &updateRecord{status: status, expires: expires}
+}
+
+// prune removes the expired statuses (must be called under lock)
+func (bundle *updateBundle) prune(now time.Time) {
+	for id, record := range bundle.records {
+		if now.After(record.expires) {
+			delete(bundle.records, id)
+		}
+	}
+}
+
+// evict removes the oldest status (must be called under lock)
+func (bundle *updateBundle) evict() {
+	var oldest *updateRecord
+	for _, record := range bundle.records {
+		if oldest == nil || record.status.Created.Before(oldest.status.Created) {
+			oldest = record
+		}
+	}
+	if oldest != nil {
+		delete(bundle.records, oldest.status.ID)
+	}
+}
+
+// get returns the status of the update specified by ID and removes the expired statuses
+func (bundle *updateBundle) get(id string) (UpdateStatus, bool) {
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	bundle.prune(time.Now())
+	record, ok := bundle.records[id]
+	if !ok {
+		return UpdateStatus{}, false
+	}
+	return record.status, true
+}
+
+// track collects the outcomes of the update which is not answered in time
+// until all nodes answer or the status is expired
+func (bundle *updateBundle) track(status UpdateStatus, targets []string, result fanOutResult,
+	outcomes chan updateOutcome, options AsyncUpdates) {
+	id, created := status.ID, status.Created
+	expired := time.NewTimer(time.Second * options.Retention)
+	defer expired.Stop()
+	for !result.complete() {
+		select {
+		case outcome := <-outcomes:
+			result.add(outcome)
+			bundle.set(updateStatus(id, created, targets, result), options)
+		case <-expired.C:
+			return
+		}
+	}
+}
+
+// asyncResponse returns 202 Accepted response with the location of the status of the update
+// which is not answered in time and starts the tracking of its delivery
+func (server *Server) asyncResponse(request *http.Request, targets []string, result fanOutResult,
+	outcomes chan updateOutcome) (*http.Response, error) {
+	options := server.Options.AsyncUpdates.withDefaults()
+	status := updateStatus(traceID(16), time.Now(), targets, result)
+	server.updates.set(status, options)
+	go server.updates.track(status, targets, result, outcomes, options)
+
+	id := status.ID
+	location := "/updates/" + id
+	response, err := jsonResponse(request, http.StatusAccepted, data{
+		"success":  true,
+		"id":       id,
+		"location": location,
+		"total":    len(targets),
+		"nodes":    targets,
+	})
+	if err != nil {
+		return nil, err
+	}
+	response.Header.Set("Location", location)
+	response.Header.Set("Retry-After", strconv.Itoa(options.RetryAfter))
+
+	return response, nil
+}
+
+// getUpdate - gets the delivery status of the update specified by ID
+func (server *Server) getUpdate(c *router.Control) {
+	c.UseTimer()
+
+	// Try to decode ID
+	id, ok := decodeString(":id", c)
+	if !ok {
+		return
+	}
+	status, ok := server.updates.get(id)
+	if !ok {
+		recordNotFound(c)
+		return
+	}
+
+	c.Code(http.StatusOK).Body(data{
+		"success": true,
+		"total":   1,
+		"results": []UpdateStatus{status},
+	})
+}
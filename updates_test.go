@@ -0,0 +1,87 @@
+package spawn
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsyncUpdates(t *testing.T) {
+	release := make(chan struct{})
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/check" {
+			return
+		}
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer node.Close()
+	host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+	number, _ := strconv.ParseUint(port, 10, 64)
+
+	server, err := NewServer("test")
+	test(t, err == nil, "Expected create a new server, got", err)
+	server.transport = http.DefaultTransport
+	server.responseTimeout = 1
+	server.check.URL = "/check"
+	server.Options.AsyncUpdates.Enabled = true
+	go server.jobListener()
+	server.Nodes.SetAll([]Node{{Host: host, Port: number, Active: true}})
+	server.job <- responseSignal
+	<-server.response
+
+	request, err := http.NewRequest(methodPOST, "http://example.com/", strings.NewReader("update"))
+	test(t, err == nil, "Expected create a new request, got", err)
+	response, err := server.RoundTrip(request)
+	test(t, err == nil, "Expected the update is accepted, got", err)
+	test(t, response.StatusCode == http.StatusAccepted, "Expected status 202, got", response.StatusCode)
+	test(t, response.Header.Get("Retry-After") == strconv.Itoa(DefaultAsyncRetryAfter),
+		"Expected default Retry-After, got", response.Header.Get("Retry-After"))
+	var accepted struct {
+		ID       string `json:"id"`
+		Location string `json:"location"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&accepted)
+	response.Body.Close()
+	test(t, err == nil, "Expected decode the response, got", err)
+	test(t, accepted.Location == "/updates/"+accepted.ID && response.Header.Get("Location") == accepted.Location,
+		"Expected location of the status of the update, got", accepted.Location)
+
+	status, ok := server.updates.get(accepted.ID)
+	test(t, ok && !status.Complete && len(status.Nodes) == 1 && status.Nodes[0].Status == 0,
+		"Expected the update is pending, got", status)
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for !status.Complete && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		status, _ = server.updates.get(accepted.ID)
+	}
+	test(t, status.Complete && status.Nodes[0].Status == http.StatusCreated,
+		"Expected the update is delivered, got", status)
+
+	_, ok = server.updates.get("unknown")
+	test(t, !ok, "Expected the status of unknown update is not found")
+}
+
+func TestUpdateRecords(t *testing.T) {
+	bundle := &updateBundle{records: make(map[string]*updateRecord)}
+	options := AsyncUpdates{MaxRecords: 2}.withDefaults()
+	created := time.Now()
+	for index, id := range []string{"first", "second", "third"} {
+		bundle.set(UpdateStatus{ID: id, Created: created.Add(time.Duration(index) * time.Millisecond)}, options)
+	}
+	_, ok := bundle.get("first")
+	test(t, !ok, "Expected the oldest status is dropped")
+	_, ok = bundle.get("third")
+	test(t, ok && len(bundle.records) == 2, "Expected the limit of the statuses, got", len(bundle.records))
+
+	bundle.records["third"].expires = created.Add(-time.Second)
+	_, ok = bundle.get("second")
+	test(t, ok && len(bundle.records) == 1, "Expected the expired status is removed on read, got", len(bundle.records))
+}
@@ -0,0 +1,136 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// envListeners is the environment variable which contains addresses of the listeners
+// inherited from the previous process, their file descriptors start from 3
+const envListeners = "SPAWN_LISTENERS"
+
+// listenerRecord contains the listener and HTTP server which serves it
+type listenerRecord struct {
+	hostPort      string
+	listener      net.Listener
+	http          *http.Server
+	proxyProtocol bool
+}
+
+// inheritedListeners returns the listeners inherited from the previous process by address
+func inheritedListeners() map[string]net.Listener {
+	listeners := make(map[string]net.Listener)
+	value := os.Getenv(envListeners)
+	if value == "" {
+		return listeners
+	}
+	os.Unsetenv(envListeners)
+	for index, hostPort := range strings.Split(value, ",") {
+		file := os.NewFile(uintptr(3+index), hostPort)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			errlog.Println("Could not inherit listener", hostPort, err)
+			continue
+		}
+		stdlog.Println("Listener", hostPort, "is inherited from previous process")
+		listeners[hostPort] = listener
+	}
+
+	return listeners
+}
+
+// listen creates the listener or takes the inherited one
+func (server *Server) listen(
+	hostPort string, handler http.Handler, inherited map[string]net.Listener,
+) (*listenerRecord, error) {
+	listener, ok := inherited[hostPort]
+	if ok {
+		delete(inherited, hostPort)
+	} else {
+		var err error
+		if listener, err = net.Listen("tcp", hostPort); err != nil {
+			return nil, err
+		}
+	}
+	record := &listenerRecord{
+		hostPort: hostPort,
+		listener: listener,
+		http:     server.httpServer(hostPort, server.accessLog(handler)),
+	}
+	server.listeners = append(server.listeners, record)
+
+	return record, nil
+}
+
+// serve accepts the connections of the listener until it is closed
+func (server *Server) serve(record *listenerRecord) {
+	listener := record.listener
+	if record.proxyProtocol {
+		listener = &proxyListener{
+			Listener: listener,
+			timeout:  record.http.ReadHeaderTimeout,
+		}
+	}
+	if err := record.http.Serve(listener); err != nil && err != http.ErrServerClosed {
+		errlog.Fatal(err)
+	}
+}
+
+// Upgrade starts a new process of the service binary which inherits the listeners,
+// the current process should be shut down after that to drain active connections
+func (server *Server) Upgrade() (*os.Process, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	files := []*os.File{os.Stdin, os.Stdout, os.Stderr}
+	var addresses []string
+	defer func() {
+		for _, file := range files[3:] {
+			file.Close()
+		}
+	}()
+	for _, record := range server.listeners {
+		tcp, ok := record.listener.(*net.TCPListener)
+		if !ok {
+			return nil, errors.New("Listener " + record.hostPort + " could not be passed to new process")
+		}
+		file, err := tcp.File()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		addresses = append(addresses, record.hostPort)
+	}
+	var env []string
+	for _, value := range os.Environ() {
+		if !strings.HasPrefix(value, envListeners+"=") {
+			env = append(env, value)
+		}
+	}
+	env = append(env, envListeners+"="+strings.Join(addresses, ","))
+
+	return os.StartProcess(path, os.Args, &os.ProcAttr{Env: env, Files: files})
+}
+
+// closeListeners stops accepting of the connections and waits for active connections
+func (server *Server) closeListeners(ctx context.Context) error {
+	var result error
+	for _, record := range server.listeners {
+		if err := record.http.Shutdown(ctx); err != nil {
+			result = err
+		}
+	}
+	server.listeners = nil
+
+	return result
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 Openprovider Authors. All rights reserved.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package spawn
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultSmoothing is a smoothing factor of the load reported by the nodes
+const DefaultSmoothing = 0.3
+
+// minWeight is the lowest dynamic weight, so the loaded node still has a chance to be selected
+const minWeight = 0.01
+
+// weightBundle contains the smoothed load reported by the nodes
+type weightBundle struct {
+	mutex   sync.RWMutex
+	records map[string]float64
+}
+
+// update applies the load reported by the node with exponential smoothing
+func (bundle *weightBundle) update(id string, load, smoothing float64) {
+	if load < 0 {
+		load = 0
+	}
+	if load > 1 {
+		load = 1
+	}
+	bundle.mutex.Lock()
+	defer bundle.mutex.Unlock()
+
+	if current, ok := bundle.records[id]; ok {
+		load = current + smoothing*(load-current)
+	}
+	bundle.records[id] = load
+}
+
+// weight returns the dynamic weight of the node, the node without reported load has full weight
+func (bundle *weightBundle) weight(id string) float64 {
+	bundle.mutex.RLock()
+	defer bundle.mutex.RUnlock()
+
+	if load, ok := bundle.records[id]; ok && 1-load > minWeight {
+		return 1 - load
+	} else if ok {
+		return minWeight
+	}
+	return 1
+}
+
+// observeLoad reads the load of the node from the response header, if it is defined
+func (server *Server) observeLoad(id string, response *http.Response) {
+	header := server.Options.Adaptive.Header
+	if header == "" || response == nil {
+		return
+	}
+	value := response.Header.Get(header)
+	if value == "" {
+		return
+	}
+	load, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		errlog.Println("Could not recognize load of the node", id, err)
+		return
+	}
+	smoothing := server.Options.Adaptive.Smoothing
+	if smoothing <= 0 || smoothing > 1 {
+		smoothing = DefaultSmoothing
+	}
+	server.weights.update(id, load, smoothing)
+}
+
+// pickWeighted returns index of the randomly selected weight,
+// the probability of selection is proportional to the weight
+func pickWeighted(random *random, weights []float64) int {
+	var total float64
+	for _, weight := range weights {
+		total += weight
+	}
+	point := random.Float64() * total
+	for index, weight := range weights {
+		if point < weight {
+			return index
+		}
+		point -= weight
+	}
+	return len(weights) - 1
+}
+
+// pickCumulative returns index of the randomly selected cumulative weight except excluded,
+// the probability of selection is proportional to the weight, -1 means nothing to select
+func pickCumulative(random *random, cumulative []int, excluded map[int]bool) int {
+	if len(cumulative) == 0 {
+		return -1
+	}
+	total := cumulative[len(cumulative)-1]
+	if total <= 0 {
+		return -1
+	}
+	if len(excluded) == 0 {
+		return sort.SearchInts(cumulative, random.Intn(total)+1)
+	}
+	for index := range excluded {
+		total -= cumulativeWeight(cumulative, index)
+	}
+	if total <= 0 {
+		return -1
+	}
+	point := random.Intn(total)
+	for index := range cumulative {
+		if excluded[index] {
+			continue
+		}
+		weight := cumulativeWeight(cumulative, index)
+		if point < weight {
+			return index
+		}
+		point -= weight
+	}
+	return -1
+}
+
+// cumulativeWeight returns own weight of the item of cumulative weights
+func cumulativeWeight(cumulative []int, index int) int {
+	if index == 0 {
+		return cumulative[0]
+	}
+	return cumulative[index] - cumulative[index-1]
+}
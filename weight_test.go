@@ -0,0 +1,60 @@
+package spawn
+
+import (
+	"testing"
+)
+
+func TestWeight(t *testing.T) {
+	bundle := &weightBundle{records: make(map[string]float64)}
+
+	// the node without reported load has full weight
+	test(t, bundle.weight("test") == 1, "Expected weight 1, got", bundle.weight("test"))
+
+	// the load is applied with smoothing
+	bundle.update("test", 1, 0.5)
+	test(t, bundle.weight("test") == minWeight, "Expected weight", minWeight, "got", bundle.weight("test"))
+	bundle.update("test", 0, 0.5)
+	test(t, bundle.weight("test") == 0.5, "Expected weight 0.5, got", bundle.weight("test"))
+
+	// the node with zero weight is never selected
+	for i := 0; i < 100; i++ {
+		index := pickWeighted(newRandom(0), []float64{0, 1, 0})
+		test(t, index == 1, "Expected selected index 1, got", index)
+	}
+}
+
+func TestPickCumulative(t *testing.T) {
+	// weights: 1, 2, 1
+	cumulative := []int{1, 3, 4}
+	random := newRandom(0)
+	counts := make([]int, len(cumulative))
+	for i := 0; i < 4000; i++ {
+		counts[pickCumulative(random, cumulative, nil)]++
+	}
+	test(t, counts[1] > counts[0] && counts[1] > counts[2],
+		"Expected the node with the biggest weight is selected more often, got", counts)
+
+	// the excluded nodes are not selected
+	excluded := map[int]bool{1: true}
+	for i := 0; i < 100; i++ {
+		index := pickCumulative(random, cumulative, excluded)
+		test(t, index == 0 || index == 2, "Expected selected index 0 or 2, got", index)
+	}
+	excluded[0], excluded[2] = true, true
+	test(t, pickCumulative(random, cumulative, excluded) == -1, "Expected nothing to select")
+	test(t, pickCumulative(random, nil, nil) == -1, "Expected nothing to select")
+}
+
+func TestRandomSeed(t *testing.T) {
+	cumulative := []int{1, 2, 3, 4}
+	first, second := newRandom(42), newRandom(42)
+	for i := 0; i < 100; i++ {
+		a, b := pickCumulative(first, cumulative, nil), pickCumulative(second, cumulative, nil)
+		test(t, a == b, "Expected the same selection with the same seed, got", a, b)
+	}
+
+	// the source is reset by the seed
+	first.seed(7)
+	second.seed(7)
+	test(t, first.Float64() == second.Float64(), "Expected the same sequence after reset by the seed")
+}